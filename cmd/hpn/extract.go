@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/harpoon/hpn/internal/imagelist"
+	"github.com/harpoon/hpn/internal/logger"
+	"github.com/harpoon/hpn/pkg/types"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// extractFormat is the --output format of the extract command
+var extractFormat string
+
+// Extract command
+var extractCmd = &cobra.Command{
+	Use:   "extract <path>...",
+	Short: "Extract an image list from Kubernetes manifests",
+	Long: `Extract the container images of Pods, Deployments, ReplicaSets, StatefulSets,
+DaemonSets, Jobs and CronJobs, including init and ephemeral containers, from
+Kubernetes YAML or JSON manifests and Helm-rendered templates. Paths may be
+files, directories (searched recursively) or - for stdin. The list is written
+to stdout and can be passed to -f.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return usageError("at least one manifest file or directory is required")
+		}
+		return nil
+	},
+	RunE: runExtract,
+}
+
+func init() {
+	extractCmd.Flags().StringVarP(&extractFormat, "output", "o", outputText, "List format: text | json | yaml")
+	extractCmd.SetUsageTemplate(extractUsageTemplate)
+	rootCmd.AddCommand(extractCmd)
+}
+
+const extractUsageTemplate = `Usage: hpn extract <path>... [options]
+
+Options:
+  -o, --output     List format: text | json | yaml
+  -h, --help       Show help
+
+Examples:
+  hpn extract k8s/ > images.txt
+  hpn extract deploy.yaml cronjob.yaml -o yaml > images.yaml
+  helm template my-release ./chart | hpn extract - | hpn -a pull -f -
+`
+
+func runExtract(cmd *cobra.Command, args []string) error {
+	if err := validateOutputFormat(extractFormat); err != nil {
+		return err
+	}
+
+	// The image list owns stdout, messages go to the console logger on stderr
+	log = newBootstrapLogger()
+
+	images, err := imagelist.ExtractSources(args, os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	// Drop references the image list parser would reject, such as unrendered template values
+	valid := make([]string, 0, len(images))
+	for _, image := range images {
+		if err := imagelist.Validate(&types.ImageEntry{Image: image}); err != nil {
+			log.Warn("Skipping invalid image", logger.F("image", image), logger.Err(err))
+			continue
+		}
+		valid = append(valid, image)
+	}
+
+	if len(valid) == 0 {
+		return fmt.Errorf("no images found in %s", strings.Join(args, ", "))
+	}
+
+	log.Info(fmt.Sprintf("Extracted %d images", len(valid)))
+
+	switch extractFormat {
+	case outputJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(map[string][]string{"images": valid})
+	case outputYAML:
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(map[string][]string{"images": valid}); err != nil {
+			return err
+		}
+		return encoder.Close()
+	default:
+		for _, image := range valid {
+			fmt.Println(image)
+		}
+		return nil
+	}
+}
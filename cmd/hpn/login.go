@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/harpoon/hpn/internal/auth"
+	containerruntime "github.com/harpoon/hpn/internal/runtime"
+	"github.com/spf13/cobra"
+)
+
+// Flags of the login command
+var (
+	loginUsername      string
+	loginPassword      string
+	loginPasswordStdin bool
+)
+
+// Login command
+var loginCmd = &cobra.Command{
+	Use:   "login [registry]",
+	Short: "Log in to a registry",
+	Long: `Verify credentials for a registry and store them for later runs. The
+credentials are used by every runtime; registries configured in the
+registries section of the configuration take precedence. The registry
+defaults to docker.io.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			return usageError("login accepts at most one registry")
+		}
+		return nil
+	},
+	RunE: runLogin,
+}
+
+// Logout command
+var logoutCmd = &cobra.Command{
+	Use:   "logout [registry]",
+	Short: "Log out from a registry",
+	Long:  `Remove the credentials stored by hpn login for a registry, docker.io by default.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			return usageError("logout accepts at most one registry")
+		}
+		return nil
+	},
+	RunE: runLogout,
+}
+
+func init() {
+	loginCmd.Flags().StringVarP(&loginUsername, "username", "u", "", "Username")
+	loginCmd.Flags().StringVarP(&loginPassword, "password", "p", "", "Password or token")
+	loginCmd.Flags().BoolVar(&loginPasswordStdin, "password-stdin", false, "Read the password or token from stdin")
+	loginCmd.Flags().StringVarP(&configFile, "config", "c", "", "Config file (default is $HOME/.hpn/config.yaml)")
+	loginCmd.SetUsageTemplate(loginUsageTemplate)
+	logoutCmd.SetUsageTemplate(logoutUsageTemplate)
+	rootCmd.AddCommand(loginCmd, logoutCmd)
+}
+
+const loginUsageTemplate = `Usage: hpn login [registry] [options]
+
+Options:
+  -u, --username        Username
+  -p, --password        Password or token (insecure, prefer --password-stdin)
+      --password-stdin  Read the password or token from stdin
+  -c, --config          Config file path
+  -h, --help            Show help
+
+Credentials are stored in $HOME/.hpn/auth.json ($HPN_AUTH_FILE).
+
+Examples:
+  hpn login harbor.example.com -u admin
+  echo "$CI_JOB_TOKEN" | hpn login registry.gitlab.com -u gitlab-ci-token --password-stdin
+`
+
+const logoutUsageTemplate = `Usage: hpn logout [registry]
+
+Examples:
+  hpn logout harbor.example.com
+`
+
+func runLogin(cmd *cobra.Command, args []string) error {
+	if loginPassword != "" && loginPasswordStdin {
+		return usageError("--password and --password-stdin cannot be used together")
+	}
+	if loginPasswordStdin && loginUsername == "" {
+		return usageError("--password-stdin requires --username")
+	}
+
+	log = newBootstrapLogger()
+	configMgr.SetLogger(log)
+
+	var err error
+	cfg, err = configMgr.Load(configFile)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	host := registryArg(args)
+	cred, err := readLoginCredential(os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	native := containerruntime.NewNativeRuntime(cfg.Runtime.StoreDir)
+	native.SetLogger(log)
+	native.SetTLS(newTLSConfig())
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Runtime.OperationTimeout("login"))
+	defer cancel()
+
+	if err := native.CheckLogin(ctx, host, cred.Username, cred.Password, cfg.Proxy.ToRuntimeProxyConfig()); err != nil {
+		return err
+	}
+
+	path := auth.DefaultFile()
+	credentials, err := auth.LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	credentials.Set(host, cred)
+	if err := credentials.Save(path); err != nil {
+		return err
+	}
+
+	fmt.Printf("Login succeeded for %s (credentials stored in %s)\n", host, path)
+	return nil
+}
+
+func runLogout(cmd *cobra.Command, args []string) error {
+	host := registryArg(args)
+
+	path := auth.DefaultFile()
+	credentials, err := auth.LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	if !credentials.Remove(host) {
+		fmt.Printf("Not logged in to %s\n", host)
+		return nil
+	}
+	if err := credentials.Save(path); err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed credentials for %s\n", host)
+	return nil
+}
+
+// newCredentialResolver returns the resolver of the credentials configured
+// in the registries section and stored by hpn login
+func newCredentialResolver() *auth.Resolver {
+	registries := make([]auth.Registry, 0, len(cfg.Registries))
+	for i := range cfg.Registries {
+		registries = append(registries, cfg.Registries[i].ToAuthRegistry())
+	}
+
+	resolver := auth.NewResolver(auth.Options{Registries: registries, File: auth.DefaultFile()})
+	resolver.SetLogger(log)
+	return resolver
+}
+
+// newTLSConfig returns the TLS settings configured in the registries section
+func newTLSConfig() *containerruntime.TLSConfig {
+	config := &containerruntime.TLSConfig{}
+	for i := range cfg.Registries {
+		if cfg.Registries[i].HasTLS() {
+			config.Registries = append(config.Registries, cfg.Registries[i].ToRuntimeRegistryTLS())
+		}
+	}
+	return config
+}
+
+// registryArg returns the registry host named by the arguments of login and
+// logout, docker.io by default
+func registryArg(args []string) string {
+	if len(args) == 0 {
+		return auth.NormalizeHost("")
+	}
+	return auth.NormalizeHost(args[0])
+}
+
+// readLoginCredential returns the credentials given by the login flags,
+// prompting for missing values on stdin
+func readLoginCredential(stdin io.Reader) (auth.Credential, error) {
+	cred := auth.Credential{Username: loginUsername, Password: loginPassword}
+	reader := bufio.NewReader(stdin)
+
+	if loginPasswordStdin {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return cred, fmt.Errorf("failed to read password from stdin: %w", err)
+		}
+		cred.Password = strings.TrimRight(string(data), "\r\n")
+	} else if loginPassword != "" {
+		fmt.Fprintln(os.Stderr, "Warning: using --password on the command line is insecure, use --password-stdin")
+	}
+
+	if cred.Username == "" {
+		fmt.Fprint(os.Stderr, "Username: ")
+		line, _ := reader.ReadString('\n')
+		cred.Username = strings.TrimSpace(line)
+	}
+	if cred.Password == "" && !loginPasswordStdin {
+		fmt.Fprint(os.Stderr, "Password: ")
+		line, _ := reader.ReadString('\n')
+		cred.Password = strings.TrimRight(line, "\r\n")
+	}
+
+	if cred.Username == "" || cred.Password == "" {
+		return cred, usageError("username and password are required")
+	}
+	return cred, nil
+}
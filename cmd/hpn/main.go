@@ -3,11 +3,14 @@ package main
 import (
 	"fmt"
 	"os"
+
+	"github.com/harpoon/hpn/pkg/errors"
 )
 
 func main() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		reportError(os.Stdout, err)
+		os.Exit(errors.ExitCode(err))
 	}
 }
\ No newline at end of file
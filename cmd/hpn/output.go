@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/harpoon/hpn/internal/imagelist"
+	"github.com/harpoon/hpn/internal/service"
+	"github.com/harpoon/hpn/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats supported by --output
+const (
+	outputText = "text"
+	outputJSON = "json"
+	outputYAML = "yaml"
+)
+
+// Overall status of a result document
+const (
+	statusSuccess = "success"
+	statusPartial = "partial"
+	statusFailed  = "failed"
+	statusError   = "error" // the action failed before any item was processed
+)
+
+// resultWritten records whether the result document of the action was written
+var resultWritten bool
+
+// resultDocument is the machine-readable result of an action
+type resultDocument struct {
+	Action          string                `json:"action" yaml:"action"`
+	Status          string                `json:"status" yaml:"status"`
+	Summary         string                `json:"summary" yaml:"summary"`
+	Total           int                   `json:"total" yaml:"total"`
+	Succeeded       int                   `json:"succeeded" yaml:"succeeded"`
+	Failed          int                   `json:"failed" yaml:"failed"`
+	Skipped         int                   `json:"skipped" yaml:"skipped"`
+	DurationSeconds float64               `json:"duration_seconds" yaml:"duration_seconds"`
+	ExitCode        int                   `json:"exit_code" yaml:"exit_code"`
+	Items           []itemDocument        `json:"items" yaml:"items"`
+	Duplicates      []imagelist.Duplicate `json:"duplicates,omitempty" yaml:"duplicates,omitempty"`
+}
+
+// errorDocument is the machine-readable result of an action that failed
+// before it produced a result, such as on invalid flags or an unreadable list
+type errorDocument struct {
+	Action    string `json:"action,omitempty" yaml:"action,omitempty"`
+	Status    string `json:"status" yaml:"status"`
+	Error     string `json:"error" yaml:"error"`
+	ErrorCode string `json:"error_code,omitempty" yaml:"error_code,omitempty"`
+	ExitCode  int    `json:"exit_code" yaml:"exit_code"`
+}
+
+// itemDocument is the machine-readable result of a single image or file
+type itemDocument struct {
+	Item            string   `json:"item" yaml:"item"`
+	Status          string   `json:"status" yaml:"status"`
+	Source          string   `json:"source,omitempty" yaml:"source,omitempty"`
+	Target          string   `json:"target,omitempty" yaml:"target,omitempty"`
+	Digest          string   `json:"digest,omitempty" yaml:"digest,omitempty"`
+	Targets         []string `json:"targets,omitempty" yaml:"targets,omitempty"`
+	Reason          string   `json:"reason,omitempty" yaml:"reason,omitempty"`
+	DurationSeconds float64  `json:"duration_seconds" yaml:"duration_seconds"`
+	Error           string   `json:"error,omitempty" yaml:"error,omitempty"`
+	ErrorCode       string   `json:"error_code,omitempty" yaml:"error_code,omitempty"`
+}
+
+// validateOutputFormat checks the value of --output
+func validateOutputFormat(format string) error {
+	switch format {
+	case outputText, outputJSON, outputYAML:
+		return nil
+	}
+	return usageError("invalid output '%s'. Valid values: text, json, yaml", format)
+}
+
+// progressOutput returns the writer for progress messages. Structured output
+// owns stdout, so progress is written to stderr instead.
+func progressOutput() io.Writer {
+	if outputFormat == outputText {
+		return os.Stdout
+	}
+	return os.Stderr
+}
+
+// newResultDocument builds the result document of an action. batchErr is the
+// error returned for failed items, if any.
+func newResultDocument(result *service.OperationResult, batchErr error) *resultDocument {
+	doc := &resultDocument{
+		Action:          result.Action,
+		Status:          statusSuccess,
+		Summary:         result.Summary,
+		Total:           len(result.Items),
+		Succeeded:       len(result.Success),
+		Failed:          len(result.Failed),
+		Skipped:         len(result.Skipped),
+		DurationSeconds: seconds(result.Duration),
+		ExitCode:        errors.ExitCode(batchErr),
+		Items:           make([]itemDocument, 0, len(result.Items)),
+	}
+
+	switch {
+	case doc.Failed > 0 && doc.Succeeded > 0:
+		doc.Status = statusPartial
+	case doc.Failed > 0:
+		doc.Status = statusFailed
+	}
+
+	for _, item := range result.Items {
+		itemDoc := itemDocument{
+			Item:            item.Item,
+			Status:          string(item.Status),
+			Source:          item.Source,
+			Target:          item.Target,
+			Digest:          item.Digest,
+			Targets:         item.Targets,
+			Reason:          item.Reason,
+			DurationSeconds: seconds(item.Duration),
+			Error:           item.Error,
+		}
+		if item.Code != 0 {
+			itemDoc.ErrorCode = item.Code.String()
+		}
+		doc.Items = append(doc.Items, itemDoc)
+	}
+
+	return doc
+}
+
+// newErrorDocument builds the error document of an action that failed with err
+func newErrorDocument(action string, err error) *errorDocument {
+	doc := &errorDocument{
+		Action:   action,
+		Status:   statusError,
+		Error:    err.Error(),
+		ExitCode: errors.ExitCode(err),
+	}
+	if code := errors.GetCode(err); code != 0 {
+		doc.ErrorCode = code.String()
+	}
+	return doc
+}
+
+// reportError writes the error document of err to w when structured output
+// was requested and the action failed before writing its result document
+func reportError(w io.Writer, err error) {
+	if resultWritten || (outputFormat != outputJSON && outputFormat != outputYAML) {
+		return
+	}
+	if werr := writeResultDocument(w, outputFormat, newErrorDocument(action, err)); werr != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to write %s output: %v\n", outputFormat, werr)
+	}
+}
+
+// writeResultDocument writes a result or error document to w in the given format
+func writeResultDocument(w io.Writer, format string, doc interface{}) error {
+	switch format {
+	case outputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(doc)
+	case outputYAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(doc); err != nil {
+			return err
+		}
+		return encoder.Close()
+	default:
+		return fmt.Errorf("unsupported output format: %s", format)
+	}
+}
+
+// seconds converts d to seconds rounded to milliseconds
+func seconds(d time.Duration) float64 {
+	return math.Round(d.Seconds()*1000) / 1000
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/harpoon/hpn/internal/imagelist"
+	"github.com/harpoon/hpn/internal/service"
+	"github.com/harpoon/hpn/pkg/errors"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// pushResult returns a push with succeeded, skipped and failed items
+func pushResult() *service.OperationResult {
+	return &service.OperationResult{
+		Action:  "push",
+		Success: []string{"nginx:1.25", "redis:7"},
+		Failed:  []service.FailedOperation{{Item: "ghcr.io/org/app:v1", Error: "unauthorized", Code: errors.ErrRegistryAuth}},
+		Skipped: []string{"busybox:1.36"},
+		Items: []service.ItemResult{
+			{
+				Item:     "nginx:1.25",
+				Status:   service.ItemSucceeded,
+				Target:   "harbor.local/library/nginx:1.25",
+				Digest:   "sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b",
+				Targets:  []string{"harbor.local/library/nginx:stable"},
+				Duration: 2345678 * time.Microsecond,
+			},
+			{
+				Item:     "redis:7",
+				Status:   service.ItemSucceeded,
+				Source:   "mirror.local/library/redis:7",
+				Target:   "harbor.local/library/redis:7",
+				Duration: 800 * time.Millisecond,
+			},
+			{
+				Item:   "busybox:1.36",
+				Status: service.ItemSkipped,
+				Target: "harbor.local/library/busybox:1.36",
+				Reason: "up to date",
+			},
+			{
+				Item:     "ghcr.io/org/app:v1",
+				Status:   service.ItemFailed,
+				Duration: 150 * time.Millisecond,
+				Error:    "unauthorized",
+				Code:     errors.ErrRegistryAuth,
+			},
+		},
+		Duration: 3456 * time.Millisecond,
+		Summary:  "2 successful, 1 failed, 1 skipped",
+	}
+}
+
+func TestResultDocumentGolden(t *testing.T) {
+	result := pushResult()
+	doc := newResultDocument(result, batchError("push", "images", result))
+	doc.Duplicates = []imagelist.Duplicate{
+		{Image: "docker.io/library/nginx:1.25", Source: "extra.txt:3", DuplicateOf: "images.txt:1"},
+	}
+
+	checkGolden(t, "result", doc)
+}
+
+// checkGolden compares doc in every structured format with its golden files
+func checkGolden(t *testing.T, name string, doc interface{}) {
+	t.Helper()
+	for _, format := range []string{outputJSON, outputYAML} {
+		var out bytes.Buffer
+		if err := writeResultDocument(&out, format, doc); err != nil {
+			t.Fatalf("writing %s: %v", format, err)
+		}
+
+		golden := filepath.Join("testdata", name+"."+format)
+		if *update {
+			if err := os.WriteFile(golden, out.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out.Bytes(), want) {
+			t.Errorf("%s %s document differs from %s (run go test -update if the change is intended):\n%s", format, name, golden, out.String())
+		}
+	}
+}
+
+func TestErrorDocumentGolden(t *testing.T) {
+	err := usageError("missing required -f <image_list> parameter for action '%s'", "push")
+	checkGolden(t, "error", newErrorDocument("push", err))
+}
+
+func TestReportError(t *testing.T) {
+	savedAction, savedFormat, savedWritten := action, outputFormat, resultWritten
+	t.Cleanup(func() { action, outputFormat, resultWritten = savedAction, savedFormat, savedWritten })
+
+	listErr := errors.Wrap(os.ErrNotExist, errors.ErrFileNotFound, "failed to read image list")
+	tests := []struct {
+		format  string
+		written bool
+		err     error
+		want    string
+	}{
+		{outputJSON, false, listErr, `{
+  "action": "pull",
+  "status": "error",
+  "error": "failed to read image list: file does not exist",
+  "error_code": "FILE_NOT_FOUND",
+  "exit_code": 1
+}
+`},
+		{outputYAML, false, errors.New(errors.ErrRuntimeNotFound, "no container runtime found"), `action: pull
+status: error
+error: no container runtime found
+error_code: RUNTIME_NOT_FOUND
+exit_code: 4
+`},
+		{outputJSON, false, fmt.Errorf("failed to load configuration"), `{
+  "action": "pull",
+  "status": "error",
+  "error": "failed to load configuration",
+  "exit_code": 1
+}
+`},
+		// The result document already reports the failed items
+		{outputJSON, true, listErr, ""},
+		{outputText, false, listErr, ""},
+	}
+	for _, tt := range tests {
+		action, outputFormat, resultWritten = "pull", tt.format, tt.written
+		var out bytes.Buffer
+		reportError(&out, tt.err)
+		if out.String() != tt.want {
+			t.Errorf("%s output of %v (result written %v) =\n%s\nwant\n%s", tt.format, tt.err, tt.written, out.String(), tt.want)
+		}
+	}
+}
+
+func TestResultDocumentStatus(t *testing.T) {
+	tests := []struct {
+		success, failed int
+		status          string
+		exitCode        int
+	}{
+		{2, 0, statusSuccess, errors.ExitSuccess},
+		{0, 0, statusSuccess, errors.ExitSuccess},
+		{1, 1, statusPartial, errors.ExitPartialFailure},
+		{0, 2, statusFailed, errors.ExitAuth},
+	}
+	for _, tt := range tests {
+		result := &service.OperationResult{Action: "pull"}
+		for i := 0; i < tt.success; i++ {
+			result.Success = append(result.Success, "nginx")
+		}
+		for i := 0; i < tt.failed; i++ {
+			result.Failed = append(result.Failed, service.FailedOperation{Item: "app", Code: errors.ErrRegistryAuth})
+		}
+
+		doc := newResultDocument(result, batchError("pull", "images", result))
+		if doc.Status != tt.status || doc.ExitCode != tt.exitCode {
+			t.Errorf("%d succeeded, %d failed: status %s, exit code %d, want %s, %d", tt.success, tt.failed, doc.Status, doc.ExitCode, tt.status, tt.exitCode)
+		}
+	}
+}
@@ -1,18 +1,21 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/harpoon/hpn/internal/config"
+	"github.com/harpoon/hpn/internal/imagelist"
+	"github.com/harpoon/hpn/internal/logger"
 	containerruntime "github.com/harpoon/hpn/internal/runtime"
+	"github.com/harpoon/hpn/internal/service"
 	"github.com/harpoon/hpn/internal/version"
+	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/reference"
 	"github.com/harpoon/hpn/pkg/types"
 )
 
@@ -27,15 +30,28 @@ var (
 // Command line flags matching images.sh
 var (
 	action       string
-	imageFile    string
+	imageFiles   []string
 	registry     string
 	project      string
 	pushMode     int
+	pushTemplate string
 	loadMode     int
 	saveMode     int
 	configFile   string
 	runtimeName  string
 	autoFallback bool
+	parallel     int
+	timeout      time.Duration
+	opTimeouts   map[string]string
+	logLevel     string
+	outputFormat string
+	setVariables []string
+	platformList string
+	platforms    []string
+	force        bool
+	extraTags    []string
+	tagRuleList  []string
+	tagRules     []service.TagRule
 )
 
 // Global configuration
@@ -43,12 +59,13 @@ var (
 	cfg             *types.Config
 	configMgr       *config.Manager
 	runtimeDetector *containerruntime.Detector
+	log             = logger.Nop()
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "hpn",
-	Short: "Manage container images (pull/save/load/push) with flexible modes",
-	Long:  `Manage container images (pull/save/load/push) with flexible modes`,
+	Short: "Manage container images (pull/save/load/push/copy) with flexible modes",
+	Long:  `Manage container images (pull/save/load/push/copy) with flexible modes`,
 	Version:       version.GetFullVersion(),
 	RunE:          runCommand,
 	SilenceUsage:  true, // Don't show usage on errors
@@ -73,22 +90,41 @@ func init() {
 	runtimeDetector = containerruntime.NewDetector()
 	
 	// Required flags matching images.sh interface
-	rootCmd.Flags().StringVarP(&action, "action", "a", "", "Action (required): pull | save | load | push")
-	rootCmd.Flags().StringVarP(&imageFile, "file", "f", "", "Image list file (required for pull/save/push)")
+	rootCmd.Flags().StringVarP(&action, "action", "a", "", "Action (required): pull | save | load | push | copy")
+	rootCmd.Flags().StringArrayVarP(&imageFiles, "file", "f", nil, "Image list file, directory or - for stdin; repeatable (required for pull/save/push/copy)")
+	rootCmd.Flags().StringArrayVar(&setVariables, "set", nil, "Image list variable NAME=value; repeatable (overrides variables and HPN_VAR_*)")
 	rootCmd.Flags().StringVarP(&registry, "registry", "r", "", "Target registry")
 	rootCmd.Flags().StringVarP(&project, "project", "p", "", "Target project namespace")
+	rootCmd.Flags().StringVar(&platformList, "platform", "", "Platforms to pull, save and push, e.g. linux/amd64,linux/arm64")
 	
 	// Mode flags
 	rootCmd.Flags().IntVar(&pushMode, "push-mode", 0, "Push mode (1|2|3)")
+	rootCmd.Flags().StringVar(&pushTemplate, "push-template", "", "Push target template, e.g. {{.Registry}}/{{.Project}}/{{.Path}}:{{.Tag}} (replaces --push-mode)")
 	rootCmd.Flags().IntVar(&loadMode, "load-mode", 0, "Load mode (1|2|3)")
 	rootCmd.Flags().IntVar(&saveMode, "save-mode", 0, "Save mode (1|2|3)")
+	rootCmd.Flags().BoolVar(&force, "force", false, "Push or copy images even if the target already holds them")
+	rootCmd.Flags().StringArrayVar(&extraTags, "tag", nil, "Additional tag pushed with every image; repeatable")
+	rootCmd.Flags().StringArrayVar(&tagRuleList, "tag-rule", nil, "Tag rule MATCH=REPLACEMENT, e.g. latest={{.Date}}; repeatable")
 	
 	// Configuration flag
 	rootCmd.Flags().StringVarP(&configFile, "config", "c", "", "Config file (default is $HOME/.hpn/config.yaml)")
 	
 	// Runtime flags
-	rootCmd.Flags().StringVar(&runtimeName, "runtime", "", "Container runtime to use (docker|podman|nerdctl)")
+	rootCmd.Flags().StringVar(&runtimeName, "runtime", "", "Container runtime to use (docker|podman|nerdctl|native)")
 	rootCmd.Flags().BoolVar(&autoFallback, "auto-fallback", false, "Automatically fallback to available runtime")
+
+	// Timeout flags
+	rootCmd.Flags().DurationVar(&timeout, "timeout", 0, "Timeout for each runtime operation without its own timeout (overrides runtime.timeout)")
+	rootCmd.Flags().StringToStringVar(&opTimeouts, "op-timeout", nil, "Per-operation timeouts, e.g. pull=10m,save=20m (pull|push|save|load|tag)")
+
+	// Output flag
+	rootCmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, "Output format: text | json | yaml")
+
+	// Logging flag
+	rootCmd.Flags().StringVar(&logLevel, "log-level", "", "Log level: debug | info | warn | error (overrides logging.level)")
+
+	// Parallel processing flag
+	rootCmd.Flags().IntVar(&parallel, "parallel", 0, "Number of parallel workers (overrides parallel.max_workers)")
 	
 	// Version flags (in addition to --version)
 	rootCmd.Flags().BoolP("version", "v", false, "Show version information")
@@ -99,6 +135,11 @@ func init() {
 	
 	// Custom usage template matching images.sh
 	rootCmd.SetUsageTemplate(usageTemplate)
+
+	// Report flag parsing errors as usage errors
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return errors.Wrap(err, errors.ErrInvalidArgument, "invalid arguments")
+	})
 }
 
 const usageTemplate = `Usage: {{.UseLine}} -a <action> -f <file> [options]
@@ -108,20 +149,34 @@ Actions:
   save    Save images to tar files  
   load    Load images from tar files
   push    Push images to registry
+  copy    Copy images from their registry to the target registry without local storage
 
 Options:
-  -a, --action     Action: pull | save | load | push
-  -f, --file       Image list file
+  -a, --action     Action: pull | save | load | push | copy
+  -f, --file       Image list file, directory or - for stdin (repeatable)
+      --set        Image list variable NAME=value (repeatable)
   -r, --registry   Target registry
   -p, --project    Target project namespace
+      --platform   Platforms: linux/amd64,linux/arm64 (per-platform tars, manifest list on push)
+      --force      Push or copy images even if the target is up to date
+      --tag        Additional tag pushed with every image (repeatable)
+      --tag-rule   Tag rule MATCH=REPLACEMENT, e.g. latest={{.Date}} or '.*=$0-amd64' (repeatable)
   -c, --config     Config file path
-      --runtime    Container runtime: docker | podman | nerdctl
+      --runtime    Container runtime: docker | podman | nerdctl | native
       --auto-fallback  Auto fallback to available runtime
+      --parallel   Number of parallel workers
+  -o, --output     Output format: text | json | yaml
+      --log-level  Log level: debug | info | warn | error
+      --timeout    Timeout for each runtime operation (e.g. 10m)
+      --op-timeout Per-operation timeouts: pull=10m,save=20m (pull|push|save|load|tag)
   -v, --version    Show version
   -h, --help       Show help
 
 Modes:
-  --push-mode      1=registry/image:tag  2=registry/project/image:tag
+  --push-mode      1=registry/image:tag  2=registry/project/image:tag  3=registry/original/path:tag
+  --push-template  Target template, e.g. {{.Registry}}/mirror/{{.Path}}:{{.Tag}}
+                   Fields: Registry Project Domain Path Namespace Name Tag
+                   Functions: replace OLD NEW, lower, trimPrefix, trimSuffix
   --save-mode      1=current dir  2=./images/  3=./images/<project>/
   --load-mode      1=current dir  2=./images/  3=recursive ./images/*/
 
@@ -130,6 +185,21 @@ Examples:
   hpn -a save -f images.txt --save-mode 2
   hpn -a push -f images.txt -r harbor.com -p prod --push-mode 2
   hpn --runtime podman -a pull -f images.txt
+  hpn -a pull -f images.txt --parallel 8
+  hpn -a push -f images.txt -r harbor.com -o json
+  hpn -a copy -f images.txt -r harbor.com -p mirror --push-mode 2
+  hpn -a push -f images.txt -r harbor.com --push-template '{{.Registry}}/mirror/{{.Path}}:{{.Tag}}'
+  hpn -a push -f images.txt -r harbor.com --tag stable --tag-rule 'latest={{.Date}}'
+  hpn -a pull -f images.txt --platform linux/amd64,linux/arm64
+  hpn -a pull -f base.txt -f lists/ -f -
+  hpn -a pull -f images.txt --set K8S_VERSION=v1.30.2 --set ARCH=arm64
+  hpn extract k8s/ | hpn -a pull -f -
+
+Commands:
+  extract          Extract an image list from Kubernetes manifests
+  login            Log in to a registry
+  logout           Log out from a registry
+  version          Show version information
 `
 
 func runCommand(cmd *cobra.Command, args []string) error {
@@ -143,12 +213,34 @@ func runCommand(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 	
+	// Log configuration loading with a console logger until the configured one is available
+	log = newBootstrapLogger()
+	configMgr.SetLogger(log)
+
 	// Load configuration
 	var err error
 	cfg, err = configMgr.Load(configFile)
 	if err != nil {
-		return fmt.Errorf("failed to load configuration: %v", err)
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	if cmd.Flags().Changed("log-level") {
+		cfg.Logging.Level = logLevel
+	}
+
+	// Set up the configured logger
+	log, err = newLogger(&cfg.Logging)
+	if err != nil {
+		return errors.Wrap(err, errors.ErrInvalidConfig, "failed to set up logging")
 	}
+	defer logger.Close(log)
+
+	configMgr.SetLogger(log)
+	runtimeDetector.SetLogger(log)
+	runtimeDetector.SetNativeStore(cfg.Runtime.StoreDir)
+	resolver := newCredentialResolver()
+	runtimeDetector.SetCredentials(resolver.Credentials, resolver.StoredCredentials)
+	runtimeDetector.SetTLS(newTLSConfig())
 	
 	// Apply configuration defaults if flags are not set
 	if registry == "" {
@@ -160,6 +252,9 @@ func runCommand(cmd *cobra.Command, args []string) error {
 	if pushMode == 0 {
 		pushMode = int(cfg.Modes.PushMode)
 	}
+	if pushTemplate == "" && !cmd.Flags().Changed("push-mode") {
+		pushTemplate = cfg.Modes.PushTemplate
+	}
 	if loadMode == 0 {
 		loadMode = int(cfg.Modes.LoadMode)
 	}
@@ -169,7 +264,7 @@ func runCommand(cmd *cobra.Command, args []string) error {
 	
 	// Validate action (skip if empty, as it might be a version-only call)
 	if action != "" {
-		validActions := []string{"pull", "save", "load", "push"}
+		validActions := []string{"pull", "save", "load", "push", "copy"}
 		actionValid := false
 		for _, validAction := range validActions {
 			if action == validAction {
@@ -179,81 +274,132 @@ func runCommand(cmd *cobra.Command, args []string) error {
 		}
 		
 		if !actionValid {
-			return fmt.Errorf("invalid action '%s'. Valid actions: %s", action, strings.Join(validActions, ", "))
+			return usageError("invalid action '%s'. Valid actions: %s", action, strings.Join(validActions, ", "))
 		}
 	} else {
 		// If no action provided and no version flags, show error
-		return fmt.Errorf("missing required -a <action> parameter. Use -h for help or -v for version")
+		return usageError("missing required -a <action> parameter. Use -h for help or -v for version")
 	}
 	
+	// Validate output format
+	if err := validateOutputFormat(outputFormat); err != nil {
+		return err
+	}
+
+	// Apply timeout flags on top of the configuration
+	if err := applyTimeoutFlags(cmd); err != nil {
+		return err
+	}
+
+	// Validate platforms
+	if platformList != "" {
+		if action == "load" {
+			return usageError("--platform cannot be used with load action")
+		}
+		if platforms, err = parsePlatforms(platformList); err != nil {
+			return err
+		}
+	}
+
+	// Validate parallel worker count
+	if cmd.Flags().Changed("parallel") && (parallel < 1 || parallel > 100) {
+		return usageError("invalid parallel '%d'. Valid values: 1-100", parallel)
+	}
+
 	// Validate file parameter for actions that require it
-	if action != "load" && imageFile == "" {
-		return fmt.Errorf("missing required -f <image_list> parameter for action '%s'", action)
+	if action != "load" && len(imageFiles) == 0 {
+		return usageError("missing required -f <image_list> parameter for action '%s'", action)
 	}
 	
 	// Validate mode compatibility with action
 	switch action {
-	case "push":
+	case "push", "copy":
 		// Check for incompatible modes
 		if cmd.Flags().Changed("save-mode") {
-			return fmt.Errorf("--save-mode cannot be used with push action")
+			return usageError("--save-mode cannot be used with %s action", action)
 		}
 		if cmd.Flags().Changed("load-mode") {
-			return fmt.Errorf("--load-mode cannot be used with push action")
+			return usageError("--load-mode cannot be used with %s action", action)
 		}
 		// Validate push mode range
-		if pushMode < 1 || pushMode > 2 {
-			return fmt.Errorf("invalid push-mode '%d'. Valid values: 1, 2", pushMode)
+		if pushMode < 1 || pushMode > 3 {
+			return usageError("invalid push-mode '%d'. Valid values: 1, 2, 3", pushMode)
+		}
+		if cmd.Flags().Changed("push-mode") && cmd.Flags().Changed("push-template") {
+			return usageError("--push-mode cannot be used with --push-template")
+		}
+		if _, err := service.ParseTargetTemplate(pushTemplate, service.PushMode(pushMode)); err != nil {
+			return usageError("%v", err)
+		}
+		for _, tag := range extraTags {
+			if !reference.ValidTag(tag) {
+				return usageError("invalid --tag '%s'", tag)
+			}
+		}
+		if tagRules, err = newTagRules(); err != nil {
+			return err
 		}
 	case "save":
 		// Check for incompatible modes
 		if cmd.Flags().Changed("push-mode") {
-			return fmt.Errorf("--push-mode cannot be used with save action")
+			return usageError("--push-mode cannot be used with save action")
 		}
 		if cmd.Flags().Changed("load-mode") {
-			return fmt.Errorf("--load-mode cannot be used with save action")
+			return usageError("--load-mode cannot be used with save action")
 		}
 		// Validate save mode range
 		if saveMode < 1 || saveMode > 3 {
-			return fmt.Errorf("invalid save-mode '%d'. Valid values: 1, 2, 3", saveMode)
+			return usageError("invalid save-mode '%d'. Valid values: 1, 2, 3", saveMode)
 		}
 	case "load":
 		// Check for incompatible modes
 		if cmd.Flags().Changed("push-mode") {
-			return fmt.Errorf("--push-mode cannot be used with load action")
+			return usageError("--push-mode cannot be used with load action")
 		}
 		if cmd.Flags().Changed("save-mode") {
-			return fmt.Errorf("--save-mode cannot be used with load action")
+			return usageError("--save-mode cannot be used with load action")
 		}
 		// Validate load mode range
 		if loadMode < 1 || loadMode > 3 {
-			return fmt.Errorf("invalid load-mode '%d'. Valid values: 1, 2, 3", loadMode)
+			return usageError("invalid load-mode '%d'. Valid values: 1, 2, 3", loadMode)
 		}
 	case "pull":
 		// Pull doesn't use any modes, check for incompatible modes
 		if cmd.Flags().Changed("push-mode") {
-			return fmt.Errorf("--push-mode cannot be used with pull action")
+			return usageError("--push-mode cannot be used with pull action")
 		}
 		if cmd.Flags().Changed("save-mode") {
-			return fmt.Errorf("--save-mode cannot be used with pull action")
+			return usageError("--save-mode cannot be used with pull action")
 		}
 		if cmd.Flags().Changed("load-mode") {
-			return fmt.Errorf("--load-mode cannot be used with pull action")
+			return usageError("--load-mode cannot be used with pull action")
 		}
 	}
+	if cmd.Flags().Changed("force") && action != "push" && action != "copy" {
+		return usageError("--force cannot be used with %s action", action)
+	}
+	if cmd.Flags().Changed("push-template") && action != "push" && action != "copy" {
+		return usageError("--push-template cannot be used with %s action", action)
+	}
+	if (cmd.Flags().Changed("tag") || cmd.Flags().Changed("tag-rule")) && action != "push" && action != "copy" {
+		return usageError("--tag and --tag-rule cannot be used with %s action", action)
+	}
 	
 	// Smart push mode adjustment: if user specifies project but uses default push mode 1,
 	// automatically switch to push mode 2 to include the project
-	if action == "push" && pushMode == 1 && project != "" {
+	if (action == "push" || action == "copy") && pushMode == 1 && pushTemplate == "" && project != "" {
 		// Check if project was explicitly specified by user (not just from config default)
 		projectExplicitlySet := cmd.Flags().Changed("project") || 
 			(cfg != nil && cfg.Project != project) // project differs from config default
 		
 		if projectExplicitlySet {
 			pushMode = 2
-			fmt.Printf("Auto-adjusted to push mode 2 for project '%s'\n", project)
+			log.Info(fmt.Sprintf("Auto-adjusted to push mode 2 for project '%s'", project))
 		}
 	}
+	if (action == "push" || action == "copy") && pushMode == 3 && pushTemplate == "" && cmd.Flags().Changed("project") {
+		log.Warn("Push mode 3 keeps the original path and ignores --project; use --push-template to add a prefix")
+	}
 	
 	// Execute the action
 	switch action {
@@ -265,532 +411,476 @@ func runCommand(cmd *cobra.Command, args []string) error {
 		return executeLoad()
 	case "push":
 		return executePush(cmd)
+	case "copy":
+		return executeCopy(cmd)
 	default:
-		return fmt.Errorf("unknown action: %s", action)
+		return usageError("unknown action: %s", action)
 	}
 }
 
 func executePull() error {
-	fmt.Printf("Executing pull action with file: %s\n", imageFile)
-	
-	// Select container runtime
-	selectedRuntime, err := selectContainerRuntime()
+	log.Info("Executing pull action", logger.F("files", strings.Join(imageFiles, ",")))
+
+	// Read the image list before selecting the runtime, whose fallback
+	// prompt would otherwise consume a list read from stdin
+	list, err := readImageList(imageFiles)
 	if err != nil {
-		return fmt.Errorf("container runtime selection failed: %v", err)
+		return fmt.Errorf("failed to read image list: %w", err)
 	}
-	
-	fmt.Printf("Using container runtime: %s\n", selectedRuntime.Name())
-	
-	// Read image list from file
-	images, err := readImageList(imageFile)
+	images := list.Entries
+
+	svc, err := newImageService()
 	if err != nil {
-		return fmt.Errorf("failed to read image list: %v", err)
-	}
-	
-	fmt.Printf("Found %d images to pull\n", len(images))
-	
-	// Pull each image
-	successCount := 0
-	failedImages := []string{}
-	
-	for i, image := range images {
-		fmt.Printf("[%d/%d] Pulling %s...\n", i+1, len(images), image)
-		
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-		pullOptions := containerruntime.PullOptions{
-			Timeout: 5 * time.Minute,
-		}
-		
-		if err := selectedRuntime.Pull(ctx, image, pullOptions); err != nil {
-			fmt.Printf("❌ Failed to pull %s: %v\n", image, err)
-			failedImages = append(failedImages, image)
-		} else {
-			fmt.Printf("✅ Successfully pulled %s\n", image)
-			successCount++
-		}
-		cancel()
+		return err
 	}
-	
-	// Print summary
-	fmt.Printf("\nSummary: %d successful, %d failed\n", successCount, len(failedImages))
-	
-	if len(failedImages) > 0 {
-		fmt.Printf("\nFailed images:\n")
-		for _, img := range failedImages {
-			fmt.Printf("  - %s\n", img)
-		}
-		return fmt.Errorf("failed to pull %d images", len(failedImages))
+
+	log.Info(fmt.Sprintf("Found %d images to pull", len(images)))
+
+	result, err := svc.Pull(context.Background(), service.PullRequest{
+		Entries:     images,
+		Platforms:   platforms,
+		Parallel:    parallel,
+		ProxyConfig: cfg.Proxy.ToRuntimeProxyConfig(),
+	})
+	if err != nil {
+		return err
 	}
-	
-	return nil
+
+	return reportResult("pull", "images", result, list.Duplicates)
 }
 
 func executeSave() error {
-	fmt.Printf("Executing save action with file: %s, mode: %d\n", imageFile, saveMode)
-	
-	// Select container runtime
-	selectedRuntime, err := selectContainerRuntime()
+	log.Info("Executing save action", logger.F("files", strings.Join(imageFiles, ",")), logger.F("mode", saveMode))
+
+	// Read the image list before selecting the runtime, whose fallback
+	// prompt would otherwise consume a list read from stdin
+	list, err := readImageList(imageFiles)
 	if err != nil {
-		return fmt.Errorf("container runtime selection failed: %v", err)
+		return fmt.Errorf("failed to read image list: %w", err)
 	}
-	
-	fmt.Printf("Using container runtime: %s\n", selectedRuntime.Name())
-	
-	// Read image list from file
-	images, err := readImageList(imageFile)
+	images := list.Entries
+
+	svc, err := newImageService()
 	if err != nil {
-		return fmt.Errorf("failed to read image list: %v", err)
+		return err
 	}
-	
-	fmt.Printf("Found %d images to save\n", len(images))
-	
-	// Determine save directory based on mode
-	var saveDir string
-	switch saveMode {
-	case 1:
-		saveDir = "." // Current directory
-	case 2:
-		saveDir = "./images"
-		if err := os.MkdirAll(saveDir, 0755); err != nil {
-			return fmt.Errorf("failed to create images directory: %v", err)
-		}
-	case 3:
-		// Will create project-specific directories as needed
-		saveDir = "./images"
-		if err := os.MkdirAll(saveDir, 0755); err != nil {
-			return fmt.Errorf("failed to create images directory: %v", err)
-		}
-	}
-	
-	fmt.Printf("Save mode %d: saving to %s\n", saveMode, saveDir)
-	
-	// Save each image
-	successCount := 0
-	failedImages := []string{}
-	
-	for i, image := range images {
-		fmt.Printf("[%d/%d] Saving %s...\n", i+1, len(images), image)
-		
-		if err := saveImage(selectedRuntime, image, saveDir, saveMode); err != nil {
-			fmt.Printf("❌ Failed to save %s: %v\n", image, err)
-			failedImages = append(failedImages, image)
-		} else {
-			fmt.Printf("✅ Successfully saved %s\n", image)
-			successCount++
-		}
-	}
-	
-	// Print summary
-	fmt.Printf("\nSummary: %d successful, %d failed\n", successCount, len(failedImages))
-	
-	if len(failedImages) > 0 {
-		fmt.Printf("\nFailed images:\n")
-		for _, img := range failedImages {
-			fmt.Printf("  - %s\n", img)
-		}
-		return fmt.Errorf("failed to save %d images", len(failedImages))
+
+	log.Info(fmt.Sprintf("Found %d images to save", len(images)))
+	log.Info(fmt.Sprintf("Save mode %d: saving to %s", saveMode, service.SaveDir(service.SaveMode(saveMode))))
+
+	result, err := svc.Save(context.Background(), service.SaveRequest{
+		Entries:   images,
+		Platforms: platforms,
+		Mode:      service.SaveMode(saveMode),
+		Parallel:  parallel,
+	})
+	if err != nil {
+		return err
 	}
-	
-	return nil
+
+	return reportResult("save", "images", result, list.Duplicates)
 }
 
 func executeLoad() error {
-	fmt.Printf("Executing load action with mode: %d\n", loadMode)
-	
-	// Select container runtime
-	selectedRuntime, err := selectContainerRuntime()
+	log.Info("Executing load action", logger.F("mode", loadMode))
+
+	svc, err := newImageService()
 	if err != nil {
-		return fmt.Errorf("container runtime selection failed: %v", err)
+		return err
 	}
-	
-	fmt.Printf("Using container runtime: %s\n", selectedRuntime.Name())
-	
-	// Determine load directory based on mode
-	var loadDir string
-	var tarFiles []string
-	
-	switch loadMode {
-	case 1:
-		// Load from current directory
-		loadDir = "."
-		files, err := findTarFiles(loadDir, false)
-		if err != nil {
-			return fmt.Errorf("failed to find tar files in current directory: %v", err)
-		}
-		tarFiles = files
-	case 2:
-		// Load from ./images/ directory
-		loadDir = "./images"
-		files, err := findTarFiles(loadDir, false)
-		if err != nil {
-			return fmt.Errorf("failed to find tar files in images directory: %v", err)
-		}
-		tarFiles = files
-	case 3:
-		// Recursively load from ./images/*/ subdirectories
-		loadDir = "./images"
-		files, err := findTarFiles(loadDir, true)
-		if err != nil {
-			return fmt.Errorf("failed to find tar files recursively: %v", err)
-		}
-		tarFiles = files
-	}
-	
-	fmt.Printf("Found %d tar files to load\n", len(tarFiles))
-	
-	// Load each tar file
-	successCount := 0
-	failedFiles := []string{}
-	
-	for i, tarFile := range tarFiles {
-		fmt.Printf("[%d/%d] Loading %s...\n", i+1, len(tarFiles), tarFile)
-		
-		if err := loadImage(selectedRuntime, tarFile); err != nil {
-			fmt.Printf("❌ Failed to load %s: %v\n", tarFile, err)
-			failedFiles = append(failedFiles, tarFile)
-		} else {
-			fmt.Printf("✅ Successfully loaded %s\n", tarFile)
-			successCount++
-		}
-	}
-	
-	// Print summary
-	fmt.Printf("\nSummary: %d successful, %d failed\n", successCount, len(failedFiles))
-	
-	if len(failedFiles) > 0 {
-		fmt.Printf("\nFailed files:\n")
-		for _, file := range failedFiles {
-			fmt.Printf("  - %s\n", file)
-		}
-		return fmt.Errorf("failed to load %d files", len(failedFiles))
+
+	result, err := svc.Load(context.Background(), service.LoadRequest{
+		Mode:     service.LoadMode(loadMode),
+		Parallel: parallel,
+	})
+	if err != nil {
+		return err
 	}
-	
-	return nil
+
+	return reportResult("load", "files", result, nil)
 }
 
 func executePush(cmd *cobra.Command) error {
-	fmt.Printf("Executing push action with file: %s, mode: %d, registry: %s, project: %s\n", 
-		imageFile, pushMode, registry, project)
-	
-	// Detect container runtime
-	selectedRuntime, err := selectContainerRuntime()
+	log.Info("Executing push action",
+		logger.F("files", strings.Join(imageFiles, ",")),
+		logger.F("mode", pushMode),
+		logger.F("template", pushTemplate),
+		logger.F("registry", registry),
+		logger.F("project", project))
+
+	// Read the image list before selecting the runtime, whose fallback
+	// prompt would otherwise consume a list read from stdin
+	list, err := readImageList(imageFiles)
 	if err != nil {
-		return fmt.Errorf("container runtime selection failed: %v", err)
+		return fmt.Errorf("failed to read image list: %w", err)
 	}
-	
-	fmt.Printf("Using container runtime: %s\n", selectedRuntime.Name())
-	
-	// Read image list from file
-	images, err := readImageList(imageFile)
+	images := list.Entries
+
+	svc, err := newImageService()
 	if err != nil {
-		return fmt.Errorf("failed to read image list: %v", err)
+		return err
 	}
-	
-	fmt.Printf("Found %d images to push\n", len(images))
-	fmt.Printf("Target registry: %s\n", registry)
-	fmt.Printf("Target project: %s\n", project)
-	fmt.Printf("Push mode: %d\n", pushMode)
-	
-	// Push each image
-	successCount := 0
-	failedImages := []string{}
-	
-	for i, image := range images {
-		fmt.Printf("[%d/%d] Pushing %s...\n", i+1, len(images), image)
-		
-		// Determine project name for this specific image based on push mode
-		var effectiveProject string
-		if pushMode == 2 {
-			// For mode 2, use smart project selection
-			if cmd.Flags().Changed("project") {
-				// User explicitly specified project via command line
-				effectiveProject = project
-			} else if cfg != nil && cfg.Project != "" && cfg.Project != "library" {
-				// Use config file project (if not default "library")
-				effectiveProject = cfg.Project
-			} else {
-				// Use original image project name
-				effectiveProject = extractProjectFromImage(image)
-			}
-		} else {
-			// For mode 1, use the project as-is (though it won't be used)
-			effectiveProject = project
-		}
-		
-		if err := pushImage(selectedRuntime, image, registry, effectiveProject, pushMode); err != nil {
-			fmt.Printf("❌ Failed to push %s: %v\n", image, err)
-			failedImages = append(failedImages, image)
-		} else {
-			fmt.Printf("✅ Successfully pushed %s\n", image)
-			successCount++
-		}
+
+	log.Info(fmt.Sprintf("Found %d images to push", len(images)))
+
+	result, err := svc.Push(context.Background(), service.PushRequest{
+		Entries:     images,
+		Registry:    registry,
+		Project:     targetProject(cmd),
+		Platforms:   platforms,
+		Mode:        service.PushMode(pushMode),
+		Template:    pushTemplate,
+		Tags:        pushTags(),
+		TagRules:    tagRules,
+		Parallel:    parallel,
+		ProxyConfig: cfg.Proxy.ToRuntimeProxyConfig(),
+		Force:       force,
+	})
+	if err != nil {
+		return err
 	}
-	
-	// Print summary
-	fmt.Printf("\nSummary: %d successful, %d failed\n", successCount, len(failedImages))
-	
-	if len(failedImages) > 0 {
-		fmt.Printf("\nFailed images:\n")
-		for _, img := range failedImages {
-			fmt.Printf("  - %s\n", img)
-		}
-		return fmt.Errorf("failed to push %d images", len(failedImages))
+
+	return reportResult("push", "images", result, list.Duplicates)
+}
+
+func executeCopy(cmd *cobra.Command) error {
+	log.Info("Executing copy action",
+		logger.F("files", strings.Join(imageFiles, ",")),
+		logger.F("mode", pushMode),
+		logger.F("template", pushTemplate),
+		logger.F("registry", registry),
+		logger.F("project", project))
+
+	// Read the image list before selecting the runtime, whose fallback
+	// prompt would otherwise consume a list read from stdin
+	list, err := readImageList(imageFiles)
+	if err != nil {
+		return fmt.Errorf("failed to read image list: %w", err)
 	}
-	
-	return nil
+	images := list.Entries
+
+	svc, err := newImageService()
+	if err != nil {
+		return err
+	}
+
+	log.Info(fmt.Sprintf("Found %d images to copy", len(images)))
+
+	result, err := svc.Copy(context.Background(), service.CopyRequest{
+		Entries:     images,
+		Registry:    registry,
+		Project:     targetProject(cmd),
+		Platforms:   platforms,
+		Mode:        service.PushMode(pushMode),
+		Template:    pushTemplate,
+		Tags:        pushTags(),
+		TagRules:    tagRules,
+		Parallel:    parallel,
+		ProxyConfig: cfg.Proxy.ToRuntimeProxyConfig(),
+		Force:       force,
+	})
+	if err != nil {
+		return err
+	}
+
+	return reportResult("copy", "images", result, list.Duplicates)
 }
 
-// selectContainerRuntime selects the appropriate container runtime
-func selectContainerRuntime() (containerruntime.ContainerRuntime, error) {
-	// If runtime is explicitly specified via flag
-	if runtimeName != "" {
-		selectedRuntime, err := runtimeDetector.GetByName(runtimeName)
-		if err != nil {
-			return nil, fmt.Errorf("specified runtime '%s' is not available: %v", runtimeName, err)
-		}
-		return selectedRuntime, nil
+// targetProject returns the project images are pushed to. For push mode 2
+// and push templates an empty project tells the service to keep each
+// image's own project.
+func targetProject(cmd *cobra.Command) string {
+	if (pushMode != 2 && pushTemplate == "") || cmd.Flags().Changed("project") {
+		return project
+	}
+	if cfg != nil && cfg.Project != "" && cfg.Project != "library" {
+		// Use config file project (if not default "library")
+		return cfg.Project
+	}
+	// Use original image project name
+	return ""
+}
+
+// newBootstrapLogger creates the console logger used before the configuration is loaded
+func newBootstrapLogger() logger.Logger {
+	l, _ := logger.New(logger.Options{
+		Level:   logger.ParseLogLevel(os.Getenv("HPN_LOG_LEVEL")),
+		Format:  os.Getenv("HPN_LOG_FORMAT"),
+		Console: true,
+	})
+	return l
+}
+
+// newLogger creates a logger from the logging configuration
+func newLogger(logging *types.LoggingConfig) (logger.Logger, error) {
+	return logger.New(logger.Options{
+		Level:      logger.ParseLogLevel(logging.Level),
+		Format:     logging.Format,
+		File:       logging.File,
+		MaxSize:    int64(logging.MaxSize) * 1024 * 1024,
+		MaxBackups: logging.MaxBackups,
+		Console:    logging.Console,
+		Timestamp:  logging.Timestamp,
+		Colors:     logging.Colors && isTerminal(os.Stderr),
+	})
+}
+
+// isTerminal reports whether f is attached to a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
 	}
-	
-	// Check if runtime is specified in config
-	var configuredRuntime string
-	if cfg != nil && cfg.Runtime.Preferred != "" {
-		configuredRuntime = cfg.Runtime.Preferred
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// applyTimeoutFlags applies --timeout and --op-timeout to the loaded configuration
+func applyTimeoutFlags(cmd *cobra.Command) error {
+	if cmd.Flags().Changed("timeout") {
+		cfg.Runtime.Timeout = timeout
 	}
-	
-	// If configured runtime is specified, try to use it
-	if configuredRuntime != "" {
-		configuredRuntimeObj, err := runtimeDetector.GetByName(configuredRuntime)
-		if err == nil {
-			return configuredRuntimeObj, nil
-		}
-		
-		// Configured runtime is not available, check for alternatives
-		available := runtimeDetector.DetectAvailable()
-		if len(available) == 0 {
-			return nil, fmt.Errorf("no container runtime found. Please install docker, podman, or nerdctl")
+
+	for op, value := range opTimeouts {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return usageError("invalid --op-timeout value '%s=%s': %v", op, value, err)
 		}
-		
-		// Check if auto-fallback is enabled
-		if autoFallback || (cfg != nil && cfg.Runtime.AutoFallback) {
-			fmt.Printf("Runtime '%s' unavailable, using '%s'\n", configuredRuntime, available[0].Name())
-			return available[0], nil
+
+		switch op {
+		case "pull":
+			cfg.Runtime.Timeouts.Pull = d
+		case "push":
+			cfg.Runtime.Timeouts.Push = d
+		case "save":
+			cfg.Runtime.Timeouts.Save = d
+		case "load":
+			cfg.Runtime.Timeouts.Load = d
+		case "tag":
+			cfg.Runtime.Timeouts.Tag = d
+		default:
+			return usageError("invalid --op-timeout operation '%s'. Valid operations: pull, push, save, load, tag", op)
 		}
-		
-		// Ask user for confirmation
-		fmt.Printf("Runtime '%s' is not available\n", configuredRuntime)
-		fmt.Printf("Found available runtime: %s\n", available[0].Name())
-		fmt.Printf("Use '%s' instead of '%s'? (y/N): ", available[0].Name(), configuredRuntime)
-		
-		var response string
-		fmt.Scanln(&response)
-		response = strings.ToLower(strings.TrimSpace(response))
-		
-		if response == "y" || response == "yes" {
-			fmt.Printf("Using '%s' runtime\n", available[0].Name())
-			return available[0], nil
-		} else {
-			return nil, fmt.Errorf("user declined runtime fallback. Please install '%s' or update config", configuredRuntime)
+	}
+
+	return config.ValidateConfig(cfg)
+}
+
+// newImageService creates the image service and selects its container runtime
+func newImageService() (*service.Service, error) {
+	opts := service.Options{
+		Detector: runtimeDetector,
+		Runtime:  runtimeName,
+		Confirm:  confirmRuntimeFallback,
+		Output:   progressOutput(),
+		Logger:   log,
+	}
+	if cfg != nil {
+		opts.Preferred = cfg.Runtime.Preferred
+		opts.AutoFallback = autoFallback || cfg.Runtime.AutoFallback
+		opts.Parallel = cfg.Parallel.MaxWorkers
+		opts.AutoAdjust = cfg.Parallel.AutoAdjust
+		opts.Retry = cfg.Runtime.Retry.ToRuntimeRetryConfig()
+		opts.Timeouts = service.Timeouts{
+			Pull: cfg.Runtime.OperationTimeout("pull"),
+			Push: cfg.Runtime.OperationTimeout("push"),
+			Save: cfg.Runtime.OperationTimeout("save"),
+			Load: cfg.Runtime.OperationTimeout("load"),
+			Tag:  cfg.Runtime.OperationTimeout("tag"),
+		}
+		for _, mirror := range cfg.Mirrors {
+			rule, err := service.NewMirrorRule(mirror.Prefix, mirror.Regex, mirror.Mirrors)
+			if err != nil {
+				return nil, err
+			}
+			opts.Mirrors = append(opts.Mirrors, rule)
 		}
 	}
-	
-	// No specific runtime configured, use the preferred one
-	preferred := runtimeDetector.GetPreferred()
-	if preferred == nil {
-		return nil, fmt.Errorf("no container runtime found. Please install docker, podman, or nerdctl")
+
+	svc := service.NewImageService(opts)
+
+	selectedRuntime, err := svc.Runtime()
+	if err != nil {
+		return nil, fmt.Errorf("container runtime selection failed: %w", err)
 	}
-	
-	return preferred, nil
+
+	log.Info(fmt.Sprintf("Using container runtime: %s", selectedRuntime.Name()))
+	return svc, nil
 }
 
-// readImageList reads image list from file
-func readImageList(filename string) ([]string, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open file %s: %v", filename, err)
+// confirmRuntimeFallback asks the user whether to use an available runtime
+// instead of the configured one
+func confirmRuntimeFallback(configured, fallback string) bool {
+	out := progressOutput()
+	fmt.Fprintf(out, "Runtime '%s' is not available\n", configured)
+	fmt.Fprintf(out, "Found available runtime: %s\n", fallback)
+
+	// Standard input holds the image list, not an answer
+	if stdinList() {
+		fmt.Fprintf(out, "Not asking to use '%s' while reading the image list from stdin; use --auto-fallback\n", fallback)
+		return false
 	}
-	defer file.Close()
-	
-	var images []string
-	scanner := bufio.NewScanner(file)
-	
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		// Skip empty lines and comments
-		if line != "" && !strings.HasPrefix(line, "#") {
-			images = append(images, line)
+	fmt.Fprintf(out, "Use '%s' instead of '%s'? (y/N): ", fallback, configured)
+
+	var response string
+	fmt.Scanln(&response)
+	response = strings.ToLower(strings.TrimSpace(response))
+
+	return response == "y" || response == "yes"
+}
+
+// stdinList reports whether an image list is read from standard input
+func stdinList() bool {
+	for _, source := range imageFiles {
+		if source == imagelist.Stdin {
+			return true
 		}
 	}
-	
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading file: %v", err)
-	}
-	
-	if len(images) == 0 {
-		return nil, fmt.Errorf("no images found in file %s", filename)
-	}
-	
-	return images, nil
+	return false
 }
 
+// reportResult prints the result of an operation in the selected output
+// format and returns an error if any item failed. duplicates are the images
+// dropped from the image lists.
+func reportResult(action, noun string, result *service.OperationResult, duplicates []imagelist.Duplicate) error {
+	batchErr := batchError(action, noun, result)
+
+	if outputFormat != outputText {
+		doc := newResultDocument(result, batchErr)
+		doc.Duplicates = duplicates
+		resultWritten = true
+		if err := writeResultDocument(os.Stdout, outputFormat, doc); err != nil {
+			return fmt.Errorf("failed to write %s output: %w", outputFormat, err)
+		}
+		return batchErr
+	}
 
+	fmt.Printf("\nSummary: %s\n", result.Summary)
 
-// saveImage saves a single image to tar file
-func saveImage(containerRuntime containerruntime.ContainerRuntime, image, baseDir string, mode int) error {
-	// Parse image name to generate tar filename
-	tarFilename := generateTarFilename(image)
-	
-	var tarPath string
-	
-	switch mode {
-	case 1, 2:
-		// Mode 1: current directory, Mode 2: ./images/
-		tarPath = fmt.Sprintf("%s/%s", baseDir, tarFilename)
-	case 3:
-		// Mode 3: ./images/<project>/
-		projectDir := extractProjectFromImage(image)
-		fullDir := fmt.Sprintf("%s/%s", baseDir, projectDir)
-		if err := os.MkdirAll(fullDir, 0755); err != nil {
-			return fmt.Errorf("failed to create project directory %s: %v", fullDir, err)
-		}
-		tarPath = fmt.Sprintf("%s/%s", fullDir, tarFilename)
+	if len(result.Failed) > 0 {
+		fmt.Printf("\nFailed %s:\n", noun)
+		for _, failed := range result.Failed {
+			fmt.Printf("  - %s\n", failed.Item)
+		}
 	}
-	
-	// Execute save command using runtime interface
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
-	defer cancel()
-	
-	if err := containerRuntime.Save(ctx, image, tarPath); err != nil {
-		return fmt.Errorf("failed to save image: %v", err)
+
+	return batchErr
+}
+
+// batchError returns the error reported for the failed items of result, or
+// nil if every item succeeded
+func batchError(action, noun string, result *service.OperationResult) error {
+	if len(result.Failed) == 0 {
+		return nil
 	}
-	
-	// Check if file was created successfully
-	if _, err := os.Stat(tarPath); err != nil {
-		return fmt.Errorf("tar file was not created: %v", err)
+
+	failures := make([]errors.ErrorCode, 0, len(result.Failed))
+	for _, failed := range result.Failed {
+		failures = append(failures, failed.Code)
 	}
-	
-	fmt.Printf("  Saved: %s\n", tarPath)
-	return nil
+	total := len(result.Success) + len(result.Failed)
+	return errors.NewBatchError(fmt.Sprintf("failed to %s %d %s", action, len(result.Failed), noun), total, failures)
 }
 
-// generateTarFilename generates tar filename from image name
-func generateTarFilename(image string) string {
-	// Replace problematic characters for filename
-	filename := strings.ReplaceAll(image, "/", "_")
-	filename = strings.ReplaceAll(filename, ":", "_")
-	
-	// Add .tar extension
-	return filename + ".tar"
+// usageError creates an error for invalid command line arguments
+func usageError(format string, args ...interface{}) error {
+	return errors.New(errors.ErrInvalidArgument, fmt.Sprintf(format, args...))
 }
 
-// extractProjectFromImage extracts project name from image for mode 3
-func extractProjectFromImage(image string) string {
-	parts := strings.Split(image, "/")
-	
-	if len(parts) >= 3 {
-		// For images like registry.k8s.io/coredns/coredns:v1.11.1
-		return parts[len(parts)-2] // Return "coredns"
-	} else if len(parts) == 2 {
-		// For images like calico/node:v3.28.2
-		return parts[0] // Return "calico"
-	} else {
-		// For images like nginx:latest
-		return "library" // Default project name
+// readImageList reads and merges the image lists of all sources and reports
+// duplicate images
+func readImageList(sources []string) (*imagelist.List, error) {
+	variables, err := listVariables()
+	if err != nil {
+		return nil, err
 	}
-}
 
-// findTarFiles finds all .tar files in the specified directory
-func findTarFiles(dir string, recursive bool) ([]string, error) {
-	var tarFiles []string
-	
-	if recursive {
-		// Recursively find tar files in subdirectories
-		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			if !info.IsDir() && strings.HasSuffix(strings.ToLower(info.Name()), ".tar") {
-				tarFiles = append(tarFiles, path)
-			}
-			return nil
-		})
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		// Find tar files only in the specified directory
-		files, err := filepath.Glob(filepath.Join(dir, "*.tar"))
-		if err != nil {
-			return nil, err
-		}
-		tarFiles = files
+	list, err := imagelist.ReadSources(sources, os.Stdin, imagelist.Options{Variables: variables})
+	if err != nil {
+		return nil, err
 	}
-	
-	return tarFiles, nil
-}
 
-// loadImage loads a single tar file using the specified runtime
-func loadImage(containerRuntime containerruntime.ContainerRuntime, tarFile string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
-	defer cancel()
-	
-	if err := containerRuntime.Load(ctx, tarFile); err != nil {
-		return fmt.Errorf("failed to load image: %v", err)
+	if len(list.Entries) == 0 {
+		return nil, fmt.Errorf("no images found in %s", strings.Join(sources, ", "))
 	}
-	
-	return nil
+
+	if len(list.Duplicates) > 0 {
+		out := progressOutput()
+		fmt.Fprintf(out, "Skipped %d duplicate images:\n", len(list.Duplicates))
+		for _, duplicate := range list.Duplicates {
+			fmt.Fprintf(out, "  - %s (%s, duplicate of %s)\n", duplicate.Image, duplicate.Source, duplicate.DuplicateOf)
+		}
+	}
+
+	return list, nil
 }
 
-// pushImage pushes a single image to registry with the specified mode
-func pushImage(containerRuntime containerruntime.ContainerRuntime, image, targetRegistry, targetProject string, mode int) error {
-	var targetImage string
-	
-	// Parse original image name and tag
-	imageName, imageTag := parseImageNameAndTag(image)
-	
-	switch mode {
-	case 1:
-		// Mode 1: registry/image:tag (不包含项目名称)
-		targetImage = fmt.Sprintf("%s/%s:%s", targetRegistry, imageName, imageTag)
-	case 2:
-		// Mode 2: registry/project/image:tag
-		targetImage = fmt.Sprintf("%s/%s/%s:%s", targetRegistry, targetProject, imageName, imageTag)
-		fmt.Printf("  Project: %s\n", targetProject)
+// listVariables returns the image list variables: the configured variables
+// (including HPN_VAR_*) overridden by --set. A single --platform sets the
+// default ARCH and OS.
+func listVariables() (map[string]string, error) {
+	variables := make(map[string]string, len(cfg.Variables)+len(setVariables)+2)
+	if len(platforms) == 1 {
+		parts := strings.Split(platforms[0], "/")
+		variables["OS"], variables["ARCH"] = parts[0], parts[1]
+	}
+	for name, value := range cfg.Variables {
+		variables[strings.ToUpper(name)] = value
 	}
-	
-	fmt.Printf("  Tag: %s -> %s\n", image, targetImage)
-	
-	// Tag the image
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancel()
-	
-	if err := containerRuntime.Tag(ctx, image, targetImage); err != nil {
-		return fmt.Errorf("failed to tag image: %v", err)
+
+	for _, assignment := range setVariables {
+		name, value, ok := strings.Cut(assignment, "=")
+		if !ok || !imagelist.ValidVariable(name) {
+			return nil, usageError("invalid --set '%s', expected NAME=value", assignment)
+		}
+		variables[strings.ToUpper(name)] = value
 	}
-	
-	// Push the image
-	pushOptions := containerruntime.PushOptions{
-		Timeout: 10 * time.Minute,
+
+	return variables, nil
+}
+
+// pushTags returns the additional tags of every image: the configured tags
+// followed by --tag
+func pushTags() []string {
+	return append(append([]string(nil), cfg.Tags...), extraTags...)
+}
+
+// newTagRules returns the configured tag rules followed by those of
+// --tag-rule, which replace the tags matching MATCH
+func newTagRules() ([]service.TagRule, error) {
+	rules, err := service.NewTagRules(cfg.TagRules)
+	if err != nil {
+		return nil, err
 	}
-	
-	if err := containerRuntime.Push(ctx, targetImage, pushOptions); err != nil {
-		return fmt.Errorf("failed to push image: %v", err)
+
+	for _, value := range tagRuleList {
+		match, replace, ok := strings.Cut(value, "=")
+		if !ok || replace == "" {
+			return nil, usageError("invalid --tag-rule '%s', expected MATCH=REPLACEMENT", value)
+		}
+		rule, err := service.NewTagRule(match, replace, nil)
+		if err != nil {
+			return nil, usageError("invalid --tag-rule '%s': %v", value, err)
+		}
+		rules = append(rules, rule)
 	}
-	
-	fmt.Printf("  Pushed: %s\n", targetImage)
-	return nil
+	return rules, nil
 }
 
-// parseImageNameAndTag parses image name and tag from full image string
-func parseImageNameAndTag(image string) (string, string) {
-	parts := strings.Split(image, "/")
-	lastPart := parts[len(parts)-1]
-	
-	if strings.Contains(lastPart, ":") {
-		tagParts := strings.Split(lastPart, ":")
-		return tagParts[0], tagParts[1]
+// parsePlatforms parses the comma-separated --platform list
+func parsePlatforms(list string) ([]string, error) {
+	var parsed []string
+	seen := make(map[string]bool)
+	for _, platform := range strings.Split(list, ",") {
+		platform = strings.TrimSpace(platform)
+		if !imagelist.ValidPlatform(platform) {
+			return nil, usageError("invalid platform '%s'. Expected os/arch[/variant], e.g. linux/arm64", platform)
+		}
+		if !seen[platform] {
+			seen[platform] = true
+			parsed = append(parsed, platform)
+		}
 	}
-	
-	return lastPart, "latest"
+	return parsed, nil
 }
 
 // printVersionInfo prints version information (legacy function)
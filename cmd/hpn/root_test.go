@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/harpoon/hpn/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+func TestApplyTimeoutFlags(t *testing.T) {
+	savedConfig, savedTimeout, savedOpTimeouts := cfg, timeout, opTimeouts
+	t.Cleanup(func() { cfg, timeout, opTimeouts = savedConfig, savedTimeout, savedOpTimeouts })
+
+	operations := []string{"pull", "push", "save", "load", "tag"}
+	tests := []struct {
+		name       string
+		config     types.RuntimeConfig // runtime.timeout and runtime.timeouts
+		timeout    string              // --timeout, if given
+		opTimeouts map[string]string   // --op-timeout
+		want       []time.Duration     // timeouts of operations in order
+		err        string              // expected error, if any
+	}{
+		{"defaults", types.RuntimeConfig{}, "", nil,
+			[]time.Duration{5 * time.Minute, 10 * time.Minute, 10 * time.Minute, 10 * time.Minute, 5 * time.Minute}, ""},
+		{"config timeout", types.RuntimeConfig{Timeout: 2 * time.Minute}, "", nil,
+			[]time.Duration{2 * time.Minute, 2 * time.Minute, 2 * time.Minute, 2 * time.Minute, 2 * time.Minute}, ""},
+		{"--timeout over the config", types.RuntimeConfig{Timeout: 2 * time.Minute}, "3m", nil,
+			[]time.Duration{3 * time.Minute, 3 * time.Minute, 3 * time.Minute, 3 * time.Minute, 3 * time.Minute}, ""},
+		{"config operation timeout over --timeout", types.RuntimeConfig{Timeouts: types.TimeoutConfig{Push: 20 * time.Minute}}, "3m", nil,
+			[]time.Duration{3 * time.Minute, 20 * time.Minute, 3 * time.Minute, 3 * time.Minute, 3 * time.Minute}, ""},
+		{"--op-timeout", types.RuntimeConfig{Timeouts: types.TimeoutConfig{Push: 20 * time.Minute}}, "3m", map[string]string{"push": "15m", "tag": "30s"},
+			[]time.Duration{3 * time.Minute, 15 * time.Minute, 3 * time.Minute, 3 * time.Minute, 30 * time.Second}, ""},
+		{"invalid operation", types.RuntimeConfig{}, "", map[string]string{"copy": "1m"}, nil, "invalid --op-timeout operation 'copy'"},
+		{"invalid duration", types.RuntimeConfig{}, "", map[string]string{"pull": "soon"}, nil, "invalid --op-timeout value 'pull=soon'"},
+		{"timeout too long", types.RuntimeConfig{}, "45m", nil, nil, "runtime timeout cannot exceed 30 minutes"},
+	}
+	for _, tt := range tests {
+		cmd := &cobra.Command{}
+		cmd.Flags().DurationVar(&timeout, "timeout", 0, "")
+		if tt.timeout != "" {
+			if err := cmd.Flags().Set("timeout", tt.timeout); err != nil {
+				t.Fatal(err)
+			}
+		}
+		opTimeouts = tt.opTimeouts
+		cfg = types.DefaultConfig()
+		cfg.Runtime.Timeout = tt.config.Timeout
+		cfg.Runtime.Timeouts = tt.config.Timeouts
+
+		err := applyTimeoutFlags(cmd)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: applyTimeoutFlags = %v, want an error containing %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: applyTimeoutFlags failed: %v", tt.name, err)
+			continue
+		}
+		for i, operation := range operations {
+			if got := cfg.Runtime.OperationTimeout(operation); got != tt.want[i] {
+				t.Errorf("%s: %s timeout = %s, want %s", tt.name, operation, got, tt.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,212 @@
+// Package auth resolves the credentials hpn uses for registries: per-registry
+// settings from the configuration, the credentials stored by hpn login and
+// docker config.json files with their credential helpers.
+package auth
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/harpoon/hpn/internal/logger"
+	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/reference"
+)
+
+// Credential is a username and password or access token for a registry
+type Credential struct {
+	Username string
+	Password string
+	Helper   string // credential helper that returned the credential, empty if stored
+}
+
+// IsEmpty reports whether c holds no credentials
+func (c Credential) IsEmpty() bool {
+	return c.Username == "" && c.Password == ""
+}
+
+// Registry configures the credentials of the registries matching Registry.
+// The password is taken from PasswordEnv, TokenFile or a credential helper.
+type Registry struct {
+	Registry    string // hostname[:port] or *.domain wildcard
+	Username    string
+	PasswordEnv string // environment variable holding the password or token
+	TokenFile   string // file holding the password or token
+	Helper      string // credential helper, run as docker-credential-<Helper>
+}
+
+// Options configures a Resolver
+type Options struct {
+	// Registries are the configured per-registry credentials
+	Registries []Registry
+
+	// File is the credential file written by hpn login
+	File string
+
+	// DockerConfig is a docker config.json consulted last
+	DockerConfig string
+}
+
+// Resolver looks up the credentials of registry hosts. Configured registries
+// take precedence over the credential file, which takes precedence over the
+// docker config. Resolved credentials are cached.
+type Resolver struct {
+	opts Options
+	log  logger.Logger
+
+	mu    sync.Mutex
+	cache map[string]Credential
+}
+
+// NewResolver creates a credential resolver
+func NewResolver(opts Options) *Resolver {
+	return &Resolver{
+		opts:  opts,
+		log:   logger.Nop(),
+		cache: make(map[string]Credential),
+	}
+}
+
+// SetLogger sets the logger used to report failed lookups
+func (r *Resolver) SetLogger(l logger.Logger) {
+	r.log = l
+}
+
+// Credentials returns the username and password for host, or empty strings
+// if there are none. Failed lookups are logged and treated as anonymous.
+func (r *Resolver) Credentials(host string) (string, string) {
+	cred, err := r.Lookup(host)
+	if err != nil {
+		r.log.Warn("Failed to get registry credentials", logger.F("registry", host), logger.Err(err))
+		return "", ""
+	}
+	return cred.Username, cred.Password
+}
+
+// StoredCredentials returns the username and password for host like
+// Credentials, but not those of credential helpers, whose secrets must not
+// be written to the auth files passed to container engines
+func (r *Resolver) StoredCredentials(host string) (string, string) {
+	cred, err := r.Lookup(host)
+	if err != nil {
+		r.log.Warn("Failed to get registry credentials", logger.F("registry", host), logger.Err(err))
+		return "", ""
+	}
+	if cred.Helper != "" {
+		r.log.Debug("Leaving credentials of credential helper to the runtime",
+			logger.F("registry", host), logger.F("helper", cred.Helper))
+		return "", ""
+	}
+	return cred.Username, cred.Password
+}
+
+// Lookup returns the credentials for host, which are empty if there are none
+func (r *Resolver) Lookup(host string) (Credential, error) {
+	host = NormalizeHost(host)
+
+	r.mu.Lock()
+	cred, ok := r.cache[host]
+	r.mu.Unlock()
+	if ok {
+		return cred, nil
+	}
+
+	cred, err := r.lookup(host)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	r.mu.Lock()
+	r.cache[host] = cred
+	r.mu.Unlock()
+	return cred, nil
+}
+
+// lookup resolves the credentials for host without the cache
+func (r *Resolver) lookup(host string) (Credential, error) {
+	for _, registry := range r.opts.Registries {
+		if matchHost(registry.Registry, host) {
+			return registry.credential(host)
+		}
+	}
+
+	for _, path := range []string{r.opts.File, r.opts.DockerConfig} {
+		if path == "" {
+			continue
+		}
+		config, err := LoadConfig(path)
+		if err != nil {
+			return Credential{}, err
+		}
+		cred, err := config.Lookup(host)
+		if err != nil || !cred.IsEmpty() {
+			return cred, err
+		}
+	}
+
+	return Credential{}, nil
+}
+
+// credential returns the configured credentials of a registry for host
+func (r *Registry) credential(host string) (Credential, error) {
+	cred := Credential{Username: r.Username}
+
+	switch {
+	case r.Helper != "":
+		return runHelper(r.Helper, serverURL(host))
+
+	case r.PasswordEnv != "":
+		cred.Password = os.Getenv(r.PasswordEnv)
+		if cred.Password == "" {
+			return Credential{}, errors.New(errors.ErrRegistryAuth,
+				fmt.Sprintf("environment variable %s with the password for registry %s is not set", r.PasswordEnv, host))
+		}
+
+	case r.TokenFile != "":
+		data, err := os.ReadFile(r.TokenFile)
+		if err != nil {
+			return Credential{}, errors.Wrap(err, errors.ErrRegistryAuth,
+				fmt.Sprintf("failed to read token file for registry %s", host))
+		}
+		cred.Password = strings.TrimSpace(string(data))
+	}
+
+	return cred, nil
+}
+
+// NormalizeHost returns the registry host of a registry name, server URL or
+// docker config key. Docker Hub endpoints are normalized to docker.io.
+func NormalizeHost(name string) string {
+	host := strings.TrimSpace(name)
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	host, _, _ = strings.Cut(host, "/")
+	host = strings.ToLower(host)
+
+	switch host {
+	case "", "index.docker.io", "registry-1.docker.io":
+		return reference.DefaultDomain
+	}
+	return host
+}
+
+// serverURL returns the server URL credential helpers and docker config
+// files use for a registry host
+func serverURL(host string) string {
+	if host == reference.DefaultDomain {
+		return "https://index.docker.io/v1/"
+	}
+	return host
+}
+
+// matchHost reports whether host matches a registry pattern: an exact
+// hostname (optionally with port) or a "*.domain" wildcard
+func matchHost(pattern, host string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:])
+	}
+	return NormalizeHost(pattern) == host
+}
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/harpoon/hpn/pkg/errors"
+)
+
+func TestResolverOrder(t *testing.T) {
+	dir := t.TempDir()
+
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HPN_TEST_PASSWORD", "env-secret")
+
+	file := filepath.Join(dir, "auth.json")
+	login := &Config{}
+	login.Set("https://harbor.example.com/", Credential{Username: "admin", Password: "login"})
+	login.Set("registry.example.com", Credential{Username: "shadowed", Password: "login"})
+	if err := login.Save(file); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if info, err := os.Stat(file); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("credential file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	docker := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(docker, []byte(`{"auths":{"https://index.docker.io/v1/":{"auth":"aHViOmh1Yi1zZWNyZXQ="}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	resolver := NewResolver(Options{
+		Registries: []Registry{
+			{Registry: "registry.example.com", Username: "ci", PasswordEnv: "HPN_TEST_PASSWORD"},
+			{Registry: "*.corp.example.com", Username: "robot", TokenFile: tokenFile},
+			{Registry: "unset.example.com", Username: "ci", PasswordEnv: "HPN_TEST_UNSET"},
+		},
+		File:         file,
+		DockerConfig: docker,
+	})
+
+	tests := []struct {
+		host string
+		want Credential
+	}{
+		{"registry.example.com", Credential{Username: "ci", Password: "env-secret"}},
+		{"eu.corp.example.com", Credential{Username: "robot", Password: "file-token"}},
+		{"HARBOR.example.com", Credential{Username: "admin", Password: "login"}},
+		{"registry-1.docker.io", Credential{Username: "hub", Password: "hub-secret"}},
+		{"quay.io", Credential{}},
+	}
+	for _, tt := range tests {
+		got, err := resolver.Lookup(tt.host)
+		if err != nil {
+			t.Errorf("Lookup(%q) failed: %v", tt.host, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Lookup(%q) = %+v, want %+v", tt.host, got, tt.want)
+		}
+	}
+
+	if _, err := resolver.Lookup("unset.example.com"); errors.GetCode(err) != errors.ErrRegistryAuth {
+		t.Errorf("Lookup with unset password variable returned %v, want ErrRegistryAuth", err)
+	}
+	if username, password := resolver.Credentials("unset.example.com"); username != "" || password != "" {
+		t.Errorf("Credentials with unset password variable = %q, %q, want anonymous", username, password)
+	}
+}
+
+func TestConfigSetRemove(t *testing.T) {
+	config := &Config{}
+	config.Set("index.docker.io", Credential{Username: "user", Password: "secret"})
+	if _, ok := config.Auths["https://index.docker.io/v1/"]; !ok {
+		t.Errorf("Docker Hub credentials stored under %v, want the docker server URL", config.Auths)
+	}
+
+	cred, err := config.Lookup("docker.io")
+	if err != nil || cred != (Credential{Username: "user", Password: "secret"}) {
+		t.Errorf("Lookup = %+v, %v, want stored credentials", cred, err)
+	}
+
+	if !config.Remove("docker.io") {
+		t.Error("Remove returned false for stored credentials")
+	}
+	if config.Remove("docker.io") {
+		t.Error("Remove returned true for removed credentials")
+	}
+}
+
+func TestCredentialHelper(t *testing.T) {
+	bin := t.TempDir()
+	script := `#!/bin/sh
+read url
+case "$url" in
+  registry.example.com) echo '{"ServerURL":"registry.example.com","Username":"helper","Secret":"helper-secret"}' ;;
+  *) echo "credentials not found in native keychain"; exit 1 ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(bin, "docker-credential-test"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	config := &Config{CredsStore: "test"}
+	cred, err := config.Lookup("registry.example.com")
+	if err != nil || cred != (Credential{Username: "helper", Password: "helper-secret", Helper: "test"}) {
+		t.Errorf("Lookup = %+v, %v, want helper credentials", cred, err)
+	}
+
+	cred, err = config.Lookup("quay.io")
+	if err != nil || !cred.IsEmpty() {
+		t.Errorf("Lookup of unknown registry = %+v, %v, want no credentials", cred, err)
+	}
+
+	config = &Config{CredHelpers: map[string]string{"quay.io": "missing"}}
+	if _, err := config.Lookup("quay.io"); errors.GetCode(err) != errors.ErrRegistryAuth {
+		t.Errorf("Lookup with missing helper returned %v, want ErrRegistryAuth", err)
+	}
+
+	// Helper secrets are not handed out for container engine auth files
+	t.Setenv("HPN_TEST_PASSWORD", "env-secret")
+	resolver := NewResolver(Options{Registries: []Registry{
+		{Registry: "registry.example.com", Helper: "test"},
+		{Registry: "quay.io", Username: "ci", PasswordEnv: "HPN_TEST_PASSWORD"},
+	}})
+	if username, password := resolver.Credentials("registry.example.com"); username != "helper" || password != "helper-secret" {
+		t.Errorf("Credentials of helper registry = %q, %q, want helper credentials", username, password)
+	}
+	if username, password := resolver.StoredCredentials("registry.example.com"); username != "" || password != "" {
+		t.Errorf("StoredCredentials of helper registry = %q, %q, want none", username, password)
+	}
+	if username, password := resolver.StoredCredentials("quay.io"); username != "ci" || password != "env-secret" {
+		t.Errorf("StoredCredentials of configured registry = %q, %q, want configured credentials", username, password)
+	}
+}
+
+func TestMergeDockerConfig(t *testing.T) {
+	base := t.TempDir()
+	original := `{
+	"auths": {"https://index.docker.io/v1/": {"auth": "aHViOmh1Yi1zZWNyZXQ="}},
+	"credsStore": "desktop",
+	"credHelpers": {"harbor.example.com": "ecr-login", "gcr.io": "gcloud"},
+	"proxies": {"default": {"httpProxy": "http://proxy.local:3128"}},
+	"currentContext": "remote"
+}`
+	if err := os.WriteFile(filepath.Join(base, "config.json"), []byte(original), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(base, "contexts", "meta"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := MergeDockerConfig(dir, base, "harbor.example.com", Credential{Username: "ci", Password: "secret"}); err != nil {
+		t.Fatalf("MergeDockerConfig failed: %v", err)
+	}
+
+	merged, err := LoadConfig(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred, err := merged.Lookup("harbor.example.com"); err != nil || cred != (Credential{Username: "ci", Password: "secret"}) {
+		t.Errorf("merged credentials = %+v, %v, want hpn credentials", cred, err)
+	}
+	if cred, err := merged.Lookup("docker.io"); err != nil || cred.Username != "hub" {
+		t.Errorf("merged Docker Hub credentials = %+v, %v, want the user's", cred, err)
+	}
+	if merged.CredsStore != "" || merged.CredHelpers["gcr.io"] != "gcloud" || merged.CredHelpers["harbor.example.com"] != "" {
+		t.Errorf("merged credential helpers = %q %v, want only the other registries' helpers", merged.CredsStore, merged.CredHelpers)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, "config.json"))
+	for _, want := range []string{`"proxies"`, `"currentContext": "remote"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("merged config lacks %s:\n%s", want, data)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "contexts", "meta")); err != nil {
+		t.Errorf("contexts not linked into the merged config: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(base, "config.json")); string(data) != original {
+		t.Errorf("user config modified:\n%s", data)
+	}
+}
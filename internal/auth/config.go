@@ -0,0 +1,251 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/harpoon/hpn/pkg/errors"
+)
+
+// Config holds the credentials of a docker config.json. The credential file
+// of hpn login uses the same format, so it can be used as a docker config or
+// podman auth file.
+type Config struct {
+	Auths       map[string]ConfigAuth `json:"auths"`
+	CredsStore  string                `json:"credsStore,omitempty"`
+	CredHelpers map[string]string     `json:"credHelpers,omitempty"`
+}
+
+// ConfigAuth is a credential entry of a Config
+type ConfigAuth struct {
+	Auth          string `json:"auth,omitempty"` // base64 of username:password
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+}
+
+// DefaultFile returns the credential file of hpn login, $HPN_AUTH_FILE or
+// $HOME/.hpn/auth.json
+func DefaultFile() string {
+	if path := os.Getenv("HPN_AUTH_FILE"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".hpn", "auth.json")
+	}
+	return filepath.Join(home, ".hpn", "auth.json")
+}
+
+// DockerConfigFile returns the docker config.json, in $DOCKER_CONFIG or
+// $HOME/.docker
+func DockerConfigFile() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".docker", "config.json")
+}
+
+// LoadConfig reads a config file. A missing file is an empty config.
+func LoadConfig(path string) (*Config, error) {
+	config := &Config{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrConfigParsing, fmt.Sprintf("failed to read credentials from %s", path))
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, errors.Wrap(err, errors.ErrConfigParsing, fmt.Sprintf("invalid credential file %s", path))
+	}
+	return config, nil
+}
+
+// Save writes the config to path, readable only by the current user
+func (c *Config) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return errors.Wrap(err, errors.ErrConfigParsing, "failed to encode credentials")
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrap(err, errors.ErrFileOperation, fmt.Sprintf("failed to create %s", dir))
+	}
+
+	// Replace the file atomically so a failed write keeps the old credentials
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return errors.Wrap(err, errors.ErrFileOperation, fmt.Sprintf("failed to write %s", path))
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, errors.ErrFileOperation, fmt.Sprintf("failed to write %s", path))
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, errors.ErrFileOperation, fmt.Sprintf("failed to write %s", path))
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return errors.Wrap(err, errors.ErrFileOperation, fmt.Sprintf("failed to write %s", path))
+	}
+	return nil
+}
+
+// Set stores the credentials for host under the key docker uses for it
+func (c *Config) Set(host string, cred Credential) {
+	if c.Auths == nil {
+		c.Auths = make(map[string]ConfigAuth)
+	}
+	host = NormalizeHost(host)
+	for _, key := range c.keys(host) {
+		delete(c.Auths, key)
+	}
+	c.Auths[serverURL(host)] = ConfigAuth{Auth: base64.StdEncoding.EncodeToString([]byte(cred.Username + ":" + cred.Password))}
+}
+
+// Remove removes the credentials for host and reports whether there were any
+func (c *Config) Remove(host string) bool {
+	keys := c.keys(NormalizeHost(host))
+	for _, key := range keys {
+		delete(c.Auths, key)
+	}
+	return len(keys) > 0
+}
+
+// Lookup returns the credentials for host like docker does: a credential
+// helper configured for host, a stored entry, or the credential store
+func (c *Config) Lookup(host string) (Credential, error) {
+	host = NormalizeHost(host)
+
+	for key, helper := range c.CredHelpers {
+		if NormalizeHost(key) == host {
+			return runHelper(helper, serverURL(host))
+		}
+	}
+
+	for _, key := range c.keys(host) {
+		entry := c.Auths[key]
+		if entry.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return Credential{}, errors.Wrap(err, errors.ErrConfigParsing, fmt.Sprintf("invalid credentials for registry %s", host))
+			}
+			username, password, _ := strings.Cut(string(decoded), ":")
+			return Credential{Username: username, Password: password}, nil
+		}
+		if entry.Username != "" {
+			return Credential{Username: entry.Username, Password: entry.Password}, nil
+		}
+	}
+
+	if c.CredsStore != "" {
+		return runHelper(c.CredsStore, serverURL(host))
+	}
+	return Credential{}, nil
+}
+
+// MergeDockerConfig writes to dir a copy of the docker config in base with
+// the credentials for host, which replace its entry, credential helper and
+// credential store for host. The other files of base, such as contexts and
+// plugins, are linked into dir. An empty base is an empty config.
+func MergeDockerConfig(dir, base, host string, cred Credential) error {
+	var entries []os.DirEntry
+	var data []byte
+	var err error
+	if base != "" {
+		if base, err = filepath.Abs(base); err != nil {
+			return errors.Wrap(err, errors.ErrFileOperation, "failed to locate docker config")
+		}
+	}
+	path := filepath.Join(base, "config.json")
+	if base != "" {
+		entries, err = os.ReadDir(base)
+		if err == nil {
+			data, err = os.ReadFile(path)
+		}
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, errors.ErrFileOperation, fmt.Sprintf("failed to read docker config %s", base))
+	}
+	for _, entry := range entries {
+		if entry.Name() == "config.json" {
+			continue
+		}
+		if err := os.Symlink(filepath.Join(base, entry.Name()), filepath.Join(dir, entry.Name())); err != nil {
+			return errors.Wrap(err, errors.ErrFileOperation, "failed to link docker config")
+		}
+	}
+
+	// Keep the fields hpn does not know, such as proxies and currentContext
+	fields := make(map[string]json.RawMessage)
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return errors.Wrap(err, errors.ErrConfigParsing, fmt.Sprintf("invalid credential file %s", path))
+		}
+	}
+
+	config := &Config{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, config); err != nil {
+			return errors.Wrap(err, errors.ErrConfigParsing, fmt.Sprintf("invalid credential file %s", path))
+		}
+	}
+	host = NormalizeHost(host)
+	config.Set(host, cred)
+	for key := range config.CredHelpers {
+		if NormalizeHost(key) == host {
+			delete(config.CredHelpers, key)
+		}
+	}
+
+	// The credential store would take precedence over the entry; the
+	// command only talks to host
+	delete(fields, "credsStore")
+	fields["auths"], _ = json.Marshal(config.Auths)
+	if len(config.CredHelpers) > 0 {
+		fields["credHelpers"], _ = json.Marshal(config.CredHelpers)
+	} else {
+		delete(fields, "credHelpers")
+	}
+
+	data, err = json.MarshalIndent(fields, "", "\t")
+	if err != nil {
+		return errors.Wrap(err, errors.ErrConfigParsing, "failed to encode credentials")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), append(data, '\n'), 0600); err != nil {
+		return errors.Wrap(err, errors.ErrFileOperation, "failed to write docker config")
+	}
+	return nil
+}
+
+// DockerConfigDir returns the docker config directory, $DOCKER_CONFIG or
+// $HOME/.docker, or an empty string if there is no home directory
+func DockerConfigDir() string {
+	path := DockerConfigFile()
+	if path == "" {
+		return ""
+	}
+	return filepath.Dir(path)
+}
+
+// keys returns the keys of the entries for host
+func (c *Config) keys(host string) []string {
+	var keys []string
+	for key := range c.Auths {
+		if NormalizeHost(key) == host {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
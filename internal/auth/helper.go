@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/harpoon/hpn/pkg/errors"
+)
+
+// helperTimeout bounds a credential helper invocation
+const helperTimeout = 30 * time.Second
+
+// identityTokenUser is the username helpers return for identity tokens,
+// which are exchanged for registry tokens by docker and not supported here
+const identityTokenUser = "<token>"
+
+// runHelper gets the credentials for serverURL from a credential helper
+// using the docker credential helper protocol. Credentials the helper does
+// not know are empty.
+func runHelper(helper, serverURL string) (Credential, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), helperTimeout)
+	defer cancel()
+
+	program := "docker-credential-" + helper
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, program, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		output := strings.TrimSpace(stdout.String() + " " + stderr.String())
+		if strings.Contains(strings.ToLower(output), "credentials not found") {
+			return Credential{}, nil
+		}
+		if output != "" {
+			err = fmt.Errorf("%w: %s", err, output)
+		}
+		return Credential{}, errors.Wrap(err, errors.ErrRegistryAuth,
+			fmt.Sprintf("credential helper %s failed for %s", program, serverURL))
+	}
+
+	var response struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		return Credential{}, errors.Wrap(err, errors.ErrRegistryAuth,
+			fmt.Sprintf("invalid response of credential helper %s", program))
+	}
+	if response.Username == identityTokenUser {
+		return Credential{}, errors.New(errors.ErrRegistryAuth,
+			fmt.Sprintf("credential helper %s returned an identity token for %s, which is not supported", program, serverURL))
+	}
+	return Credential{Username: response.Username, Password: response.Secret, Helper: helper}, nil
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/spf13/viper"
+	"github.com/harpoon/hpn/internal/logger"
 	"github.com/harpoon/hpn/pkg/errors"
 	"github.com/harpoon/hpn/pkg/types"
 )
@@ -15,15 +16,22 @@ import (
 type Manager struct {
 	config *types.Config
 	viper  *viper.Viper
+	logger logger.Logger
 }
 
 // NewManager creates a new configuration manager
 func NewManager() *Manager {
 	return &Manager{
-		viper: viper.New(),
+		viper:  viper.New(),
+		logger: logger.Nop(),
 	}
 }
 
+// SetLogger sets the logger used while loading configuration
+func (m *Manager) SetLogger(l logger.Logger) {
+	m.logger = l
+}
+
 // Load loads configuration from various sources with proper priority
 func (m *Manager) Load(configFile string) (*types.Config, error) {
 	// Start with default configuration
@@ -37,6 +45,12 @@ func (m *Manager) Load(configFile string) (*types.Config, error) {
 		return nil, err
 	}
 
+	if path := m.viper.ConfigFileUsed(); path != "" {
+		m.logger.Debug("Loaded configuration file", logger.F("path", path))
+	} else {
+		m.logger.Debug("No configuration file found, using defaults")
+	}
+
 	// Load environment variables
 	m.loadEnvironmentVariables()
 
@@ -104,12 +118,20 @@ func (m *Manager) loadEnvironmentVariables() {
 		"HPN_PROXY_HTTP":         "proxy.http",
 		"HPN_PROXY_HTTPS":        "proxy.https",
 		"HPN_PROXY_ENABLED":      "proxy.enabled",
+		"HPN_PROXY_NO_PROXY":     "proxy.no_proxy",
 		"HPN_RUNTIME_PREFERRED":  "runtime.preferred",
 		"HPN_RUNTIME_TIMEOUT":    "runtime.timeout",
+		"HPN_STORE_DIR":          "runtime.store_dir",
+		"HPN_PULL_TIMEOUT":       "runtime.timeouts.pull",
+		"HPN_PUSH_TIMEOUT":       "runtime.timeouts.push",
+		"HPN_SAVE_TIMEOUT":       "runtime.timeouts.save",
+		"HPN_LOAD_TIMEOUT":       "runtime.timeouts.load",
+		"HPN_TAG_TIMEOUT":        "runtime.timeouts.tag",
 		"HPN_LOG_LEVEL":          "logging.level",
 		"HPN_LOG_FORMAT":         "logging.format",
 		"HPN_LOG_FILE":           "logging.file",
 		"HPN_LOG_CONSOLE":        "logging.console",
+		"HPN_LOG_COLORS":         "logging.colors",
 		"HPN_PARALLEL_MAX":       "parallel.max_workers",
 		"HPN_PARALLEL_AUTO":      "parallel.auto_adjust",
 	}
@@ -117,18 +139,41 @@ func (m *Manager) loadEnvironmentVariables() {
 	for envVar, configKey := range envMappings {
 		if value := os.Getenv(envVar); value != "" {
 			m.viper.Set(configKey, value)
+			m.logger.Debug("Applied environment override", logger.F("env", envVar), logger.F("key", configKey))
+		}
+	}
+
+	// HPN_VAR_<NAME> defines the image list variable NAME
+	for _, env := range os.Environ() {
+		key, value, _ := strings.Cut(env, "=")
+		if name := strings.TrimPrefix(key, "HPN_VAR_"); name != key && name != "" {
+			m.viper.Set("variables."+name, value)
+			m.logger.Debug("Applied environment variable", logger.F("env", key))
 		}
 	}
 
 	// Handle proxy environment variables (standard names)
-	if httpProxy := os.Getenv("http_proxy"); httpProxy != "" {
+	if httpProxy := getenvAny("http_proxy", "HTTP_PROXY"); httpProxy != "" {
 		m.viper.Set("proxy.http", httpProxy)
 		m.viper.Set("proxy.enabled", true)
 	}
-	if httpsProxy := os.Getenv("https_proxy"); httpsProxy != "" {
+	if httpsProxy := getenvAny("https_proxy", "HTTPS_PROXY"); httpsProxy != "" {
 		m.viper.Set("proxy.https", httpsProxy)
 		m.viper.Set("proxy.enabled", true)
 	}
+	if noProxy := getenvAny("no_proxy", "NO_PROXY"); noProxy != "" && os.Getenv("HPN_PROXY_NO_PROXY") == "" {
+		m.viper.Set("proxy.no_proxy", noProxy)
+	}
+}
+
+// getenvAny returns the value of the first non-empty environment variable
+func getenvAny(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
 }
 
 // GetConfigPath returns the path of the loaded config file
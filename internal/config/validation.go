@@ -5,13 +5,19 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
+	"github.com/harpoon/hpn/internal/imagelist"
 	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/reference"
 	"github.com/harpoon/hpn/pkg/types"
 )
 
+// maxRuntimeTimeout is the upper bound for runtime operation timeouts
+const maxRuntimeTimeout = 30 * time.Minute
+
 // ValidateConfig validates the entire configuration
 func ValidateConfig(cfg *types.Config) error {
 	if err := validateRegistry(cfg.Registry); err != nil {
@@ -42,6 +48,33 @@ func ValidateConfig(cfg *types.Config) error {
 		return err
 	}
 
+	if err := validateVariables(cfg.Variables); err != nil {
+		return err
+	}
+
+	for i := range cfg.Registries {
+		if err := validateRegistryConfig(&cfg.Registries[i]); err != nil {
+			return err
+		}
+	}
+
+	for i := range cfg.Mirrors {
+		if err := validateMirrorConfig(&cfg.Mirrors[i]); err != nil {
+			return err
+		}
+	}
+
+	for _, tag := range cfg.Tags {
+		if !reference.ValidTag(tag) {
+			return errors.New(errors.ErrInvalidConfig, fmt.Sprintf("invalid tag '%s'", tag))
+		}
+	}
+	for i := range cfg.TagRules {
+		if err := imagelist.ValidateTagRule(&cfg.TagRules[i]); err != nil {
+			return errors.Wrap(err, errors.ErrInvalidConfig, "invalid tag_rules entry")
+		}
+	}
+
 	return nil
 }
 
@@ -78,6 +111,12 @@ func validateProject(project string) error {
 
 // validateProxyConfig validates proxy configuration
 func validateProxyConfig(proxy *types.ProxyConfig) error {
+	for _, override := range proxy.Registries {
+		if err := validateRegistryProxy(&override); err != nil {
+			return err
+		}
+	}
+
 	if !proxy.Enabled {
 		return nil
 	}
@@ -97,6 +136,88 @@ func validateProxyConfig(proxy *types.ProxyConfig) error {
 	return nil
 }
 
+// validateRegistryProxy validates a per-registry proxy override
+func validateRegistryProxy(override *types.RegistryProxyConfig) error {
+	if strings.TrimSpace(override.Registry) == "" {
+		return errors.New(errors.ErrInvalidConfig, "proxy registry override requires a registry")
+	}
+
+	if strings.Contains(override.Registry, "://") {
+		return errors.New(errors.ErrInvalidConfig, fmt.Sprintf("proxy registry override '%s' should not include protocol", override.Registry))
+	}
+
+	if err := validateProxyURL(override.HTTP); err != nil {
+		return errors.Wrap(err, errors.ErrInvalidConfig, fmt.Sprintf("invalid HTTP proxy URL for registry '%s'", override.Registry))
+	}
+
+	if err := validateProxyURL(override.HTTPS); err != nil {
+		return errors.Wrap(err, errors.ErrInvalidConfig, fmt.Sprintf("invalid HTTPS proxy URL for registry '%s'", override.Registry))
+	}
+
+	return nil
+}
+
+// validateRegistryConfig validates the settings of a registry
+func validateRegistryConfig(registry *types.RegistryConfig) error {
+	if strings.TrimSpace(registry.Registry) == "" {
+		return errors.New(errors.ErrInvalidConfig, "registries entry requires a registry")
+	}
+
+	if strings.Contains(registry.Registry, "://") {
+		return errors.New(errors.ErrInvalidConfig, fmt.Sprintf("registry '%s' should not include protocol", registry.Registry))
+	}
+
+	sources := 0
+	for _, source := range []string{registry.PasswordEnv, registry.TokenFile, registry.CredentialHelper} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return errors.New(errors.ErrInvalidConfig, fmt.Sprintf("registry '%s' can use only one of password_env, token_file and credential_helper", registry.Registry))
+	}
+
+	if registry.CredentialHelper == "" && (registry.PasswordEnv != "" || registry.TokenFile != "") && registry.Username == "" {
+		return errors.New(errors.ErrInvalidConfig, fmt.Sprintf("registry '%s' requires a username with password_env or token_file", registry.Registry))
+	}
+
+	if (registry.CertFile == "") != (registry.KeyFile == "") {
+		return errors.New(errors.ErrInvalidConfig, fmt.Sprintf("registry '%s' requires both cert_file and key_file", registry.Registry))
+	}
+
+	return nil
+}
+
+// validateMirrorConfig validates a mirror rule
+func validateMirrorConfig(mirror *types.MirrorConfig) error {
+	if (mirror.Prefix == "") == (mirror.Regex == "") {
+		return errors.New(errors.ErrInvalidConfig, "mirrors entry requires either prefix or regex")
+	}
+
+	name := mirror.Prefix
+	if mirror.Regex != "" {
+		name = mirror.Regex
+		if _, err := regexp.Compile(mirror.Regex); err != nil {
+			return errors.Wrap(err, errors.ErrInvalidConfig, fmt.Sprintf("invalid mirror regex '%s'", mirror.Regex))
+		}
+	}
+
+	if strings.Contains(mirror.Prefix, "://") {
+		return errors.New(errors.ErrInvalidConfig, fmt.Sprintf("mirror prefix '%s' should not include protocol", mirror.Prefix))
+	}
+
+	if len(mirror.Mirrors) == 0 {
+		return errors.New(errors.ErrInvalidConfig, fmt.Sprintf("mirror rule '%s' has no mirrors", name))
+	}
+	for _, m := range mirror.Mirrors {
+		if strings.TrimSpace(m) == "" || strings.Contains(m, "://") {
+			return errors.New(errors.ErrInvalidConfig, fmt.Sprintf("invalid mirror '%s' of rule '%s'", m, name))
+		}
+	}
+
+	return nil
+}
+
 // validateProxyURL validates a proxy URL
 func validateProxyURL(proxyURL string) error {
 	if proxyURL == "" {
@@ -122,7 +243,7 @@ func validateProxyURL(proxyURL string) error {
 // validateRuntimeConfig validates runtime configuration
 func validateRuntimeConfig(runtime *types.RuntimeConfig) error {
 	if runtime.Preferred != "" {
-		validRuntimes := []string{"docker", "podman", "nerdctl"}
+		validRuntimes := []string{"docker", "podman", "nerdctl", "native"}
 		valid := false
 		for _, r := range validRuntimes {
 			if runtime.Preferred == r {
@@ -135,17 +256,46 @@ func validateRuntimeConfig(runtime *types.RuntimeConfig) error {
 		}
 	}
 
-	if runtime.Timeout <= 0 {
-		return errors.New(errors.ErrInvalidConfig, "runtime timeout must be positive")
+	if runtime.Timeout < 0 {
+		return errors.New(errors.ErrInvalidConfig, "runtime timeout cannot be negative")
 	}
 
-	if runtime.Timeout > 30*time.Minute {
+	if runtime.Timeout > maxRuntimeTimeout {
 		return errors.New(errors.ErrInvalidConfig, "runtime timeout cannot exceed 30 minutes")
 	}
 
+	if err := validateTimeoutConfig(&runtime.Timeouts); err != nil {
+		return err
+	}
+
 	return validateRetryConfig(&runtime.Retry)
 }
 
+// validateTimeoutConfig validates per-operation timeouts
+func validateTimeoutConfig(timeouts *types.TimeoutConfig) error {
+	operations := []struct {
+		name    string
+		timeout time.Duration
+	}{
+		{"pull", timeouts.Pull},
+		{"push", timeouts.Push},
+		{"save", timeouts.Save},
+		{"load", timeouts.Load},
+		{"tag", timeouts.Tag},
+	}
+
+	for _, op := range operations {
+		if op.timeout < 0 {
+			return errors.New(errors.ErrInvalidConfig, fmt.Sprintf("%s timeout cannot be negative", op.name))
+		}
+		if op.timeout > maxRuntimeTimeout {
+			return errors.New(errors.ErrInvalidConfig, fmt.Sprintf("%s timeout cannot exceed 30 minutes", op.name))
+		}
+	}
+
+	return nil
+}
+
 // validateRetryConfig validates retry configuration
 func validateRetryConfig(retry *types.RetryConfig) error {
 	if retry.MaxAttempts < 1 {
@@ -193,6 +343,14 @@ func validateLoggingConfig(logging *types.LoggingConfig) error {
 		return errors.New(errors.ErrInvalidConfig, fmt.Sprintf("invalid log format: %s (must be one of: %s)", logging.Format, strings.Join(validFormats, ", ")))
 	}
 
+	if logging.MaxSize < 0 {
+		return errors.New(errors.ErrInvalidConfig, "log max size cannot be negative")
+	}
+
+	if logging.MaxBackups < 0 {
+		return errors.New(errors.ErrInvalidConfig, "log max backups cannot be negative")
+	}
+
 	if logging.File != "" {
 		// Check if the directory exists and is writable
 		dir := filepath.Dir(logging.File)
@@ -234,6 +392,17 @@ func validateModeConfig(modes *types.ModeConfig) error {
 	return nil
 }
 
+// validateVariables validates image list variable names
+func validateVariables(variables map[string]string) error {
+	for name := range variables {
+		if !imagelist.ValidVariable(name) {
+			return errors.New(errors.ErrInvalidConfig, fmt.Sprintf("invalid variable name '%s': use letters, digits and underscores", name))
+		}
+	}
+
+	return nil
+}
+
 // validateDirectory checks if a directory exists and is writable
 func validateDirectory(dir string) error {
 	info, err := os.Stat(dir)
@@ -0,0 +1,224 @@
+package imagelist
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/harpoon/hpn/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// manifestExtensions are the file extensions read when extracting from a directory
+var manifestExtensions = map[string]bool{
+	".yaml": true,
+	".yml":  true,
+	".json": true,
+}
+
+// podSpecPaths are the paths to the pod spec of each workload kind
+var podSpecPaths = map[string][]string{
+	"Pod":                   {"spec"},
+	"PodTemplate":           {"template", "spec"},
+	"Deployment":            {"spec", "template", "spec"},
+	"ReplicaSet":            {"spec", "template", "spec"},
+	"ReplicationController": {"spec", "template", "spec"},
+	"StatefulSet":           {"spec", "template", "spec"},
+	"DaemonSet":             {"spec", "template", "spec"},
+	"Job":                   {"spec", "template", "spec"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// containerFields are the pod spec fields listing containers
+var containerFields = []string{"initContainers", "containers", "ephemeralContainers"}
+
+// Extract returns the container images of the Kubernetes workloads in a
+// stream of YAML or JSON documents, such as kubectl output or Helm-rendered
+// templates. Images of init and ephemeral containers are included, List
+// kinds are searched recursively and other documents are ignored. Images are
+// returned in order of appearance without duplicates.
+func Extract(data []byte, name string) ([]string, error) {
+	var images []string
+	seen := make(map[string]bool)
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		err := decoder.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, errors.ErrImageParsing, fmt.Sprintf("failed to parse manifest %s", name)).
+				WithContext("file", name)
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+
+		for _, image := range workloadImages(doc.Content[0]) {
+			if !seen[image] {
+				seen[image] = true
+				images = append(images, image)
+			}
+		}
+	}
+
+	return images, nil
+}
+
+// ExtractSources extracts the images of all manifests in files, directories
+// (searched recursively for *.yaml, *.yml and *.json files) and standard
+// input ("-"). Images are returned in order of appearance without duplicates.
+func ExtractSources(sources []string, stdin io.Reader) ([]string, error) {
+	var images []string
+	seen := make(map[string]bool)
+	stdinRead := false
+
+	add := func(data []byte, name string) error {
+		extracted, err := Extract(data, name)
+		if err != nil {
+			return err
+		}
+		for _, image := range extracted {
+			if !seen[image] {
+				seen[image] = true
+				images = append(images, image)
+			}
+		}
+		return nil
+	}
+
+	for _, source := range sources {
+		if source == Stdin {
+			if stdinRead {
+				return nil, errors.New(errors.ErrInvalidArgument, "standard input can only be read once")
+			}
+			stdinRead = true
+
+			data, err := io.ReadAll(stdin)
+			if err != nil {
+				return nil, errors.Wrap(err, errors.ErrFileOperation, "failed to read manifests from standard input")
+			}
+			if err := add(data, "<stdin>"); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		files, err := manifestFiles(source)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, errors.Wrap(err, errors.ErrFileOperation, fmt.Sprintf("failed to open file %s", file))
+			}
+			if err := add(data, file); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return images, nil
+}
+
+// manifestFiles returns the manifest files of a file or directory source
+func manifestFiles(source string) ([]string, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrFileNotFound, fmt.Sprintf("failed to open file %s", source))
+	}
+	if !info.IsDir() {
+		return []string{source}, nil
+	}
+
+	// WalkDir visits files in lexical order
+	var files []string
+	err = filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != source && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasPrefix(d.Name(), ".") && manifestExtensions[strings.ToLower(filepath.Ext(path))] {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrFileOperation, fmt.Sprintf("failed to read directory %s", source))
+	}
+
+	return files, nil
+}
+
+// workloadImages returns the container images of a Kubernetes object
+func workloadImages(object *yaml.Node) []string {
+	if object.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	kind := field(object, "kind")
+	if kind == nil {
+		return nil
+	}
+
+	if strings.HasSuffix(kind.Value, "List") {
+		var images []string
+		if items := field(object, "items"); items != nil && items.Kind == yaml.SequenceNode {
+			for _, item := range items.Content {
+				images = append(images, workloadImages(item)...)
+			}
+		}
+		return images
+	}
+
+	path, ok := podSpecPaths[kind.Value]
+	if !ok {
+		return nil
+	}
+
+	spec := object
+	for _, key := range path {
+		if spec = field(spec, key); spec == nil {
+			return nil
+		}
+	}
+
+	var images []string
+	for _, name := range containerFields {
+		containers := field(spec, name)
+		if containers == nil || containers.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, container := range containers.Content {
+			if image := field(container, "image"); image != nil && image.Kind == yaml.ScalarNode && image.Value != "" {
+				images = append(images, strings.TrimSpace(image.Value))
+			}
+		}
+	}
+	return images
+}
+
+// field returns the value of key in a mapping node, or nil
+func field(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
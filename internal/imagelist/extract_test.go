@@ -0,0 +1,82 @@
+package imagelist
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/harpoon/hpn/pkg/errors"
+)
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		file string
+		want []string
+	}{
+		// Pod, Deployment and CronJob documents with init containers,
+		// a Service and an empty document
+		{"workloads.yaml", []string{
+			"busybox:1.36",
+			"alpine:3.19",
+			"ghcr.io/example/migrate:v2",
+			"nginx:1.25",
+			"nginx/nginx-prometheus-exporter:1.1.0",
+			"registry.example.com/tools/backup@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		}},
+		// kubectl get -o json output
+		{"list.json", []string{"quay.io/prometheus/node-exporter:v1.8.0", "postgres:16"}},
+		{filepath.Join("charts", "job.yml"), []string{"postgres:16"}},
+	}
+	for _, tt := range tests {
+		path := filepath.Join("testdata", "k8s", tt.file)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Extract(data, path)
+		if err != nil {
+			t.Errorf("Extract(%s) failed: %v", tt.file, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Extract(%s) = %v, want %v", tt.file, got, tt.want)
+		}
+	}
+
+	if _, err := Extract([]byte("kind: Pod\nspec: [\n"), "broken.yaml"); errors.GetCode(err) != errors.ErrImageParsing {
+		t.Errorf("Extract of invalid YAML = %v, want IMAGE_PARSING", err)
+	}
+}
+
+func TestExtractSources(t *testing.T) {
+	stdin := strings.NewReader("kind: Pod\nspec:\n  containers:\n    - image: nginx:1.25\n    - image: redis:7\n")
+	got, err := ExtractSources([]string{filepath.Join("testdata", "k8s"), "-"}, stdin)
+	if err != nil {
+		t.Fatalf("ExtractSources failed: %v", err)
+	}
+
+	// Files in lexical order, hidden directories and other files skipped
+	want := []string{
+		"postgres:16",
+		"quay.io/prometheus/node-exporter:v1.8.0",
+		"busybox:1.36",
+		"alpine:3.19",
+		"ghcr.io/example/migrate:v2",
+		"nginx:1.25",
+		"nginx/nginx-prometheus-exporter:1.1.0",
+		"registry.example.com/tools/backup@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		"redis:7",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtractSources = %v, want %v", got, want)
+	}
+
+	if _, err := ExtractSources([]string{"-", "-"}, strings.NewReader("")); errors.GetCode(err) != errors.ErrInvalidArgument {
+		t.Errorf("extracting from stdin twice = %v, want INVALID_ARGUMENT", err)
+	}
+	if _, err := ExtractSources([]string{filepath.Join("testdata", "missing")}, nil); errors.GetCode(err) != errors.ErrFileNotFound {
+		t.Errorf("extracting from a missing file = %v, want FILE_NOT_FOUND", err)
+	}
+}
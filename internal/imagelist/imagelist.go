@@ -0,0 +1,288 @@
+// Package imagelist reads image lists. Two formats are supported: plain text
+// lists with one image reference per line and "#" comments, and YAML or JSON
+// manifests whose entries may override how each image is processed:
+//
+//	images:
+//	  - nginx:1.25
+//	  - image: calico/node:v3.28.2
+//	    name: calico-node
+//	    project: network
+//	    platform: linux/arm64
+//	    tags: [stable]
+//	    tag_rules:
+//	      - replace: "$0-arm64"
+//	    skip: [save]
+//
+// A manifest may also be a top-level sequence of entries.
+//
+// Both formats are templates: ${NAME} and ${NAME:-default} are replaced by
+// variables, and "#!" directives include other lists and select sections
+// per architecture or variable value:
+//
+//	#!include base.txt
+//	registry.k8s.io/kube-apiserver:${K8S_VERSION}
+//	#!if arch=arm64
+//	example.com/tool-arm64:1.0
+//	#!else
+//	example.com/tool:1.0
+//	#!endif
+package imagelist
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/reference"
+	"github.com/harpoon/hpn/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+// entryFields are the keys allowed in a manifest entry
+var entryFields = map[string]bool{
+	"image":     true,
+	"name":      true,
+	"project":   true,
+	"platform":  true,
+	"tags":      true,
+	"tag_rules": true,
+	"skip":      true,
+}
+
+// skipActions are the actions an entry can skip
+var skipActions = map[string]bool{
+	types.ActionPull: true,
+	types.ActionSave: true,
+	types.ActionPush: true,
+}
+
+// platformPattern matches os/arch[/variant]
+var platformPattern = regexp.MustCompile(`^[a-z0-9_]+/[a-z0-9_]+(?:/[a-z0-9_]+)?$`)
+
+// Parse parses an image list. Lists named *.yaml, *.yml or *.json, or whose
+// content starts like a YAML or JSON document, are parsed as manifests. name
+// identifies the list in error messages; includes are resolved relative to
+// its directory.
+func Parse(data []byte, name string, opts Options) ([]types.ImageEntry, error) {
+	r, err := newReader(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := r.read(data, name, filepath.Dir(name))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]types.ImageEntry, len(lines))
+	for i, line := range lines {
+		entries[i] = line.entry
+	}
+	return entries, nil
+}
+
+// line is an entry of an image list with the file and line it was defined on
+type line struct {
+	entry  types.ImageEntry
+	source string
+	number int
+}
+
+// parse parses an expanded image list keeping the line number of every entry
+func parse(data []byte, name string) ([]line, error) {
+	if isManifest(data, name) {
+		return parseManifest(data, name)
+	}
+	return parseText(data, name)
+}
+
+// isManifest reports whether an image list is a YAML or JSON manifest
+func isManifest(data []byte, name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+
+	// Image references never start with these, so plain lists are not mistaken for manifests
+	line := firstLine(data)
+	return strings.HasPrefix(line, "{") ||
+		strings.HasPrefix(line, "[") ||
+		strings.HasPrefix(line, "---") ||
+		strings.HasPrefix(line, "- ") ||
+		strings.HasPrefix(line, "images:")
+}
+
+// firstLine returns the first line that is neither empty nor a comment
+func firstLine(data []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return line
+		}
+	}
+	return ""
+}
+
+// parseText parses a plain text list with one image per line
+func parseText(data []byte, name string) ([]line, error) {
+	var entries []line
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		text := strings.TrimSpace(scanner.Text())
+		// Skip empty lines and comments
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		entry := types.ImageEntry{Image: text}
+		if err := Validate(&entry); err != nil {
+			return nil, parseError(name, lineNumber, err)
+		}
+		entries = append(entries, line{entry: entry, source: name, number: lineNumber})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, errors.ErrFileOperation, fmt.Sprintf("error reading %s", name))
+	}
+
+	return entries, nil
+}
+
+// parseManifest parses a YAML or JSON manifest. JSON is parsed as YAML.
+func parseManifest(data []byte, name string) ([]line, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Wrap(err, errors.ErrImageParsing, fmt.Sprintf("failed to parse image list %s", name))
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+
+	root := doc.Content[0]
+	items := root
+	if root.Kind == yaml.MappingNode {
+		items = nil
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			key, value := root.Content[i], root.Content[i+1]
+			if key.Value != "images" {
+				return nil, parseError(name, key.Line, fmt.Errorf("unknown field %q", key.Value))
+			}
+			items = value
+		}
+		// "images:" without entries is an empty list
+		if items == nil || items.Tag == "!!null" {
+			return nil, nil
+		}
+	}
+	if items.Kind != yaml.SequenceNode {
+		return nil, parseError(name, items.Line, fmt.Errorf("expected a list of images"))
+	}
+
+	entries := make([]line, 0, len(items.Content))
+	for _, item := range items.Content {
+		entry, err := decodeEntry(item)
+		if err == nil {
+			err = Validate(&entry)
+		}
+		if err != nil {
+			return nil, parseError(name, item.Line, err)
+		}
+		entries = append(entries, line{entry: entry, source: name, number: item.Line})
+	}
+
+	return entries, nil
+}
+
+// decodeEntry decodes a manifest entry, which is either an image reference
+// or a mapping of entry fields
+func decodeEntry(node *yaml.Node) (types.ImageEntry, error) {
+	var entry types.ImageEntry
+
+	switch node.Kind {
+	case yaml.ScalarNode:
+		entry.Image = node.Value
+	case yaml.MappingNode:
+		for i := 0; i < len(node.Content); i += 2 {
+			if key := node.Content[i].Value; !entryFields[key] {
+				return entry, fmt.Errorf("unknown field %q", key)
+			}
+		}
+		if err := node.Decode(&entry); err != nil {
+			return entry, err
+		}
+	default:
+		return entry, fmt.Errorf("expected an image reference or an image entry")
+	}
+
+	entry.Image = strings.TrimSpace(entry.Image)
+	return entry, nil
+}
+
+// Validate checks the image reference and overrides of an entry
+func Validate(entry *types.ImageEntry) error {
+	if entry.Image == "" {
+		return fmt.Errorf("image is required")
+	}
+	if _, err := reference.Parse(entry.Image); err != nil {
+		return err
+	}
+
+	if entry.Name != "" && !reference.ValidPath(entry.Name) {
+		return fmt.Errorf("invalid name %q", entry.Name)
+	}
+	if entry.Project != "" && !reference.ValidPath(entry.Project) {
+		return fmt.Errorf("invalid project %q", entry.Project)
+	}
+	if entry.Platform != "" && !ValidPlatform(entry.Platform) {
+		return fmt.Errorf("invalid platform %q, expected os/arch[/variant]", entry.Platform)
+	}
+	for _, tag := range entry.Tags {
+		if !reference.ValidTag(tag) {
+			return fmt.Errorf("invalid tag %q", tag)
+		}
+	}
+	for _, rule := range entry.TagRules {
+		if err := ValidateTagRule(&rule); err != nil {
+			return err
+		}
+	}
+	for _, action := range entry.Skip {
+		if !skipActions[action] {
+			return fmt.Errorf("invalid skip action %q, valid actions: pull, save, push", action)
+		}
+	}
+
+	return nil
+}
+
+// ValidateTagRule checks the match expression of a tag rule and that it
+// replaces or adds tags. Its templates are checked when it is applied.
+func ValidateTagRule(rule *types.TagRule) error {
+	if rule.Replace == "" && len(rule.Add) == 0 {
+		return fmt.Errorf("tag rule %q requires replace or add", rule.Match)
+	}
+	if _, err := regexp.Compile(rule.Match); err != nil {
+		return fmt.Errorf("invalid tag rule match %q: %w", rule.Match, err)
+	}
+	return nil
+}
+
+// ValidPlatform reports whether platform has the form os/arch[/variant]
+func ValidPlatform(platform string) bool {
+	return platformPattern.MatchString(platform)
+}
+
+// parseError creates the error returned for an invalid line of an image list
+func parseError(name string, line int, err error) error {
+	return errors.Wrap(err, errors.ErrImageParsing, fmt.Sprintf("%s:%d", name, line)).
+		WithContext("file", name).
+		WithContext("line", line)
+}
@@ -0,0 +1,125 @@
+package imagelist
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/types"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		data string
+		want []types.ImageEntry
+	}{
+		{"text", "images.txt", "# base images\nnginx:1.25\n\n  calico/node:v3.28.2  \n# done\n",
+			[]types.ImageEntry{{Image: "nginx:1.25"}, {Image: "calico/node:v3.28.2"}}},
+		{"text without extension", "images", "nginx:1.25\nregistry.k8s.io/pause:3.9\n",
+			[]types.ImageEntry{{Image: "nginx:1.25"}, {Image: "registry.k8s.io/pause:3.9"}}},
+		{"yaml by extension", "images.yaml", "- nginx:1.25\n",
+			[]types.ImageEntry{{Image: "nginx:1.25"}}},
+		{"yaml by content", "images.txt", "# manifest\nimages:\n  - nginx:1.25\n  - image: calico/node:v3.28.2\n    name: calico-node\n    project: network\n",
+			[]types.ImageEntry{{Image: "nginx:1.25"}, {Image: "calico/node:v3.28.2", Name: "calico-node", Project: "network"}}},
+		{"sequence by content", "-", "- nginx:1.25\n- image: redis:7\n  skip: [push]\n",
+			[]types.ImageEntry{{Image: "nginx:1.25"}, {Image: "redis:7", Skip: []string{"push"}}}},
+		{"document marker", "images", "---\nimages: [nginx:1.25]\n",
+			[]types.ImageEntry{{Image: "nginx:1.25"}}},
+		{"json", "images.json", `{"images": ["nginx:1.25", {"image": "redis:7", "platform": "linux/arm64/v8", "tags": ["stable"]}]}`,
+			[]types.ImageEntry{{Image: "nginx:1.25"}, {Image: "redis:7", Platform: "linux/arm64/v8", Tags: []string{"stable"}}}},
+		{"json by content", "images", `["nginx:1.25"]`,
+			[]types.ImageEntry{{Image: "nginx:1.25"}}},
+		{"tag rules", "images.yaml", "- image: app:v1.2.3\n  tag_rules:\n    - match: 'v(\\d+)\\..*'\n      add: [v$1]\n",
+			[]types.ImageEntry{{Image: "app:v1.2.3", TagRules: []types.TagRule{{Match: `v(\d+)\..*`, Add: []string{"v$1"}}}}}},
+		{"empty manifest", "images.yaml", "images:\n", nil},
+		{"empty text", "images.txt", "# nothing yet\n", nil},
+	}
+	for _, tt := range tests {
+		got, err := Parse([]byte(tt.data), tt.file, Options{})
+		if err != nil {
+			t.Errorf("%s: Parse failed: %v", tt.name, err)
+			continue
+		}
+		if len(got) == 0 && len(tt.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Parse = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		file string
+		data string
+		line int
+		want string
+	}{
+		{"images.txt", "nginx:1.25\n\nNginx:1.25\n", 3, "images.txt:3"},
+		{"images.yaml", "images:\n  - nginx:1.25\n  - image: redis:7\n    tag: stable\n", 3, `unknown field "tag"`},
+		{"images.yaml", "images: []\nregistry: harbor.local\n", 2, `unknown field "registry"`},
+		{"images.yaml", "- image: redis:7\n  skip: [copy]\n", 1, `invalid skip action "copy"`},
+		{"images.yaml", "- image: redis:7\n  platform: arm64\n", 1, `invalid platform "arm64"`},
+		{"images.yaml", "- image: redis:7\n  platform: linux/ARM64\n", 1, `invalid platform "linux/ARM64"`},
+		{"images.yaml", "- image: redis:7\n  tags: [-stable]\n", 1, `invalid tag "-stable"`},
+		{"images.yaml", "- image: redis:7\n  name: Redis\n", 1, `invalid name "Redis"`},
+		{"images.yaml", "- image: redis:7\n  project: /prod\n", 1, `invalid project "/prod"`},
+		{"images.yaml", "- image: redis:7\n  tag_rules: [{match: latest}]\n", 1, "requires replace or add"},
+		{"images.yaml", "- image: redis:7\n  tag_rules: [{match: '(', replace: x}]\n", 1, "invalid tag rule match"},
+		{"images.yaml", "- name: redis\n", 1, "image is required"},
+		{"images.yaml", "- [nginx]\n", 1, "expected an image reference or an image entry"},
+		{"images.yaml", "images: nginx\n", 1, "expected a list of images"},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.data), tt.file, Options{})
+		if err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", tt.data)
+			continue
+		}
+		if errors.GetCode(err) != errors.ErrImageParsing {
+			t.Errorf("Parse(%q) error code = %s, want IMAGE_PARSING", tt.data, errors.GetCode(err))
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) = %v, want an error containing %q", tt.data, err, tt.want)
+		}
+
+		herr := err.(*errors.HarpoonError)
+		if herr.Context["file"] != tt.file || herr.Context["line"] != tt.line {
+			t.Errorf("Parse(%q) error location = %v:%v, want %s:%d", tt.data, herr.Context["file"], herr.Context["line"], tt.file, tt.line)
+		}
+	}
+
+	if _, err := Parse([]byte("images: [nginx\n"), "images.yaml", Options{}); errors.GetCode(err) != errors.ErrImageParsing {
+		t.Errorf("Parse of invalid YAML = %v, want IMAGE_PARSING", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := types.ImageEntry{
+		Image:    "ghcr.io/org/app:v1",
+		Name:     "team/app",
+		Project:  "prod",
+		Platform: "linux/arm/v7",
+		Tags:     []string{"stable", "v1.0_rc"},
+		TagRules: []types.TagRule{{Replace: "$0-arm"}},
+		Skip:     []string{"pull", "save", "push"},
+	}
+	if err := Validate(&valid); err != nil {
+		t.Errorf("Validate(%+v) failed: %v", valid, err)
+	}
+
+	for _, platform := range []string{"linux/amd64", "windows/amd64", "linux/arm64/v8"} {
+		if !ValidPlatform(platform) {
+			t.Errorf("ValidPlatform(%q) = false, want true", platform)
+		}
+	}
+	for _, platform := range []string{"linux", "linux/", "linux/amd64/v1/x", "Linux/amd64", "linux amd64"} {
+		if ValidPlatform(platform) {
+			t.Errorf("ValidPlatform(%q) = true, want false", platform)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package imagelist
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/reference"
+	"github.com/harpoon/hpn/pkg/types"
+)
+
+// Stdin is the source name that reads an image list from standard input
+const Stdin = "-"
+
+// listExtensions are the file extensions read from a directory source
+var listExtensions = map[string]bool{
+	".txt":  true,
+	".list": true,
+	".yaml": true,
+	".yml":  true,
+	".json": true,
+}
+
+// List is the merged content of one or more image list sources
+type List struct {
+	Entries    []types.ImageEntry
+	Duplicates []Duplicate
+}
+
+// Duplicate is an entry that was dropped because an earlier source already
+// listed the same image with the same overrides
+type Duplicate struct {
+	Image       string `json:"image" yaml:"image"`
+	Source      string `json:"source" yaml:"source"`             // file:line of the dropped entry
+	DuplicateOf string `json:"duplicate_of" yaml:"duplicate_of"` // file:line of the kept entry
+}
+
+// ReadSources reads and merges image lists from files, directories and
+// standard input ("-"). Directories contribute their *.txt, *.list, *.yaml,
+// *.yml and *.json files in name order. Entries that repeat an earlier image
+// with the same overrides are dropped and reported as duplicates; references
+// are compared in normalized form, so nginx and docker.io/library/nginx:latest
+// are the same image. Variables and directives are expanded with opts.
+func ReadSources(sources []string, stdin io.Reader, opts Options) (*List, error) {
+	r, err := newReader(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &List{}
+	seen := make(map[string]string)
+	stdinRead := false
+
+	add := func(lines []line) {
+		for _, l := range lines {
+			location := fmt.Sprintf("%s:%d", l.source, l.number)
+			key := entryKey(&l.entry)
+			if first, ok := seen[key]; ok {
+				list.Duplicates = append(list.Duplicates, Duplicate{
+					Image:       l.entry.Image,
+					Source:      location,
+					DuplicateOf: first,
+				})
+				continue
+			}
+			seen[key] = location
+			list.Entries = append(list.Entries, l.entry)
+		}
+	}
+
+	for _, source := range sources {
+		if source == Stdin {
+			if stdinRead {
+				return nil, errors.New(errors.ErrInvalidArgument, "standard input can only be read once")
+			}
+			stdinRead = true
+
+			data, err := io.ReadAll(stdin)
+			if err != nil {
+				return nil, errors.Wrap(err, errors.ErrFileOperation, "failed to read image list from standard input")
+			}
+			// Lists on stdin include files relative to the working directory
+			lines, err := r.read(data, "<stdin>", ".")
+			if err != nil {
+				return nil, err
+			}
+			add(lines)
+			continue
+		}
+
+		files, err := sourceFiles(source)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			lines, err := r.readFile(file)
+			if err != nil {
+				return nil, err
+			}
+			add(lines)
+		}
+	}
+
+	return list, nil
+}
+
+// sourceFiles returns the list files of a file or directory source
+func sourceFiles(source string) ([]string, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrFileNotFound, fmt.Sprintf("failed to open file %s", source))
+	}
+	if !info.IsDir() {
+		return []string{source}, nil
+	}
+
+	dirEntries, err := os.ReadDir(source)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrFileOperation, fmt.Sprintf("failed to read directory %s", source))
+	}
+
+	var files []string
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if dirEntry.IsDir() || strings.HasPrefix(name, ".") || !listExtensions[strings.ToLower(filepath.Ext(name))] {
+			continue
+		}
+		files = append(files, filepath.Join(source, name))
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// entryKey identifies an entry for de-duplication: its normalized reference
+// and overrides
+func entryKey(entry *types.ImageEntry) string {
+	image := entry.Image
+	if ref, err := reference.Parse(entry.Image); err == nil {
+		image = ref.Name() + ":" + ref.TagOrDefault() + "@" + ref.Digest
+	}
+
+	return strings.Join([]string{
+		image,
+		entry.Name,
+		entry.Project,
+		entry.Platform,
+		strings.Join(entry.Tags, ","),
+		fmt.Sprint(entry.TagRules),
+		strings.Join(entry.Skip, ","),
+	}, "|")
+}
@@ -0,0 +1,117 @@
+package imagelist
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/types"
+)
+
+// writeFiles writes files relative to dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadSources(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"base.txt":           "nginx\nredis:7\n",
+		"lists/b.yaml":       "- docker.io/library/nginx:latest\n- image: redis:7\n  platform: linux/arm64\n",
+		"lists/a.txt":        "calico/node:v3.28.2\n",
+		"lists/notes.md":     "not-a-list\n",
+		"lists/.hidden.txt":  "hidden:1\n",
+		"lists/nested/c.txt": "nested:1\n",
+	})
+	stdin := strings.NewReader("index.docker.io/library/redis:7\nbusybox\n")
+
+	list, err := ReadSources([]string{filepath.Join(dir, "base.txt"), filepath.Join(dir, "lists"), Stdin}, stdin, Options{})
+	if err != nil {
+		t.Fatalf("ReadSources failed: %v", err)
+	}
+
+	want := []types.ImageEntry{
+		{Image: "nginx"},
+		{Image: "redis:7"},
+		{Image: "calico/node:v3.28.2"},
+		{Image: "redis:7", Platform: "linux/arm64"},
+		{Image: "busybox"},
+	}
+	if !reflect.DeepEqual(list.Entries, want) {
+		t.Errorf("entries = %+v, want %+v", list.Entries, want)
+	}
+
+	wantDuplicates := []Duplicate{
+		{Image: "docker.io/library/nginx:latest", Source: filepath.Join(dir, "lists", "b.yaml") + ":1", DuplicateOf: filepath.Join(dir, "base.txt") + ":1"},
+		{Image: "index.docker.io/library/redis:7", Source: "<stdin>:1", DuplicateOf: filepath.Join(dir, "base.txt") + ":2"},
+	}
+	if !reflect.DeepEqual(list.Duplicates, wantDuplicates) {
+		t.Errorf("duplicates = %+v, want %+v", list.Duplicates, wantDuplicates)
+	}
+}
+
+func TestReadSourcesErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"bad.txt": "nginx\nNGINX\n"})
+
+	if _, err := ReadSources([]string{Stdin, Stdin}, strings.NewReader("nginx\n"), Options{}); errors.GetCode(err) != errors.ErrInvalidArgument {
+		t.Errorf("reading stdin twice = %v, want INVALID_ARGUMENT", err)
+	}
+	if _, err := ReadSources([]string{filepath.Join(dir, "missing.txt")}, nil, Options{}); errors.GetCode(err) != errors.ErrFileNotFound {
+		t.Errorf("reading a missing file = %v, want FILE_NOT_FOUND", err)
+	}
+	_, err := ReadSources([]string{filepath.Join(dir, "bad.txt")}, nil, Options{})
+	if errors.GetCode(err) != errors.ErrImageParsing || !strings.Contains(err.Error(), "bad.txt:2") {
+		t.Errorf("reading an invalid list = %v, want IMAGE_PARSING at bad.txt:2", err)
+	}
+}
+
+func TestEntryKey(t *testing.T) {
+	const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	same := [][]types.ImageEntry{
+		{{Image: "nginx"}, {Image: "nginx:latest"}, {Image: "library/nginx"}, {Image: "docker.io/library/nginx:latest"}, {Image: "index.docker.io/library/nginx"}},
+		{{Image: "calico/node:v3.28.2"}, {Image: "docker.io/calico/node:v3.28.2"}},
+		{{Image: "nginx@" + digest}, {Image: "docker.io/library/nginx@" + digest}},
+		{{Image: "nginx", Tags: []string{"a", "b"}}, {Image: "nginx:latest", Tags: []string{"a", "b"}}},
+	}
+	for _, group := range same {
+		for _, entry := range group[1:] {
+			if entryKey(&entry) != entryKey(&group[0]) {
+				t.Errorf("entryKey(%+v) = %q, want the key of %+v, %q", entry, entryKey(&entry), group[0], entryKey(&group[0]))
+			}
+		}
+	}
+
+	different := []types.ImageEntry{
+		{Image: "nginx"},
+		{Image: "nginx:1.25"},
+		{Image: "nginx:1.25@" + digest},
+		{Image: "ghcr.io/library/nginx"},
+		{Image: "nginx", Name: "web"},
+		{Image: "nginx", Project: "prod"},
+		{Image: "nginx", Platform: "linux/arm64"},
+		{Image: "nginx", Tags: []string{"stable"}},
+		{Image: "nginx", TagRules: []types.TagRule{{Replace: "$0-arm64"}}},
+		{Image: "nginx", Skip: []string{"push"}},
+	}
+	keys := make(map[string]types.ImageEntry)
+	for _, entry := range different {
+		key := entryKey(&entry)
+		if other, ok := keys[key]; ok {
+			t.Errorf("entryKey(%+v) equals the key of %+v", entry, other)
+		}
+		keys[key] = entry
+	}
+}
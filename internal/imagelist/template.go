@@ -0,0 +1,297 @@
+package imagelist
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/harpoon/hpn/pkg/errors"
+)
+
+// Options control how image lists are read
+type Options struct {
+	// Variables are substituted for ${NAME} and tested by #!if directives.
+	// Names are case-insensitive. ARCH and OS default to the host platform.
+	Variables map[string]string
+}
+
+// variableName matches a valid variable name
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// variableReference matches ${NAME} and ${NAME:-default}
+var variableReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// ValidVariable reports whether name is a valid variable name
+func ValidVariable(name string) bool {
+	return variableName.MatchString(name)
+}
+
+// include is an #!include directive of an image list
+type include struct {
+	path   string
+	number int
+}
+
+// condition is an open #!if directive
+type condition struct {
+	parent bool // whether the enclosing section is active
+	result bool
+	inElse bool
+	number int
+}
+
+// reader reads image lists, expanding variables, conditions and includes
+type reader struct {
+	variables map[string]string
+	files     []string // files being read, to detect include cycles
+}
+
+// newReader creates a reader with the variables of opts
+func newReader(opts Options) (*reader, error) {
+	r := &reader{variables: map[string]string{
+		"ARCH": runtime.GOARCH,
+		"OS":   runtime.GOOS,
+	}}
+	for name, value := range opts.Variables {
+		if !ValidVariable(name) {
+			return nil, errors.New(errors.ErrInvalidArgument, fmt.Sprintf("invalid variable name %q", name))
+		}
+		r.variables[strings.ToUpper(name)] = value
+	}
+	return r, nil
+}
+
+// readFile reads the image list in file
+func (r *reader) readFile(file string) ([]line, error) {
+	path, err := filepath.Abs(file)
+	if err != nil {
+		path = file
+	}
+	for _, open := range r.files {
+		if open == path {
+			return nil, errors.New(errors.ErrImageParsing, fmt.Sprintf("%s is included recursively", file))
+		}
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrFileOperation, fmt.Sprintf("failed to open file %s", file))
+	}
+
+	r.files = append(r.files, path)
+	defer func() { r.files = r.files[:len(r.files)-1] }()
+
+	return r.read(data, file, filepath.Dir(file))
+}
+
+// read parses an image list after expanding its directives. Included lists
+// are resolved relative to dir and their entries take the place of the
+// #!include line.
+func (r *reader) read(data []byte, name, dir string) ([]line, error) {
+	expanded, includes, err := r.expand(data, name)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := parse(expanded, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(includes) == 0 {
+		return lines, nil
+	}
+
+	merged := make([]line, 0, len(lines))
+	for _, inc := range includes {
+		for len(lines) > 0 && lines[0].number < inc.number {
+			merged = append(merged, lines[0])
+			lines = lines[1:]
+		}
+
+		path := inc.path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		files, err := sourceFiles(path)
+		if err != nil {
+			return nil, parseError(name, inc.number, err)
+		}
+		for _, file := range files {
+			included, err := r.readFile(file)
+			if err != nil {
+				return nil, parseError(name, inc.number, err)
+			}
+			merged = append(merged, included...)
+		}
+	}
+
+	return append(merged, lines...), nil
+}
+
+// expand substitutes variables and evaluates directives. Directive lines and
+// lines of inactive sections are blanked so line numbers stay unchanged.
+func (r *reader) expand(data []byte, name string) ([]byte, []include, error) {
+	var out bytes.Buffer
+	var includes []include
+	var conditions []condition
+
+	active := func() bool {
+		return len(conditions) == 0 || (conditions[len(conditions)-1].parent && conditions[len(conditions)-1].result)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	number := 0
+	for scanner.Scan() {
+		number++
+		text := scanner.Text()
+
+		directive, arg, ok := parseDirective(text)
+		if !ok {
+			switch {
+			case !active():
+				text = ""
+			case !strings.HasPrefix(strings.TrimSpace(text), "#"):
+				expanded, err := r.substitute(text)
+				if err != nil {
+					return nil, nil, parseError(name, number, err)
+				}
+				text = expanded
+			}
+			out.WriteString(text)
+			out.WriteByte('\n')
+			continue
+		}
+
+		// Directives are blanked out of the parsed list
+		out.WriteByte('\n')
+
+		switch directive {
+		case "include":
+			if !active() {
+				continue
+			}
+			path, err := r.substitute(arg)
+			if err == nil && path == "" {
+				err = fmt.Errorf("#!include requires a path")
+			}
+			if err != nil {
+				return nil, nil, parseError(name, number, err)
+			}
+			includes = append(includes, include{path: path, number: number})
+
+		case "if":
+			parent := active()
+			result, err := r.evaluate(arg)
+			if err != nil {
+				return nil, nil, parseError(name, number, err)
+			}
+			conditions = append(conditions, condition{parent: parent, result: result, number: number})
+
+		case "else":
+			if len(conditions) == 0 || conditions[len(conditions)-1].inElse {
+				return nil, nil, parseError(name, number, fmt.Errorf("#!else without #!if"))
+			}
+			top := &conditions[len(conditions)-1]
+			top.result = !top.result
+			top.inElse = true
+
+		case "endif":
+			if len(conditions) == 0 {
+				return nil, nil, parseError(name, number, fmt.Errorf("#!endif without #!if"))
+			}
+			conditions = conditions[:len(conditions)-1]
+
+		default:
+			return nil, nil, parseError(name, number, fmt.Errorf("unknown directive #!%s, expected #!include, #!if, #!else or #!endif", directive))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, errors.Wrap(err, errors.ErrFileOperation, fmt.Sprintf("error reading %s", name))
+	}
+	if len(conditions) > 0 {
+		return nil, nil, parseError(name, conditions[len(conditions)-1].number, fmt.Errorf("#!if without #!endif"))
+	}
+
+	return out.Bytes(), includes, nil
+}
+
+// directivePrefix starts directive lines. Plain "#" lines are comments, even
+// if they start with a directive name, like "#include these for prod".
+const directivePrefix = "#!"
+
+// parseDirective splits a directive line into its name and argument
+func parseDirective(text string) (string, string, bool) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, directivePrefix) {
+		return "", "", false
+	}
+
+	directive, arg, _ := strings.Cut(text[len(directivePrefix):], " ")
+	return directive, strings.TrimSpace(arg), true
+}
+
+// substitute replaces the variable references in text
+func (r *reader) substitute(text string) (string, error) {
+	var err error
+	expanded := variableReference.ReplaceAllStringFunc(text, func(match string) string {
+		groups := variableReference.FindStringSubmatch(match)
+		if value, ok := r.variables[strings.ToUpper(groups[1])]; ok {
+			return value
+		}
+		if strings.Contains(match, ":-") {
+			return groups[2]
+		}
+		if err == nil {
+			err = fmt.Errorf("undefined variable %s", groups[1])
+		}
+		return match
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if strings.Contains(expanded, "${") {
+		return "", fmt.Errorf("invalid variable reference in %q", text)
+	}
+	return expanded, nil
+}
+
+// evaluate evaluates the condition of an #!if directive: NAME (set and not
+// empty), NAME=value[,value...] or NAME!=value[,value...]. The values may
+// reference variables.
+func (r *reader) evaluate(expr string) (bool, error) {
+	expr, err := r.substitute(expr)
+	if err != nil {
+		return false, err
+	}
+
+	name, values, negate := expr, "", false
+	if i := strings.Index(expr, "!="); i >= 0 {
+		name, values, negate = expr[:i], expr[i+2:], true
+	} else if i := strings.Index(expr, "="); i >= 0 {
+		name, values = expr[:i], expr[i+1:]
+	}
+
+	name = strings.TrimSpace(name)
+	if !ValidVariable(name) {
+		return false, fmt.Errorf("invalid condition %q, expected NAME, NAME=value or NAME!=value", expr)
+	}
+	value := r.variables[strings.ToUpper(name)]
+
+	if values == "" && !strings.Contains(expr, "=") {
+		return value != "", nil
+	}
+
+	for _, candidate := range strings.Split(values, ",") {
+		if strings.TrimSpace(candidate) == value {
+			return !negate, nil
+		}
+	}
+	return negate, nil
+}
@@ -0,0 +1,191 @@
+package imagelist
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/types"
+)
+
+// images returns the image references of entries
+func images(entries []types.ImageEntry) []string {
+	refs := make([]string, len(entries))
+	for i, entry := range entries {
+		refs[i] = entry.Image
+	}
+	return refs
+}
+
+func TestTemplateVariables(t *testing.T) {
+	variables := map[string]string{"k8s_version": "v1.30.2", "Registry": "mirror.local", "EMPTY": ""}
+	tests := []struct {
+		data string
+		want []string
+	}{
+		{"registry.k8s.io/kube-apiserver:${K8S_VERSION}\n", []string{"registry.k8s.io/kube-apiserver:v1.30.2"}},
+		{"${registry}/app:${TAG:-latest}\n", []string{"mirror.local/app:latest"}},
+		{"app:${EMPTY:-default}\n", nil}, // set but empty: the default does not apply
+		{"app:${MISSING:-1.0}-${K8S_VERSION}\n", []string{"app:1.0-v1.30.2"}},
+		{"# ${UNDEFINED} in a comment\napp:1\n", []string{"app:1"}},
+		{"app-${ARCH:-x}:1\n", []string{"app-arm64:1"}},
+	}
+	for _, tt := range tests {
+		opts := Options{Variables: map[string]string{"ARCH": "arm64"}}
+		for name, value := range variables {
+			opts.Variables[name] = value
+		}
+		entries, err := Parse([]byte(tt.data), "images.txt", opts)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("Parse(%q) = %v, want an error", tt.data, images(entries))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.data, err)
+			continue
+		}
+		if got := images(entries); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+
+	if _, err := newReader(Options{Variables: map[string]string{"1BAD": "x"}}); errors.GetCode(err) != errors.ErrInvalidArgument {
+		t.Errorf("newReader with an invalid variable name = %v, want INVALID_ARGUMENT", err)
+	}
+}
+
+func TestTemplateConditions(t *testing.T) {
+	const list = `common:1
+#!if ARCH=arm64
+arm:1
+#!if GPU
+arm-gpu:1
+#!else
+arm-cpu:1
+#!endif
+#!else
+#!if OS!=linux,darwin
+other:1
+#!endif
+x86:1
+#!endif
+#!if CHANNEL=stable, lts
+stable:1
+#!endif
+last:1
+`
+	tests := []struct {
+		variables map[string]string
+		want      []string
+	}{
+		{map[string]string{"ARCH": "arm64", "GPU": "1"}, []string{"common:1", "arm:1", "arm-gpu:1", "last:1"}},
+		{map[string]string{"ARCH": "arm64", "GPU": ""}, []string{"common:1", "arm:1", "arm-cpu:1", "last:1"}},
+		{map[string]string{"ARCH": "amd64", "OS": "linux", "GPU": "1"}, []string{"common:1", "x86:1", "last:1"}},
+		{map[string]string{"ARCH": "amd64", "OS": "windows", "CHANNEL": "lts"}, []string{"common:1", "other:1", "x86:1", "stable:1", "last:1"}},
+	}
+	for _, tt := range tests {
+		entries, err := Parse([]byte(list), "images.txt", Options{Variables: tt.variables})
+		if err != nil {
+			t.Errorf("Parse with %v failed: %v", tt.variables, err)
+			continue
+		}
+		if got := images(entries); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse with %v = %v, want %v", tt.variables, got, tt.want)
+		}
+	}
+
+	// Line numbers are kept across blanked directives and sections
+	_, err := Parse([]byte("#!if ARCH=amd64\nskipped:1\n#!endif\nBAD\n"), "images.txt", Options{Variables: map[string]string{"ARCH": "arm64"}})
+	if err == nil || !strings.Contains(err.Error(), "images.txt:4") {
+		t.Errorf("Parse of an invalid image after a condition = %v, want an error at images.txt:4", err)
+	}
+}
+
+func TestTemplateComments(t *testing.T) {
+	// Comments that merely start like a directive are not directives
+	const comments = "#include these for prod\n#if needed\n#else\n#endif of the list\n"
+	tests := []struct {
+		file string
+		data string
+	}{
+		{"images.txt", comments + "nginx:1.25\n# redis:7\n"},
+		{"images.yaml", comments + "images:\n  #if arm64\n  - nginx:1.25\n  #endif\n"},
+	}
+	for _, tt := range tests {
+		entries, err := Parse([]byte(tt.data), tt.file, Options{})
+		if err != nil {
+			t.Errorf("Parse(%s) failed: %v", tt.file, err)
+			continue
+		}
+		if got := images(entries); !reflect.DeepEqual(got, []string{"nginx:1.25"}) {
+			t.Errorf("Parse(%s) = %v, want [nginx:1.25]", tt.file, got)
+		}
+	}
+}
+
+func TestTemplateIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.txt":           "first:1\n#!include base.txt\n#!include ${TEAM}/\nlast:1\n",
+		"base.txt":           "base:1\n#!include common/shared.yaml\n",
+		"common/shared.yaml": "- shared:1\n",
+		"web/a.txt":          "web-a:1\n",
+		"web/b.txt":          "web-b:1\n",
+		"cycle/a.txt":        "a:1\n#!include b.txt\n",
+		"cycle/b.txt":        "b:1\n#!include a.txt\n",
+		"self.txt":           "#!include self.txt\n",
+		"missing.txt":        "ok:1\n#!include nowhere.txt\n",
+	})
+
+	list, err := ReadSources([]string{filepath.Join(dir, "main.txt")}, nil, Options{Variables: map[string]string{"TEAM": "web"}})
+	if err != nil {
+		t.Fatalf("ReadSources failed: %v", err)
+	}
+	want := []string{"first:1", "base:1", "shared:1", "web-a:1", "web-b:1", "last:1"}
+	if got := images(list.Entries); !reflect.DeepEqual(got, want) {
+		t.Errorf("included entries = %v, want %v", got, want)
+	}
+
+	for _, tt := range []struct {
+		file string
+		want string
+	}{
+		{"cycle/a.txt", "included recursively"},
+		{"self.txt", "included recursively"},
+		{"missing.txt", "missing.txt:2"},
+	} {
+		_, err := ReadSources([]string{filepath.Join(dir, tt.file)}, nil, Options{})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("reading %s = %v, want an error containing %q", tt.file, err, tt.want)
+		}
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"app:${VERSION}\n", "images.txt:1: undefined variable VERSION"},
+		{"app:1\napp:${VERSION\n", "images.txt:2: invalid variable reference"},
+		{"#!if ARCH=amd64\napp:1\n", "images.txt:1: #!if without #!endif"},
+		{"#!if ARCH=amd64\n#!if GPU\napp:1\n#!endif\n", "images.txt:1: #!if without #!endif"},
+		{"app:1\n#!endif\n", "images.txt:2: #!endif without #!if"},
+		{"#!else\n", "images.txt:1: #!else without #!if"},
+		{"#!if GPU\n#!else\n#!else\n#!endif\n", "images.txt:3: #!else without #!if"},
+		{"#!if 1ARCH=amd64\n#!endif\n", "images.txt:1: invalid condition"},
+		{"#!if ${UNSET}\n#!endif\n", "images.txt:1: undefined variable UNSET"},
+		{"#!include\n", "images.txt:1: #!include requires a path"},
+		{"#!ifdef GPU\n#!endif\n", "images.txt:1: unknown directive #!ifdef"},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.data), "images.txt", Options{})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) = %v, want an error containing %q", tt.data, err, tt.want)
+		}
+	}
+}
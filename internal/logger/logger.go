@@ -0,0 +1,342 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default rotation settings for file output
+const (
+	defaultMaxSize    = 10 * 1024 * 1024 // 10 MiB
+	defaultMaxBackups = 3
+)
+
+// ANSI color codes per level
+var levelColors = map[LogLevel]string{
+	DebugLevel: "\033[36m", // cyan
+	InfoLevel:  "\033[32m", // green
+	WarnLevel:  "\033[33m", // yellow
+	ErrorLevel: "\033[31m", // red
+}
+
+const colorReset = "\033[0m"
+
+// Options configures a logger
+type Options struct {
+	Level      LogLevel
+	Format     string // "text" or "json"
+	File       string // optional log file path
+	MaxSize    int64  // rotate the log file once it exceeds this many bytes
+	MaxBackups int    // number of rotated log files to keep
+	Console    bool   // write to the console writer
+	Timestamp  bool   // include timestamps
+	Colors     bool   // colorize levels on the console
+	Writer     io.Writer
+}
+
+// sink is a destination of formatted log entries
+type sink struct {
+	w      io.Writer
+	colors bool
+}
+
+// core holds the state shared by a logger and all loggers derived from it
+type core struct {
+	mu        sync.Mutex
+	level     LogLevel
+	json      bool
+	timestamp bool
+	sinks     []sink
+	closers   []io.Closer
+}
+
+// logger implements Logger
+type logger struct {
+	core   *core
+	fields []Field
+}
+
+// New creates a logger writing to the console and/or a rotating log file
+func New(opts Options) (Logger, error) {
+	c := &core{
+		level:     opts.Level,
+		json:      opts.Format == "json",
+		timestamp: opts.Timestamp,
+	}
+
+	if opts.Console {
+		w := opts.Writer
+		if w == nil {
+			w = os.Stderr
+		}
+		c.sinks = append(c.sinks, sink{w: w, colors: opts.Colors && !c.json})
+	}
+
+	if opts.File != "" {
+		f, err := newRotatingFile(opts.File, opts.MaxSize, opts.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		c.sinks = append(c.sinks, sink{w: f})
+		c.closers = append(c.closers, f)
+	}
+
+	return &logger{core: c}, nil
+}
+
+// Nop returns a logger that discards all messages
+func Nop() Logger {
+	return &logger{core: &core{level: ErrorLevel + 1}}
+}
+
+// Close closes the log file of a logger created by New, if any
+func Close(l Logger) error {
+	lg, ok := l.(*logger)
+	if !ok {
+		return nil
+	}
+
+	lg.core.mu.Lock()
+	defer lg.core.mu.Unlock()
+
+	var firstErr error
+	for _, c := range lg.core.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	lg.core.closers = nil
+	lg.core.sinks = nil
+	return firstErr
+}
+
+// Debug logs a debug message
+func (l *logger) Debug(msg string, fields ...Field) { l.log(DebugLevel, msg, fields) }
+
+// Info logs an info message
+func (l *logger) Info(msg string, fields ...Field) { l.log(InfoLevel, msg, fields) }
+
+// Warn logs a warning message
+func (l *logger) Warn(msg string, fields ...Field) { l.log(WarnLevel, msg, fields) }
+
+// Error logs an error message
+func (l *logger) Error(msg string, fields ...Field) { l.log(ErrorLevel, msg, fields) }
+
+// WithFields returns a logger with additional fields
+func (l *logger) WithFields(fields ...Field) Logger {
+	combined := make([]Field, 0, len(l.fields)+len(fields))
+	combined = append(combined, l.fields...)
+	combined = append(combined, fields...)
+	return &logger{core: l.core, fields: combined}
+}
+
+// WithContext returns a logger with the fields stored in ctx
+func (l *logger) WithContext(ctx context.Context) Logger {
+	fields := FieldsFromContext(ctx)
+	if len(fields) == 0 {
+		return l
+	}
+	return l.WithFields(fields...)
+}
+
+// log formats and writes an entry to all sinks
+func (l *logger) log(level LogLevel, msg string, fields []Field) {
+	if level < l.core.level {
+		return
+	}
+
+	all := l.fields
+	if len(fields) > 0 {
+		all = append(append(make([]Field, 0, len(l.fields)+len(fields)), l.fields...), fields...)
+	}
+
+	now := time.Now()
+
+	l.core.mu.Lock()
+	defer l.core.mu.Unlock()
+
+	for _, s := range l.core.sinks {
+		var line string
+		if l.core.json {
+			line = l.core.formatJSON(now, level, msg, all)
+		} else {
+			line = l.core.formatText(now, level, msg, all, s.colors)
+		}
+		io.WriteString(s.w, line)
+	}
+}
+
+// formatText formats an entry as a single human readable line
+func (c *core) formatText(now time.Time, level LogLevel, msg string, fields []Field, colors bool) string {
+	var b strings.Builder
+
+	if c.timestamp {
+		b.WriteString(now.Format(time.RFC3339))
+		b.WriteByte(' ')
+	}
+
+	name := fmt.Sprintf("%-5s", strings.ToUpper(level.String()))
+	if colors {
+		name = levelColors[level] + name + colorReset
+	}
+	b.WriteString(name)
+	b.WriteByte(' ')
+	b.WriteString(msg)
+
+	for _, f := range fields {
+		b.WriteByte(' ')
+		b.WriteString(f.Key)
+		b.WriteByte('=')
+		value := fmt.Sprint(f.Value)
+		if strings.ContainsAny(value, " \t\n\"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		b.WriteString(value)
+	}
+
+	b.WriteByte('\n')
+	return b.String()
+}
+
+// formatJSON formats an entry as a JSON object on a single line
+func (c *core) formatJSON(now time.Time, level LogLevel, msg string, fields []Field) string {
+	entry := make(map[string]interface{}, len(fields)+3)
+	for _, f := range fields {
+		if err, ok := f.Value.(error); ok {
+			entry[f.Key] = err.Error()
+		} else {
+			entry[f.Key] = f.Value
+		}
+	}
+	if c.timestamp {
+		entry["time"] = now.Format(time.RFC3339Nano)
+	}
+	entry["level"] = level.String()
+	entry["msg"] = msg
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		// Fall back to string values for fields that cannot be encoded
+		for k, v := range entry {
+			entry[k] = fmt.Sprint(v)
+		}
+		data, _ = json.Marshal(entry)
+	}
+	return string(data) + "\n"
+}
+
+// F creates a field
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err creates an "error" field
+func Err(err error) Field {
+	return Field{Key: "error", Value: err}
+}
+
+type fieldsKey struct{}
+
+// ContextWithFields returns a context carrying fields that are added to
+// loggers derived with WithContext
+func ContextWithFields(ctx context.Context, fields ...Field) context.Context {
+	existing := FieldsFromContext(ctx)
+	combined := append(append(make([]Field, 0, len(existing)+len(fields)), existing...), fields...)
+	return context.WithValue(ctx, fieldsKey{}, combined)
+}
+
+// FieldsFromContext returns the logging fields stored in ctx
+func FieldsFromContext(ctx context.Context) []Field {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey{}).([]Field)
+	return fields
+}
+
+// rotatingFile is an append-only log file that is rotated by size
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// newRotatingFile opens path for appending
+func newRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	if maxSize <= 0 {
+		maxSize = defaultMaxSize
+	}
+	if maxBackups < 0 {
+		maxBackups = defaultMaxBackups
+	}
+
+	r := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens the current log file
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file %s: %v", r.path, err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat log file %s: %v", r.path, err)
+	}
+
+	r.file = f
+	r.size = info.Size()
+	return nil
+}
+
+// Write appends p, rotating the file first if it would exceed the maximum size
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate shifts path.N to path.N+1, moves the current file to path.1 and
+// opens a new file. The oldest backup beyond maxBackups is removed.
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+
+	if r.maxBackups == 0 {
+		os.Remove(r.path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", r.path, r.maxBackups))
+		for i := r.maxBackups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+		}
+		os.Rename(r.path, r.path+".1")
+	}
+
+	return r.open()
+}
+
+// Close closes the log file
+func (r *rotatingFile) Close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,207 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTextFormat(t *testing.T) {
+	var out strings.Builder
+	log, err := New(Options{Level: InfoLevel, Format: "text", Console: true, Writer: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := ContextWithFields(context.Background(), F("operation", "push"))
+	log = log.WithContext(ctx).WithFields(F("item", "nginx:1.25"))
+	log.Debug("Starting worker")
+	log.Info("Pushed image", F("target", "harbor.local/nginx:1.25"), F("attempts", 2))
+	log.Warn("Retrying operation", F("delay", 1500*time.Millisecond), Err(fmt.Errorf(`lookup "harbor.local": no such host`)))
+
+	want := "INFO  Pushed image operation=push item=nginx:1.25 target=harbor.local/nginx:1.25 attempts=2\n" +
+		`WARN  Retrying operation operation=push item=nginx:1.25 delay=1.5s error="lookup \"harbor.local\": no such host"` + "\n"
+	if out.String() != want {
+		t.Errorf("text output =\n%s\nwant\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	colored, err := New(Options{Level: DebugLevel, Console: true, Colors: true, Timestamp: true, Writer: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	colored.Error("Push failed")
+	line := out.String()
+	stamp, rest, _ := strings.Cut(line, " ")
+	if _, err := time.Parse(time.RFC3339, stamp); err != nil {
+		t.Errorf("text line %q does not start with an RFC 3339 timestamp: %v", line, err)
+	}
+	if rest != "\033[31mERROR\033[0m Push failed\n" {
+		t.Errorf("colored line = %q, want a red ERROR level", rest)
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	var out strings.Builder
+	log, err := New(Options{Level: WarnLevel, Format: "json", Console: true, Colors: true, Timestamp: true, Writer: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.Info("Pulled image")
+	log.WithFields(F("item", "nginx:1.25")).Error("Pull failed", F("attempt", 3), Err(fmt.Errorf("manifest unknown")), F("done", make(chan int)))
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("json output has %d lines, want 1:\n%s", len(lines), out.String())
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("json line %q: %v", lines[0], err)
+	}
+	stamp, _ := entry["time"].(string)
+	if _, err := time.Parse(time.RFC3339Nano, stamp); err != nil {
+		t.Errorf("time = %q, want an RFC 3339 timestamp", entry["time"])
+	}
+	delete(entry, "time")
+
+	// A field that cannot be encoded turns every value into a string
+	want := map[string]interface{}{
+		"level":   "error",
+		"msg":     "Pull failed",
+		"item":    "nginx:1.25",
+		"attempt": "3",
+		"error":   "manifest unknown",
+	}
+	done, _ := entry["done"].(string)
+	delete(entry, "done")
+	if !reflect.DeepEqual(entry, want) || !strings.HasPrefix(done, "0x") {
+		t.Errorf("json entry = %v (done %q), want %v", entry, done, want)
+	}
+
+	out.Reset()
+	log.WithFields(F("attempt", 3)).Warn("Retrying", Err(fmt.Errorf("timeout")))
+	if got := out.String(); !strings.HasPrefix(got, `{"attempt":3,"error":"timeout","level":"warn","msg":"Retrying","time":"`) {
+		t.Errorf("json line = %q, want fields, level, msg and time in key order", got)
+	}
+}
+
+// logLine returns a message logged as a text line of exactly 40 bytes
+func logLine(i int) string {
+	return fmt.Sprintf("line %02d %s", i, strings.Repeat("x", 25))
+}
+
+// readLog returns the messages in a log file, or nil if it does not exist
+func readLog(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []string
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		messages = append(messages, strings.TrimPrefix(line, "INFO  "))
+	}
+	return messages
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hpn.log")
+	open := func() Logger {
+		log, err := New(Options{Level: InfoLevel, File: path, MaxSize: 100, MaxBackups: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return log
+	}
+
+	// Two 40 byte lines fit below the 100 byte limit, the third rotates
+	log := open()
+	for i := 1; i <= 10; i++ {
+		log.Info(logLine(i))
+	}
+	if err := Close(log); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		path:        {logLine(9), logLine(10)},
+		path + ".1": {logLine(7), logLine(8)},
+		path + ".2": {logLine(5), logLine(6)},
+		path + ".3": nil,
+	}
+	for file, lines := range want {
+		if got := readLog(t, file); !reflect.DeepEqual(got, lines) {
+			t.Errorf("%s = %q, want %q", filepath.Base(file), got, lines)
+		}
+	}
+
+	// A reopened file keeps its size and rotates on the next line
+	log = open()
+	log.Info(logLine(11))
+	Close(log)
+	want = map[string][]string{
+		path:        {logLine(11)},
+		path + ".1": {logLine(9), logLine(10)},
+		path + ".2": {logLine(7), logLine(8)},
+	}
+	for file, lines := range want {
+		if got := readLog(t, file); !reflect.DeepEqual(got, lines) {
+			t.Errorf("after reopening, %s = %q, want %q", filepath.Base(file), got, lines)
+		}
+	}
+
+	// Messages after Close are dropped
+	log.Info(logLine(12))
+	if got := readLog(t, path); len(got) != 1 {
+		t.Errorf("log after Close = %q, want only %q", got, logLine(11))
+	}
+}
+
+func TestRotatingFileWithoutBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hpn.log")
+	log, err := New(Options{Level: InfoLevel, File: path, MaxSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 5; i++ {
+		log.Info(logLine(i))
+	}
+	Close(log)
+
+	if got := readLog(t, path); !reflect.DeepEqual(got, []string{logLine(5)}) {
+		t.Errorf("log = %q, want only the last line", got)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("log directory has %d files, want no backups", len(entries))
+	}
+
+	// A single entry larger than the limit is written to an empty file
+	r, err := newRotatingFile(filepath.Join(dir, "big.log"), 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if n, err := r.Write([]byte(logLine(1) + "\n")); n != 34 || err != nil {
+		t.Errorf("Write of an oversized entry = %d, %v, want 34 bytes", n, err)
+	}
+
+	if _, err := New(Options{File: filepath.Join(dir, "missing", "hpn.log")}); err == nil {
+		t.Error("New with a log file in a missing directory succeeded, want an error")
+	}
+}
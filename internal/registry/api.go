@@ -0,0 +1,310 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/harpoon/hpn/internal/logger"
+	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/reference"
+)
+
+// maxManifestSize bounds the size of fetched manifests
+const maxManifestSize = 4 * 1024 * 1024
+
+// GetManifest fetches the manifest or index tagged or pinned by ref. The
+// digest of manifests fetched by digest is verified.
+func (c *Client) GetManifest(ctx context.Context, ref *reference.Reference) (Descriptor, []byte, error) {
+	tagOrDigest := manifestReference(ref)
+	resp, err := c.do(ctx, &request{
+		method:  http.MethodGet,
+		ref:     ref,
+		path:    "manifests/" + tagOrDigest,
+		header:  http.Header{"Accept": {strings.Join(manifestMediaTypes, ", ")}},
+		actions: "pull",
+	})
+	if err != nil {
+		return Descriptor{}, nil, err
+	}
+	defer drain(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return Descriptor{}, nil, responseError(resp, fmt.Sprintf("failed to get manifest of %s", ref))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return Descriptor{}, nil, transportError(ctx, err, fmt.Sprintf("failed to read manifest of %s", ref))
+	}
+	if len(data) > maxManifestSize {
+		return Descriptor{}, nil, errors.New(errors.ErrImageInvalid, fmt.Sprintf("manifest of %s exceeds %d bytes", ref, maxManifestSize))
+	}
+
+	desc := Descriptor{
+		MediaType: contentType(resp.Header),
+		Digest:    Digest(data),
+		Size:      int64(len(data)),
+	}
+	if desc.MediaType == "" {
+		if manifest, err := ParseManifest(data); err == nil {
+			desc.MediaType = manifest.MediaType
+		}
+	}
+	if ref.Digest != "" && desc.Digest != ref.Digest {
+		return Descriptor{}, nil, errors.New(errors.ErrDigestMismatch,
+			fmt.Sprintf("manifest of %s has digest %s", ref, desc.Digest))
+	}
+
+	return desc, data, nil
+}
+
+// HeadManifest returns the descriptor of the manifest tagged or pinned by ref
+// without fetching it. It reports false if the registry does not have it.
+func (c *Client) HeadManifest(ctx context.Context, ref *reference.Reference) (Descriptor, bool, error) {
+	resp, err := c.do(ctx, &request{
+		method:  http.MethodHead,
+		ref:     ref,
+		path:    "manifests/" + manifestReference(ref),
+		header:  http.Header{"Accept": {strings.Join(manifestMediaTypes, ", ")}},
+		actions: "pull",
+	})
+	if err != nil {
+		return Descriptor{}, false, err
+	}
+	defer drain(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return Descriptor{}, false, nil
+	default:
+		return Descriptor{}, false, responseError(resp, fmt.Sprintf("failed to check manifest of %s", ref))
+	}
+
+	// Registries that do not report the digest need the manifest itself
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		desc, _, err := c.GetManifest(ctx, ref)
+		if err != nil {
+			return Descriptor{}, false, err
+		}
+		return desc, true, nil
+	}
+	return Descriptor{
+		MediaType: contentType(resp.Header),
+		Digest:    digest,
+		Size:      resp.ContentLength,
+	}, true, nil
+}
+
+// PutManifest uploads a manifest under the tag or digest of ref and returns
+// its digest
+func (c *Client) PutManifest(ctx context.Context, ref *reference.Reference, mediaType string, data []byte) (string, error) {
+	resp, err := c.do(ctx, &request{
+		method: http.MethodPut,
+		ref:    ref,
+		path:   "manifests/" + manifestReference(ref),
+		header: http.Header{"Content-Type": {mediaType}},
+		body: func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		},
+		size:    int64(len(data)),
+		actions: "pull,push",
+	})
+	if err != nil {
+		return "", err
+	}
+	defer drain(resp)
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", responseError(resp, fmt.Sprintf("failed to push manifest %s", ref))
+	}
+	return Digest(data), nil
+}
+
+// GetBlob opens a blob of the repository of ref. The caller verifies the
+// content against the digest.
+func (c *Client) GetBlob(ctx context.Context, ref *reference.Reference, digest string) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, &request{
+		method:  http.MethodGet,
+		ref:     ref,
+		path:    "blobs/" + digest,
+		actions: "pull",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer drain(resp)
+		return nil, responseError(resp, fmt.Sprintf("failed to get blob %s of %s", digest, ref.Name()))
+	}
+	return resp.Body, nil
+}
+
+// BlobExists reports whether the repository of ref holds a blob
+func (c *Client) BlobExists(ctx context.Context, ref *reference.Reference, digest string) (bool, error) {
+	resp, err := c.do(ctx, &request{
+		method:  http.MethodHead,
+		ref:     ref,
+		path:    "blobs/" + digest,
+		actions: "pull",
+	})
+	if err != nil {
+		return false, err
+	}
+	defer drain(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, responseError(resp, fmt.Sprintf("failed to check blob %s of %s", digest, ref.Name()))
+	}
+}
+
+// UploadBlob makes sure the repository of ref holds a blob. Blobs the
+// repository already has are not uploaded again, and blobs of the
+// repositories from on the same registry are mounted instead of uploaded.
+func (c *Client) UploadBlob(ctx context.Context, ref *reference.Reference, desc Descriptor, open func() (io.ReadCloser, error), from ...string) error {
+	exists, err := c.BlobExists(ctx, ref, desc.Digest)
+	if err != nil {
+		return err
+	}
+	if exists {
+		c.log.Debug("Blob exists", logger.F("digest", desc.Digest), logger.F("repository", ref.Path))
+		return nil
+	}
+
+	for _, repository := range from {
+		if repository == ref.Path {
+			continue
+		}
+		// A failed mount, e.g. without pull access to repository, falls back
+		// to an upload
+		mounted, err := c.MountBlob(ctx, ref, desc.Digest, repository)
+		if err != nil {
+			c.log.Debug("Blob mount failed", logger.F("digest", desc.Digest), logger.F("from", repository), logger.Err(err))
+			continue
+		}
+		if mounted {
+			c.log.Debug("Mounted blob", logger.F("digest", desc.Digest), logger.F("from", repository))
+			return nil
+		}
+	}
+
+	c.log.Debug("Pushing blob", logger.F("digest", desc.Digest), logger.F("size", desc.Size))
+	return c.PushBlob(ctx, ref, desc, open)
+}
+
+// PushBlob uploads a blob to the repository of ref in a single request.
+// open is called again if the upload has to be retried after authentication.
+func (c *Client) PushBlob(ctx context.Context, ref *reference.Reference, desc Descriptor, open func() (io.ReadCloser, error)) error {
+	resp, err := c.do(ctx, &request{
+		method:  http.MethodPost,
+		ref:     ref,
+		path:    "blobs/uploads/",
+		actions: "pull,push",
+	})
+	if err != nil {
+		return err
+	}
+	drain(resp)
+
+	if resp.StatusCode != http.StatusAccepted {
+		return responseError(resp, fmt.Sprintf("failed to start upload of blob %s to %s", desc.Digest, ref.Name()))
+	}
+
+	location, err := uploadURL(resp)
+	if err != nil {
+		return errors.Wrap(err, errors.ErrRegistryConnection, fmt.Sprintf("invalid upload location for %s", ref.Name()))
+	}
+	query := location.Query()
+	query.Set("digest", desc.Digest)
+	location.RawQuery = query.Encode()
+
+	resp, err = c.do(ctx, &request{
+		method:  http.MethodPut,
+		ref:     ref,
+		url:     location.String(),
+		header:  http.Header{"Content-Type": {"application/octet-stream"}},
+		body:    open,
+		size:    desc.Size,
+		actions: "pull,push",
+	})
+	if err != nil {
+		return err
+	}
+	defer drain(resp)
+
+	if resp.StatusCode != http.StatusCreated {
+		return responseError(resp, fmt.Sprintf("failed to upload blob %s to %s", desc.Digest, ref.Name()))
+	}
+	return nil
+}
+
+// MountBlob mounts a blob from another repository of the same registry into
+// the repository of ref. It reports false if the registry does not mount the
+// blob, in which case it has to be uploaded.
+func (c *Client) MountBlob(ctx context.Context, ref *reference.Reference, digest, from string) (bool, error) {
+	query := url.Values{"mount": {digest}, "from": {from}}
+	resp, err := c.do(ctx, &request{
+		method:  http.MethodPost,
+		ref:     ref,
+		path:    "blobs/uploads/?" + query.Encode(),
+		actions: "pull,push",
+		from:    from,
+	})
+	if err != nil {
+		return false, err
+	}
+	defer drain(resp)
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		return true, nil
+	case http.StatusAccepted:
+		// The registry started a regular upload instead; it expires unused
+		return false, nil
+	default:
+		return false, responseError(resp, fmt.Sprintf("failed to mount blob %s from %s into %s", digest, from, ref.Name()))
+	}
+}
+
+// manifestReference returns the digest of ref, or its tag
+func manifestReference(ref *reference.Reference) string {
+	if ref.Digest != "" {
+		return ref.Digest
+	}
+	return ref.TagOrDefault()
+}
+
+// contentType returns the media type of a response without parameters
+func contentType(header http.Header) string {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || mediaType == "application/json" || mediaType == "text/plain" {
+		return ""
+	}
+	return mediaType
+}
+
+// uploadURL returns the absolute upload location of a started upload
+func uploadURL(resp *http.Response) (*url.URL, error) {
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return nil, fmt.Errorf("missing Location header")
+	}
+	u, err := resp.Request.URL.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
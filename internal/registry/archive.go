@@ -0,0 +1,412 @@
+package registry
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/reference"
+)
+
+// maxMetadataSize bounds the size of index.json and manifest.json in archives
+const maxMetadataSize = 16 * 1024 * 1024
+
+// ArchiveImage is an image of the store written to an archive
+type ArchiveImage struct {
+	Ref        *reference.Reference
+	Descriptor Descriptor
+}
+
+// dockerManifest is an entry of the manifest.json of a docker archive
+type dockerManifest struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// WriteArchive writes images from the store to w as a tar archive that is
+// both an OCI image layout and a docker archive, so it can be imported by
+// docker load, podman load, nerdctl load and OCI tools alike
+func WriteArchive(ctx context.Context, store *Store, w io.Writer, images []ArchiveImage) error {
+	tw := tar.NewWriter(w)
+	written := make(map[string]bool)
+
+	index := Manifest{SchemaVersion: 2, MediaType: MediaTypeOCIIndex}
+	var dockerManifests []dockerManifest
+
+	if err := writeTarFile(tw, "oci-layout", []byte(ociLayout)); err != nil {
+		return err
+	}
+
+	for _, image := range images {
+		desc := image.Descriptor
+		data, err := store.ReadBlob(desc.Digest)
+		if err != nil {
+			return err
+		}
+		manifest, err := ParseManifest(data)
+		if err != nil {
+			return errors.Wrap(err, errors.ErrImageInvalid, fmt.Sprintf("invalid manifest of %s", image.Ref))
+		}
+		if IsIndex(desc.MediaType) {
+			return errors.New(errors.ErrImageInvalid, fmt.Sprintf("%s is an image index, only platform images can be saved", image.Ref))
+		}
+
+		for _, blob := range append([]Descriptor{desc}, manifest.Blobs()...) {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if written[blob.Digest] {
+				continue
+			}
+			if err := writeTarBlob(tw, store, blob.Digest); err != nil {
+				return err
+			}
+			written[blob.Digest] = true
+		}
+
+		name := image.Ref.String()
+		index.Manifests = append(index.Manifests, Descriptor{
+			MediaType: desc.MediaType,
+			Digest:    desc.Digest,
+			Size:      desc.Size,
+			Platform:  desc.Platform,
+			Annotations: map[string]string{
+				AnnotationImageName: name,
+				AnnotationRefName:   name,
+			},
+		})
+
+		entry := dockerManifest{Config: blobName(manifest.Config.Digest), RepoTags: []string{}}
+		if image.Ref.Digest == "" {
+			entry.RepoTags = append(entry.RepoTags, image.Ref.FamiliarName()+":"+image.Ref.TagOrDefault())
+		}
+		for _, layer := range manifest.Layers {
+			entry.Layers = append(entry.Layers, blobName(layer.Digest))
+		}
+		dockerManifests = append(dockerManifests, entry)
+	}
+
+	indexData, err := json.Marshal(index)
+	if err != nil {
+		return errors.Wrap(err, errors.ErrFileOperation, "failed to encode archive index")
+	}
+	if err := writeTarFile(tw, "index.json", indexData); err != nil {
+		return err
+	}
+
+	manifestData, err := json.Marshal(dockerManifests)
+	if err != nil {
+		return errors.Wrap(err, errors.ErrFileOperation, "failed to encode archive manifest")
+	}
+	if err := writeTarFile(tw, "manifest.json", manifestData); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return errors.Wrap(err, errors.ErrFileOperation, "failed to write archive")
+	}
+	return nil
+}
+
+// ReadArchive imports the images of an OCI image layout or docker archive
+// into the store and returns their fully qualified references. Images are
+// named after the io.containerd.image.name or fully qualified
+// org.opencontainers.image.ref.name annotations of index.json, or the
+// RepoTags of manifest.json.
+func ReadArchive(ctx context.Context, store *Store, r io.Reader) ([]string, error) {
+	tr := tar.NewReader(bufio.NewReader(r))
+	files := make(map[string]Descriptor) // blobs by archive path
+	links := make(map[string]string)     // symlinked files of legacy docker archives
+	var indexData, manifestData []byte
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, errors.ErrFileOperation, "failed to read archive")
+		}
+
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if hdr.Typeflag == tar.TypeSymlink {
+			links[name] = path.Join(path.Dir(name), hdr.Linkname)
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		switch {
+		case name == "index.json":
+			indexData, err = readMetadata(tr, name)
+		case name == "manifest.json":
+			manifestData, err = readMetadata(tr, name)
+		case strings.HasPrefix(name, "blobs/sha256/"):
+			digest := "sha256:" + path.Base(name)
+			if !store.HasBlob(digest) {
+				err = store.WriteBlob(digest, tr)
+			}
+			files[name] = Descriptor{Digest: digest, Size: hdr.Size}
+		case strings.HasSuffix(name, ".tar") || strings.HasSuffix(name, ".json"):
+			// Layers and configs of legacy docker archives
+			var desc Descriptor
+			desc.Digest, desc.Size, err = store.AddBlob(tr)
+			files[name] = desc
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	for name, target := range links {
+		if desc, ok := files[target]; ok {
+			files[name] = desc
+		}
+	}
+
+	images, err := indexImages(store, indexData)
+	if err != nil {
+		return nil, err
+	}
+	if len(images) == 0 {
+		if images, err = dockerImages(store, manifestData, files); err != nil {
+			return nil, err
+		}
+	}
+	if len(images) == 0 {
+		return nil, errors.New(errors.ErrImageInvalid, "archive contains no named images")
+	}
+
+	names := make([]string, 0, len(images))
+	for _, image := range images {
+		name := image.Ref.String()
+		if err := store.SetImage(name, image.Descriptor); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// indexImages returns the named images of the index.json of an OCI layout.
+// Indexes are resolved to the manifest of the host platform, or the first
+// manifest whose blobs are all present.
+func indexImages(store *Store, data []byte) ([]ArchiveImage, error) {
+	if data == nil {
+		return nil, nil
+	}
+	index, err := ParseManifest(data)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrImageInvalid, "invalid archive index.json")
+	}
+
+	var images []ArchiveImage
+	for _, desc := range index.Manifests {
+		name := desc.Annotations[AnnotationImageName]
+		if name == "" {
+			name = desc.Annotations[AnnotationRefName]
+		}
+		// Bare tags as used by some tools cannot be mapped to a repository
+		ref, err := reference.Parse(name)
+		if err != nil || !strings.ContainsAny(name, "/:@") {
+			continue
+		}
+
+		if IsIndex(desc.MediaType) {
+			if desc, err = availableManifest(store, desc); err != nil {
+				return nil, err
+			}
+		}
+		images = append(images, ArchiveImage{Ref: ref, Descriptor: desc})
+	}
+	return images, nil
+}
+
+// availableManifest returns the manifest of an index that is stored
+// completely, preferring the host platform
+func availableManifest(store *Store, desc Descriptor) (Descriptor, error) {
+	data, err := store.ReadBlob(desc.Digest)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	index, err := ParseManifest(data)
+	if err != nil {
+		return Descriptor{}, errors.Wrap(err, errors.ErrImageInvalid, "invalid image index in archive")
+	}
+
+	var available []Descriptor
+	for _, child := range index.Manifests {
+		if complete(store, child) {
+			available = append(available, child)
+		}
+	}
+	if len(available) == 0 {
+		return Descriptor{}, errors.New(errors.ErrImageInvalid, fmt.Sprintf("archive contains no complete platform image of index %s", desc.Digest))
+	}
+
+	if preferred, err := SelectManifest(&Manifest{Manifests: available}, ""); err == nil {
+		return preferred, nil
+	}
+	return available[0], nil
+}
+
+// complete reports whether the store holds an image manifest and all its blobs
+func complete(store *Store, desc Descriptor) bool {
+	if IsIndex(desc.MediaType) || !store.HasBlob(desc.Digest) {
+		return false
+	}
+	data, err := store.ReadBlob(desc.Digest)
+	if err != nil {
+		return false
+	}
+	manifest, err := ParseManifest(data)
+	if err != nil {
+		return false
+	}
+	for _, blob := range manifest.Blobs() {
+		if !store.HasBlob(blob.Digest) {
+			return false
+		}
+	}
+	return true
+}
+
+// dockerImages creates OCI manifests for the images of a docker archive
+// manifest.json
+func dockerImages(store *Store, data []byte, files map[string]Descriptor) ([]ArchiveImage, error) {
+	if data == nil {
+		return nil, nil
+	}
+	var entries []dockerManifest
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, errors.Wrap(err, errors.ErrImageInvalid, "invalid archive manifest.json")
+	}
+
+	var images []ArchiveImage
+	for _, entry := range entries {
+		config, ok := files[path.Clean(entry.Config)]
+		if !ok {
+			return nil, errors.New(errors.ErrImageInvalid, fmt.Sprintf("archive is missing config %s", entry.Config))
+		}
+		config.MediaType = MediaTypeOCIConfig
+
+		manifest := Manifest{SchemaVersion: 2, MediaType: MediaTypeOCIManifest, Config: &config}
+		for _, layerPath := range entry.Layers {
+			layer, ok := files[path.Clean(layerPath)]
+			if !ok {
+				return nil, errors.New(errors.ErrImageInvalid, fmt.Sprintf("archive is missing layer %s", layerPath))
+			}
+			mediaType, err := layerMediaType(store, layer.Digest)
+			if err != nil {
+				return nil, err
+			}
+			layer.MediaType = mediaType
+			manifest.Layers = append(manifest.Layers, layer)
+		}
+
+		manifestData, err := json.Marshal(manifest)
+		if err != nil {
+			return nil, errors.Wrap(err, errors.ErrImageInvalid, "failed to encode manifest")
+		}
+		desc := Descriptor{MediaType: MediaTypeOCIManifest, Digest: Digest(manifestData), Size: int64(len(manifestData))}
+		if err := store.WriteBlob(desc.Digest, bytes.NewReader(manifestData)); err != nil {
+			return nil, err
+		}
+		if configData, err := store.ReadBlob(config.Digest); err == nil {
+			if platform, err := ConfigPlatform(configData); err == nil {
+				desc.Platform = platform
+			}
+		}
+
+		for _, tag := range entry.RepoTags {
+			ref, err := reference.Parse(tag)
+			if err != nil {
+				return nil, err
+			}
+			images = append(images, ArchiveImage{Ref: ref, Descriptor: desc})
+		}
+	}
+	return images, nil
+}
+
+// layerMediaType returns the OCI media type of a stored layer based on its
+// compression
+func layerMediaType(store *Store, digest string) (string, error) {
+	f, err := store.OpenBlob(digest)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 4)
+	n, _ := io.ReadFull(f, magic)
+	switch {
+	case n >= 2 && magic[0] == 0x1f && magic[1] == 0x8b:
+		return MediaTypeOCILayerGzip, nil
+	case n == 4 && bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return MediaTypeOCILayerZstd, nil
+	default:
+		return MediaTypeOCILayer, nil
+	}
+}
+
+// blobName returns the archive path of a blob
+func blobName(digest string) string {
+	return "blobs/" + strings.Replace(digest, ":", "/", 1)
+}
+
+// writeTarFile writes a file to a tar archive
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+		return errors.Wrap(err, errors.ErrFileOperation, "failed to write archive")
+	}
+	if _, err := tw.Write(data); err != nil {
+		return errors.Wrap(err, errors.ErrFileOperation, "failed to write archive")
+	}
+	return nil
+}
+
+// writeTarBlob copies a blob of the store to a tar archive
+func writeTarBlob(tw *tar.Writer, store *Store, digest string) error {
+	f, err := store.OpenBlob(digest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return errors.Wrap(err, errors.ErrFileOperation, fmt.Sprintf("failed to read blob %s", digest))
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: blobName(digest), Mode: 0644, Size: info.Size(), Typeflag: tar.TypeReg}); err != nil {
+		return errors.Wrap(err, errors.ErrFileOperation, "failed to write archive")
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return errors.Wrap(err, errors.ErrFileOperation, "failed to write archive")
+	}
+	return nil
+}
+
+// readMetadata reads a metadata file of an archive
+func readMetadata(r io.Reader, name string) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxMetadataSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrFileOperation, fmt.Sprintf("failed to read %s from archive", name))
+	}
+	if len(data) > maxMetadataSize {
+		return nil, errors.New(errors.ErrImageInvalid, fmt.Sprintf("%s in archive exceeds %d bytes", name, maxMetadataSize))
+	}
+	return data, nil
+}
@@ -0,0 +1,476 @@
+// Package registry implements the parts of the OCI distribution API needed to
+// pull and push images without a container engine, and a local image store
+// in OCI image layout that can be exported to and imported from tar archives.
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/harpoon/hpn/internal/logger"
+	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/reference"
+)
+
+// dockerHubHost is the API endpoint of docker.io
+const dockerHubHost = "registry-1.docker.io"
+
+// maxErrorBody bounds how much of an error response is read
+const maxErrorBody = 4 * 1024
+
+// CredentialFunc returns the username and password for a registry host, or
+// empty strings for anonymous access
+type CredentialFunc func(host string) (username, password string)
+
+// Options configures a Client
+type Options struct {
+	// Transport performs the HTTP requests, defaults to http.DefaultTransport
+	Transport http.RoundTripper
+
+	// Credentials are used for basic authentication and to obtain tokens
+	Credentials CredentialFunc
+
+	// Insecure reports whether a registry domain may be reached over plain
+	// HTTP when HTTPS fails. The transport decides whether certificates are
+	// verified.
+	Insecure func(domain string) bool
+
+	// UserAgent is sent with every request
+	UserAgent string
+
+	// Logger receives diagnostic messages, defaults to a no-op logger
+	Logger logger.Logger
+}
+
+// Client is a client for the OCI distribution API. Registries on localhost
+// and loopback addresses are reached over plain HTTP, all others over HTTPS.
+// Insecure registries fall back to plain HTTP if HTTPS fails.
+type Client struct {
+	http        *http.Client
+	credentials CredentialFunc
+	insecure    func(domain string) bool
+	userAgent   string
+	log         logger.Logger
+
+	mu        sync.Mutex
+	tokens    map[string]string // Authorization header values by host and scope
+	plainHTTP map[string]bool   // insecure hosts found to serve plain HTTP
+}
+
+// NewClient creates a registry client
+func NewClient(opts Options) *Client {
+	transport := opts.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	log := opts.Logger
+	if log == nil {
+		log = logger.Nop()
+	}
+	credentials := opts.Credentials
+	if credentials == nil {
+		credentials = func(string) (string, string) { return "", "" }
+	}
+	insecure := opts.Insecure
+	if insecure == nil {
+		insecure = func(string) bool { return false }
+	}
+
+	return &Client{
+		http:        &http.Client{Transport: transport},
+		credentials: credentials,
+		insecure:    insecure,
+		userAgent:   opts.UserAgent,
+		log:         log,
+		tokens:      make(map[string]string),
+		plainHTTP:   make(map[string]bool),
+	}
+}
+
+// request is a request to the API of a repository
+type request struct {
+	method  string
+	ref     *reference.Reference // repository the request operates on
+	path    string               // path below /v2/<repository>/
+	url     string               // absolute URL, used instead of path
+	header  http.Header
+	body    func() (io.ReadCloser, error) // reopened when the request is retried after authentication
+	size    int64
+	actions string // token scope actions, e.g. "pull" or "pull,push"
+	from    string // repository blobs are mounted from, which needs pull access too
+}
+
+// do sends a request, authenticating and retrying once if the registry asks
+// for credentials. Responses with an unexpected status are returned as well;
+// callers check the status.
+func (c *Client) do(ctx context.Context, r *request) (*http.Response, error) {
+	host := apiHost(r.ref.Domain)
+	scope := fmt.Sprintf("repository:%s:%s", r.ref.Path, r.actions)
+	if r.from != "" {
+		scope += fmt.Sprintf(" repository:%s:pull", r.from)
+	}
+	key := host + " " + scope
+
+	c.mu.Lock()
+	authorization := c.tokens[key]
+	c.mu.Unlock()
+
+	resp, err := c.send(ctx, r, authorization)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	drain(resp)
+
+	authorization, err = c.authorize(ctx, r.ref.Domain, challenge, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.tokens[key] = authorization
+	c.mu.Unlock()
+
+	return c.send(ctx, r, authorization)
+}
+
+// Ping checks that the registry of domain is reachable and accepts the
+// credentials of the client, like docker login does
+func (c *Client) Ping(ctx context.Context, domain string) error {
+	r := &request{
+		method: http.MethodGet,
+		ref:    &reference.Reference{Domain: domain},
+		path:   "/v2/",
+	}
+	resp, err := c.send(ctx, r, "")
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		drain(resp)
+
+		authorization, err := c.authorize(ctx, domain, challenge, "")
+		if err != nil {
+			return err
+		}
+		if resp, err = c.send(ctx, r, authorization); err != nil {
+			return err
+		}
+	}
+	defer drain(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp, fmt.Sprintf("failed to log in to registry %s", domain))
+	}
+	return nil
+}
+
+// send sends a single attempt of a request. Requests to an insecure
+// registry that fail over HTTPS are repeated over plain HTTP.
+func (c *Client) send(ctx context.Context, r *request, authorization string) (*http.Response, error) {
+	resp, err := c.sendTo(ctx, r, c.requestURL(r), authorization)
+	if err == nil || r.url != "" || !c.insecure(r.ref.Domain) || c.isPlainHTTP(r.ref.Domain) || ctx.Err() != nil {
+		return resp, err
+	}
+
+	host := apiHost(r.ref.Domain)
+	c.log.Debug("HTTPS failed for insecure registry, trying plain HTTP", logger.F("registry", host), logger.Err(err))
+	c.mu.Lock()
+	c.plainHTTP[host] = true
+	c.mu.Unlock()
+
+	resp, httpErr := c.sendTo(ctx, r, c.requestURL(r), authorization)
+	if httpErr != nil {
+		c.mu.Lock()
+		delete(c.plainHTTP, host)
+		c.mu.Unlock()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// requestURL returns the URL of a request
+func (c *Client) requestURL(r *request) string {
+	if r.url != "" {
+		return r.url
+	}
+	if r.ref.Path == "" {
+		return c.baseURL(r.ref.Domain) + r.path
+	}
+	return fmt.Sprintf("%s/v2/%s/%s", c.baseURL(r.ref.Domain), r.ref.Path, r.path)
+}
+
+// sendTo sends a single attempt of a request to target
+func (c *Client) sendTo(ctx context.Context, r *request, target, authorization string) (*http.Response, error) {
+
+	var body io.ReadCloser
+	if r.body != nil {
+		var err error
+		if body, err = r.body(); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, r.method, target, body)
+	if err != nil {
+		if body != nil {
+			body.Close()
+		}
+		return nil, errors.Wrap(err, errors.ErrImageInvalid, "invalid registry request")
+	}
+	for name, values := range r.header {
+		req.Header[name] = values
+	}
+	if r.body != nil {
+		req.ContentLength = r.size
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	start := time.Now()
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, transportError(ctx, err, fmt.Sprintf("%s %s failed", r.method, redact(target)))
+	}
+
+	c.log.Debug("Registry request",
+		logger.F("method", r.method),
+		logger.F("url", redact(target)),
+		logger.F("status", resp.StatusCode),
+		logger.F("duration", time.Since(start)))
+	return resp, nil
+}
+
+// authorize answers an authentication challenge and returns the
+// Authorization header value to use. scope lists the token scopes separated
+// by spaces.
+func (c *Client) authorize(ctx context.Context, domain, challenge, scope string) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	username, password := c.credentials(domain)
+
+	switch scheme {
+	case "basic":
+		if username == "" {
+			return "", errors.NewRegistryAuthError(domain)
+		}
+		return basicAuth(username, password), nil
+
+	case "bearer":
+		realm, err := url.Parse(params["realm"])
+		if err != nil || realm.Host == "" {
+			return "", errors.New(errors.ErrRegistryAuth, fmt.Sprintf("invalid token realm %q of registry %s", params["realm"], domain))
+		}
+		query := realm.Query()
+		if service := params["service"]; service != "" {
+			query.Set("service", service)
+		}
+		for _, part := range strings.Fields(scope) {
+			query.Add("scope", part)
+		}
+		realm.RawQuery = query.Encode()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+		if err != nil {
+			return "", errors.Wrap(err, errors.ErrRegistryAuth, "invalid token request")
+		}
+		if username != "" {
+			req.Header.Set("Authorization", basicAuth(username, password))
+		}
+		if c.userAgent != "" {
+			req.Header.Set("User-Agent", c.userAgent)
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return "", transportError(ctx, err, fmt.Sprintf("failed to get token for registry %s", domain))
+		}
+		defer drain(resp)
+
+		if resp.StatusCode != http.StatusOK {
+			return "", responseError(resp, fmt.Sprintf("failed to get token for registry %s", domain))
+		}
+
+		var token struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+			return "", errors.Wrap(err, errors.ErrRegistryAuth, fmt.Sprintf("invalid token response of registry %s", domain))
+		}
+		if token.Token == "" {
+			token.Token = token.AccessToken
+		}
+		if token.Token == "" {
+			return "", errors.NewRegistryAuthError(domain)
+		}
+		return "Bearer " + token.Token, nil
+
+	default:
+		return "", errors.NewRegistryAuthError(domain).WithContext("challenge", challenge)
+	}
+}
+
+// parseChallenge parses a WWW-Authenticate header into its lower-cased
+// scheme and parameters
+func parseChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := make(map[string]string)
+
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		name, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				params[name] = value[1:]
+				break
+			}
+			params[name] = value[1 : end+1]
+			rest = strings.TrimPrefix(value[end+2:], ",")
+		} else {
+			value, rest, _ = strings.Cut(value, ",")
+			params[name] = strings.TrimSpace(value)
+		}
+	}
+
+	return strings.ToLower(scheme), params
+}
+
+// basicAuth returns a basic Authorization header value
+func basicAuth(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+// apiHost returns the host serving the API of a registry domain
+func apiHost(domain string) string {
+	if domain == reference.DefaultDomain {
+		return dockerHubHost
+	}
+	return domain
+}
+
+// baseURL returns the scheme and host of the API of a registry domain
+func (c *Client) baseURL(domain string) string {
+	host := apiHost(domain)
+	if isLoopback(host) || c.isPlainHTTP(domain) {
+		return "http://" + host
+	}
+	return "https://" + host
+}
+
+// isPlainHTTP reports whether the insecure registry of domain was found to
+// serve plain HTTP
+func (c *Client) isPlainHTTP(domain string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.plainHTTP[apiHost(domain)]
+}
+
+// isLoopback reports whether host[:port] is localhost or a loopback address
+func isLoopback(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// transportError converts a failed HTTP request into a HarpoonError
+func transportError(ctx context.Context, err error, message string) error {
+	if stderrors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return errors.Wrap(ctx.Err(), errors.ErrRuntimeTimeout, message+": operation timed out")
+	}
+
+	code := errors.ErrRegistryConnection
+	var netErr net.Error
+	var opErr *net.OpError
+	switch {
+	case stderrors.As(err, &opErr) && opErr.Op == "proxyconnect":
+		code = errors.ErrProxyConnection
+	case stderrors.As(err, &netErr) && netErr.Timeout():
+		code = errors.ErrNetworkTimeout
+	}
+	return errors.Wrap(err, code, message)
+}
+
+// responseError converts an unexpected response into a HarpoonError, using
+// the error details of the distribution API when present
+func responseError(resp *http.Response, message string) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+
+	var apiErrors struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	detail := resp.Status
+	if json.Unmarshal(body, &apiErrors) == nil && len(apiErrors.Errors) > 0 {
+		details := make([]string, len(apiErrors.Errors))
+		for i, e := range apiErrors.Errors {
+			details[i] = strings.ToLower(strings.ReplaceAll(e.Code, "_", " "))
+			if e.Message != "" && !strings.EqualFold(e.Message, details[i]) {
+				details[i] += ": " + e.Message
+			}
+		}
+		detail = strings.Join(details, "; ")
+	}
+
+	var code errors.ErrorCode
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		code = errors.ErrRegistryAuth
+	case resp.StatusCode == http.StatusNotFound:
+		code = errors.ErrImageNotFound
+	case resp.StatusCode == http.StatusTooManyRequests:
+		code = errors.ErrRegistryRateLimit
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusGatewayTimeout:
+		code = errors.ErrRegistryTimeout
+	case resp.StatusCode >= 500:
+		code = errors.ErrRegistryConnection
+	default:
+		code = errors.ErrRuntimeCommand
+	}
+
+	return errors.New(code, message+": "+detail).WithContext("status", resp.StatusCode)
+}
+
+// drain discards the rest of a response body and closes it so the
+// connection can be reused
+func drain(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBody))
+	resp.Body.Close()
+}
+
+// redact removes the query of a URL, which may carry upload state or tokens
+func redact(rawURL string) string {
+	if i := strings.IndexByte(rawURL, '?'); i >= 0 {
+		return rawURL[:i]
+	}
+	return rawURL
+}
@@ -0,0 +1,196 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/harpoon/hpn/internal/logger"
+	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/reference"
+)
+
+// CopyOptions configures Copy
+type CopyOptions struct {
+	// Platforms restricts the copy of an image index to these platforms
+	// (os/arch[/variant]). A single platform copies just its image manifest,
+	// several copy an index of those platforms. By default the index is
+	// copied unchanged, keeping its digest.
+	Platforms []string
+
+	// Force copies the image even if the target already holds its manifest
+	Force bool
+}
+
+// CopyResult describes a completed copy
+type CopyResult struct {
+	// Digest is the digest of the manifest at the target
+	Digest string
+
+	// UpToDate is set if the target already held the manifest and nothing
+	// was copied
+	UpToDate bool
+}
+
+// Copy copies the image or index source to target without storing it
+// locally. Blobs the target already has are skipped, and blobs are mounted
+// when both repositories are on the same registry, otherwise streamed from
+// the source registry. Nothing is copied if the target already holds the
+// manifest, unless opts.Force is set.
+func Copy(ctx context.Context, from *Client, source *reference.Reference, to *Client, target *reference.Reference, opts CopyOptions) (CopyResult, error) {
+	desc, data, err := from.GetManifest(ctx, source)
+	if err != nil {
+		return CopyResult{}, err
+	}
+
+	// Determine the manifest to push and, for an index, the platform
+	// manifests it references
+	var manifests []Descriptor
+	if IsIndex(desc.MediaType) {
+		index, err := ParseManifest(data)
+		if err != nil {
+			return CopyResult{}, errors.Wrap(err, errors.ErrImageInvalid, fmt.Sprintf("invalid image index of %s", source))
+		}
+		manifests = index.Manifests
+
+		if len(opts.Platforms) > 0 {
+			selected, err := selectManifests(index, opts.Platforms)
+			if err != nil {
+				return CopyResult{}, errors.Wrap(err, errors.ErrImageNotFound, fmt.Sprintf("failed to copy %s", source))
+			}
+
+			switch {
+			case len(selected) == 1:
+				// A single platform is copied as a plain image under the
+				// target tag
+				desc, data, manifests = selected[0], nil, nil
+			case len(selected) < len(index.Manifests):
+				index.Manifests, manifests = selected, selected
+				if data, err = json.Marshal(index); err != nil {
+					return CopyResult{}, errors.Wrap(err, errors.ErrImageInvalid, fmt.Sprintf("failed to encode image index of %s", source))
+				}
+				desc.Digest = Digest(data)
+			}
+		}
+	}
+
+	c := &copier{from: from, source: source, to: to, target: target, copied: make(map[string]bool)}
+	if !opts.Force && c.upToDate(ctx, desc.Digest) {
+		return CopyResult{Digest: desc.Digest, UpToDate: true}, nil
+	}
+
+	if data == nil {
+		if desc, data, err = c.childManifest(ctx, desc); err != nil {
+			return CopyResult{}, err
+		}
+	}
+	if !IsIndex(desc.MediaType) {
+		if err := c.copyBlobs(ctx, data); err != nil {
+			return CopyResult{}, err
+		}
+	}
+
+	// Platform manifests are pushed by digest before the index referencing them
+	for _, entry := range manifests {
+		child, childData, err := c.childManifest(ctx, entry)
+		if err != nil {
+			return CopyResult{}, err
+		}
+		if err := c.copyBlobs(ctx, childData); err != nil {
+			return CopyResult{}, err
+		}
+		pinned := &reference.Reference{Domain: target.Domain, Path: target.Path, Digest: child.Digest}
+		if _, err := to.PutManifest(ctx, pinned, child.MediaType, childData); err != nil {
+			return CopyResult{}, err
+		}
+	}
+
+	digest, err := to.PutManifest(ctx, target, desc.MediaType, data)
+	if err != nil {
+		return CopyResult{}, err
+	}
+	return CopyResult{Digest: digest}, nil
+}
+
+// selectManifests returns the manifests of an index for each platform
+func selectManifests(index *Manifest, platforms []string) ([]Descriptor, error) {
+	var selected []Descriptor
+	seen := make(map[string]bool)
+	for _, platform := range platforms {
+		desc, err := SelectManifest(index, platform)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[desc.Digest] {
+			seen[desc.Digest] = true
+			selected = append(selected, desc)
+		}
+	}
+	return selected, nil
+}
+
+// copier copies the manifests and blobs of one image
+type copier struct {
+	from   *Client
+	source *reference.Reference
+	to     *Client
+	target *reference.Reference
+	copied map[string]bool // blobs already copied
+}
+
+// childManifest fetches a platform manifest of an index
+func (c *copier) childManifest(ctx context.Context, desc Descriptor) (Descriptor, []byte, error) {
+	pinned := &reference.Reference{Domain: c.source.Domain, Path: c.source.Path, Digest: desc.Digest}
+	child, data, err := c.from.GetManifest(ctx, pinned)
+	if err != nil {
+		return Descriptor{}, nil, err
+	}
+	if IsIndex(child.MediaType) {
+		return Descriptor{}, nil, errors.New(errors.ErrImageInvalid, fmt.Sprintf("nested image index %s of %s is not supported", desc.Digest, c.source))
+	}
+	if child.MediaType == "" {
+		child.MediaType = desc.MediaType
+	}
+	return child, data, nil
+}
+
+// upToDate reports whether target already holds the manifest digest. A
+// failed check is logged and the image is copied.
+func (c *copier) upToDate(ctx context.Context, digest string) bool {
+	current, ok, err := c.to.HeadManifest(ctx, c.target)
+	if err != nil {
+		c.to.log.Debug("Manifest check failed", logger.F("target", c.target.String()), logger.Err(err))
+		return false
+	}
+	return ok && current.Digest == digest
+}
+
+// copyBlobs copies the config and layers of an image manifest
+func (c *copier) copyBlobs(ctx context.Context, data []byte) error {
+	manifest, err := ParseManifest(data)
+	if err != nil || manifest.Config == nil {
+		return errors.New(errors.ErrImageInvalid, fmt.Sprintf("unsupported manifest of %s", c.source))
+	}
+
+	// Blobs of a repository on the same registry can be mounted
+	var mountFrom []string
+	if apiHost(c.source.Domain) == apiHost(c.target.Domain) {
+		mountFrom = []string{c.source.Path}
+	}
+
+	for _, blob := range manifest.Blobs() {
+		if c.copied[blob.Digest] {
+			continue
+		}
+		digest := blob.Digest
+		err := c.to.UploadBlob(ctx, c.target, blob, func() (io.ReadCloser, error) {
+			return c.from.GetBlob(ctx, c.source, digest)
+		}, mountFrom...)
+		if err != nil {
+			return err
+		}
+		c.copied[blob.Digest] = true
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// Media types of manifests, configs and layers
+const (
+	MediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+	MediaTypeOCIConfig          = "application/vnd.oci.image.config.v1+json"
+	MediaTypeOCILayer           = "application/vnd.oci.image.layer.v1.tar"
+	MediaTypeOCILayerGzip       = "application/vnd.oci.image.layer.v1.tar+gzip"
+	MediaTypeOCILayerZstd       = "application/vnd.oci.image.layer.v1.tar+zstd"
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+// manifestMediaTypes are the manifest types accepted when fetching manifests
+var manifestMediaTypes = []string{
+	MediaTypeOCIManifest,
+	MediaTypeOCIIndex,
+	MediaTypeDockerManifest,
+	MediaTypeDockerManifestList,
+}
+
+// Descriptor describes a manifest or blob
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *Platform         `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Platform is the platform an image manifest is built for
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// String returns the platform as os/arch[/variant]
+func (p *Platform) String() string {
+	if p.Variant != "" {
+		return p.OS + "/" + p.Architecture + "/" + p.Variant
+	}
+	return p.OS + "/" + p.Architecture
+}
+
+// Manifest is an image manifest or an image index. Image manifests have a
+// config and layers, indexes list the manifests of each platform.
+type Manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Config        *Descriptor  `json:"config,omitempty"`
+	Layers        []Descriptor `json:"layers,omitempty"`
+	Manifests     []Descriptor `json:"manifests,omitempty"`
+}
+
+// ParseManifest parses a manifest or index
+func ParseManifest(data []byte) (*Manifest, error) {
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// Blobs returns the config and layer descriptors of an image manifest
+func (m *Manifest) Blobs() []Descriptor {
+	blobs := make([]Descriptor, 0, len(m.Layers)+1)
+	if m.Config != nil {
+		blobs = append(blobs, *m.Config)
+	}
+	return append(blobs, m.Layers...)
+}
+
+// IsIndex reports whether mediaType is an image index or manifest list
+func IsIndex(mediaType string) bool {
+	return mediaType == MediaTypeOCIIndex || mediaType == MediaTypeDockerManifestList
+}
+
+// imageConfig holds the platform fields of an image config
+type imageConfig struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// ConfigPlatform returns the platform recorded in an image config
+func ConfigPlatform(config []byte) (*Platform, error) {
+	var c imageConfig
+	if err := json.Unmarshal(config, &c); err != nil {
+		return nil, fmt.Errorf("invalid image config: %w", err)
+	}
+	return &Platform{Architecture: c.Architecture, OS: c.OS, Variant: c.Variant}, nil
+}
+
+// DefaultPlatform returns the platform of the host as os/arch
+func DefaultPlatform() string {
+	return "linux/" + runtime.GOARCH
+}
+
+// SelectManifest returns the manifest of an index that matches platform
+// (os/arch[/variant], defaulting to DefaultPlatform). Without a variant any
+// variant matches; arm64 manifests without a variant match v8.
+func SelectManifest(index *Manifest, platform string) (Descriptor, error) {
+	if platform == "" {
+		platform = DefaultPlatform()
+	}
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 {
+		return Descriptor{}, fmt.Errorf("invalid platform %q", platform)
+	}
+	osName, arch, variant := parts[0], parts[1], ""
+	if len(parts) > 2 {
+		variant = parts[2]
+	}
+
+	for _, desc := range index.Manifests {
+		p := desc.Platform
+		if p == nil || p.OS != osName || p.Architecture != arch {
+			continue
+		}
+		if variant == "" || p.Variant == variant || (p.Variant == "" && arch == "arm64" && variant == "v8") {
+			return desc, nil
+		}
+	}
+
+	return Descriptor{}, fmt.Errorf("no manifest for platform %s", platform)
+}
+
+// Digest returns the sha256 digest of data
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
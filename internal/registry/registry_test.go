@@ -0,0 +1,300 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/harpoon/hpn/internal/registry/registrytest"
+	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/reference"
+)
+
+func mustParse(t *testing.T, s string) *reference.Reference {
+	t.Helper()
+	ref, err := reference.Parse(s)
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %v", s, err)
+	}
+	return ref
+}
+
+func TestGetManifest(t *testing.T) {
+	reg := registrytest.New()
+	defer reg.Close()
+	digest := reg.AddIndex("team/app", "1.0", "linux/amd64", "linux/arm64/v8")
+
+	client := NewClient(Options{})
+	ctx := context.Background()
+
+	desc, data, err := client.GetManifest(ctx, mustParse(t, reg.Host()+"/team/app:1.0"))
+	if err != nil {
+		t.Fatalf("GetManifest failed: %v", err)
+	}
+	if desc.Digest != digest || desc.MediaType != MediaTypeOCIIndex {
+		t.Errorf("GetManifest = %+v, want index %s", desc, digest)
+	}
+
+	index, err := ParseManifest(data)
+	if err != nil {
+		t.Fatalf("ParseManifest failed: %v", err)
+	}
+	selected, err := SelectManifest(index, "linux/arm64")
+	if err != nil {
+		t.Fatalf("SelectManifest failed: %v", err)
+	}
+	if selected.Platform.String() != "linux/arm64/v8" {
+		t.Errorf("SelectManifest selected %s, want linux/arm64/v8", selected.Platform)
+	}
+	if _, err := SelectManifest(index, "linux/s390x"); err == nil {
+		t.Error("SelectManifest succeeded for a missing platform")
+	}
+
+	byDigest := mustParse(t, reg.Host()+"/team/app@"+selected.Digest)
+	if _, _, err := client.GetManifest(ctx, byDigest); err != nil {
+		t.Errorf("GetManifest by digest failed: %v", err)
+	}
+
+	_, _, err = client.GetManifest(ctx, mustParse(t, reg.Host()+"/team/app:missing"))
+	if errors.GetCode(err) != errors.ErrImageNotFound {
+		t.Errorf("GetManifest of a missing tag returned %v, want ErrImageNotFound", err)
+	}
+}
+
+func TestClientAuthentication(t *testing.T) {
+	reg := registrytest.New()
+	defer reg.Close()
+	reg.AddImage("app", "latest", "linux/amd64")
+	reg.RequireAuth("user", "secret")
+
+	ref := mustParse(t, reg.Host()+"/app")
+	ctx := context.Background()
+
+	_, _, err := NewClient(Options{}).GetManifest(ctx, ref)
+	if errors.GetCode(err) != errors.ErrRegistryAuth {
+		t.Errorf("anonymous GetManifest returned %v, want ErrRegistryAuth", err)
+	}
+	if err := NewClient(Options{}).Ping(ctx, reg.Host()); errors.GetCode(err) != errors.ErrRegistryAuth {
+		t.Errorf("anonymous Ping returned %v, want ErrRegistryAuth", err)
+	}
+
+	anonymous := len(reg.Requests())
+	client := NewClient(Options{Credentials: func(host string) (string, string) {
+		if host != reg.Host() {
+			t.Errorf("credentials requested for %s, want %s", host, reg.Host())
+		}
+		return "user", "secret"
+	}})
+	for i := 0; i < 2; i++ {
+		if _, _, err := client.GetManifest(ctx, ref); err != nil {
+			t.Fatalf("authenticated GetManifest failed: %v", err)
+		}
+	}
+
+	tokens := 0
+	for _, r := range reg.Requests()[anonymous:] {
+		if r == "GET /token" {
+			tokens++
+		}
+	}
+	if tokens != 1 {
+		t.Errorf("requested %d tokens, want 1 reused token", tokens)
+	}
+
+	if err := client.Ping(ctx, reg.Host()); err != nil {
+		t.Errorf("authenticated Ping failed: %v", err)
+	}
+}
+
+func TestPush(t *testing.T) {
+	reg := registrytest.New()
+	defer reg.Close()
+
+	client := NewClient(Options{})
+	ctx := context.Background()
+	ref := mustParse(t, reg.Host()+"/prod/app:v1")
+
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	configDesc := Descriptor{MediaType: MediaTypeOCIConfig, Digest: Digest(config), Size: int64(len(config))}
+	opens := 0
+	err := client.PushBlob(ctx, ref, configDesc, func() (io.ReadCloser, error) {
+		opens++
+		return io.NopCloser(bytes.NewReader(config)), nil
+	})
+	if err != nil {
+		t.Fatalf("PushBlob failed: %v", err)
+	}
+	if opens != 1 {
+		t.Errorf("blob opened %d times, want 1", opens)
+	}
+
+	manifest, err := json.Marshal(Manifest{SchemaVersion: 2, MediaType: MediaTypeOCIManifest, Config: &configDesc})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	digest, err := client.PutManifest(ctx, ref, MediaTypeOCIManifest, manifest)
+	if err != nil {
+		t.Fatalf("PutManifest failed: %v", err)
+	}
+	if stored, ok := reg.Manifest("prod/app", "v1"); !ok || Digest(stored) != digest {
+		t.Errorf("registry does not hold manifest %s under v1", digest)
+	}
+
+	missing := []byte(`{"schemaVersion":2,"config":{"digest":"` + Digest([]byte("missing")) + `"}}`)
+	if _, err := client.PutManifest(ctx, ref, MediaTypeOCIManifest, missing); err == nil {
+		t.Error("PutManifest succeeded with a missing config blob")
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	reg := registrytest.New()
+	defer reg.Close()
+	digest := reg.AddImage("app", "1.0", "linux/amd64")
+
+	ctx := context.Background()
+	client := NewClient(Options{})
+	ref := mustParse(t, reg.Host()+"/app:1.0")
+
+	store, err := OpenStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenStore failed: %v", err)
+	}
+	desc, data, err := client.GetManifest(ctx, ref)
+	if err != nil {
+		t.Fatalf("GetManifest failed: %v", err)
+	}
+	manifest, err := ParseManifest(data)
+	if err != nil {
+		t.Fatalf("ParseManifest failed: %v", err)
+	}
+	for _, blob := range manifest.Blobs() {
+		body, err := client.GetBlob(ctx, ref, blob.Digest)
+		if err != nil {
+			t.Fatalf("GetBlob failed: %v", err)
+		}
+		err = store.WriteBlob(blob.Digest, body)
+		body.Close()
+		if err != nil {
+			t.Fatalf("WriteBlob failed: %v", err)
+		}
+	}
+	if err := store.WriteBlob(desc.Digest, bytes.NewReader(data)); err != nil {
+		t.Fatalf("WriteBlob failed: %v", err)
+	}
+	if err := store.SetImage(ref.String(), desc); err != nil {
+		t.Fatalf("SetImage failed: %v", err)
+	}
+
+	var archive bytes.Buffer
+	if err := WriteArchive(ctx, store, &archive, []ArchiveImage{{Ref: ref, Descriptor: desc}}); err != nil {
+		t.Fatalf("WriteArchive failed: %v", err)
+	}
+
+	imported, err := OpenStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenStore failed: %v", err)
+	}
+	names, err := ReadArchive(ctx, imported, &archive)
+	if err != nil {
+		t.Fatalf("ReadArchive failed: %v", err)
+	}
+	if len(names) != 1 || names[0] != ref.String() {
+		t.Fatalf("ReadArchive imported %v, want [%s]", names, ref)
+	}
+	loaded, err := imported.Resolve(ref.String())
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if loaded.Digest != digest {
+		t.Errorf("loaded manifest %s, want %s", loaded.Digest, digest)
+	}
+	for _, blob := range manifest.Blobs() {
+		if !imported.HasBlob(blob.Digest) {
+			t.Errorf("blob %s missing after import", blob.Digest)
+		}
+	}
+}
+
+func TestWriteBlobVerifiesDigest(t *testing.T) {
+	store, err := OpenStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenStore failed: %v", err)
+	}
+
+	err = store.WriteBlob(Digest([]byte("expected")), strings.NewReader("actual"))
+	if errors.GetCode(err) != errors.ErrDigestMismatch {
+		t.Errorf("WriteBlob returned %v, want ErrDigestMismatch", err)
+	}
+	if store.HasBlob(Digest([]byte("expected"))) || store.HasBlob(Digest([]byte("actual"))) {
+		t.Error("WriteBlob stored a blob with a mismatching digest")
+	}
+}
+
+func TestCopy(t *testing.T) {
+	source := registrytest.New()
+	defer source.Close()
+	target := registrytest.New()
+	defer target.Close()
+	digest := source.AddIndex("library/app", "1.0", "linux/amd64", "linux/arm64")
+
+	ctx := context.Background()
+	client := NewClient(Options{})
+	sourceRef := mustParse(t, source.Host()+"/library/app:1.0")
+
+	mirrorRef := mustParse(t, target.Host()+"/mirror/app:1.0")
+	copied, err := Copy(ctx, client, sourceRef, client, mirrorRef, CopyOptions{})
+	if err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	if copied.Digest != digest || copied.UpToDate {
+		t.Errorf("Copy = %+v, want the unchanged index %s", copied, digest)
+	}
+
+	amd64, err := Copy(ctx, client, sourceRef, client, mustParse(t, target.Host()+"/mirror/app:amd64"), CopyOptions{Platforms: []string{"linux/amd64"}})
+	if err != nil {
+		t.Fatalf("Copy of one platform failed: %v", err)
+	}
+	data, _ := target.Manifest("mirror/app", "amd64")
+	if manifest, err := ParseManifest(data); err != nil || manifest.Config == nil || Digest(data) != amd64.Digest {
+		t.Errorf("Copy of one platform pushed %s, want an image manifest", amd64.Digest)
+	}
+
+	// Blobs are mounted between repositories of the same registry
+	uploads := func() int {
+		n := 0
+		for _, r := range target.Requests() {
+			if strings.HasPrefix(r, "PUT ") && strings.Contains(r, "/blobs/uploads/") {
+				n++
+			}
+		}
+		return n
+	}
+	before := uploads()
+	if _, err := Copy(ctx, client, mustParse(t, target.Host()+"/mirror/app:1.0"), client, mustParse(t, target.Host()+"/prod/app:1.0"), CopyOptions{}); err != nil {
+		t.Fatalf("Copy within a registry failed: %v", err)
+	}
+	if n := uploads() - before; n != 0 {
+		t.Errorf("Copy within a registry uploaded %d blobs, want all mounted", n)
+	}
+	if _, ok := target.Manifest("prod/app", "1.0"); !ok {
+		t.Error("Copy within a registry did not push the index")
+	}
+
+	// A repeated copy only checks the target manifest
+	requests := len(target.Requests())
+	again, err := Copy(ctx, client, sourceRef, client, mirrorRef, CopyOptions{})
+	if err != nil {
+		t.Fatalf("repeated Copy failed: %v", err)
+	}
+	if !again.UpToDate || again.Digest != digest {
+		t.Errorf("repeated Copy = %+v, want up to date %s", again, digest)
+	}
+	for _, r := range target.Requests()[requests:] {
+		if !strings.HasPrefix(r, "HEAD /v2/mirror/app/manifests/") {
+			t.Errorf("repeated Copy sent %s, want only a manifest check", r)
+		}
+	}
+}
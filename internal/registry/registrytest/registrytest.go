@@ -0,0 +1,429 @@
+// Package registrytest provides an in-memory registry implementing the parts
+// of the OCI distribution API used by hpn, for tests that pull and push
+// images without network access.
+package registrytest
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// token is the bearer token issued to authenticated clients
+const token = "registrytest-token"
+
+// Media types of the manifests created by AddImage and AddIndex
+const (
+	mediaTypeManifest = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeIndex    = "application/vnd.oci.image.index.v1+json"
+)
+
+// Registry is an in-memory registry served over HTTP or HTTPS on a loopback
+// address
+type Registry struct {
+	server *httptest.Server
+
+	mu        sync.Mutex
+	manifests map[string]manifest          // by repository and tag or digest
+	blobs     map[string]map[string][]byte // by repository and digest
+	uploads   map[string]string            // upload id to repository
+	requests  []string
+	username  string
+	password  string
+	nextID    int
+}
+
+// manifest is a stored manifest and its media type
+type manifest struct {
+	mediaType string
+	data      []byte
+}
+
+// New starts a registry. It is stopped when Close is called.
+func New() *Registry {
+	r := newRegistry()
+	r.server = httptest.NewServer(http.HandlerFunc(r.serve))
+	return r
+}
+
+// NewTLS starts a registry served over HTTPS with a self-signed certificate
+// valid for example.com and loopback addresses
+func NewTLS() *Registry {
+	r := newRegistry()
+	r.server = httptest.NewTLSServer(http.HandlerFunc(r.serve))
+	return r
+}
+
+// newRegistry returns an empty registry that is not yet served
+func newRegistry() *Registry {
+	return &Registry{
+		manifests: make(map[string]manifest),
+		blobs:     make(map[string]map[string][]byte),
+		uploads:   make(map[string]string),
+	}
+}
+
+// Close stops the registry
+func (r *Registry) Close() {
+	r.server.Close()
+}
+
+// Host returns the host:port of the registry, usable as the domain of image
+// references
+func (r *Registry) Host() string {
+	return r.server.Listener.Addr().String()
+}
+
+// CertificatePEM returns the PEM encoded certificate of a registry started
+// with NewTLS
+func (r *Registry) CertificatePEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: r.server.Certificate().Raw})
+}
+
+// RequireAuth makes the registry require a bearer token, which is issued to
+// clients presenting username and password
+func (r *Registry) RequireAuth(username, password string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.username, r.password = username, password
+}
+
+// AddBlob stores a blob in a repository and returns its digest
+func (r *Registry) AddBlob(repository string, data []byte) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	digest := digestOf(data)
+	r.putBlob(repository, digest, data)
+	return digest
+}
+
+// AddManifest stores a manifest in a repository under tag, which may be
+// empty, and returns its digest
+func (r *Registry) AddManifest(repository, tag, mediaType string, data []byte) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	digest := digestOf(data)
+	r.manifests[repository+"@"+digest] = manifest{mediaType, data}
+	if tag != "" {
+		r.manifests[repository+":"+tag] = manifest{mediaType, data}
+	}
+	return digest
+}
+
+// AddImage stores an image for platform (os/arch[/variant]) with a single
+// gzip-compressed layer under tag and returns the digest of its manifest
+func (r *Registry) AddImage(repository, tag, platform string) string {
+	parts := strings.SplitN(platform, "/", 3)
+	config := map[string]string{"os": parts[0], "architecture": parts[1]}
+	if len(parts) == 3 {
+		config["variant"] = parts[2]
+	}
+	configData, _ := json.Marshal(config)
+	layer := layerData(repository + " " + platform)
+
+	data, _ := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     mediaTypeManifest,
+		"config":        descriptor("application/vnd.oci.image.config.v1+json", r.AddBlob(repository, configData), len(configData)),
+		"layers": []any{
+			descriptor("application/vnd.oci.image.layer.v1.tar+gzip", r.AddBlob(repository, layer), len(layer)),
+		},
+	})
+	return r.AddManifest(repository, tag, mediaTypeManifest, data)
+}
+
+// AddIndex stores an image index with an image for each platform under tag
+// and returns the digest of the index
+func (r *Registry) AddIndex(repository, tag string, platforms ...string) string {
+	var manifests []any
+	for _, platform := range platforms {
+		digest := r.AddImage(repository, "", platform)
+		data, _ := r.Manifest(repository, digest)
+
+		desc := descriptor(mediaTypeManifest, digest, len(data))
+		parts := strings.SplitN(platform, "/", 3)
+		p := map[string]string{"os": parts[0], "architecture": parts[1]}
+		if len(parts) == 3 {
+			p["variant"] = parts[2]
+		}
+		desc["platform"] = p
+		manifests = append(manifests, desc)
+	}
+
+	data, _ := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     mediaTypeIndex,
+		"manifests":     manifests,
+	})
+	return r.AddManifest(repository, tag, mediaTypeIndex, data)
+}
+
+// Manifest returns the manifest of a repository by tag or digest
+func (r *Registry) Manifest(repository, reference string) ([]byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m, ok := r.manifests[manifestKey(repository, reference)]
+	return m.data, ok
+}
+
+// Blob returns a blob of a repository
+func (r *Registry) Blob(repository, digest string) ([]byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data, ok := r.blobs[repository][digest]
+	return data, ok
+}
+
+// Requests returns the requests served so far as "METHOD /path"
+func (r *Registry) Requests() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.requests...)
+}
+
+// serve dispatches a request
+func (r *Registry) serve(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req.Method+" "+req.URL.Path)
+
+	if req.URL.Path == "/token" {
+		r.serveToken(w, req)
+		return
+	}
+	if !strings.HasPrefix(req.URL.Path, "/v2/") {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+		return
+	}
+	if r.username != "" && req.Header.Get("Authorization") != "Bearer "+token {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registrytest"`, r.server.URL))
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+		return
+	}
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case path == "":
+		w.WriteHeader(http.StatusOK)
+	case strings.Contains(path, "/blobs/uploads/"):
+		i := strings.LastIndex(path, "/blobs/uploads/")
+		r.serveUpload(w, req, path[:i], path[i+len("/blobs/uploads/"):])
+	case strings.Contains(path, "/blobs/"):
+		i := strings.LastIndex(path, "/blobs/")
+		r.serveBlob(w, req, path[:i], path[i+len("/blobs/"):])
+	case strings.Contains(path, "/manifests/"):
+		i := strings.LastIndex(path, "/manifests/")
+		r.serveManifest(w, req, path[:i], path[i+len("/manifests/"):])
+	default:
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+	}
+}
+
+// serveToken issues a token for valid basic credentials
+func (r *Registry) serveToken(w http.ResponseWriter, req *http.Request) {
+	expected := "Basic " + base64.StdEncoding.EncodeToString([]byte(r.username+":"+r.password))
+	if req.Header.Get("Authorization") != expected {
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid credentials")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"token": token})
+}
+
+// serveManifest serves manifest GET, HEAD and PUT requests
+func (r *Registry) serveManifest(w http.ResponseWriter, req *http.Request, repository, reference string) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		m, ok := r.manifests[manifestKey(repository, reference)]
+		if !ok {
+			writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+			return
+		}
+		w.Header().Set("Content-Type", m.mediaType)
+		w.Header().Set("Docker-Content-Digest", digestOf(m.data))
+		w.Header().Set("Content-Length", strconv.Itoa(len(m.data)))
+		if req.Method == http.MethodGet {
+			w.Write(m.data)
+		}
+
+	case http.MethodPut:
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+			return
+		}
+		var refs struct {
+			Config *struct {
+				Digest string `json:"digest"`
+			} `json:"config"`
+			Layers []struct {
+				Digest string `json:"digest"`
+			} `json:"layers"`
+			Manifests []struct {
+				Digest string `json:"digest"`
+			} `json:"manifests"`
+		}
+		if err := json.Unmarshal(data, &refs); err != nil {
+			writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+			return
+		}
+		var missing []string
+		if refs.Config != nil {
+			missing = append(missing, refs.Config.Digest)
+		}
+		for _, layer := range refs.Layers {
+			missing = append(missing, layer.Digest)
+		}
+		for _, digest := range missing {
+			if _, ok := r.blobs[repository][digest]; !ok {
+				writeError(w, http.StatusBadRequest, "BLOB_UNKNOWN", "blob unknown: "+digest)
+				return
+			}
+		}
+		for _, child := range refs.Manifests {
+			if _, ok := r.manifests[repository+"@"+child.Digest]; !ok {
+				writeError(w, http.StatusBadRequest, "MANIFEST_BLOB_UNKNOWN", "manifest unknown: "+child.Digest)
+				return
+			}
+		}
+
+		digest := digestOf(data)
+		if strings.Contains(reference, ":") && reference != digest {
+			writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "digest does not match")
+			return
+		}
+		m := manifest{req.Header.Get("Content-Type"), data}
+		r.manifests[repository+"@"+digest] = m
+		if !strings.Contains(reference, ":") {
+			r.manifests[repository+":"+reference] = m
+		}
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusCreated)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "unsupported method")
+	}
+}
+
+// serveBlob serves blob GET and HEAD requests
+func (r *Registry) serveBlob(w http.ResponseWriter, req *http.Request, repository, digest string) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "unsupported method")
+		return
+	}
+	data, ok := r.blobs[repository][digest]
+	if !ok {
+		writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown")
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	if req.Method == http.MethodGet {
+		w.Write(data)
+	}
+}
+
+// serveUpload starts uploads and completes monolithic uploads
+func (r *Registry) serveUpload(w http.ResponseWriter, req *http.Request, repository, id string) {
+	switch {
+	case req.Method == http.MethodPost && id == "" && req.URL.Query().Get("mount") != "":
+		digest := req.URL.Query().Get("mount")
+		if data, ok := r.blobs[req.URL.Query().Get("from")][digest]; ok {
+			r.putBlob(repository, digest, data)
+			w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/%s", repository, digest))
+			w.Header().Set("Docker-Content-Digest", digest)
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		fallthrough
+
+	case req.Method == http.MethodPost && id == "":
+		r.nextID++
+		id = strconv.Itoa(r.nextID)
+		r.uploads[id] = repository
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s?state=%s", repository, id, id))
+		w.Header().Set("Docker-Upload-UUID", id)
+		w.WriteHeader(http.StatusAccepted)
+
+	case req.Method == http.MethodPut && r.uploads[id] == repository:
+		digest := req.URL.Query().Get("digest")
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "BLOB_UPLOAD_INVALID", err.Error())
+			return
+		}
+		if digestOf(data) != digest {
+			writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "digest does not match content")
+			return
+		}
+		delete(r.uploads, id)
+		r.putBlob(repository, digest, data)
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/%s", repository, digest))
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusCreated)
+
+	default:
+		writeError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "upload unknown")
+	}
+}
+
+// putBlob stores a blob; the caller holds r.mu
+func (r *Registry) putBlob(repository, digest string, data []byte) {
+	if r.blobs[repository] == nil {
+		r.blobs[repository] = make(map[string][]byte)
+	}
+	r.blobs[repository][digest] = data
+}
+
+// descriptor returns a content descriptor
+func descriptor(mediaType, digest string, size int) map[string]any {
+	return map[string]any{"mediaType": mediaType, "digest": digest, "size": size}
+}
+
+// layerData returns a gzip-compressed tar holding a single file with content
+func layerData(content string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "content", Mode: 0644, Size: int64(len(content))})
+	tw.Write([]byte(content))
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+// manifestKey returns the key of a manifest by tag or digest
+func manifestKey(repository, reference string) string {
+	if strings.Contains(reference, ":") {
+		return repository + "@" + reference
+	}
+	return repository + ":" + reference
+}
+
+// digestOf returns the sha256 digest of data
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// writeError writes an error response of the distribution API
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
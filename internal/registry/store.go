@@ -0,0 +1,311 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/harpoon/hpn/pkg/errors"
+)
+
+// Annotations of the images in a store
+const (
+	// AnnotationRefName is the fully qualified reference of an image
+	AnnotationRefName = "org.opencontainers.image.ref.name"
+
+	// AnnotationImageName is the image name used by containerd and docker archives
+	AnnotationImageName = "io.containerd.image.name"
+
+	// annotationRepoDigests lists the repo@digest references the manifest of
+	// an image is known under in registries, separated by spaces
+	annotationRepoDigests = "io.harpoon.repo-digests"
+)
+
+// ociLayout is the content of the oci-layout file
+const ociLayout = `{"imageLayoutVersion":"1.0.0"}`
+
+// Store is a local image store in OCI image layout. Every image is an entry
+// of index.json annotated with its fully qualified reference; blobs are
+// shared between images.
+type Store struct {
+	dir string
+	mu  sync.Mutex // guards index.json
+}
+
+// OpenStore opens the store in dir, creating it if needed
+func OpenStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755); err != nil {
+		return nil, errors.Wrap(err, errors.ErrFileOperation, fmt.Sprintf("failed to create image store %s", dir))
+	}
+
+	layout := filepath.Join(dir, "oci-layout")
+	if _, err := os.Stat(layout); os.IsNotExist(err) {
+		if err := os.WriteFile(layout, []byte(ociLayout), 0644); err != nil {
+			return nil, errors.Wrap(err, errors.ErrFileOperation, fmt.Sprintf("failed to create image store %s", dir))
+		}
+	}
+
+	return &Store{dir: dir}, nil
+}
+
+// Dir returns the directory of the store
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// blobPath returns the path of a blob
+func (s *Store) blobPath(digest string) (string, error) {
+	algorithm, hexDigest, ok := strings.Cut(digest, ":")
+	if !ok || algorithm != "sha256" || len(hexDigest) != 64 || strings.ContainsAny(hexDigest, "/\\.") {
+		return "", errors.New(errors.ErrImageInvalid, fmt.Sprintf("unsupported digest %q", digest))
+	}
+	return filepath.Join(s.dir, "blobs", algorithm, hexDigest), nil
+}
+
+// HasBlob reports whether the store contains a blob
+func (s *Store) HasBlob(digest string) bool {
+	path, err := s.blobPath(digest)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// OpenBlob opens a blob for reading
+func (s *Store) OpenBlob(digest string) (*os.File, error) {
+	path, err := s.blobPath(digest)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.New(errors.ErrImageNotFound, fmt.Sprintf("blob %s not found in image store", digest))
+		}
+		return nil, errors.Wrap(err, errors.ErrFileOperation, fmt.Sprintf("failed to open blob %s", digest))
+	}
+	return f, nil
+}
+
+// ReadBlob reads a blob into memory. It is meant for manifests and configs.
+func (s *Store) ReadBlob(digest string) ([]byte, error) {
+	f, err := s.OpenBlob(digest)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrFileOperation, fmt.Sprintf("failed to read blob %s", digest))
+	}
+	return data, nil
+}
+
+// WriteBlob stores the content of r as the blob digest, verifying the digest
+func (s *Store) WriteBlob(digest string, r io.Reader) error {
+	if _, err := s.blobPath(digest); err != nil {
+		return err
+	}
+	_, _, err := s.writeBlob(r, digest)
+	return err
+}
+
+// AddBlob stores the content of r and returns its digest and size
+func (s *Store) AddBlob(r io.Reader) (string, int64, error) {
+	return s.writeBlob(r, "")
+}
+
+// writeBlob writes r to a temporary file, computing its digest, and moves it
+// into place unless it does not match the expected digest
+func (s *Store) writeBlob(r io.Reader, expected string) (string, int64, error) {
+	tmp, err := os.CreateTemp(filepath.Join(s.dir, "blobs"), ".upload-*")
+	if err != nil {
+		return "", 0, errors.Wrap(err, errors.ErrFileOperation, "failed to create blob")
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, errors.Wrap(err, errors.ErrFileOperation, "failed to write blob")
+	}
+
+	digest := "sha256:" + hex.EncodeToString(hash.Sum(nil))
+	if expected != "" && digest != expected {
+		return "", 0, errors.New(errors.ErrDigestMismatch, fmt.Sprintf("blob has digest %s, expected %s", digest, expected))
+	}
+
+	path, err := s.blobPath(digest)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, errors.Wrap(err, errors.ErrFileOperation, "failed to store blob")
+	}
+	return digest, size, nil
+}
+
+// Resolve returns the manifest descriptor of an image by its fully
+// qualified reference
+func (s *Store) Resolve(name string) (Descriptor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.readIndex()
+	if err != nil {
+		return Descriptor{}, err
+	}
+	for _, desc := range index.Manifests {
+		if desc.Annotations[AnnotationRefName] == name {
+			return desc, nil
+		}
+	}
+	return Descriptor{}, errors.NewImageNotFound(name)
+}
+
+// SetImage points the image name at the manifest desc, replacing a previous
+// image of that name. repoDigests are the registry references of the
+// manifest known so far.
+func (s *Store) SetImage(name string, desc Descriptor, repoDigests ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.readIndex()
+	if err != nil {
+		return err
+	}
+
+	entry := Descriptor{
+		MediaType:   desc.MediaType,
+		Digest:      desc.Digest,
+		Size:        desc.Size,
+		Platform:    desc.Platform,
+		Annotations: map[string]string{AnnotationRefName: name},
+	}
+	if len(repoDigests) > 0 {
+		entry.Annotations[annotationRepoDigests] = strings.Join(repoDigests, " ")
+	}
+
+	manifests := index.Manifests[:0]
+	for _, existing := range index.Manifests {
+		if existing.Annotations[AnnotationRefName] != name {
+			manifests = append(manifests, existing)
+		}
+	}
+	index.Manifests = append(manifests, entry)
+
+	return s.writeIndex(index)
+}
+
+// AddRepoDigest records that the manifest of image name is known in a
+// registry as repoDigest
+func (s *Store) AddRepoDigest(name, repoDigest string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.readIndex()
+	if err != nil {
+		return err
+	}
+
+	for i, desc := range index.Manifests {
+		if desc.Annotations[AnnotationRefName] != name {
+			continue
+		}
+		digests := strings.Fields(desc.Annotations[annotationRepoDigests])
+		for _, existing := range digests {
+			if existing == repoDigest {
+				return nil
+			}
+		}
+		index.Manifests[i].Annotations[annotationRepoDigests] = strings.Join(append(digests, repoDigest), " ")
+		return s.writeIndex(index)
+	}
+
+	return errors.NewImageNotFound(name)
+}
+
+// RepoDigests returns the registry references of the manifest of image
+// name, collected from every image sharing that manifest
+func (s *Store) RepoDigests(name string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.readIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	digest := ""
+	for _, desc := range index.Manifests {
+		if desc.Annotations[AnnotationRefName] == name {
+			digest = desc.Digest
+			break
+		}
+	}
+	if digest == "" {
+		return nil, errors.NewImageNotFound(name)
+	}
+
+	seen := make(map[string]bool)
+	var repoDigests []string
+	for _, desc := range index.Manifests {
+		if desc.Digest != digest {
+			continue
+		}
+		for _, repoDigest := range strings.Fields(desc.Annotations[annotationRepoDigests]) {
+			if !seen[repoDigest] {
+				seen[repoDigest] = true
+				repoDigests = append(repoDigests, repoDigest)
+			}
+		}
+	}
+	sort.Strings(repoDigests)
+	return repoDigests, nil
+}
+
+// readIndex reads index.json, returning an empty index if there is none
+func (s *Store) readIndex() (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, "index.json"))
+	if os.IsNotExist(err) {
+		return &Manifest{SchemaVersion: 2, MediaType: MediaTypeOCIIndex}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrFileOperation, "failed to read image store index")
+	}
+
+	var index Manifest
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, errors.Wrap(err, errors.ErrFileOperation, fmt.Sprintf("corrupt image store index %s", filepath.Join(s.dir, "index.json")))
+	}
+	return &index, nil
+}
+
+// writeIndex replaces index.json atomically
+func (s *Store) writeIndex(index *Manifest) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, errors.ErrFileOperation, "failed to encode image store index")
+	}
+
+	path := filepath.Join(s.dir, "index.json")
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return errors.Wrap(err, errors.ErrFileOperation, "failed to write image store index")
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return errors.Wrap(err, errors.ErrFileOperation, "failed to write image store index")
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/harpoon/hpn/internal/auth"
+	"github.com/harpoon/hpn/pkg/errors"
+)
+
+// CredentialFunc returns the username and password hpn has for a registry
+// host, or empty strings to leave authentication to the runtime's own login
+type CredentialFunc func(host string) (username, password string)
+
+// credentialSetter is implemented by runtimes that accept credentials
+type credentialSetter interface {
+	SetCredentials(credentials CredentialFunc)
+}
+
+// registryCredential returns the registry host of image and the credentials
+// hpn has for it, or ok false if it has none
+func registryCredential(credentials CredentialFunc, image string) (host string, cred auth.Credential, ok bool) {
+	if credentials == nil {
+		return "", auth.Credential{}, false
+	}
+	host = RegistryHost(image)
+	username, password := credentials(host)
+	cred = auth.Credential{Username: username, Password: password}
+	return host, cred, !cred.IsEmpty()
+}
+
+// dockerAuthEnv returns env with DOCKER_CONFIG pointing docker or nerdctl at
+// a temporary copy of the user's docker config holding the credentials hpn
+// has for the registry of image, so contexts, proxies and other credential
+// helpers keep working. env is returned unchanged if hpn has none. cleanup
+// removes the copy.
+func dockerAuthEnv(env []string, credentials CredentialFunc, image string) ([]string, func(), error) {
+	host, cred, ok := registryCredential(credentials, image)
+	if !ok {
+		return env, func() {}, nil
+	}
+
+	dir, err := os.MkdirTemp("", "hpn-auth-")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, errors.ErrFileOperation, "failed to create temporary docker config")
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	if err := auth.MergeDockerConfig(dir, auth.DockerConfigDir(), host, cred); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	if env == nil {
+		env = os.Environ()
+	}
+	env = append(withoutEnv(env, []string{"DOCKER_CONFIG"}), "DOCKER_CONFIG="+dir)
+	return env, cleanup, nil
+}
+
+// authFile writes the credentials hpn has for the registry of image to a
+// temporary auth file for podman's --authfile, returning an empty path if
+// it has none. cleanup removes the file.
+func authFile(credentials CredentialFunc, image string) (path string, cleanup func(), err error) {
+	cleanup = func() {}
+	host, cred, ok := registryCredential(credentials, image)
+	if !ok {
+		return "", cleanup, nil
+	}
+
+	dir, err := os.MkdirTemp("", "hpn-auth-")
+	if err != nil {
+		return "", nil, errors.Wrap(err, errors.ErrFileOperation, "failed to create temporary auth file")
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+
+	config := &auth.Config{}
+	config.Set(host, cred)
+	path = filepath.Join(dir, "auth.json")
+	if err := config.Save(path); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return path, cleanup, nil
+}
+
+// withoutEnv removes the variables names from env
+func withoutEnv(env, names []string) []string {
+	filtered := make([]string, 0, len(env))
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		drop := false
+		for _, n := range names {
+			if name == n {
+				drop = true
+				break
+			}
+		}
+		if !drop {
+			filtered = append(filtered, kv)
+		}
+	}
+	return filtered
+}
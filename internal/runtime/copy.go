@@ -0,0 +1,23 @@
+package runtime
+
+import "context"
+
+// ImageCopier is implemented by runtimes that can copy images from one
+// registry to another without storing them locally
+type ImageCopier interface {
+	// Copy copies source to target unless target already holds its manifest
+	Copy(ctx context.Context, source, target string, options CopyOptions) (CopyResult, error)
+}
+
+// CopyOptions contains options for copy operations
+type CopyOptions struct {
+	Proxy     *ProxyConfig
+	Platforms []string // platforms of an image index to copy, all by default
+	Force     bool     // copy even if the target is up to date
+}
+
+// CopyResult describes a completed copy
+type CopyResult struct {
+	Digest   string // digest of the manifest at the target
+	UpToDate bool   // the target already held the manifest, nothing was copied
+}
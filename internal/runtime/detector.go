@@ -5,21 +5,82 @@ import (
 	"os/exec"
 	"sort"
 
+	"github.com/harpoon/hpn/internal/logger"
 	"github.com/harpoon/hpn/pkg/errors"
 )
 
 // Detector implements RuntimeDetector interface
 type Detector struct {
-	runtimes map[string]ContainerRuntime
+	runtimes    map[string]ContainerRuntime
+	logger      logger.Logger
+	storeDir    string
+	credentials CredentialFunc
+	stored      CredentialFunc // credentials passed to container engines
+	tls         *TLSConfig
+}
+
+// loggerSetter is implemented by runtimes that accept a logger
+type loggerSetter interface {
+	SetLogger(l logger.Logger)
 }
 
 // NewDetector creates a new runtime detector
 func NewDetector() *Detector {
 	return &Detector{
 		runtimes: make(map[string]ContainerRuntime),
+		logger:   logger.Nop(),
+	}
+}
+
+// SetLogger sets the logger passed to detected runtimes
+func (d *Detector) SetLogger(l logger.Logger) {
+	d.logger = l
+	for _, runtime := range d.runtimes {
+		if setter, ok := runtime.(loggerSetter); ok {
+			setter.SetLogger(l)
+		}
 	}
 }
 
+// SetCredentials sets the registry credentials passed to detected runtimes.
+// Container engines receive stored instead, the credentials that may be
+// written to their temporary auth files; nil passes none.
+func (d *Detector) SetCredentials(credentials, stored CredentialFunc) {
+	d.credentials = credentials
+	d.stored = stored
+	for _, runtime := range d.runtimes {
+		d.setCredentials(runtime)
+	}
+}
+
+// setCredentials passes the credentials of the detector to a runtime
+func (d *Detector) setCredentials(runtime ContainerRuntime) {
+	setter, ok := runtime.(credentialSetter)
+	if !ok {
+		return
+	}
+	if _, native := runtime.(*NativeRuntime); native {
+		setter.SetCredentials(d.credentials)
+	} else {
+		setter.SetCredentials(d.stored)
+	}
+}
+
+// SetTLS sets the registry TLS settings passed to detected runtimes
+func (d *Detector) SetTLS(config *TLSConfig) {
+	d.tls = config
+	for _, runtime := range d.runtimes {
+		if setter, ok := runtime.(tlsSetter); ok {
+			setter.SetTLS(config)
+		}
+	}
+}
+
+// SetNativeStore sets the image store directory of the native runtime
+func (d *Detector) SetNativeStore(dir string) {
+	d.storeDir = dir
+}
+
 // DetectAvailable detects all available container runtimes
 func (d *Detector) DetectAvailable() []ContainerRuntime {
 	var available []ContainerRuntime
@@ -29,22 +90,33 @@ func (d *Detector) DetectAvailable() []ContainerRuntime {
 		NewDockerRuntime(),
 		NewPodmanRuntime(),
 		NewNerdctlRuntime(),
+		NewNativeRuntime(d.storeDir),
 	}
 
 	// Check availability and store
 	for _, runtime := range runtimes {
-		if runtime.IsAvailable() {
+		if setter, ok := runtime.(loggerSetter); ok {
+			setter.SetLogger(d.logger)
+		}
+		d.setCredentials(runtime)
+		if setter, ok := runtime.(tlsSetter); ok && d.tls != nil {
+			setter.SetTLS(d.tls)
+		}
+		isAvailable := runtime.IsAvailable()
+		if isAvailable {
 			available = append(available, runtime)
 			d.runtimes[runtime.Name()] = runtime
 		}
+		d.logger.Debug("Detected container runtime", logger.F("runtime", runtime.Name()), logger.F("available", isAvailable))
 	}
 
-	// Sort by priority (Docker > Podman > Nerdctl)
+	// Sort by priority (Docker > Podman > Nerdctl > Native)
 	sort.Slice(available, func(i, j int) bool {
 		priority := map[string]int{
 			"docker":  1,
 			"podman":  2,
 			"nerdctl": 3,
+			"native":  4,
 		}
 		return priority[available[i].Name()] < priority[available[j].Name()]
 	})
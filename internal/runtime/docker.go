@@ -3,26 +3,49 @@ package runtime
 import (
 	"context"
 	"fmt"
-	"os"
 	"os/exec"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/harpoon/hpn/internal/logger"
 	"github.com/harpoon/hpn/pkg/errors"
 )
 
 // DockerRuntime implements ContainerRuntime for Docker
 type DockerRuntime struct {
-	command string
+	command     string
+	logger      logger.Logger
+	credentials CredentialFunc
+	tls         *TLSConfig
+	warned      sync.Map // registries warned about TLS settings
+	proxyWarned sync.Map // registries warned about proxy settings
 }
 
 // NewDockerRuntime creates a new Docker runtime
 func NewDockerRuntime() *DockerRuntime {
 	return &DockerRuntime{
 		command: "docker",
+		logger:  logger.Nop(),
 	}
 }
 
+// SetLogger sets the logger used for runtime commands
+func (d *DockerRuntime) SetLogger(l logger.Logger) {
+	d.logger = l.WithFields(logger.F("runtime", "docker"))
+}
+
+// SetCredentials sets the registry credentials passed to runtime commands
+func (d *DockerRuntime) SetCredentials(credentials CredentialFunc) {
+	d.credentials = credentials
+}
+
+// SetTLS sets the registry TLS settings. Docker takes them from the daemon
+// configuration, so they only make manifest commands skip verification.
+func (d *DockerRuntime) SetTLS(config *TLSConfig) {
+	d.tls = config
+}
+
 // Name returns the runtime name
 func (d *DockerRuntime) Name() string {
 	return "docker"
@@ -52,70 +75,157 @@ func (d *DockerRuntime) Pull(ctx context.Context, image string, options PullOpti
 	}
 
 	args = append(args, image)
+	d.warnTLS(image)
+	d.warnProxy(options.Proxy, image)
 
 	cmd := exec.CommandContext(ctx, d.command, args...)
 
-	// Set proxy environment if configured
-	if options.Proxy != nil && options.Proxy.Enabled {
-		env := os.Environ()
-		if options.Proxy.HTTP != "" {
-			env = append(env, fmt.Sprintf("http_proxy=%s", options.Proxy.HTTP))
-		}
-		if options.Proxy.HTTPS != "" {
-			env = append(env, fmt.Sprintf("https_proxy=%s", options.Proxy.HTTPS))
-		}
-		cmd.Env = env
-	}
-
-	if err := cmd.Run(); err != nil {
-		return errors.Wrap(err, errors.ErrRuntimeCommand, fmt.Sprintf("failed to pull image %s", image))
+	// Set proxy environment and credentials if configured
+	env, cleanup, err := dockerAuthEnv(proxyEnv(options.Proxy, image), d.credentials, image)
+	if err != nil {
+		return err
 	}
+	defer cleanup()
+	cmd.Env = env
 
-	return nil
+	return runCommand(ctx, d.logger, cmd, fmt.Sprintf("failed to pull image %s", image))
 }
 
 // Save saves an image to a tar file
 func (d *DockerRuntime) Save(ctx context.Context, image string, tarPath string) error {
 	cmd := exec.CommandContext(ctx, d.command, "save", "-o", tarPath, image)
-	
-	if err := cmd.Run(); err != nil {
-		return errors.Wrap(err, errors.ErrRuntimeCommand, fmt.Sprintf("failed to save image %s to %s", image, tarPath))
-	}
 
-	return nil
+	return runCommand(ctx, d.logger, cmd, fmt.Sprintf("failed to save image %s to %s", image, tarPath))
 }
 
 // Load loads an image from a tar file
 func (d *DockerRuntime) Load(ctx context.Context, tarPath string) error {
 	cmd := exec.CommandContext(ctx, d.command, "load", "-i", tarPath)
-	
-	if err := cmd.Run(); err != nil {
-		return errors.Wrap(err, errors.ErrRuntimeCommand, fmt.Sprintf("failed to load image from %s", tarPath))
-	}
 
-	return nil
+	return runCommand(ctx, d.logger, cmd, fmt.Sprintf("failed to load image from %s", tarPath))
 }
 
 // Push pushes an image to a registry
 func (d *DockerRuntime) Push(ctx context.Context, image string, options PushOptions) error {
+	d.warnTLS(image)
+	d.warnProxy(options.Proxy, image)
 	cmd := exec.CommandContext(ctx, d.command, "push", image)
-	
-	if err := cmd.Run(); err != nil {
-		return errors.Wrap(err, errors.ErrRuntimeCommand, fmt.Sprintf("failed to push image %s", image))
+
+	// Set proxy environment and credentials if configured
+	env, cleanup, err := dockerAuthEnv(proxyEnv(options.Proxy, image), d.credentials, image)
+	if err != nil {
+		return err
 	}
+	defer cleanup()
+	cmd.Env = env
 
-	return nil
+	return runCommand(ctx, d.logger, cmd, fmt.Sprintf("failed to push image %s", image))
 }
 
 // Tag tags an image with a new name
 func (d *DockerRuntime) Tag(ctx context.Context, source, target string) error {
 	cmd := exec.CommandContext(ctx, d.command, "tag", source, target)
-	
-	if err := cmd.Run(); err != nil {
-		return errors.Wrap(err, errors.ErrRuntimeCommand, fmt.Sprintf("failed to tag image %s as %s", source, target))
+
+	return runCommand(ctx, d.logger, cmd, fmt.Sprintf("failed to tag image %s as %s", source, target))
+}
+
+// RepoDigests returns the repo@digest references of a local image
+func (d *DockerRuntime) RepoDigests(ctx context.Context, image string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, d.command, "image", "inspect", "--format", "{{json .RepoDigests}}", image)
+
+	output, err := runCommandOutput(ctx, d.logger, cmd, fmt.Sprintf("failed to inspect image %s", image))
+	if err != nil {
+		return nil, err
+	}
+	return parseRepoDigests(output)
+}
+
+// IsIndex reports whether image refers to an image index in its registry
+func (d *DockerRuntime) IsIndex(ctx context.Context, image string, options PullOptions) (bool, error) {
+	args := []string{"manifest", "inspect"}
+	if !d.tls.ForImage(image).Verify() {
+		args = append(args, "--insecure")
+	}
+	cmd := exec.CommandContext(ctx, d.command, append(args, image)...)
+
+	// Set proxy environment and credentials if configured
+	env, cleanup, err := dockerAuthEnv(proxyEnv(options.Proxy, image), d.credentials, image)
+	if err != nil {
+		return false, err
 	}
+	defer cleanup()
+	cmd.Env = env
 
-	return nil
+	output, err := runCommandOutput(ctx, d.logger, cmd, fmt.Sprintf("failed to inspect manifest of %s", image))
+	if err != nil {
+		return false, err
+	}
+	return parseIndex(output)
+}
+
+// PushManifestList creates a manifest list from pushed images and pushes it.
+// The local copy of the list is removed after the push.
+func (d *DockerRuntime) PushManifestList(ctx context.Context, list string, images []string, options PushOptions) error {
+	args := []string{"manifest", "create", "--amend"}
+	insecure := !d.tls.ForImage(list).Verify()
+	if insecure {
+		args = append(args, "--insecure")
+	}
+	args = append(append(args, list), images...)
+	cmd := exec.CommandContext(ctx, d.command, args...)
+
+	// Set proxy environment and credentials if configured
+	env, cleanup, err := dockerAuthEnv(proxyEnv(options.Proxy, list), d.credentials, list)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	cmd.Env = env
+
+	if err := runCommand(ctx, d.logger, cmd, fmt.Sprintf("failed to create manifest list %s", list)); err != nil {
+		return err
+	}
+
+	args = []string{"manifest", "push", "--purge"}
+	if insecure {
+		args = append(args, "--insecure")
+	}
+	cmd = exec.CommandContext(ctx, d.command, append(args, list)...)
+	if env != nil {
+		cmd.Env = env
+	}
+
+	return runCommand(ctx, d.logger, cmd, fmt.Sprintf("failed to push manifest list %s", list))
+}
+
+// warnTLS warns once per registry that its TLS settings must be configured
+// in the docker daemon, which hpn cannot pass to docker pull and push
+func (d *DockerRuntime) warnTLS(image string) {
+	settings := d.tls.ForImage(image)
+	if settings == nil {
+		return
+	}
+	host := RegistryHost(image)
+	if _, warned := d.warned.LoadOrStore(host, true); warned {
+		return
+	}
+	d.logger.Warn("Docker applies registry TLS settings from its daemon configuration; add insecure registries to insecure-registries in daemon.json and certificates to /etc/docker/certs.d/"+host,
+		logger.F("registry", host))
+}
+
+// warnProxy warns once per registry that the proxy settings hpn has for it do
+// not apply to pulls and pushes, which the docker daemon performs with the
+// proxy of its own configuration
+func (d *DockerRuntime) warnProxy(proxy *ProxyConfig, image string) {
+	if proxy.ForImage(image) == nil {
+		return
+	}
+	host := RegistryHost(image)
+	if _, warned := d.proxyWarned.LoadOrStore(host, true); warned {
+		return
+	}
+	d.logger.Warn("Docker pulls and pushes through the proxy of its daemon configuration; set proxies and no-proxy exceptions in daemon.json or the docker service environment",
+		logger.F("registry", host))
 }
 
 // Version returns the Docker version
@@ -0,0 +1,159 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/harpoon/hpn/internal/logger"
+	"github.com/harpoon/hpn/pkg/errors"
+)
+
+// maxStderrBytes bounds how much of a command's stderr is kept
+const maxStderrBytes = 8 * 1024
+
+// tailBuffer is an io.Writer keeping only the last limit bytes written
+type tailBuffer struct {
+	limit int
+	buf   []byte
+}
+
+// Write appends p, discarding the oldest bytes beyond the limit
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(p) >= t.limit {
+		t.buf = append(t.buf[:0], p[len(p)-t.limit:]...)
+		return n, nil
+	}
+	if overflow := len(t.buf) + len(p) - t.limit; overflow > 0 {
+		t.buf = append(t.buf[:0], t.buf[overflow:]...)
+	}
+	t.buf = append(t.buf, p...)
+	return n, nil
+}
+
+// String returns the buffered output
+func (t *tailBuffer) String() string {
+	return string(t.buf)
+}
+
+// runCommandOutput runs a runtime command like runCommand and returns its
+// standard output
+func runCommandOutput(ctx context.Context, log logger.Logger, cmd *exec.Cmd, message string) (string, error) {
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	if err := runCommand(ctx, log, cmd, message); err != nil {
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// runCommand runs a runtime command and converts a failure into a
+// HarpoonError. Commands killed because ctx expired are reported with
+// ErrRuntimeTimeout so they can be told apart from command failures. The
+// tail of stderr is attached to the error context and used to classify it.
+func runCommand(ctx context.Context, log logger.Logger, cmd *exec.Cmd, message string) error {
+	stderr := &tailBuffer{limit: maxStderrBytes}
+	cmd.Stderr = stderr
+
+	log.Debug("Running runtime command", logger.F("command", strings.Join(cmd.Args, " ")))
+
+	start := time.Now()
+	err := cmd.Run()
+	if err == nil {
+		log.Debug("Runtime command finished", logger.F("command", cmd.Args[1]), logger.F("duration", time.Since(start)))
+		return nil
+	}
+
+	output := strings.TrimSpace(stderr.String())
+	log.Debug("Runtime command failed",
+		logger.F("command", cmd.Args[1]),
+		logger.F("duration", time.Since(start)),
+		logger.F("stderr", output),
+		logger.Err(err))
+
+	var herr *errors.HarpoonError
+	if stderrors.Is(ctx.Err(), context.DeadlineExceeded) {
+		herr = errors.Wrap(ctx.Err(), errors.ErrRuntimeTimeout, message+": operation timed out")
+	} else {
+		if summary := summarizeStderr(output); summary != "" {
+			message = message + ": " + summary
+		}
+		herr = errors.Wrap(err, classifyStderr(output), message)
+	}
+
+	herr.WithContext("runtime", filepath.Base(cmd.Path))
+	if output != "" {
+		herr.WithContext("stderr", output)
+	}
+	return herr
+}
+
+// stderrPatterns maps well-known runtime and registry messages to error codes.
+// Patterns are matched in order against the lower-cased stderr output, so
+// registry errors come before the generic permission and "not found"
+// messages of the runtimes and the file system.
+var stderrPatterns = []struct {
+	pattern string
+	code    errors.ErrorCode
+}{
+	{"toomanyrequests", errors.ErrRegistryRateLimit},
+	{"too many requests", errors.ErrRegistryRateLimit},
+	{"rate limit", errors.ErrRegistryRateLimit},
+	{"no space left on device", errors.ErrInsufficientSpace},
+	{"manifest unknown", errors.ErrImageNotFound},
+	{"name unknown", errors.ErrImageNotFound},
+	{"no such image", errors.ErrImageNotFound},
+	{"image not known", errors.ErrImageNotFound},
+	{"repository does not exist", errors.ErrImageNotFound},
+	{"unauthorized", errors.ErrRegistryAuth},
+	{"authentication required", errors.ErrRegistryAuth},
+	{"denied: ", errors.ErrRegistryAuth},
+	{"requested access to the resource is denied", errors.ErrRegistryAuth},
+	{"insufficient_scope", errors.ErrRegistryAuth},
+	{"docker daemon", errors.ErrRuntimeUnavailable},
+	{"docker.sock", errors.ErrRuntimeUnavailable},
+	{"containerd.sock", errors.ErrRuntimeUnavailable},
+	{"cannot connect to podman", errors.ErrRuntimeUnavailable},
+	{"permission denied", errors.ErrFilePermission},
+	{"read-only file system", errors.ErrFilePermission},
+	{"invalid reference format", errors.ErrImageInvalid},
+	{"proxyconnect", errors.ErrProxyConnection},
+	{"i/o timeout", errors.ErrNetworkTimeout},
+	{"tls handshake timeout", errors.ErrNetworkTimeout},
+	{"deadline exceeded", errors.ErrNetworkTimeout},
+	{"connection refused", errors.ErrRegistryConnection},
+	{"connection reset", errors.ErrRegistryConnection},
+	{"no such host", errors.ErrRegistryConnection},
+	{"server misbehaving", errors.ErrRegistryConnection},
+	{": not found", errors.ErrImageNotFound}, // containerd: "<reference>: not found"
+}
+
+// classifyStderr returns the error code matching a command's stderr output,
+// or ErrRuntimeCommand when the failure is not recognized
+func classifyStderr(stderr string) errors.ErrorCode {
+	lower := strings.ToLower(stderr)
+	for _, p := range stderrPatterns {
+		if strings.Contains(lower, p.pattern) {
+			return p.code
+		}
+	}
+	return errors.ErrRuntimeCommand
+}
+
+// summarizeStderr returns the last non-empty line of stderr, which usually
+// carries the actual error of docker, podman and nerdctl
+func summarizeStderr(stderr string) string {
+	lines := strings.Split(stderr, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,49 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/harpoon/hpn/pkg/errors"
+)
+
+func TestClassifyStderr(t *testing.T) {
+	tests := []struct {
+		stderr string
+		want   errors.ErrorCode
+	}{
+		// Registries
+		{"Error response from daemon: toomanyrequests: You have reached your pull rate limit.", errors.ErrRegistryRateLimit},
+		{"Error response from daemon: manifest for nginx:1.99 not found: manifest unknown: manifest unknown", errors.ErrImageNotFound},
+		{"Error response from daemon: pull access denied for nosuch/app, repository does not exist or may require 'docker login': denied: requested access to the resource is denied", errors.ErrImageNotFound},
+		{"Error: initializing source docker://quay.io/nosuch/app:latest: reading manifest latest in quay.io/nosuch/app: name unknown: repository not found", errors.ErrImageNotFound},
+		{"Error: harbor.local/app:v1: image not known", errors.ErrImageNotFound},
+		{"FATA[0001] failed to resolve reference \"docker.io/library/nginx:1.99\": docker.io/library/nginx:1.99: not found", errors.ErrImageNotFound},
+		{"unauthorized: authentication required", errors.ErrRegistryAuth},
+		{"denied: requested access to the resource is denied", errors.ErrRegistryAuth},
+		{"Error: writing blob: initiating layer upload to /v2/prod/app/blobs/uploads/ in harbor.local: requested access to the resource is denied", errors.ErrRegistryAuth},
+		{"failed to push: insufficient_scope: authorization failed", errors.ErrRegistryAuth},
+		{"Error response from daemon: Get \"https://harbor.local/v2/\": proxyconnect tcp: dial tcp 10.0.0.1:3128: connect: connection refused", errors.ErrProxyConnection},
+		{"Error response from daemon: Get \"https://harbor.local/v2/\": dial tcp 10.0.0.2:443: i/o timeout", errors.ErrNetworkTimeout},
+		{"Error response from daemon: Get \"https://harbor.local/v2/\": dial tcp: lookup harbor.local: no such host", errors.ErrRegistryConnection},
+		{"invalid reference format: repository name must be lowercase", errors.ErrImageInvalid},
+
+		// Runtimes and the local file system
+		{"permission denied while trying to connect to the Docker daemon socket at unix:///var/run/docker.sock: Get \"http://%2Fvar%2Frun%2Fdocker.sock/v1.45/images/json\": dial unix /var/run/docker.sock: connect: permission denied", errors.ErrRuntimeUnavailable},
+		{"Cannot connect to the Docker daemon at unix:///var/run/docker.sock. Is the docker daemon running?", errors.ErrRuntimeUnavailable},
+		{"FATA[0000] cannot access containerd socket \"/run/containerd/containerd.sock\": no such file or directory", errors.ErrRuntimeUnavailable},
+		{"Error: cannot connect to Podman. Please verify your connection to the Linux system", errors.ErrRuntimeUnavailable},
+		{"open /srv/images/.docker_temp_123: permission denied", errors.ErrFilePermission},
+		{"Error: open /mnt/images/nginx.tar: read-only file system", errors.ErrFilePermission},
+		{"write /var/lib/docker/tmp/GetImageBlob123: no space left on device", errors.ErrInsufficientSpace},
+
+		// Unrecognized messages
+		{"Error response from daemon: No such container: web", errors.ErrRuntimeCommand},
+		{"error: config file not found", errors.ErrRuntimeCommand},
+		{"", errors.ErrRuntimeCommand},
+	}
+	for _, tt := range tests {
+		if got := classifyStderr(tt.stderr); got != tt.want {
+			t.Errorf("classifyStderr(%q) = %s, want %s", tt.stderr, got, tt.want)
+		}
+	}
+}
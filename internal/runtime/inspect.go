@@ -0,0 +1,113 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/harpoon/hpn/internal/registry"
+	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/reference"
+)
+
+// ImageInspector is implemented by runtimes that can report the registry
+// digests of local images
+type ImageInspector interface {
+	// RepoDigests returns the repo@digest references of a local image
+	RepoDigests(ctx context.Context, image string) ([]string, error)
+}
+
+// PushChecker is implemented by runtimes that can tell whether a push would
+// change the registry
+type PushChecker interface {
+	// UpToDate returns the digest of the manifest of the local image that
+	// would be pushed to target, and whether target already holds it
+	UpToDate(ctx context.Context, image, target string, options PushOptions) (string, bool, error)
+}
+
+// ManifestInspector is implemented by runtimes that can look up manifests in
+// the registry of an image
+type ManifestInspector interface {
+	// IsIndex reports whether image refers to an image index or manifest
+	// list in its registry rather than a single platform manifest
+	IsIndex(ctx context.Context, image string, options PullOptions) (bool, error)
+}
+
+// As returns the first runtime in the decorator chain of rt that implements T.
+// Decorators such as RetryRuntime expose the runtime they wrap via Unwrap.
+func As[T any](rt ContainerRuntime) (T, bool) {
+	for rt != nil {
+		if t, ok := rt.(T); ok {
+			return t, true
+		}
+		u, ok := rt.(interface{ Unwrap() ContainerRuntime })
+		if !ok {
+			break
+		}
+		rt = u.Unwrap()
+	}
+
+	var zero T
+	return zero, false
+}
+
+// ImageDigest returns the registry manifest digest of the local image for the
+// repository of image. It returns an empty digest if rt cannot inspect images
+// or the image has no digest for that repository, e.g. it was never pulled
+// from or pushed to it.
+func ImageDigest(ctx context.Context, rt ContainerRuntime, image string) (string, error) {
+	inspector, ok := As[ImageInspector](rt)
+	if !ok {
+		return "", nil
+	}
+
+	ref, err := reference.Parse(image)
+	if err != nil {
+		return "", err
+	}
+
+	repoDigests, err := inspector.RepoDigests(ctx, image)
+	if err != nil {
+		return "", err
+	}
+
+	for _, repoDigest := range repoDigests {
+		candidate, err := reference.Parse(repoDigest)
+		if err != nil || candidate.Digest == "" {
+			continue
+		}
+		if candidate.Name() == ref.Name() {
+			return candidate.Digest, nil
+		}
+	}
+	return "", nil
+}
+
+// parseRepoDigests decodes the RepoDigests printed as JSON by an image
+// inspect command
+func parseRepoDigests(output string) ([]string, error) {
+	output = strings.TrimSpace(output)
+	if output == "" || output == "null" {
+		return nil, nil
+	}
+
+	var repoDigests []string
+	if err := json.Unmarshal([]byte(output), &repoDigests); err != nil {
+		return nil, errors.Wrap(err, errors.ErrRuntimeCommand, fmt.Sprintf("failed to parse image digests %q", output))
+	}
+	return repoDigests, nil
+}
+
+// parseIndex decodes the manifest printed by a manifest inspect command and
+// reports whether it is an image index
+func parseIndex(output string) (bool, error) {
+	var manifest struct {
+		MediaType string            `json:"mediaType"`
+		Manifests []json.RawMessage `json:"manifests"`
+	}
+	if err := json.Unmarshal([]byte(output), &manifest); err != nil {
+		return false, errors.Wrap(err, errors.ErrRuntimeCommand, "failed to parse manifest")
+	}
+	return registry.IsIndex(manifest.MediaType) || len(manifest.Manifests) > 0, nil
+}
@@ -42,15 +42,42 @@ type PullOptions struct {
 
 // PushOptions contains options for push operations
 type PushOptions struct {
+	Proxy   *ProxyConfig
 	Timeout time.Duration
 	Retry   RetryConfig
 }
 
 // ProxyConfig contains proxy configuration
 type ProxyConfig struct {
-	HTTP    string
-	HTTPS   string
-	Enabled bool
+	HTTP       string
+	HTTPS      string
+	NoProxy    []string
+	Enabled    bool
+	Bypass     bool
+	Registries []RegistryProxy
+}
+
+// RegistryProxy overrides the proxy settings for a registry
+type RegistryProxy struct {
+	Registry string // hostname[:port] or *.domain wildcard
+	HTTP     string
+	HTTPS    string
+	Bypass   bool // connect directly, ignoring any proxy
+}
+
+// TLSConfig contains the TLS settings of registries
+type TLSConfig struct {
+	Registries []RegistryTLS
+}
+
+// RegistryTLS contains the TLS settings of a registry
+type RegistryTLS struct {
+	Registry   string // hostname[:port] or *.domain wildcard
+	Insecure   bool   // allow plain HTTP and unverified HTTPS
+	SkipVerify bool   // do not verify the server certificate
+	CAFile     string // CA certificates trusted in addition to the system roots
+	CertFile   string // client certificate
+	KeyFile    string // key of the client certificate
 }
 
 // RetryConfig contains retry configuration
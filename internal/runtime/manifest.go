@@ -0,0 +1,11 @@
+package runtime
+
+import "context"
+
+// ManifestListBuilder is implemented by runtimes that can combine images
+// pushed for several platforms into a manifest list
+type ManifestListBuilder interface {
+	// PushManifestList creates the manifest list list from images, which must
+	// already be pushed to the registry of list, and pushes it
+	PushManifestList(ctx context.Context, list string, images []string, options PushOptions) error
+}
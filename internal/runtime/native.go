@@ -0,0 +1,663 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/harpoon/hpn/internal/auth"
+	"github.com/harpoon/hpn/internal/logger"
+	"github.com/harpoon/hpn/internal/registry"
+	"github.com/harpoon/hpn/internal/version"
+	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/reference"
+)
+
+// NativeRuntime implements ContainerRuntime by talking to registries over the
+// OCI distribution API. Images are kept in a local store in OCI image layout
+// instead of a container engine, so hpn works on hosts without docker,
+// podman or nerdctl.
+type NativeRuntime struct {
+	storeDir    string
+	logger      logger.Logger
+	credentials CredentialFunc
+	docker      *auth.Resolver // credentials of the docker config
+	tls         *TLSConfig
+
+	mu      sync.Mutex
+	store   *registry.Store
+	clients map[string]*registry.Client // by effective proxy and TLS configuration
+}
+
+// NewNativeRuntime creates a native runtime keeping images in storeDir,
+// defaulting to DefaultStoreDir
+func NewNativeRuntime(storeDir string) *NativeRuntime {
+	if storeDir == "" {
+		storeDir = DefaultStoreDir()
+	}
+	return &NativeRuntime{
+		storeDir: storeDir,
+		logger:   logger.Nop(),
+		docker:   auth.NewResolver(auth.Options{DockerConfig: auth.DockerConfigFile()}),
+		clients:  make(map[string]*registry.Client),
+	}
+}
+
+// DefaultStoreDir returns the default image store of the native runtime,
+// $HOME/.hpn/store
+func DefaultStoreDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".hpn", "store")
+	}
+	return filepath.Join(home, ".hpn", "store")
+}
+
+// SetLogger sets the logger used for registry requests
+func (n *NativeRuntime) SetLogger(l logger.Logger) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.logger = l.WithFields(logger.F("runtime", "native"))
+	n.docker.SetLogger(n.logger)
+	n.clients = make(map[string]*registry.Client)
+}
+
+// SetCredentials sets the registry credentials. Registries without
+// credentials use those of the docker config, like docker does.
+func (n *NativeRuntime) SetCredentials(credentials CredentialFunc) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.credentials = credentials
+	n.clients = make(map[string]*registry.Client)
+}
+
+// SetTLS sets the registry TLS settings
+func (n *NativeRuntime) SetTLS(config *TLSConfig) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.tls = config
+	n.clients = make(map[string]*registry.Client)
+}
+
+// Name returns the runtime name
+func (n *NativeRuntime) Name() string {
+	return "native"
+}
+
+// IsAvailable reports true; the native runtime needs no external tools
+func (n *NativeRuntime) IsAvailable() bool {
+	return true
+}
+
+// Pull pulls an image into the store. Image indexes are resolved to the
+// manifest of options.Platform, defaulting to the host platform.
+func (n *NativeRuntime) Pull(ctx context.Context, image string, options PullOptions) error {
+	ref, err := reference.Parse(image)
+	if err != nil {
+		return err
+	}
+	store, err := n.openStore()
+	if err != nil {
+		return err
+	}
+	client, err := n.client(options.Proxy, image)
+	if err != nil {
+		return err
+	}
+
+	desc, data, err := client.GetManifest(ctx, ref)
+	if err != nil {
+		return err
+	}
+	repoDigest := ref.Name() + "@" + desc.Digest
+
+	if registry.IsIndex(desc.MediaType) {
+		index, err := registry.ParseManifest(data)
+		if err != nil {
+			return errors.Wrap(err, errors.ErrImageInvalid, fmt.Sprintf("invalid image index of %s", image))
+		}
+		platform, err := registry.SelectManifest(index, options.Platform)
+		if err != nil {
+			return errors.Wrap(err, errors.ErrImageNotFound, fmt.Sprintf("failed to pull image %s", image))
+		}
+
+		child := &reference.Reference{Domain: ref.Domain, Path: ref.Path, Digest: platform.Digest}
+		if desc, data, err = client.GetManifest(ctx, child); err != nil {
+			return err
+		}
+		desc.Platform = platform.Platform
+	}
+
+	manifest, err := registry.ParseManifest(data)
+	if err != nil || manifest.Config == nil {
+		return errors.New(errors.ErrImageInvalid, fmt.Sprintf("unsupported manifest of %s (%s)", image, desc.MediaType))
+	}
+
+	for _, blob := range manifest.Blobs() {
+		if store.HasBlob(blob.Digest) {
+			continue
+		}
+		if err := n.fetchBlob(ctx, client, store, ref, blob); err != nil {
+			return err
+		}
+	}
+	if err := store.WriteBlob(desc.Digest, bytes.NewReader(data)); err != nil {
+		return err
+	}
+
+	if desc.Platform == nil {
+		if config, err := store.ReadBlob(manifest.Config.Digest); err == nil {
+			desc.Platform, _ = registry.ConfigPlatform(config)
+		}
+	}
+
+	return store.SetImage(storeName(ref), desc, repoDigest)
+}
+
+// fetchBlob downloads a blob into the store, verifying its digest
+func (n *NativeRuntime) fetchBlob(ctx context.Context, client *registry.Client, store *registry.Store, ref *reference.Reference, blob registry.Descriptor) error {
+	body, err := client.GetBlob(ctx, ref, blob.Digest)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	n.logger.Debug("Fetching blob", logger.F("digest", blob.Digest), logger.F("size", blob.Size))
+	if err := store.WriteBlob(blob.Digest, body); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return errors.Wrap(ctxErr, errors.ErrRuntimeTimeout, fmt.Sprintf("failed to fetch blob %s of %s", blob.Digest, ref.Name()))
+		}
+		return err
+	}
+	return nil
+}
+
+// Save writes an image of the store to a tar file that can be loaded by
+// docker, podman, nerdctl and OCI tools
+func (n *NativeRuntime) Save(ctx context.Context, image string, tarPath string) error {
+	ref, err := reference.Parse(image)
+	if err != nil {
+		return err
+	}
+	store, err := n.openStore()
+	if err != nil {
+		return err
+	}
+	name := storeName(ref)
+	desc, err := store.Resolve(name)
+	if err != nil {
+		return err
+	}
+	if ref, err = reference.Parse(name); err != nil {
+		return err
+	}
+
+	f, err := os.Create(tarPath)
+	if err != nil {
+		return errors.Wrap(err, errors.ErrFileOperation, fmt.Sprintf("failed to save image %s to %s", image, tarPath))
+	}
+
+	err = registry.WriteArchive(ctx, store, f, []registry.ArchiveImage{{Ref: ref, Descriptor: desc}})
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = errors.Wrap(closeErr, errors.ErrFileOperation, fmt.Sprintf("failed to save image %s to %s", image, tarPath))
+	}
+	if err != nil {
+		os.Remove(tarPath)
+		return err
+	}
+	return nil
+}
+
+// Load imports the images of a docker archive or OCI layout tar file into
+// the store
+func (n *NativeRuntime) Load(ctx context.Context, tarPath string) error {
+	store, err := n.openStore()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return errors.Wrap(err, errors.ErrFileOperation, fmt.Sprintf("failed to load image from %s", tarPath))
+	}
+	defer f.Close()
+
+	names, err := registry.ReadArchive(ctx, store, f)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		n.logger.Debug("Loaded image", logger.F("image", name), logger.F("file", tarPath))
+	}
+	return nil
+}
+
+// Push pushes an image of the store to its registry, uploading the blobs
+// followed by the manifest. Blobs the repository already has are skipped,
+// and blobs of other repositories of the registry the image was pulled from
+// or pushed to are mounted.
+func (n *NativeRuntime) Push(ctx context.Context, image string, options PushOptions) error {
+	ref, err := reference.Parse(image)
+	if err != nil {
+		return err
+	}
+	store, err := n.openStore()
+	if err != nil {
+		return err
+	}
+	name := storeName(ref)
+	desc, err := store.Resolve(name)
+	if err != nil {
+		return err
+	}
+	data, err := store.ReadBlob(desc.Digest)
+	if err != nil {
+		return err
+	}
+	manifest, err := registry.ParseManifest(data)
+	if err != nil || manifest.Config == nil {
+		return errors.New(errors.ErrImageInvalid, fmt.Sprintf("unsupported manifest of %s (%s)", image, desc.MediaType))
+	}
+
+	var mountFrom []string
+	repoDigests, _ := store.RepoDigests(name)
+	for _, repoDigest := range repoDigests {
+		if known, err := reference.Parse(repoDigest); err == nil && known.Domain == ref.Domain {
+			mountFrom = append(mountFrom, known.Path)
+		}
+	}
+
+	client, err := n.client(options.Proxy, image)
+	if err != nil {
+		return err
+	}
+	for _, blob := range manifest.Blobs() {
+		digest := blob.Digest
+		err := client.UploadBlob(ctx, ref, blob, func() (io.ReadCloser, error) {
+			return store.OpenBlob(digest)
+		}, mountFrom...)
+		if err != nil {
+			return err
+		}
+	}
+
+	digest, err := client.PutManifest(ctx, ref, desc.MediaType, data)
+	if err != nil {
+		return err
+	}
+	return store.AddRepoDigest(name, ref.Name()+"@"+digest)
+}
+
+// UpToDate reports whether the registry of target holds the manifest of the
+// stored image under the tag or digest of target
+func (n *NativeRuntime) UpToDate(ctx context.Context, image, target string, options PushOptions) (string, bool, error) {
+	ref, err := reference.Parse(image)
+	if err != nil {
+		return "", false, err
+	}
+	targetRef, err := reference.Parse(target)
+	if err != nil {
+		return "", false, err
+	}
+	store, err := n.openStore()
+	if err != nil {
+		return "", false, err
+	}
+	desc, err := store.Resolve(storeName(ref))
+	if err != nil {
+		return "", false, err
+	}
+
+	client, err := n.client(options.Proxy, target)
+	if err != nil {
+		return "", false, err
+	}
+	current, ok, err := client.HeadManifest(ctx, targetRef)
+	if err != nil {
+		return "", false, err
+	}
+	return desc.Digest, ok && current.Digest == desc.Digest, nil
+}
+
+// IsIndex reports whether image refers to an image index in its registry
+func (n *NativeRuntime) IsIndex(ctx context.Context, image string, options PullOptions) (bool, error) {
+	ref, err := reference.Parse(image)
+	if err != nil {
+		return false, err
+	}
+	client, err := n.client(options.Proxy, image)
+	if err != nil {
+		return false, err
+	}
+
+	desc, ok, err := client.HeadManifest(ctx, ref)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, errors.New(errors.ErrImageNotFound, fmt.Sprintf("manifest of %s not found", image))
+	}
+	return registry.IsIndex(desc.MediaType), nil
+}
+
+// Tag tags an image of the store with a new name
+func (n *NativeRuntime) Tag(ctx context.Context, source, target string) error {
+	sourceRef, err := reference.Parse(source)
+	if err != nil {
+		return err
+	}
+	targetRef, err := reference.Parse(target)
+	if err != nil {
+		return err
+	}
+	store, err := n.openStore()
+	if err != nil {
+		return err
+	}
+
+	desc, err := store.Resolve(storeName(sourceRef))
+	if err != nil {
+		return err
+	}
+	return store.SetImage(storeName(targetRef), desc)
+}
+
+// RepoDigests returns the repo@digest references of an image of the store
+func (n *NativeRuntime) RepoDigests(ctx context.Context, image string) ([]string, error) {
+	ref, err := reference.Parse(image)
+	if err != nil {
+		return nil, err
+	}
+	store, err := n.openStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.RepoDigests(storeName(ref))
+}
+
+// PushManifestList pushes an OCI image index referencing the manifests of
+// images, which must already be pushed to the repository of list
+func (n *NativeRuntime) PushManifestList(ctx context.Context, list string, images []string, options PushOptions) error {
+	ref, err := reference.Parse(list)
+	if err != nil {
+		return err
+	}
+	store, err := n.openStore()
+	if err != nil {
+		return err
+	}
+
+	index := registry.Manifest{SchemaVersion: 2, MediaType: registry.MediaTypeOCIIndex}
+	for _, image := range images {
+		imageRef, err := reference.Parse(image)
+		if err != nil {
+			return err
+		}
+		desc, err := store.Resolve(storeName(imageRef))
+		if err != nil {
+			return err
+		}
+		if desc.Platform == nil {
+			return errors.New(errors.ErrImageInvalid, fmt.Sprintf("platform of %s is unknown", image))
+		}
+		index.Manifests = append(index.Manifests, registry.Descriptor{
+			MediaType: desc.MediaType,
+			Digest:    desc.Digest,
+			Size:      desc.Size,
+			Platform:  desc.Platform,
+		})
+	}
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		return errors.Wrap(err, errors.ErrImageInvalid, fmt.Sprintf("failed to encode manifest list %s", list))
+	}
+	client, err := n.client(options.Proxy, list)
+	if err != nil {
+		return err
+	}
+	_, err = client.PutManifest(ctx, ref, registry.MediaTypeOCIIndex, data)
+	return err
+}
+
+// Copy copies an image or index from its registry to target, streaming or
+// mounting blobs without using the store
+func (n *NativeRuntime) Copy(ctx context.Context, source, target string, options CopyOptions) (CopyResult, error) {
+	sourceRef, err := reference.Parse(source)
+	if err != nil {
+		return CopyResult{}, err
+	}
+	targetRef, err := reference.Parse(target)
+	if err != nil {
+		return CopyResult{}, err
+	}
+
+	sourceClient, err := n.client(options.Proxy, source)
+	if err != nil {
+		return CopyResult{}, err
+	}
+	targetClient, err := n.client(options.Proxy, target)
+	if err != nil {
+		return CopyResult{}, err
+	}
+
+	result, err := registry.Copy(ctx,
+		sourceClient, sourceRef,
+		targetClient, targetRef,
+		registry.CopyOptions{Platforms: options.Platforms, Force: options.Force})
+	if err != nil {
+		return CopyResult{}, err
+	}
+	return CopyResult{Digest: result.Digest, UpToDate: result.UpToDate}, nil
+}
+
+// Version returns the version of hpn, which implements this runtime
+func (n *NativeRuntime) Version() (string, error) {
+	return version.GetVersion(), nil
+}
+
+// openStore opens the image store on first use
+func (n *NativeRuntime) openStore() (*registry.Store, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.store == nil {
+		store, err := registry.OpenStore(n.storeDir)
+		if err != nil {
+			return nil, err
+		}
+		n.store = store
+	}
+	return n.store, nil
+}
+
+// client returns the registry client for image, using the proxy and TLS
+// settings that apply to it. Clients are shared so tokens and connections
+// are reused.
+func (n *NativeRuntime) client(proxy *ProxyConfig, image string) (*registry.Client, error) {
+	effective := proxy.ForImage(image)
+	key := "environment"
+	if effective != nil {
+		key = fmt.Sprintf("%t %s %s %s", effective.Bypass, effective.HTTP, effective.HTTPS, strings.Join(effective.NoProxy, ","))
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	settings := n.tls.ForImage(image)
+	if settings != nil {
+		key += " tls " + settings.Registry
+	}
+	if client, ok := n.clients[key]; ok {
+		return client, nil
+	}
+
+	transport, err := newTransport(effective, settings)
+	if err != nil {
+		return nil, err
+	}
+	client := registry.NewClient(registry.Options{
+		Transport:   transport,
+		Credentials: n.registryCredentials,
+		Insecure:    insecureFunc(n.tls),
+		UserAgent:   "hpn/" + version.GetVersion(),
+		Logger:      n.logger,
+	})
+	n.clients[key] = client
+	return client, nil
+}
+
+// registryCredentials returns the credentials for a registry host, falling
+// back to the docker config
+func (n *NativeRuntime) registryCredentials(host string) (string, string) {
+	n.mu.Lock()
+	credentials := n.credentials
+	n.mu.Unlock()
+
+	if credentials != nil {
+		if username, password := credentials(host); username != "" || password != "" {
+			return username, password
+		}
+	}
+	return n.docker.Credentials(host)
+}
+
+// CheckLogin verifies that the registry host accepts username and password
+func (n *NativeRuntime) CheckLogin(ctx context.Context, host, username, password string, proxy *ProxyConfig) error {
+	n.mu.Lock()
+	tlsConfig := n.tls
+	n.mu.Unlock()
+
+	transport, err := newTransport(proxy.ForRegistry(host), tlsConfig.ForRegistry(host))
+	if err != nil {
+		return err
+	}
+	client := registry.NewClient(registry.Options{
+		Transport: transport,
+		Credentials: func(string) (string, string) {
+			return username, password
+		},
+		Insecure:  insecureFunc(tlsConfig),
+		UserAgent: "hpn/" + version.GetVersion(),
+		Logger:    n.logger,
+	})
+	return client.Ping(ctx, host)
+}
+
+// newTransport returns the HTTP transport for the effective proxy settings
+// and the TLS settings of a registry
+func newTransport(effective *ProxyConfig, settings *RegistryTLS) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxyFunc(effective)
+
+	tlsConfig, err := settings.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return transport, nil
+}
+
+// insecureFunc returns whether a registry may be reached over plain HTTP
+func insecureFunc(config *TLSConfig) func(domain string) bool {
+	return func(domain string) bool {
+		settings := config.ForRegistry(domain)
+		return settings != nil && settings.Insecure
+	}
+}
+
+// proxyFunc returns the proxy selection of an HTTP transport for the
+// effective proxy settings of an image. Without settings the proxy
+// environment variables apply.
+func proxyFunc(effective *ProxyConfig) func(*http.Request) (*url.URL, error) {
+	if effective == nil {
+		return http.ProxyFromEnvironment
+	}
+	if effective.Bypass {
+		return nil
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		host, port := req.URL.Hostname(), req.URL.Port()
+		if port == "" {
+			port = "443"
+			if req.URL.Scheme == "http" {
+				port = "80"
+			}
+		}
+		for _, pattern := range effective.NoProxy {
+			if matchNoProxy(pattern, host, port) {
+				return nil, nil
+			}
+		}
+
+		proxy := effective.HTTPS
+		if req.URL.Scheme == "http" {
+			proxy = effective.HTTP
+		}
+		if proxy == "" {
+			return nil, nil
+		}
+		if !strings.Contains(proxy, "://") {
+			proxy = "http://" + proxy
+		}
+		return url.Parse(proxy)
+	}
+}
+
+// matchNoProxy reports whether a request to host and port matches a no_proxy
+// entry: "*", an IP address or CIDR range, a hostname that also matches its
+// subdomains, or a ".domain" suffix. Entries with a port only match that port.
+func matchNoProxy(pattern, host, port string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	host = strings.ToLower(host)
+	switch pattern {
+	case "":
+		return false
+	case "*":
+		return true
+	}
+
+	if _, network, err := net.ParseCIDR(pattern); err == nil {
+		ip := net.ParseIP(host)
+		return ip != nil && network.Contains(ip)
+	}
+	if patternHost, patternPort, err := net.SplitHostPort(pattern); err == nil {
+		if patternPort != port {
+			return false
+		}
+		pattern = patternHost
+	}
+	if ip := net.ParseIP(pattern); ip != nil {
+		return ip.Equal(net.ParseIP(host))
+	}
+
+	if strings.HasPrefix(pattern, ".") || strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, strings.TrimPrefix(pattern, "*"))
+	}
+	return host == pattern || strings.HasSuffix(host, "."+pattern)
+}
+
+// storeName returns the name of an image in the store: its fully qualified
+// reference with the default tag made explicit. Like docker, images pulled
+// by digest are known by digest only.
+func storeName(ref *reference.Reference) string {
+	if ref.Digest != "" {
+		return ref.Name() + "@" + ref.Digest
+	}
+	return ref.Name() + ":" + ref.TagOrDefault()
+}
@@ -0,0 +1,432 @@
+package runtime
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/harpoon/hpn/internal/registry"
+	"github.com/harpoon/hpn/internal/registry/registrytest"
+)
+
+func TestNativeRuntime(t *testing.T) {
+	reg := registrytest.New()
+	defer reg.Close()
+	indexDigest := reg.AddIndex("library/app", "1.0", "linux/amd64", "linux/arm64")
+	armDigest := reg.AddImage("library/app", "", "linux/arm64")
+
+	ctx := context.Background()
+	source := reg.Host() + "/library/app:1.0"
+	target := reg.Host() + "/prod/app:1.0"
+
+	rt := NewNativeRuntime(t.TempDir())
+	if err := rt.Pull(ctx, source, PullOptions{Platform: "linux/arm64"}); err != nil {
+		t.Fatalf("Pull failed: %v", err)
+	}
+
+	for digest, want := range map[string]bool{indexDigest: true, armDigest: false} {
+		if index, err := rt.IsIndex(ctx, reg.Host()+"/library/app@"+digest, PullOptions{}); err != nil || index != want {
+			t.Errorf("IsIndex(%s) = %v, %v, want %v", digest, index, err, want)
+		}
+	}
+
+	tarPath := filepath.Join(t.TempDir(), "app.tar")
+	if err := rt.Save(ctx, source, tarPath); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded := NewNativeRuntime(t.TempDir())
+	if err := loaded.Load(ctx, tarPath); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if err := loaded.Tag(ctx, source, target); err != nil {
+		t.Fatalf("Tag failed: %v", err)
+	}
+	if err := loaded.Push(ctx, target, PushOptions{}); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+
+	pushed, ok := reg.Manifest("prod/app", "1.0")
+	if !ok {
+		t.Fatal("pushed manifest not found in registry")
+	}
+	if digest := registry.Digest(pushed); digest != armDigest {
+		t.Errorf("pushed manifest %s, want the linux/arm64 manifest %s", digest, armDigest)
+	}
+
+	digest, err := ImageDigest(ctx, loaded, target)
+	if err != nil {
+		t.Fatalf("ImageDigest failed: %v", err)
+	}
+	if digest != armDigest {
+		t.Errorf("ImageDigest = %q, want %s", digest, armDigest)
+	}
+}
+
+func TestNativeRuntimeIncrementalPush(t *testing.T) {
+	reg := registrytest.New()
+	defer reg.Close()
+	reg.AddImage("team/app", "1.0", "linux/amd64")
+
+	ctx := context.Background()
+	source := reg.Host() + "/team/app:1.0"
+	target := reg.Host() + "/prod/app:1.0"
+
+	rt := NewNativeRuntime(t.TempDir())
+	if err := rt.Pull(ctx, source, PullOptions{}); err != nil {
+		t.Fatalf("Pull failed: %v", err)
+	}
+	if err := rt.Tag(ctx, source, target); err != nil {
+		t.Fatalf("Tag failed: %v", err)
+	}
+	if _, ok, err := rt.UpToDate(ctx, target, target, PushOptions{}); err != nil || ok {
+		t.Errorf("UpToDate before push = %t, %v, want false", ok, err)
+	}
+
+	// Blobs are mounted from the repository the image was pulled from
+	requests := len(reg.Requests())
+	if err := rt.Push(ctx, target, PushOptions{}); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	for _, r := range reg.Requests()[requests:] {
+		if strings.HasPrefix(r, "PUT /v2/prod/app/blobs/") {
+			t.Errorf("Push uploaded a blob (%s), want all mounted", r)
+		}
+	}
+
+	digest, ok, err := rt.UpToDate(ctx, target, target, PushOptions{})
+	if err != nil || !ok {
+		t.Fatalf("UpToDate after push = %t, %v, want true", ok, err)
+	}
+	if pushed, _ := reg.Manifest("prod/app", "1.0"); registry.Digest(pushed) != digest {
+		t.Errorf("UpToDate returned %s, want the pushed digest", digest)
+	}
+
+	// Blobs the repository has are not uploaded again
+	requests = len(reg.Requests())
+	if err := rt.Push(ctx, target, PushOptions{}); err != nil {
+		t.Fatalf("repeated Push failed: %v", err)
+	}
+	for _, r := range reg.Requests()[requests:] {
+		if strings.HasPrefix(r, "POST ") || strings.Contains(r, "/blobs/uploads/") {
+			t.Errorf("repeated Push sent %s, want existing blobs skipped", r)
+		}
+	}
+}
+
+func TestNativeRuntimeManifestList(t *testing.T) {
+	reg := registrytest.New()
+	defer reg.Close()
+	reg.AddImage("app", "1.0-linux-amd64", "linux/amd64")
+	reg.AddImage("app", "1.0-linux-arm64", "linux/arm64")
+
+	ctx := context.Background()
+	rt := NewNativeRuntime(t.TempDir())
+	images := []string{reg.Host() + "/app:1.0-linux-amd64", reg.Host() + "/app:1.0-linux-arm64"}
+	for _, image := range images {
+		if err := rt.Pull(ctx, image, PullOptions{}); err != nil {
+			t.Fatalf("Pull failed: %v", err)
+		}
+	}
+
+	if err := rt.PushManifestList(ctx, reg.Host()+"/app:1.0", images, PushOptions{}); err != nil {
+		t.Fatalf("PushManifestList failed: %v", err)
+	}
+
+	data, ok := reg.Manifest("app", "1.0")
+	if !ok {
+		t.Fatal("manifest list not found in registry")
+	}
+	index, err := registry.ParseManifest(data)
+	if err != nil {
+		t.Fatalf("ParseManifest failed: %v", err)
+	}
+	for _, platform := range []string{"linux/amd64", "linux/arm64"} {
+		if _, err := registry.SelectManifest(index, platform); err != nil {
+			t.Errorf("manifest list lacks %s: %v", platform, err)
+		}
+	}
+}
+
+func TestNativeRuntimeMissingImage(t *testing.T) {
+	reg := registrytest.New()
+	defer reg.Close()
+
+	rt := NewNativeRuntime(t.TempDir())
+	err := rt.Pull(context.Background(), reg.Host()+"/missing:1.0", PullOptions{})
+	if err == nil || IsRetryable(err) {
+		t.Errorf("Pull of a missing image returned %v, want a permanent error", err)
+	}
+}
+
+func TestNativeRegistryTLS(t *testing.T) {
+	secure := registrytest.NewTLS()
+	defer secure.Close()
+	plain := registrytest.New()
+	defer plain.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(caFile, secure.CertificatePEM(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// ping connects to addr for the registry example.com, which is not a
+	// loopback host and therefore reached over HTTPS
+	ping := func(addr string, settings *RegistryTLS) error {
+		config := &TLSConfig{}
+		if settings != nil {
+			settings.Registry = "example.com"
+			config.Registries = append(config.Registries, *settings)
+		}
+		transport, err := newTransport(nil, config.ForRegistry("example.com"))
+		if err != nil {
+			return err
+		}
+		transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		}
+		client := registry.NewClient(registry.Options{Transport: transport, Insecure: insecureFunc(config)})
+		return client.Ping(context.Background(), "example.com")
+	}
+
+	tests := []struct {
+		name     string
+		addr     string
+		settings *RegistryTLS
+		ok       bool
+	}{
+		{"untrusted certificate", secure.Host(), nil, false},
+		{"ca_file", secure.Host(), &RegistryTLS{CAFile: caFile}, true},
+		{"skip_verify", secure.Host(), &RegistryTLS{SkipVerify: true}, true},
+		{"insecure over HTTPS", secure.Host(), &RegistryTLS{Insecure: true}, true},
+		{"plain HTTP", plain.Host(), &RegistryTLS{SkipVerify: true}, false},
+		{"insecure over plain HTTP", plain.Host(), &RegistryTLS{Insecure: true}, true},
+	}
+	for _, tt := range tests {
+		err := ping(tt.addr, tt.settings)
+		if tt.ok && err != nil {
+			t.Errorf("%s: Ping failed: %v", tt.name, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("%s: Ping succeeded, want an error", tt.name)
+		}
+	}
+
+	if _, err := newTransport(nil, &RegistryTLS{Registry: "example.com", CAFile: filepath.Join(t.TempDir(), "missing.crt")}); err == nil {
+		t.Error("newTransport with a missing CA file succeeded, want an error")
+	}
+}
+
+func TestRegistryTLSArgs(t *testing.T) {
+	config := &TLSConfig{Registries: []RegistryTLS{
+		{Registry: "harbor.local:8443", Insecure: true},
+		{Registry: "*.corp.example.com", CAFile: "/etc/pki/corp.crt", CertFile: "/etc/pki/client.crt", KeyFile: "/etc/pki/client.key"},
+	}}
+
+	podman := NewPodmanRuntime()
+	podman.SetTLS(config)
+	nerdctl := NewNerdctlRuntime()
+	nerdctl.SetTLS(config)
+
+	if args, cleanup, err := podman.tlsArgs("docker.io/library/nginx:latest"); err != nil || len(args) != 0 {
+		t.Errorf("podman TLS args for docker.io = %v, %v, want none", args, err)
+	} else {
+		cleanup()
+	}
+	if args, cleanup, err := nerdctl.tlsArgs("docker.io/library/nginx:latest"); err != nil || len(args) != 0 {
+		t.Errorf("nerdctl TLS args for docker.io = %v, %v, want none", args, err)
+	} else {
+		cleanup()
+	}
+
+	args, cleanup, err := podman.tlsArgs("harbor.local:8443/prod/app:1.0")
+	if err != nil || strings.Join(args, " ") != "--tls-verify=false" {
+		t.Errorf("podman TLS args for insecure registry = %v, %v", args, err)
+	}
+	cleanup()
+	args, cleanup, err = nerdctl.tlsArgs("harbor.local:8443/prod/app:1.0")
+	if err != nil || strings.Join(args, " ") != "--insecure-registry" {
+		t.Errorf("nerdctl TLS args for insecure registry = %v, %v", args, err)
+	}
+	cleanup()
+
+	args, cleanup, err = nerdctl.tlsArgs("eu.corp.example.com/team/app:1.0")
+	if err != nil || len(args) != 2 || args[0] != "--hosts-dir" {
+		t.Fatalf("nerdctl TLS args for registry with certificates = %v, %v", args, err)
+	}
+	hosts, err := os.ReadFile(filepath.Join(args[1], "eu.corp.example.com", "hosts.toml"))
+	if err != nil {
+		t.Fatalf("hosts.toml not written: %v", err)
+	}
+	for _, want := range []string{`ca = "/etc/pki/corp.crt"`, `client = [["/etc/pki/client.crt", "/etc/pki/client.key"]]`} {
+		if !strings.Contains(string(hosts), want) {
+			t.Errorf("hosts.toml lacks %s:\n%s", want, hosts)
+		}
+	}
+	cleanup()
+	if _, err := os.Stat(args[1]); !os.IsNotExist(err) {
+		t.Errorf("hosts directory %s not removed", args[1])
+	}
+}
+
+func TestEngineAuth(t *testing.T) {
+	base := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", base)
+	if err := os.WriteFile(filepath.Join(base, "config.json"), []byte(`{"proxies": {"default": {"httpProxy": "http://proxy.local:3128"}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	credentials := func(host string) (string, string) {
+		if host == "harbor.local" {
+			return "ci", "secret"
+		}
+		return "", ""
+	}
+
+	// Without credentials the user's config is used as is
+	env, cleanup, err := dockerAuthEnv(nil, credentials, "docker.io/library/nginx:1.25")
+	if err != nil || env != nil {
+		t.Fatalf("dockerAuthEnv without credentials = %v, %v, want the unchanged environment", env, err)
+	}
+	cleanup()
+	if path, cleanup, err := authFile(credentials, "nginx:1.25"); err != nil || path != "" {
+		t.Fatalf("authFile without credentials = %q, %v, want no file", path, err)
+	} else {
+		cleanup()
+	}
+
+	env, cleanup, err = dockerAuthEnv(nil, credentials, "harbor.local/library/nginx:1.25")
+	if err != nil {
+		t.Fatalf("dockerAuthEnv failed: %v", err)
+	}
+	var dir string
+	for _, kv := range env {
+		if value, ok := strings.CutPrefix(kv, "DOCKER_CONFIG="); ok {
+			dir = value
+		}
+	}
+	if dir == "" || dir == base {
+		t.Fatalf("DOCKER_CONFIG = %q, want a temporary copy", dir)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil || !strings.Contains(string(data), "harbor.local") || !strings.Contains(string(data), "proxy.local") {
+		t.Errorf("merged docker config = %s, %v, want credentials and the user's proxies", data, err)
+	}
+	cleanup()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("temporary docker config %s not removed", dir)
+	}
+
+	path, cleanup, err := authFile(credentials, "harbor.local/library/nginx:1.25")
+	if err != nil || path == "" {
+		t.Fatalf("authFile = %q, %v, want an auth file", path, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("auth file mode = %v, %v, want 0600", info, err)
+	}
+	cleanup()
+}
+
+func TestParseIndex(t *testing.T) {
+	tests := []struct {
+		output string
+		want   bool
+	}{
+		{`{"schemaVersion": 2, "mediaType": "application/vnd.oci.image.index.v1+json", "manifests": []}`, true},
+		{`{"schemaVersion": 2, "mediaType": "application/vnd.docker.distribution.manifest.list.v2+json"}`, true},
+		{`{"schemaVersion": 2, "manifests": [{"digest": "sha256:0123"}]}`, true},
+		{`{"schemaVersion": 2, "mediaType": "application/vnd.oci.image.manifest.v1+json", "layers": []}`, false},
+	}
+	for _, tt := range tests {
+		if got, err := parseIndex(tt.output); err != nil || got != tt.want {
+			t.Errorf("parseIndex(%s) = %v, %v, want %v", tt.output, got, err, tt.want)
+		}
+	}
+	if _, err := parseIndex("no such manifest"); err == nil {
+		t.Error("parseIndex of invalid output succeeded, want an error")
+	}
+}
+
+func TestMatchNoProxy(t *testing.T) {
+	tests := []struct {
+		pattern, host, port string
+		want                bool
+	}{
+		{"*", "registry-1.docker.io", "443", true},
+		{"", "registry-1.docker.io", "443", false},
+		{"harbor.local", "harbor.local", "443", true},
+		{" Harbor.Local ", "HARBOR.local", "5000", true},
+		{"corp.example", "registry.corp.example", "443", true},
+		{"corp.example", "evilcorp.example", "443", false},
+		{".corp.example", "registry.corp.example", "443", true},
+		{".corp.example", "corp.example", "443", false},
+		{"*.corp.example", "a.b.corp.example", "443", true},
+		{"harbor.local:5000", "harbor.local", "5000", true},
+		{"harbor.local:5000", "harbor.local", "443", false},
+		{".corp.example:8443", "registry.corp.example", "8443", true},
+		{".corp.example:8443", "registry.corp.example", "443", false},
+		{"10.0.0.0/8", "10.1.2.3", "443", true},
+		{"10.0.0.0/8", "192.168.1.10", "443", false},
+		{"10.0.0.0/8", "registry.local", "443", false},
+		{"fd00::/8", "fd00::1", "5000", true},
+		{"192.168.1.10", "192.168.1.10", "80", true},
+		{"192.168.1.10:5000", "192.168.1.10", "443", false},
+		{"[::1]:5000", "::1", "5000", true},
+	}
+	for _, tt := range tests {
+		if got := matchNoProxy(tt.pattern, tt.host, tt.port); got != tt.want {
+			t.Errorf("matchNoProxy(%q, %q, %q) = %v, want %v", tt.pattern, tt.host, tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestProxyFunc(t *testing.T) {
+	config := &ProxyConfig{
+		HTTP:    "proxy:3128",
+		HTTPS:   "http://proxy:3129",
+		NoProxy: []string{"harbor.local:5000", "10.0.0.0/8", ".internal"},
+		Enabled: true,
+	}
+	tests := []struct {
+		config *ProxyConfig
+		url    string
+		want   string // proxy URL, empty for a direct connection
+	}{
+		{config, "https://registry-1.docker.io/v2/", "http://proxy:3129"},
+		{config, "http://insecure.local/v2/", "http://proxy:3128"},
+		{config, "https://harbor.local:5000/v2/", ""},
+		{config, "https://harbor.local/v2/", "http://proxy:3129"},
+		{config, "http://harbor.local:5000/v2/", ""},
+		{config, "https://10.1.2.3/v2/", ""},
+		{config, "https://registry.internal/v2/", ""},
+		{&ProxyConfig{HTTP: "http://proxy:3128", Enabled: true}, "https://quay.io/v2/", ""},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proxy, err := proxyFunc(tt.config)(req)
+		if err != nil {
+			t.Errorf("proxy for %s failed: %v", tt.url, err)
+			continue
+		}
+		got := ""
+		if proxy != nil {
+			got = proxy.String()
+		}
+		if got != tt.want {
+			t.Errorf("proxy for %s = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+
+	if proxyFunc(&ProxyConfig{Bypass: true}) != nil {
+		t.Error("proxyFunc of a bypassed registry is not nil, want a direct connection")
+	}
+	if proxyFunc(nil) == nil {
+		t.Error("proxyFunc without settings is nil, want the proxy environment")
+	}
+}
@@ -3,26 +3,45 @@ package runtime
 import (
 	"context"
 	"fmt"
-	"os"
 	"os/exec"
 	"strings"
 	"time"
 
+	"github.com/harpoon/hpn/internal/logger"
 	"github.com/harpoon/hpn/pkg/errors"
 )
 
 // NerdctlRuntime implements ContainerRuntime for Nerdctl
 type NerdctlRuntime struct {
-	command string
+	command     string
+	logger      logger.Logger
+	credentials CredentialFunc
+	tls         *TLSConfig
 }
 
 // NewNerdctlRuntime creates a new Nerdctl runtime
 func NewNerdctlRuntime() *NerdctlRuntime {
 	return &NerdctlRuntime{
 		command: "nerdctl",
+		logger:  logger.Nop(),
 	}
 }
 
+// SetLogger sets the logger used for runtime commands
+func (n *NerdctlRuntime) SetLogger(l logger.Logger) {
+	n.logger = l.WithFields(logger.F("runtime", "nerdctl"))
+}
+
+// SetCredentials sets the registry credentials passed to runtime commands
+func (n *NerdctlRuntime) SetCredentials(credentials CredentialFunc) {
+	n.credentials = credentials
+}
+
+// SetTLS sets the registry TLS settings passed to runtime commands
+func (n *NerdctlRuntime) SetTLS(config *TLSConfig) {
+	n.tls = config
+}
+
 // Name returns the runtime name
 func (n *NerdctlRuntime) Name() string {
 	return "nerdctl"
@@ -46,8 +65,13 @@ func (n *NerdctlRuntime) IsAvailable() bool {
 func (n *NerdctlRuntime) Pull(ctx context.Context, image string, options PullOptions) error {
 	args := []string{"pull"}
 
-	// Add insecure registry flag for private registries
-	args = append(args, "--insecure-registry")
+	// Add TLS settings of the registry
+	tlsArgs, cleanupHosts, err := n.tlsArgs(image)
+	if err != nil {
+		return err
+	}
+	defer cleanupHosts()
+	args = append(args, tlsArgs...)
 
 	// Add platform if specified
 	if options.Platform != "" {
@@ -58,73 +82,97 @@ func (n *NerdctlRuntime) Pull(ctx context.Context, image string, options PullOpt
 
 	cmd := exec.CommandContext(ctx, n.command, args...)
 
-	// Set proxy environment if configured
-	if options.Proxy != nil && options.Proxy.Enabled {
-		env := os.Environ()
-		if options.Proxy.HTTP != "" {
-			env = append(env, fmt.Sprintf("http_proxy=%s", options.Proxy.HTTP))
-		}
-		if options.Proxy.HTTPS != "" {
-			env = append(env, fmt.Sprintf("https_proxy=%s", options.Proxy.HTTPS))
-		}
-		cmd.Env = env
-	}
-
-	if err := cmd.Run(); err != nil {
-		return errors.Wrap(err, errors.ErrRuntimeCommand, fmt.Sprintf("failed to pull image %s", image))
+	// Set proxy environment and credentials if configured
+	env, cleanup, err := dockerAuthEnv(proxyEnv(options.Proxy, image), n.credentials, image)
+	if err != nil {
+		return err
 	}
+	defer cleanup()
+	cmd.Env = env
 
-	return nil
+	return runCommand(ctx, n.logger, cmd, fmt.Sprintf("failed to pull image %s", image))
 }
 
 // Save saves an image to a tar file
 func (n *NerdctlRuntime) Save(ctx context.Context, image string, tarPath string) error {
 	cmd := exec.CommandContext(ctx, n.command, "save", "-o", tarPath, image)
-	
-	if err := cmd.Run(); err != nil {
-		return errors.Wrap(err, errors.ErrRuntimeCommand, fmt.Sprintf("failed to save image %s to %s", image, tarPath))
-	}
 
-	return nil
+	return runCommand(ctx, n.logger, cmd, fmt.Sprintf("failed to save image %s to %s", image, tarPath))
 }
 
 // Load loads an image from a tar file
 func (n *NerdctlRuntime) Load(ctx context.Context, tarPath string) error {
 	cmd := exec.CommandContext(ctx, n.command, "load", "-i", tarPath)
-	
-	if err := cmd.Run(); err != nil {
-		return errors.Wrap(err, errors.ErrRuntimeCommand, fmt.Sprintf("failed to load image from %s", tarPath))
-	}
 
-	return nil
+	return runCommand(ctx, n.logger, cmd, fmt.Sprintf("failed to load image from %s", tarPath))
 }
 
 // Push pushes an image to a registry
 func (n *NerdctlRuntime) Push(ctx context.Context, image string, options PushOptions) error {
 	args := []string{"push"}
-	
-	// Add insecure registry flag for private registries
-	args = append(args, "--insecure-registry")
+
+	// Add TLS settings of the registry
+	tlsArgs, cleanupHosts, err := n.tlsArgs(image)
+	if err != nil {
+		return err
+	}
+	defer cleanupHosts()
+	args = append(args, tlsArgs...)
 	args = append(args, image)
 
 	cmd := exec.CommandContext(ctx, n.command, args...)
-	
-	if err := cmd.Run(); err != nil {
-		return errors.Wrap(err, errors.ErrRuntimeCommand, fmt.Sprintf("failed to push image %s", image))
+
+	// Set proxy environment and credentials if configured
+	env, cleanup, err := dockerAuthEnv(proxyEnv(options.Proxy, image), n.credentials, image)
+	if err != nil {
+		return err
 	}
+	defer cleanup()
+	cmd.Env = env
 
-	return nil
+	return runCommand(ctx, n.logger, cmd, fmt.Sprintf("failed to push image %s", image))
 }
 
 // Tag tags an image with a new name
 func (n *NerdctlRuntime) Tag(ctx context.Context, source, target string) error {
 	cmd := exec.CommandContext(ctx, n.command, "tag", source, target)
-	
-	if err := cmd.Run(); err != nil {
-		return errors.Wrap(err, errors.ErrRuntimeCommand, fmt.Sprintf("failed to tag image %s as %s", source, target))
+
+	return runCommand(ctx, n.logger, cmd, fmt.Sprintf("failed to tag image %s as %s", source, target))
+}
+
+// RepoDigests returns the repo@digest references of a local image
+func (n *NerdctlRuntime) RepoDigests(ctx context.Context, image string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, n.command, "image", "inspect", "--format", "{{json .RepoDigests}}", image)
+
+	output, err := runCommandOutput(ctx, n.logger, cmd, fmt.Sprintf("failed to inspect image %s", image))
+	if err != nil {
+		return nil, err
+	}
+	return parseRepoDigests(output)
+}
+
+// tlsArgs returns the TLS flags for a command operating on image: insecure
+// access for insecure registries and a temporary hosts directory for
+// configured certificates. cleanup removes the directory.
+func (n *NerdctlRuntime) tlsArgs(image string) (args []string, cleanup func(), err error) {
+	cleanup = func() {}
+	settings := n.tls.ForImage(image)
+	if settings == nil {
+		return nil, cleanup, nil
 	}
 
-	return nil
+	if !settings.Verify() {
+		args = append(args, "--insecure-registry")
+	}
+	if settings.hasCertificates() {
+		dir, removeDir, err := hostsDir(RegistryHost(image), settings)
+		if err != nil {
+			return nil, nil, err
+		}
+		args = append(args, "--hosts-dir", dir)
+		cleanup = removeDir
+	}
+	return args, cleanup, nil
 }
 
 // Version returns the Nerdctl version
@@ -8,21 +8,41 @@ import (
 	"strings"
 	"time"
 
+	"github.com/harpoon/hpn/internal/logger"
 	"github.com/harpoon/hpn/pkg/errors"
 )
 
 // PodmanRuntime implements ContainerRuntime for Podman
 type PodmanRuntime struct {
-	command string
+	command     string
+	logger      logger.Logger
+	credentials CredentialFunc
+	tls         *TLSConfig
 }
 
 // NewPodmanRuntime creates a new Podman runtime
 func NewPodmanRuntime() *PodmanRuntime {
 	return &PodmanRuntime{
 		command: "podman",
+		logger:  logger.Nop(),
 	}
 }
 
+// SetLogger sets the logger used for runtime commands
+func (p *PodmanRuntime) SetLogger(l logger.Logger) {
+	p.logger = l.WithFields(logger.F("runtime", "podman"))
+}
+
+// SetCredentials sets the registry credentials passed to runtime commands
+func (p *PodmanRuntime) SetCredentials(credentials CredentialFunc) {
+	p.credentials = credentials
+}
+
+// SetTLS sets the registry TLS settings passed to runtime commands
+func (p *PodmanRuntime) SetTLS(config *TLSConfig) {
+	p.tls = config
+}
+
 // Name returns the runtime name
 func (p *PodmanRuntime) Name() string {
 	return "podman"
@@ -51,71 +71,195 @@ func (p *PodmanRuntime) Pull(ctx context.Context, image string, options PullOpti
 		args = append(args, "--platform", options.Platform)
 	}
 
+	tlsArgs, cleanupCerts, err := p.tlsArgs(image)
+	if err != nil {
+		return err
+	}
+	defer cleanupCerts()
+	args = append(args, tlsArgs...)
+
+	// Add the credentials hpn has for the registry
+	authArgs, cleanup, err := p.authArgs(image)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	args = append(args, authArgs...)
+
 	args = append(args, image)
 
 	cmd := exec.CommandContext(ctx, p.command, args...)
 
 	// Set proxy environment if configured
-	if options.Proxy != nil && options.Proxy.Enabled {
-		env := os.Environ()
-		if options.Proxy.HTTP != "" {
-			env = append(env, fmt.Sprintf("http_proxy=%s", options.Proxy.HTTP))
-		}
-		if options.Proxy.HTTPS != "" {
-			env = append(env, fmt.Sprintf("https_proxy=%s", options.Proxy.HTTPS))
-		}
-		cmd.Env = env
-	}
-
-	if err := cmd.Run(); err != nil {
-		return errors.Wrap(err, errors.ErrRuntimeCommand, fmt.Sprintf("failed to pull image %s", image))
-	}
+	cmd.Env = proxyEnv(options.Proxy, image)
 
-	return nil
+	return runCommand(ctx, p.logger, cmd, fmt.Sprintf("failed to pull image %s", image))
 }
 
 // Save saves an image to a tar file
 func (p *PodmanRuntime) Save(ctx context.Context, image string, tarPath string) error {
 	cmd := exec.CommandContext(ctx, p.command, "save", "-o", tarPath, image)
-	
-	if err := cmd.Run(); err != nil {
-		return errors.Wrap(err, errors.ErrRuntimeCommand, fmt.Sprintf("failed to save image %s to %s", image, tarPath))
-	}
 
-	return nil
+	return runCommand(ctx, p.logger, cmd, fmt.Sprintf("failed to save image %s to %s", image, tarPath))
 }
 
 // Load loads an image from a tar file
 func (p *PodmanRuntime) Load(ctx context.Context, tarPath string) error {
 	cmd := exec.CommandContext(ctx, p.command, "load", "-i", tarPath)
-	
-	if err := cmd.Run(); err != nil {
-		return errors.Wrap(err, errors.ErrRuntimeCommand, fmt.Sprintf("failed to load image from %s", tarPath))
-	}
 
-	return nil
+	return runCommand(ctx, p.logger, cmd, fmt.Sprintf("failed to load image from %s", tarPath))
 }
 
 // Push pushes an image to a registry
 func (p *PodmanRuntime) Push(ctx context.Context, image string, options PushOptions) error {
-	cmd := exec.CommandContext(ctx, p.command, "push", image)
-	
-	if err := cmd.Run(); err != nil {
-		return errors.Wrap(err, errors.ErrRuntimeCommand, fmt.Sprintf("failed to push image %s", image))
+	tlsArgs, cleanupCerts, err := p.tlsArgs(image)
+	if err != nil {
+		return err
+	}
+	defer cleanupCerts()
+
+	authArgs, cleanup, err := p.authArgs(image)
+	if err != nil {
+		return err
 	}
+	defer cleanup()
+
+	args := append(append(append([]string{"push"}, tlsArgs...), authArgs...), image)
+	cmd := exec.CommandContext(ctx, p.command, args...)
+
+	// Set proxy environment if configured
+	cmd.Env = proxyEnv(options.Proxy, image)
 
-	return nil
+	return runCommand(ctx, p.logger, cmd, fmt.Sprintf("failed to push image %s", image))
 }
 
 // Tag tags an image with a new name
 func (p *PodmanRuntime) Tag(ctx context.Context, source, target string) error {
 	cmd := exec.CommandContext(ctx, p.command, "tag", source, target)
-	
-	if err := cmd.Run(); err != nil {
-		return errors.Wrap(err, errors.ErrRuntimeCommand, fmt.Sprintf("failed to tag image %s as %s", source, target))
+
+	return runCommand(ctx, p.logger, cmd, fmt.Sprintf("failed to tag image %s as %s", source, target))
+}
+
+// RepoDigests returns the repo@digest references of a local image
+func (p *PodmanRuntime) RepoDigests(ctx context.Context, image string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, p.command, "image", "inspect", "--format", "{{json .RepoDigests}}", image)
+
+	output, err := runCommandOutput(ctx, p.logger, cmd, fmt.Sprintf("failed to inspect image %s", image))
+	if err != nil {
+		return nil, err
+	}
+	return parseRepoDigests(output)
+}
+
+// IsIndex reports whether image refers to an image index in its registry
+func (p *PodmanRuntime) IsIndex(ctx context.Context, image string, options PullOptions) (bool, error) {
+	authArgs, cleanup, err := p.authArgs(image)
+	if err != nil {
+		return false, err
 	}
+	defer cleanup()
 
-	return nil
+	args := append([]string{"manifest", "inspect"}, authArgs...)
+	if !p.tls.ForImage(image).Verify() {
+		args = append(args, "--tls-verify=false")
+	}
+	cmd := exec.CommandContext(ctx, p.command, append(args, image)...)
+
+	// Set proxy environment if configured
+	cmd.Env = proxyEnv(options.Proxy, image)
+
+	output, err := runCommandOutput(ctx, p.logger, cmd, fmt.Sprintf("failed to inspect manifest of %s", image))
+	if err != nil {
+		return false, err
+	}
+	return parseIndex(output)
+}
+
+// PushManifestList creates a manifest list from pushed images and pushes it.
+// A stale local list of the same name is replaced and the list is removed
+// after the push.
+func (p *PodmanRuntime) PushManifestList(ctx context.Context, list string, images []string, options PushOptions) error {
+	// Fails when there is no such list, which is the common case
+	_ = exec.CommandContext(ctx, p.command, "manifest", "rm", list).Run()
+
+	args := []string{"manifest", "create", list}
+	if !p.tls.ForImage(list).Verify() {
+		args = append(args, "--tls-verify=false")
+	}
+	for _, image := range images {
+		args = append(args, "docker://"+image)
+	}
+	cmd := exec.CommandContext(ctx, p.command, args...)
+
+	// Set proxy environment and credentials if configured; manifest create
+	// has no --authfile flag
+	path, cleanup, err := authFile(p.credentials, list)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	env := proxyEnv(options.Proxy, list)
+	cmd.Env = env
+	if path != "" {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(withoutEnv(cmd.Env, []string{"REGISTRY_AUTH_FILE"}), "REGISTRY_AUTH_FILE="+path)
+	}
+
+	if err := runCommand(ctx, p.logger, cmd, fmt.Sprintf("failed to create manifest list %s", list)); err != nil {
+		return err
+	}
+
+	tlsArgs, cleanupCerts, err := p.tlsArgs(list)
+	if err != nil {
+		return err
+	}
+	defer cleanupCerts()
+
+	args = append([]string{"manifest", "push", "--all", "--rm"}, tlsArgs...)
+	if path != "" {
+		args = append(args, "--authfile", path)
+	}
+	cmd = exec.CommandContext(ctx, p.command, append(args, list, "docker://"+list)...)
+	cmd.Env = env
+
+	return runCommand(ctx, p.logger, cmd, fmt.Sprintf("failed to push manifest list %s", list))
+}
+
+// authArgs returns the --authfile flag pointing a command operating on image
+// at the credentials hpn has for its registry, or none if it has none.
+// cleanup removes the auth file.
+func (p *PodmanRuntime) authArgs(image string) (args []string, cleanup func(), err error) {
+	path, cleanup, err := authFile(p.credentials, image)
+	if err != nil || path == "" {
+		return nil, cleanup, err
+	}
+	return []string{"--authfile", path}, cleanup, nil
+}
+
+// tlsArgs returns the TLS flags for a command operating on image: no
+// verification for insecure registries and a temporary certificate
+// directory for configured certificates. cleanup removes the directory.
+func (p *PodmanRuntime) tlsArgs(image string) (args []string, cleanup func(), err error) {
+	cleanup = func() {}
+	settings := p.tls.ForImage(image)
+	if settings == nil {
+		return nil, cleanup, nil
+	}
+
+	if !settings.Verify() {
+		args = append(args, "--tls-verify=false")
+	}
+	if settings.hasCertificates() {
+		dir, removeDir, err := certDir(settings)
+		if err != nil {
+			return nil, nil, err
+		}
+		args = append(args, "--cert-dir", dir)
+		cleanup = removeDir
+	}
+	return args, cleanup, nil
 }
 
 // Version returns the Podman version
@@ -0,0 +1,137 @@
+package runtime
+
+import (
+	"os"
+	"strings"
+
+	"github.com/harpoon/hpn/pkg/reference"
+)
+
+// proxyEnvVars are the environment variables controlling proxies of runtime commands
+var proxyEnvVars = []string{
+	"http_proxy", "HTTP_PROXY",
+	"https_proxy", "HTTPS_PROXY",
+	"no_proxy", "NO_PROXY",
+}
+
+// ForImage returns the proxy settings that apply to image, taking per-registry
+// overrides into account. It returns nil when no proxy configuration applies.
+func (p *ProxyConfig) ForImage(image string) *ProxyConfig {
+	return p.ForRegistry(RegistryHost(image))
+}
+
+// ForRegistry returns the proxy settings that apply to the registry host
+func (p *ProxyConfig) ForRegistry(host string) *ProxyConfig {
+	if p == nil {
+		return nil
+	}
+
+	for _, override := range p.Registries {
+		if !matchRegistry(override.Registry, host) {
+			continue
+		}
+		if override.Bypass {
+			return &ProxyConfig{Enabled: false, Bypass: true}
+		}
+
+		effective := &ProxyConfig{
+			HTTP:    p.HTTP,
+			HTTPS:   p.HTTPS,
+			NoProxy: p.NoProxy,
+			Enabled: true,
+		}
+		if override.HTTP != "" {
+			effective.HTTP = override.HTTP
+		}
+		if override.HTTPS != "" {
+			effective.HTTPS = override.HTTPS
+		}
+		return effective
+	}
+
+	if !p.Enabled {
+		return nil
+	}
+	return &ProxyConfig{
+		HTTP:    p.HTTP,
+		HTTPS:   p.HTTPS,
+		NoProxy: p.NoProxy,
+		Enabled: true,
+	}
+}
+
+// proxyEnv returns the environment for a runtime command operating on image,
+// or nil to inherit the current environment unchanged
+func proxyEnv(proxy *ProxyConfig, image string) []string {
+	effective := proxy.ForImage(image)
+	if effective == nil {
+		return nil
+	}
+
+	// Drop inherited proxy settings so the effective configuration wins
+	env := withoutProxyEnv(os.Environ())
+	if effective.Bypass {
+		return env
+	}
+
+	if effective.HTTP != "" {
+		env = append(env, "http_proxy="+effective.HTTP, "HTTP_PROXY="+effective.HTTP)
+	}
+	if effective.HTTPS != "" {
+		env = append(env, "https_proxy="+effective.HTTPS, "HTTPS_PROXY="+effective.HTTPS)
+	}
+	if len(effective.NoProxy) > 0 {
+		noProxy := strings.Join(effective.NoProxy, ",")
+		env = append(env, "no_proxy="+noProxy, "NO_PROXY="+noProxy)
+	}
+	return env
+}
+
+// withoutProxyEnv removes proxy variables from env
+func withoutProxyEnv(env []string) []string {
+	filtered := make([]string, 0, len(env))
+	for _, kv := range env {
+		name := kv
+		if i := strings.IndexByte(kv, '='); i >= 0 {
+			name = kv[:i]
+		}
+
+		isProxy := false
+		for _, proxyVar := range proxyEnvVars {
+			if name == proxyVar {
+				isProxy = true
+				break
+			}
+		}
+		if !isProxy {
+			filtered = append(filtered, kv)
+		}
+	}
+	return filtered
+}
+
+// matchRegistry reports whether host matches pattern. Patterns are exact
+// hostnames (optionally with port) or "*.domain" wildcards, which match
+// subdomains on any port.
+func matchRegistry(pattern, host string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	host = strings.ToLower(host)
+
+	if strings.HasPrefix(pattern, "*.") {
+		if i := strings.LastIndexByte(host, ':'); i >= 0 {
+			host = host[:i]
+		}
+		return strings.HasSuffix(host, pattern[1:])
+	}
+	return pattern == host
+}
+
+// RegistryHost returns the registry hostname of an image reference,
+// defaulting to docker.io for references without a registry
+func RegistryHost(image string) string {
+	ref, err := reference.Parse(image)
+	if err != nil {
+		return reference.DefaultDomain
+	}
+	return ref.Domain
+}
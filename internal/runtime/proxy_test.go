@@ -0,0 +1,167 @@
+package runtime
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestProxyForImage(t *testing.T) {
+	global := &ProxyConfig{
+		HTTP:    "http://proxy:3128",
+		HTTPS:   "http://proxy:3129",
+		NoProxy: []string{"localhost", "10.0.0.0/8"},
+		Enabled: true,
+		Registries: []RegistryProxy{
+			{Registry: "harbor.local", Bypass: true},
+			{Registry: "*.corp.example", HTTPS: "http://corp-proxy:8080"},
+			{Registry: "localhost:5000", Bypass: true},
+			{Registry: "registry.corp.example", Bypass: true}, // shadowed by the wildcard
+		},
+	}
+	corp := &ProxyConfig{HTTP: global.HTTP, HTTPS: "http://corp-proxy:8080", NoProxy: global.NoProxy, Enabled: true}
+	bypass := &ProxyConfig{Bypass: true}
+	proxied := &ProxyConfig{HTTP: global.HTTP, HTTPS: global.HTTPS, NoProxy: global.NoProxy, Enabled: true}
+
+	// Overrides apply even when the global proxy is disabled
+	disabled := &ProxyConfig{
+		HTTP:       "http://proxy:3128",
+		Registries: []RegistryProxy{{Registry: "ghcr.io", HTTPS: "http://gh-proxy:8080"}},
+	}
+
+	tests := []struct {
+		config *ProxyConfig
+		image  string
+		want   *ProxyConfig
+	}{
+		{global, "nginx:1.25", proxied},
+		{global, "docker.io/library/nginx", proxied},
+		{global, "harbor.local/library/nginx:1.25", bypass},
+		{global, "harbor.local:8443/library/nginx", proxied},
+		{global, "registry.corp.example/team/app:v1", corp},
+		{global, "registry.corp.example:5000/team/app", corp},
+		{global, "corp.example/app", proxied},
+		{global, "registry.corp.example.org/app", proxied},
+		{global, "localhost:5000/app", bypass},
+		{global, "localhost/app", proxied},
+		{disabled, "ghcr.io/org/app", &ProxyConfig{HTTP: "http://proxy:3128", HTTPS: "http://gh-proxy:8080", Enabled: true}},
+		{disabled, "nginx", nil},
+		{nil, "nginx", nil},
+	}
+	for _, tt := range tests {
+		if got := tt.config.ForImage(tt.image); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ForImage(%q) = %+v, want %+v", tt.image, got, tt.want)
+		}
+	}
+}
+
+func TestProxyForRegistry(t *testing.T) {
+	config := &ProxyConfig{
+		HTTP:    "http://proxy:3128",
+		HTTPS:   "http://proxy:3129",
+		NoProxy: []string{"*.internal"},
+		Enabled: true,
+		Registries: []RegistryProxy{
+			{Registry: "harbor.local:5000", Bypass: true},
+			{Registry: "*.corp.example", HTTP: "http://corp-proxy:8080"},
+		},
+	}
+	proxied := &ProxyConfig{HTTP: config.HTTP, HTTPS: config.HTTPS, NoProxy: config.NoProxy, Enabled: true}
+
+	tests := []struct {
+		host string
+		want *ProxyConfig
+	}{
+		{"docker.io", proxied},
+		{"harbor.local:5000", &ProxyConfig{Bypass: true}},
+		{"HARBOR.LOCAL:5000", &ProxyConfig{Bypass: true}},
+		{"harbor.local", proxied},
+		{"registry.corp.example:8443", &ProxyConfig{HTTP: "http://corp-proxy:8080", HTTPS: config.HTTPS, NoProxy: config.NoProxy, Enabled: true}},
+	}
+	for _, tt := range tests {
+		if got := config.ForRegistry(tt.host); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ForRegistry(%q) = %+v, want %+v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestProxyEnv(t *testing.T) {
+	t.Setenv("HTTP_PROXY", "http://inherited:1")
+	t.Setenv("no_proxy", "inherited.local")
+	t.Setenv("HPN_TEST_KEEP", "1")
+
+	config := &ProxyConfig{
+		HTTPS:      "http://proxy:3129",
+		NoProxy:    []string{"localhost", ".internal"},
+		Enabled:    true,
+		Registries: []RegistryProxy{{Registry: "harbor.local", Bypass: true}},
+	}
+
+	env := proxyEnv(config, "nginx")
+	for _, kv := range []string{"https_proxy=http://proxy:3129", "HTTPS_PROXY=http://proxy:3129", "no_proxy=localhost,.internal", "NO_PROXY=localhost,.internal", "HPN_TEST_KEEP=1"} {
+		if !slices.Contains(env, kv) {
+			t.Errorf("proxy environment lacks %s", kv)
+		}
+	}
+	for _, kv := range []string{"HTTP_PROXY=http://inherited:1", "no_proxy=inherited.local"} {
+		if slices.Contains(env, kv) {
+			t.Errorf("proxy environment keeps inherited %s", kv)
+		}
+	}
+
+	// Bypassed registries get no proxy at all, not even an inherited one
+	env = proxyEnv(config, "harbor.local/library/nginx")
+	if !slices.Contains(env, "HPN_TEST_KEEP=1") || len(env) != len(withoutProxyEnv(env)) {
+		t.Errorf("bypass environment = %v, want no proxy variables", env)
+	}
+
+	// Without an applicable configuration the environment is inherited
+	if env := proxyEnv(&ProxyConfig{HTTP: "http://proxy:3128"}, "nginx"); env != nil {
+		t.Errorf("disabled proxy environment = %v, want nil", env)
+	}
+	if env := proxyEnv(nil, "nginx"); env != nil {
+		t.Errorf("proxy environment without a configuration = %v, want nil", env)
+	}
+}
+
+func TestMatchRegistry(t *testing.T) {
+	tests := []struct {
+		pattern, host string
+		want          bool
+	}{
+		{"harbor.local", "harbor.local", true},
+		{" Harbor.Local ", "harbor.local", true},
+		{"harbor.local", "HARBOR.LOCAL", true},
+		{"harbor.local", "harbor.local:5000", false},
+		{"harbor.local:5000", "harbor.local:5000", true},
+		{"harbor.local:5000", "harbor.local", false},
+		{"*.corp.example", "registry.corp.example", true},
+		{"*.corp.example", "a.b.corp.example:443", true},
+		{"*.corp.example", "corp.example", false},
+		{"*.corp.example", "evilcorp.example", false},
+		{"*", "docker.io", false},
+	}
+	for _, tt := range tests {
+		if got := matchRegistry(tt.pattern, tt.host); got != tt.want {
+			t.Errorf("matchRegistry(%q, %q) = %v, want %v", tt.pattern, tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestRegistryHost(t *testing.T) {
+	tests := map[string]string{
+		"nginx":                         "docker.io",
+		"library/nginx:1.25":            "docker.io",
+		"docker.io/library/nginx":       "docker.io",
+		"index.docker.io/library/nginx": "docker.io",
+		"quay.io/prometheus/node":       "quay.io",
+		"localhost/app":                 "localhost",
+		"localhost:5000/app":            "localhost:5000",
+		"harbor.local:8443/lib/app:1":   "harbor.local:8443",
+	}
+	for image, want := range tests {
+		if got := RegistryHost(image); got != want {
+			t.Errorf("RegistryHost(%q) = %q, want %q", image, got, want)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package runtime
+
+import (
+	"context"
+	stderrors "errors"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/harpoon/hpn/pkg/errors"
+)
+
+// RetryObserver is notified before an operation is retried
+type RetryObserver func(attempt, maxAttempts int, delay time.Duration, err error)
+
+type retryObserverKey struct{}
+
+// WithRetryObserver returns a context that reports retries to observer
+func WithRetryObserver(ctx context.Context, observer RetryObserver) context.Context {
+	return context.WithValue(ctx, retryObserverKey{}, observer)
+}
+
+// Retry executes fn until it succeeds, fails permanently, the context is done
+// or the configured attempts are exhausted. Delays grow exponentially from
+// config.Delay up to config.MaxDelay with random jitter.
+func Retry(ctx context.Context, config RetryConfig, fn func(ctx context.Context) error) error {
+	attempts := config.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	observer, _ := ctx.Value(retryObserverKey{}).(RetryObserver)
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(ctx); err == nil {
+			return nil
+		}
+
+		if attempt >= attempts || ctx.Err() != nil || !IsRetryable(err) {
+			return err
+		}
+
+		delay := backoff(config, attempt)
+		if observer != nil {
+			observer(attempt, attempts, delay, err)
+		}
+
+		if sleep(ctx, delay) != nil {
+			return err
+		}
+	}
+}
+
+// sleep waits for d or until ctx is done, returning the context error in
+// that case. Tests replace it to run without delays.
+var sleep = func(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// jitter returns a random duration between 0 and n inclusive
+var jitter = func(n time.Duration) time.Duration {
+	return time.Duration(rand.Int63n(int64(n) + 1))
+}
+
+// backoff returns the delay before the next attempt. The exponential delay
+// is capped at MaxDelay and randomized to the upper half of its range so
+// concurrent workers don't retry in lockstep.
+func backoff(config RetryConfig, attempt int) time.Duration {
+	delay := config.Delay
+	if delay <= 0 {
+		return 0
+	}
+
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if config.MaxDelay > 0 && delay >= config.MaxDelay {
+			delay = config.MaxDelay
+			break
+		}
+	}
+
+	half := delay / 2
+	return half + jitter(delay-half)
+}
+
+// permanentMessages are runtime messages that will not succeed on retry
+var permanentMessages = []string{
+	"unauthorized",
+	"authentication required",
+	"denied",
+	"manifest unknown",
+	"not found",
+	"no such image",
+	"no such file",
+	"invalid reference format",
+	"no space left",
+}
+
+// IsRetryable reports whether an operation that failed with err may succeed
+// when retried. Authentication, missing images, invalid references and full
+// disks are permanent; network failures, timeouts and unknown runtime
+// failures are retried.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if stderrors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var herr *errors.HarpoonError
+	if stderrors.As(err, &herr) {
+		switch herr.Code {
+		case errors.ErrRegistryAuth,
+			errors.ErrImageNotFound,
+			errors.ErrImageInvalid,
+			errors.ErrImageParsing,
+			errors.ErrInsufficientSpace,
+			errors.ErrFileNotFound,
+			errors.ErrFilePermission,
+			errors.ErrInvalidConfig,
+			errors.ErrDigestMismatch:
+			return false
+		case errors.ErrRuntimeTimeout,
+			errors.ErrRegistryRateLimit,
+			errors.ErrNetworkTimeout,
+			errors.ErrNetworkConnection,
+			errors.ErrProxyConnection,
+			errors.ErrRegistryConnection,
+			errors.ErrRegistryTimeout:
+			return true
+		}
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, permanent := range permanentMessages {
+		if strings.Contains(msg, permanent) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RetryRuntime wraps a ContainerRuntime and retries failed pull, push, save
+// and load operations
+type RetryRuntime struct {
+	ContainerRuntime
+	config      RetryConfig
+	saveTimeout time.Duration
+	loadTimeout time.Duration
+}
+
+// NewRetryRuntime creates a runtime that retries operations of rt using config.
+// Pull and push use the retry configuration of their options when set.
+func NewRetryRuntime(rt ContainerRuntime, config RetryConfig) *RetryRuntime {
+	return &RetryRuntime{
+		ContainerRuntime: rt,
+		config:           config,
+	}
+}
+
+// SetTimeouts sets the timeouts applied to every save and load attempt.
+// Pull and push attempts use the timeout of their options.
+func (r *RetryRuntime) SetTimeouts(save, load time.Duration) {
+	r.saveTimeout = save
+	r.loadTimeout = load
+}
+
+// Unwrap returns the underlying runtime
+func (r *RetryRuntime) Unwrap() ContainerRuntime {
+	return r.ContainerRuntime
+}
+
+// Pull pulls an image, retrying transient failures
+func (r *RetryRuntime) Pull(ctx context.Context, image string, options PullOptions) error {
+	return Retry(ctx, r.retryConfig(options.Retry), func(ctx context.Context) error {
+		ctx, cancel := withOptionalTimeout(ctx, options.Timeout)
+		defer cancel()
+		return r.ContainerRuntime.Pull(ctx, image, options)
+	})
+}
+
+// Push pushes an image, retrying transient failures
+func (r *RetryRuntime) Push(ctx context.Context, image string, options PushOptions) error {
+	return Retry(ctx, r.retryConfig(options.Retry), func(ctx context.Context) error {
+		ctx, cancel := withOptionalTimeout(ctx, options.Timeout)
+		defer cancel()
+		return r.ContainerRuntime.Push(ctx, image, options)
+	})
+}
+
+// Save saves an image to a tar file, retrying transient failures
+func (r *RetryRuntime) Save(ctx context.Context, image string, tarPath string) error {
+	return Retry(ctx, r.config, func(ctx context.Context) error {
+		ctx, cancel := withOptionalTimeout(ctx, r.saveTimeout)
+		defer cancel()
+		return r.ContainerRuntime.Save(ctx, image, tarPath)
+	})
+}
+
+// Load loads an image from a tar file, retrying transient failures
+func (r *RetryRuntime) Load(ctx context.Context, tarPath string) error {
+	return Retry(ctx, r.config, func(ctx context.Context) error {
+		ctx, cancel := withOptionalTimeout(ctx, r.loadTimeout)
+		defer cancel()
+		return r.ContainerRuntime.Load(ctx, tarPath)
+	})
+}
+
+// retryConfig returns the per-operation retry configuration if set
+func (r *RetryRuntime) retryConfig(override RetryConfig) RetryConfig {
+	if override.MaxAttempts > 0 {
+		return override
+	}
+	return r.config
+}
+
+// withOptionalTimeout applies timeout to ctx when it is positive
+func withOptionalTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,271 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/harpoon/hpn/pkg/errors"
+)
+
+// fakeSleep replaces sleep for the duration of a test and records the delays
+func fakeSleep(t *testing.T) *[]time.Duration {
+	t.Helper()
+	var delays []time.Duration
+	saved := sleep
+	sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return ctx.Err()
+	}
+	t.Cleanup(func() { sleep = saved })
+	return &delays
+}
+
+// fixedJitter replaces jitter for the duration of a test; full selects the
+// largest delay instead of the smallest
+func fixedJitter(t *testing.T, full bool) {
+	t.Helper()
+	saved := jitter
+	jitter = func(n time.Duration) time.Duration {
+		if full {
+			return n
+		}
+		return 0
+	}
+	t.Cleanup(func() { jitter = saved })
+}
+
+func TestRetry(t *testing.T) {
+	transient := errors.New(errors.ErrNetworkTimeout, "i/o timeout")
+	permanent := errors.New(errors.ErrRegistryAuth, "unauthorized")
+	config := RetryConfig{MaxAttempts: 3, Delay: time.Second, MaxDelay: 5 * time.Second}
+
+	tests := []struct {
+		name   string
+		config RetryConfig
+		errs   []error // results of the attempts, nil for success
+		want   error
+		calls  int
+		delays []time.Duration
+	}{
+		{"success", config, []error{nil}, nil, 1, nil},
+		{"transient then success", config, []error{transient, transient, nil}, nil, 3, []time.Duration{time.Second, 2 * time.Second}},
+		{"permanent", config, []error{permanent}, permanent, 1, nil},
+		{"transient then permanent", config, []error{transient, permanent}, permanent, 2, []time.Duration{time.Second}},
+		{"exhausted", config, []error{transient, transient, transient}, transient, 3, []time.Duration{time.Second, 2 * time.Second}},
+		{"no attempts configured", RetryConfig{}, []error{transient}, transient, 1, nil},
+	}
+	for _, tt := range tests {
+		delays := fakeSleep(t)
+		fixedJitter(t, true)
+
+		var observed []string
+		ctx := WithRetryObserver(context.Background(), func(attempt, maxAttempts int, delay time.Duration, err error) {
+			observed = append(observed, fmt.Sprintf("%d/%d %s", attempt, maxAttempts, delay))
+		})
+
+		calls := 0
+		err := Retry(ctx, tt.config, func(ctx context.Context) error {
+			calls++
+			return tt.errs[calls-1]
+		})
+		if err != tt.want {
+			t.Errorf("%s: Retry = %v, want %v", tt.name, err, tt.want)
+		}
+		if calls != tt.calls {
+			t.Errorf("%s: %d attempts, want %d", tt.name, calls, tt.calls)
+		}
+		if !reflect.DeepEqual(*delays, tt.delays) {
+			t.Errorf("%s: delays = %v, want %v", tt.name, *delays, tt.delays)
+		}
+
+		var want []string
+		for i, delay := range tt.delays {
+			want = append(want, fmt.Sprintf("%d/%d %s", i+1, tt.config.MaxAttempts, delay))
+		}
+		if !reflect.DeepEqual(observed, want) {
+			t.Errorf("%s: observed retries %v, want %v", tt.name, observed, want)
+		}
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	delays := fakeSleep(t)
+	transient := errors.New(errors.ErrNetworkTimeout, "i/o timeout")
+
+	// A cancellation while waiting returns the last error without retrying
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := Retry(ctx, RetryConfig{MaxAttempts: 5, Delay: time.Second}, func(ctx context.Context) error {
+		calls++
+		cancel()
+		return transient
+	})
+	if err != transient || calls != 1 || len(*delays) != 0 {
+		t.Errorf("Retry after cancel = %v after %d attempts and %d delays, want %v after 1 attempt", err, calls, len(*delays), transient)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	saved := sleep
+	sleep = func(ctx context.Context, d time.Duration) error {
+		cancel()
+		return saved(ctx, d)
+	}
+	calls = 0
+	err = Retry(ctx, RetryConfig{MaxAttempts: 5, Delay: time.Hour}, func(ctx context.Context) error {
+		calls++
+		return transient
+	})
+	if err != transient || calls != 1 {
+		t.Errorf("Retry canceled during backoff = %v after %d attempts, want %v after 1 attempt", err, calls, transient)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	config := RetryConfig{Delay: time.Second, MaxDelay: 5 * time.Second}
+	ceiling := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+
+	// Random jitter stays in the upper half of the delay
+	for i := 0; i < 100; i++ {
+		if got := backoff(config, 3); got < 2*time.Second || got > 4*time.Second {
+			t.Fatalf("backoff(attempt 3) = %s, want between 2s and 4s", got)
+		}
+	}
+
+	for _, full := range []bool{false, true} {
+		fixedJitter(t, full)
+		for i, delay := range ceiling {
+			want := delay / 2
+			if full {
+				want = delay
+			}
+			if got := backoff(config, i+1); got != want {
+				t.Errorf("backoff(attempt %d, full jitter %v) = %s, want %s", i+1, full, got, want)
+			}
+		}
+	}
+
+	if got := backoff(RetryConfig{}, 3); got != 0 {
+		t.Errorf("backoff without a delay = %s, want 0", got)
+	}
+	if got := backoff(RetryConfig{Delay: time.Second}, 7); got < 32*time.Second {
+		t.Errorf("backoff without a maximum delay = %s, want at least 32s", got)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{context.Canceled, false},
+		{fmt.Errorf("pull: %w", context.Canceled), false},
+		{context.DeadlineExceeded, true},
+		{errors.New(errors.ErrRegistryAuth, "login required"), false},
+		{errors.New(errors.ErrImageNotFound, "nginx:1.99"), false},
+		{errors.New(errors.ErrInsufficientSpace, "disk full"), false},
+		{errors.New(errors.ErrDigestMismatch, "digest differs"), false},
+		{errors.New(errors.ErrRuntimeTimeout, "timed out"), true},
+		{errors.New(errors.ErrRegistryRateLimit, "toomanyrequests"), true},
+		{errors.New(errors.ErrNetworkConnection, "connection refused"), true},
+		// The code decides over the message
+		{errors.New(errors.ErrRegistryConnection, "tls: handshake failure: not found"), true},
+		{fmt.Errorf("push: %w", errors.New(errors.ErrRegistryAuth, "denied")), false},
+		// Without a known code the message is classified
+		{errors.New(errors.ErrRuntimeCommand, "exit status 1: unauthorized: authentication required"), false},
+		{fmt.Errorf("open /tmp/x.tar: no such file or directory"), false},
+		{fmt.Errorf("invalid reference format: repository name must be lowercase"), false},
+		{fmt.Errorf("write /var/lib/docker: no space left on device"), false},
+		{fmt.Errorf("exit status 1: unexpected EOF"), true},
+		{errors.New(errors.ErrRuntimeCommand, "exit status 125"), true},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// flakyRuntime fails the first attempts of its operations with err
+type flakyRuntime struct {
+	ContainerRuntime
+	failures int
+	err      error
+	calls    int
+	deadline bool // whether the last attempt had a deadline
+}
+
+func (f *flakyRuntime) attempt(ctx context.Context) error {
+	f.calls++
+	_, f.deadline = ctx.Deadline()
+	if f.calls <= f.failures {
+		return f.err
+	}
+	return nil
+}
+
+func (f *flakyRuntime) Pull(ctx context.Context, image string, options PullOptions) error {
+	return f.attempt(ctx)
+}
+
+func (f *flakyRuntime) Push(ctx context.Context, image string, options PushOptions) error {
+	return f.attempt(ctx)
+}
+
+func (f *flakyRuntime) Save(ctx context.Context, image, tarPath string) error {
+	return f.attempt(ctx)
+}
+
+func (f *flakyRuntime) Load(ctx context.Context, tarPath string) error {
+	return f.attempt(ctx)
+}
+
+func TestRetryRuntime(t *testing.T) {
+	fakeSleep(t)
+	transient := errors.New(errors.ErrNetworkConnection, "connection reset by peer")
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		op       func(r *RetryRuntime) error
+		failures int
+		calls    int
+		deadline bool
+		ok       bool
+	}{
+		{"pull with the runtime retries", func(r *RetryRuntime) error {
+			return r.Pull(ctx, "nginx", PullOptions{})
+		}, 2, 3, false, true},
+		{"pull with its own retries", func(r *RetryRuntime) error {
+			return r.Pull(ctx, "nginx", PullOptions{Retry: RetryConfig{MaxAttempts: 2}, Timeout: time.Minute})
+		}, 2, 2, true, false},
+		{"push", func(r *RetryRuntime) error {
+			return r.Push(ctx, "harbor.local/nginx", PushOptions{Retry: RetryConfig{MaxAttempts: 5}})
+		}, 4, 5, false, true},
+		{"save", func(r *RetryRuntime) error {
+			return r.Save(ctx, "nginx", "nginx.tar")
+		}, 3, 3, true, false},
+		{"load", func(r *RetryRuntime) error {
+			return r.Load(ctx, "nginx.tar")
+		}, 1, 2, false, true},
+	}
+	for _, tt := range tests {
+		rt := &flakyRuntime{failures: tt.failures, err: transient}
+		r := NewRetryRuntime(rt, RetryConfig{MaxAttempts: 3})
+		r.SetTimeouts(time.Minute, 0)
+
+		err := tt.op(r)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: error = %v, want success %v", tt.name, err, tt.ok)
+		}
+		if rt.calls != tt.calls {
+			t.Errorf("%s: %d attempts, want %d", tt.name, rt.calls, tt.calls)
+		}
+		if rt.deadline != tt.deadline {
+			t.Errorf("%s: attempt deadline = %v, want %v", tt.name, rt.deadline, tt.deadline)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package runtime
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/reference"
+)
+
+// tlsSetter is implemented by runtimes that accept registry TLS settings
+type tlsSetter interface {
+	SetTLS(config *TLSConfig)
+}
+
+// ForImage returns the TLS settings of the registry of image, or nil if
+// none are configured
+func (t *TLSConfig) ForImage(image string) *RegistryTLS {
+	return t.ForRegistry(RegistryHost(image))
+}
+
+// ForRegistry returns the TLS settings of the registry host, or nil if none
+// are configured. The first matching registry applies.
+func (t *TLSConfig) ForRegistry(host string) *RegistryTLS {
+	if t == nil {
+		return nil
+	}
+	for i := range t.Registries {
+		if matchRegistry(t.Registries[i].Registry, host) {
+			return &t.Registries[i]
+		}
+	}
+	return nil
+}
+
+// Verify reports whether server certificates are verified. Registries
+// without settings are verified.
+func (r *RegistryTLS) Verify() bool {
+	return r == nil || (!r.Insecure && !r.SkipVerify)
+}
+
+// hasCertificates reports whether r configures a CA or client certificate
+func (r *RegistryTLS) hasCertificates() bool {
+	return r != nil && (r.CAFile != "" || r.CertFile != "")
+}
+
+// clientConfig returns the crypto/tls configuration of the settings, or nil
+// for the defaults
+func (r *RegistryTLS) clientConfig() (*tls.Config, error) {
+	if r == nil {
+		return nil, nil
+	}
+
+	config := &tls.Config{InsecureSkipVerify: !r.Verify()}
+	if r.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		data, err := os.ReadFile(r.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, errors.ErrInvalidConfig, fmt.Sprintf("failed to read CA file of registry %s", r.Registry))
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.New(errors.ErrInvalidConfig, fmt.Sprintf("CA file %s of registry %s contains no certificates", r.CAFile, r.Registry))
+		}
+		config.RootCAs = pool
+	}
+	if r.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(r.CertFile, r.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, errors.ErrInvalidConfig, fmt.Sprintf("failed to load client certificate of registry %s", r.Registry))
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// certDir returns a temporary certificate directory in the layout of
+// containers/image (podman --cert-dir): *.crt CA certificates and a
+// *.cert/*.key client certificate
+func certDir(settings *RegistryTLS) (string, func(), error) {
+	dir, err := os.MkdirTemp("", "hpn-certs-")
+	if err != nil {
+		return "", nil, errors.Wrap(err, errors.ErrFileOperation, "failed to create temporary certificate directory")
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	links := map[string]string{
+		"ca.crt":      settings.CAFile,
+		"client.cert": settings.CertFile,
+		"client.key":  settings.KeyFile,
+	}
+	for name, file := range links {
+		if file == "" {
+			continue
+		}
+		if err := linkFile(file, filepath.Join(dir, name)); err != nil {
+			cleanup()
+			return "", nil, err
+		}
+	}
+	return dir, cleanup, nil
+}
+
+// hostsDir returns a temporary containerd hosts directory (nerdctl
+// --hosts-dir) configuring the certificates of the registry host
+func hostsDir(host string, settings *RegistryTLS) (string, func(), error) {
+	dir, err := os.MkdirTemp("", "hpn-hosts-")
+	if err != nil {
+		return "", nil, errors.Wrap(err, errors.ErrFileOperation, "failed to create temporary hosts directory")
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	server := "https://" + host
+	if host == reference.DefaultDomain {
+		server = "https://registry-1.docker.io"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "server = %q\n\n[host.%q]\n", server, server)
+	b.WriteString("  capabilities = [\"pull\", \"resolve\", \"push\"]\n")
+	if settings.CAFile != "" {
+		fmt.Fprintf(&b, "  ca = %q\n", absPath(settings.CAFile))
+	}
+	if settings.CertFile != "" {
+		fmt.Fprintf(&b, "  client = [[%q, %q]]\n", absPath(settings.CertFile), absPath(settings.KeyFile))
+	}
+	if !settings.Verify() {
+		b.WriteString("  skip_verify = true\n")
+	}
+
+	hostDir := filepath.Join(dir, host)
+	if err := os.MkdirAll(hostDir, 0700); err != nil {
+		cleanup()
+		return "", nil, errors.Wrap(err, errors.ErrFileOperation, "failed to create temporary hosts directory")
+	}
+	if err := os.WriteFile(filepath.Join(hostDir, "hosts.toml"), []byte(b.String()), 0600); err != nil {
+		cleanup()
+		return "", nil, errors.Wrap(err, errors.ErrFileOperation, "failed to write temporary hosts configuration")
+	}
+	return dir, cleanup, nil
+}
+
+// linkFile links path to file, failing if file does not exist
+func linkFile(file, path string) error {
+	file = absPath(file)
+	if _, err := os.Stat(file); err != nil {
+		return errors.Wrap(err, errors.ErrInvalidConfig, fmt.Sprintf("failed to read %s", file))
+	}
+	if err := os.Symlink(file, path); err != nil {
+		return errors.Wrap(err, errors.ErrFileOperation, fmt.Sprintf("failed to link %s", file))
+	}
+	return nil
+}
+
+// absPath returns the absolute form of path, or path if it has none
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/harpoon/hpn/internal/logger"
+	"github.com/harpoon/hpn/pkg/errors"
+)
+
+const (
+	// rampThreshold is the relative throughput gain required to add a worker
+	rampThreshold = 0.05
+
+	// backoffThreshold is the relative throughput loss that removes a worker
+	backoffThreshold = 0.10
+
+	// rateLimitCooldown is the number of rounds to hold the limit after a rate-limit response
+	rateLimitCooldown = 2
+)
+
+// adaptiveLimiter adjusts the number of concurrent jobs based on observed
+// throughput and errors. It starts with a single worker, adds one worker per
+// round while throughput keeps improving, removes one when throughput drops
+// or a job fails and halves the limit when the registry rate-limits us.
+// A round ends once as many jobs have completed as the current limit.
+type adaptiveLimiter struct {
+	mu         sync.Mutex
+	max        int
+	limit      int
+	completed  int
+	roundStart time.Time
+	lastRate   float64
+	cooldown   int
+	log        logger.Logger
+	now        func() time.Time
+}
+
+// newAdaptiveLimiter creates an adaptive limiter bounded by max workers
+func newAdaptiveLimiter(max int, log logger.Logger) *adaptiveLimiter {
+	if max < 1 {
+		max = 1
+	}
+	return &adaptiveLimiter{
+		max:        max,
+		limit:      1,
+		roundStart: time.Now(),
+		log:        log,
+		now:        time.Now,
+	}
+}
+
+// Max returns the upper bound of concurrently running jobs
+func (a *adaptiveLimiter) Max() int {
+	return a.max
+}
+
+// Limit returns the number of jobs currently allowed to run
+func (a *adaptiveLimiter) Limit() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.limit
+}
+
+// Done records the outcome of a finished job and adjusts the limit
+func (a *adaptiveLimiter) Done(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	previous := a.limit
+	defer func() {
+		if a.limit != previous {
+			a.log.Debug("Adjusted parallel workers", logger.F("from", previous), logger.F("to", a.limit))
+		}
+	}()
+
+	if err != nil {
+		if isRateLimited(err) {
+			a.limit = maxInt(1, a.limit/2)
+			a.cooldown = rateLimitCooldown
+		} else if a.limit > 1 {
+			a.limit--
+		}
+		// Throughput measured across a failure is not comparable
+		a.lastRate = 0
+		a.resetRound()
+		return
+	}
+
+	a.completed++
+	if a.completed < a.limit {
+		return
+	}
+
+	rate := float64(a.completed) / a.now().Sub(a.roundStart).Seconds()
+
+	switch {
+	case a.cooldown > 0:
+		a.cooldown--
+	case a.lastRate == 0 || rate > a.lastRate*(1+rampThreshold):
+		if a.limit < a.max {
+			a.limit++
+		}
+	case rate < a.lastRate*(1-backoffThreshold):
+		if a.limit > 1 {
+			a.limit--
+		}
+	}
+
+	a.lastRate = rate
+	a.resetRound()
+}
+
+// resetRound starts a new measurement round
+func (a *adaptiveLimiter) resetRound() {
+	a.completed = 0
+	a.roundStart = a.now()
+}
+
+// rateLimitStatus matches HTTP 429 status codes in runtime and registry errors
+var rateLimitStatus = regexp.MustCompile(`\b(?:status(?: code)?|http)[ :=]*429\b`)
+
+// isRateLimited reports whether err indicates a registry rate-limit response
+func isRateLimited(err error) bool {
+	if errors.GetCode(err) == errors.ErrRegistryRateLimit {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "toomanyrequests") ||
+		strings.Contains(msg, "too many requests") ||
+		rateLimitStatus.MatchString(msg)
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
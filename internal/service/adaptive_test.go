@@ -0,0 +1,78 @@
+package service
+
+import (
+	stderrors "errors"
+	"testing"
+	"time"
+
+	"github.com/harpoon/hpn/internal/logger"
+	"github.com/harpoon/hpn/pkg/errors"
+)
+
+func TestAdaptiveLimiter(t *testing.T) {
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	lim := newAdaptiveLimiter(3, logger.Nop())
+	lim.now = func() time.Time { return clock }
+	lim.roundStart = clock
+
+	// round completes the jobs of a round, taking d for all of them
+	round := func(d time.Duration) {
+		clock = clock.Add(d)
+		for i, n := 0, lim.Limit(); i < n; i++ {
+			lim.Done(nil)
+		}
+	}
+	failure := errors.New(errors.ErrRuntimeCommand, "push failed")
+	rateLimit := errors.New(errors.ErrRegistryRateLimit, "toomanyrequests")
+
+	steps := []struct {
+		name string
+		step func()
+		want int
+	}{
+		{"first round", func() { round(time.Second) }, 2},
+		{"throughput improves", func() { round(time.Second) }, 3},
+		{"bounded by max", func() { round(time.Second / 2) }, 3},
+		{"failure removes a worker", func() { lim.Done(failure) }, 2},
+		{"measurement restarts", func() { round(time.Second) }, 3},
+		{"throughput drops", func() { round(3 * time.Second) }, 2},
+		{"steady throughput", func() { round(2 * time.Second) }, 2},
+		{"rate limit halves", func() { lim.Done(rateLimit) }, 1},
+		{"cooldown holds", func() { round(time.Second / 10) }, 1},
+		{"cooldown holds again", func() { round(time.Second / 10) }, 1},
+		{"ramps after cooldown", func() { round(time.Second / 20) }, 2},
+		{"rate limit halves", func() { lim.Done(rateLimit) }, 1},
+		{"failure keeps one worker", func() { lim.Done(failure) }, 1},
+	}
+	for _, s := range steps {
+		s.step()
+		if got := lim.Limit(); got != s.want {
+			t.Fatalf("%s: limit = %d, want %d", s.name, got, s.want)
+		}
+	}
+	if lim.Max() != 3 {
+		t.Errorf("Max() = %d, want 3", lim.Max())
+	}
+}
+
+func TestIsRateLimited(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errors.New(errors.ErrRegistryRateLimit, "failed to pull image nginx"), true},
+		{stderrors.New("toomanyrequests: You have reached your pull rate limit"), true},
+		{stderrors.New("429 Too Many Requests"), true},
+		{stderrors.New("unexpected status code 429"), true},
+		{stderrors.New("registry returned HTTP 429"), true},
+		{stderrors.New("pushed digest sha256:4291aa of harbor.local/app:v1 does not match"), false},
+		{stderrors.New("failed to push harbor.local:4290/app:1.429"), false},
+		{stderrors.New("dial tcp 10.0.4.29:443: connection refused"), false},
+		{stderrors.New("unexpected status code 500"), false},
+	}
+	for _, tt := range tests {
+		if got := isRateLimited(tt.err); got != tt.want {
+			t.Errorf("isRateLimited(%q) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/harpoon/hpn/internal/runtime"
+	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/reference"
+	"github.com/harpoon/hpn/pkg/types"
+)
+
+// copyFunc copies source to target unless it is up to date
+type copyFunc func(ctx context.Context, source, target string, options runtime.CopyOptions) (runtime.CopyResult, error)
+
+// Copy copies every image in the request from its registry to its push
+// target. Blobs are streamed between the registries, so nothing is pulled or
+// stored locally; runtimes that cannot copy images use the native runtime.
+func (s *Service) Copy(ctx context.Context, req CopyRequest) (*OperationResult, error) {
+	timeout := req.Timeout
+	if timeout <= 0 {
+		timeout = s.timeouts.Push
+	}
+	retry := req.Retry
+	if retry.MaxAttempts <= 0 {
+		retry = s.opts.Retry
+	}
+
+	rt, err := s.Runtime()
+	if err != nil {
+		return nil, err
+	}
+	copier := s.imageCopier(rt)
+
+	// The timeout applies to every attempt of a copy
+	copyWithRetry := func(ctx context.Context, source, target string, options runtime.CopyOptions) (runtime.CopyResult, error) {
+		var result runtime.CopyResult
+		err := runtime.Retry(ctx, retry, func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			var err error
+			result, err = copier.Copy(ctx, source, target, options)
+			return err
+		})
+		return result, err
+	}
+
+	targets, err := ParseTargetTemplate(req.Template, req.Mode)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+
+	entries := imageEntries(req.Images, req.Entries)
+	return s.run(ctx, opCopy, entryImages(entries), req.Parallel, func(ctx context.Context, rt runtime.ContainerRuntime, i int, res *ItemResult, out io.Writer) error {
+		entry := entries[i]
+		if entry.Skips(types.ActionPush) {
+			return &skipped{reason: "skip: push"}
+		}
+
+		ref, err := reference.Parse(entry.Image)
+		if err != nil {
+			return err
+		}
+
+		options := runtime.CopyOptions{Proxy: req.ProxyConfig, Platforms: req.Platforms, Force: req.Force}
+		if entry.Platform != "" {
+			options.Platforms = []string{entry.Platform}
+		}
+
+		target, err := targets.Target(ref, &entry, req.Registry, req.Project)
+		if err != nil {
+			return err
+		}
+
+		rules, err := entryTagRules(req.TagRules, &entry)
+		if err != nil {
+			return err
+		}
+
+		job := &pushJob{
+			image:  entry.Image,
+			ref:    ref,
+			target: target,
+			tags:   append(append([]string(nil), entry.Tags...), req.Tags...),
+		}
+		if err := retag(job, rules, now); err != nil {
+			return err
+		}
+		return copyImage(ctx, copyWithRetry, job, options, res, out)
+	})
+}
+
+// imageCopier returns rt if it can copy images, or the native runtime of the
+// detector, which has its credentials
+func (s *Service) imageCopier(rt runtime.ContainerRuntime) runtime.ImageCopier {
+	if copier, ok := runtime.As[runtime.ImageCopier](rt); ok {
+		return copier
+	}
+	if s.opts.Detector != nil {
+		if native, err := s.opts.Detector.GetByName("native"); err == nil {
+			if copier, ok := runtime.As[runtime.ImageCopier](native); ok {
+				return copier
+			}
+		}
+	}
+
+	native := runtime.NewNativeRuntime("")
+	native.SetLogger(s.log)
+	return native
+}
+
+// copyImage copies a single image to its push target and records the
+// target and digest in res. The digest of an image pinned by digest must be
+// preserved unless only some of its platforms are copied. Images whose
+// target and additional tags are up to date are skipped.
+func copyImage(ctx context.Context, copyFn copyFunc, job *pushJob, options runtime.CopyOptions, res *ItemResult, out io.Writer) error {
+	res.Target = job.target
+	fmt.Fprintf(out, "  Copy: %s -> %s\n", job.image, job.target)
+
+	start := time.Now()
+	result, err := copyFn(ctx, job.ref.String(), job.target, options)
+	if err != nil {
+		return fmt.Errorf("failed to copy image: %w", err)
+	}
+	digest := result.Digest
+	res.Digest = digest
+
+	switch {
+	case job.ref.Digest == "" || len(options.Platforms) > 0:
+		fmt.Fprintf(out, "  Digest: %s\n", digest)
+	case digest != job.ref.Digest:
+		return errors.New(errors.ErrDigestMismatch,
+			fmt.Sprintf("copied digest %s of %s does not match pinned digest %s", digest, job.target, job.ref.Digest)).
+			WithContext("expected", job.ref.Digest).
+			WithContext("actual", digest)
+	default:
+		fmt.Fprintf(out, "  Digest: %s (verified)\n", digest)
+	}
+	if result.UpToDate {
+		fmt.Fprintf(out, "  Up to date: %s\n", job.target)
+	} else {
+		fmt.Fprintf(out, "  Copied: %s (%s)\n", job.target, time.Since(start).Round(time.Millisecond))
+	}
+
+	// The blobs are in the target repository now, so the additional tags
+	// only need their manifests
+	upToDate := result.UpToDate
+	for _, target := range tagTargets(job) {
+		tagResult, err := copyFn(ctx, job.target, target, runtime.CopyOptions{Proxy: options.Proxy, Force: options.Force})
+		if err != nil {
+			return fmt.Errorf("failed to copy image: %w", err)
+		}
+		if tagResult.UpToDate {
+			fmt.Fprintf(out, "  Up to date: %s\n", target)
+		} else {
+			fmt.Fprintf(out, "  Copied: %s\n", target)
+			upToDate = false
+		}
+		res.Targets = append(res.Targets, target)
+	}
+
+	if upToDate {
+		return &skipped{reason: reasonUpToDate}
+	}
+	return nil
+}
@@ -5,6 +5,8 @@ import (
 	"time"
 
 	"github.com/harpoon/hpn/internal/runtime"
+	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/types"
 )
 
 // ImageService defines the interface for image operations
@@ -13,11 +15,14 @@ type ImageService interface {
 	Save(ctx context.Context, req SaveRequest) (*OperationResult, error)
 	Load(ctx context.Context, req LoadRequest) (*OperationResult, error)
 	Push(ctx context.Context, req PushRequest) (*OperationResult, error)
+	Copy(ctx context.Context, req CopyRequest) (*OperationResult, error)
 }
 
 // PullRequest contains parameters for pull operations
 type PullRequest struct {
 	Images      []string
+	Entries     []types.ImageEntry // images with per-image overrides, used instead of Images when set
+	Platforms   []string           // pull every platform and tag it as <tag>-<os>-<arch>[-<variant>]
 	Parallel    int
 	ProxyConfig *runtime.ProxyConfig
 	Retry       runtime.RetryConfig
@@ -26,10 +31,12 @@ type PullRequest struct {
 
 // SaveRequest contains parameters for save operations
 type SaveRequest struct {
-	Images   []string
-	Mode     SaveMode
-	Parallel int
-	BaseDir  string
+	Images    []string
+	Entries   []types.ImageEntry // images with per-image overrides, used instead of Images when set
+	Platforms []string           // save every pulled platform image to its own tar file
+	Mode      SaveMode
+	Parallel  int
+	BaseDir   string
 }
 
 // LoadRequest contains parameters for load operations
@@ -42,26 +49,82 @@ type LoadRequest struct {
 
 // PushRequest contains parameters for push operations
 type PushRequest struct {
-	Images   []string
-	Registry string
-	Project  string
-	Mode     PushMode
-	Parallel int
-	Timeout  time.Duration
+	Images      []string
+	Entries     []types.ImageEntry // images with per-image overrides, used instead of Images when set
+	Platforms   []string           // push every pulled platform image and combine them into a manifest list
+	Registry    string
+	Project     string
+	Mode        PushMode
+	Template    string    // push target template, see ParseTargetTemplate; overrides Mode
+	Tags        []string  // additional tags pushed with every image
+	TagRules    []TagRule // applied to the tags of every image before the rules of its entry
+	Parallel    int
+	ProxyConfig *runtime.ProxyConfig
+	Retry       runtime.RetryConfig
+	Timeout     time.Duration
+	Force       bool // push images even if the target already holds them
+}
+
+// CopyRequest contains parameters for copy operations. Images are copied
+// from their registry to the push target without local storage.
+type CopyRequest struct {
+	Images      []string
+	Entries     []types.ImageEntry // images with per-image overrides, used instead of Images when set
+	Platforms   []string           // platforms of multi-platform images to copy, all by default
+	Registry    string
+	Project     string
+	Mode        PushMode
+	Template    string    // push target template, see ParseTargetTemplate; overrides Mode
+	Tags        []string  // additional tags copied with every image
+	TagRules    []TagRule // applied to the tags of every image before the rules of its entry
+	Parallel    int
+	ProxyConfig *runtime.ProxyConfig
+	Retry       runtime.RetryConfig
+	Timeout     time.Duration
+	Force       bool // copy images even if the target already holds them
 }
 
 // OperationResult contains the result of an operation
 type OperationResult struct {
+	Action   string            `json:"action"`
 	Success  []string          `json:"success"`
 	Failed   []FailedOperation `json:"failed"`
+	Skipped  []string          `json:"skipped"`
+	Items    []ItemResult      `json:"items"`
 	Duration time.Duration     `json:"duration"`
 	Summary  string            `json:"summary"`
 }
 
+// ItemStatus is the outcome of an operation on a single item
+type ItemStatus string
+
+const (
+	ItemSucceeded ItemStatus = "success"
+	ItemFailed    ItemStatus = "failed"
+	ItemSkipped   ItemStatus = "skipped"
+	ItemCancelled ItemStatus = "cancelled" // not started because the operation was cancelled
+)
+
+// ItemResult contains the outcome of an operation on a single item, in the
+// order the items were requested
+type ItemResult struct {
+	Item     string           `json:"item"`
+	Status   ItemStatus       `json:"status"`
+	Source   string           `json:"source,omitempty"`  // mirror the image was pulled from
+	Target   string           `json:"target,omitempty"`  // pushed reference or written tar file
+	Digest   string           `json:"digest,omitempty"`  // manifest digest of the pulled or pushed image
+	Targets  []string         `json:"targets,omitempty"` // additional references pushed, or platform images pulled or saved
+	Reason   string           `json:"reason,omitempty"`  // why the item was skipped
+	Duration time.Duration    `json:"duration"`
+	Error    string           `json:"error,omitempty"`
+	Code     errors.ErrorCode `json:"code,omitempty"`
+}
+
 // FailedOperation represents a failed operation
 type FailedOperation struct {
-	Item  string `json:"item"`
-	Error string `json:"error"`
+	Item  string           `json:"item"`
+	Error string           `json:"error"`
+	Code  errors.ErrorCode `json:"code,omitempty"`
 }
 
 // SaveMode defines how images are saved
@@ -88,5 +151,5 @@ type PushMode int
 const (
 	PushModeSimple   PushMode = iota + 1 // registry/image:tag
 	PushModeProject                      // registry/project/image:tag
-	PushModePreserve                     // Preserve original project path
-)
\ No newline at end of file
+	PushModePreserve                     // registry/original/path/image:tag
+)
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/harpoon/hpn/internal/logger"
+	"github.com/harpoon/hpn/internal/runtime"
+	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/reference"
+)
+
+// MirrorRule redirects pulls of the images matching Prefix or Pattern to
+// Mirrors, which are tried in order
+type MirrorRule struct {
+	// Prefix is a repository prefix such as registry.k8s.io or
+	// docker.io/library, matched at path component boundaries
+	Prefix string
+
+	// Pattern is matched against the fully qualified reference with its tag,
+	// e.g. registry.k8s.io/pause:3.9
+	Pattern *regexp.Regexp
+
+	// Mirrors replace Prefix, or are expanded with the submatches of Pattern
+	// ($1, ${name}) in place of the matched text
+	Mirrors []string
+}
+
+// NewMirrorRule creates a rule from a prefix or a regular expression.
+// Trailing "/*" of the prefix and mirrors are ignored, so
+// "registry.k8s.io/*" -> "mirror.local/k8s/*" works as written.
+func NewMirrorRule(prefix, pattern string, mirrors []string) (MirrorRule, error) {
+	rule := MirrorRule{Prefix: trimWildcard(prefix)}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return MirrorRule{}, errors.Wrap(err, errors.ErrInvalidConfig, fmt.Sprintf("invalid mirror regex %q", pattern))
+		}
+		rule.Pattern = re
+	}
+	for _, mirror := range mirrors {
+		if rule.Pattern == nil {
+			mirror = trimWildcard(mirror)
+		}
+		rule.Mirrors = append(rule.Mirrors, mirror)
+	}
+	return rule, nil
+}
+
+// trimWildcard removes a trailing "/*", "*" or "/" from a prefix
+func trimWildcard(prefix string) string {
+	return strings.TrimRight(strings.TrimSpace(prefix), "/*")
+}
+
+// rewrite returns the mirror references of ref in order, or nil if the rule
+// does not match
+func (r *MirrorRule) rewrite(ref *reference.Reference) ([]string, error) {
+	canonical := ref.Name()
+	if tag := ref.TagOrDefault(); tag != "" {
+		canonical += ":" + tag
+	}
+	if ref.Digest != "" {
+		canonical += "@" + ref.Digest
+	}
+
+	var images []string
+	switch {
+	case r.Pattern != nil:
+		if !r.Pattern.MatchString(canonical) {
+			return nil, nil
+		}
+		for _, mirror := range r.Mirrors {
+			images = append(images, r.Pattern.ReplaceAllString(canonical, mirror))
+		}
+
+	case r.Prefix != "":
+		name := ref.Name()
+		if name != r.Prefix && !strings.HasPrefix(name, r.Prefix+"/") {
+			return nil, nil
+		}
+		for _, mirror := range r.Mirrors {
+			images = append(images, mirror+strings.TrimPrefix(canonical, r.Prefix))
+		}
+
+	default:
+		return nil, nil
+	}
+
+	for _, image := range images {
+		if _, err := reference.Parse(image); err != nil {
+			return nil, errors.Wrap(err, errors.ErrInvalidConfig, fmt.Sprintf("invalid mirror reference for %s", ref.FamiliarString()))
+		}
+	}
+	return images, nil
+}
+
+// mirrorImages returns the mirror references to pull image from in order,
+// using the first matching rule, or nil if no rule matches
+func mirrorImages(rules []MirrorRule, ref *reference.Reference) ([]string, error) {
+	for i := range rules {
+		images, err := rules[i].rewrite(ref)
+		if err != nil || images != nil {
+			return images, err
+		}
+	}
+	return nil, nil
+}
+
+// pullMirrors pulls an image from the first mirror that has it and tags the
+// pulled image with the original name, so save and push find it under its
+// canonical name. Images pinned by digest are tagged with their tag, or the
+// digest tag if they have none, as findLocalImage expects. It returns the
+// mirror image pulled.
+func pullMirrors(ctx context.Context, rt runtime.ContainerRuntime, ref *reference.Reference, source string, mirrors []string, pull func(image string) error, tagTimeout time.Duration, log logger.Logger, out io.Writer) (string, error) {
+	target := source
+	if ref.Digest != "" {
+		target = mirroredImage(ref)
+	}
+
+	var err error
+	for i, mirror := range mirrors {
+		fmt.Fprintf(out, "  Mirror: %s\n", mirror)
+		if err = pull(mirror); err != nil {
+			if ctx.Err() != nil {
+				return "", err
+			}
+			log.Debug("Pull from mirror failed", logger.F("mirror", mirror), logger.Err(err))
+			if i < len(mirrors)-1 {
+				fmt.Fprintf(out, "  Mirror failed: %v\n", err)
+			}
+			continue
+		}
+
+		if mirror == target {
+			return mirror, nil
+		}
+		tagCtx, cancel := context.WithTimeout(ctx, tagTimeout)
+		err = rt.Tag(tagCtx, mirror, target)
+		cancel()
+		if err != nil {
+			return "", fmt.Errorf("failed to tag image: %w", err)
+		}
+		fmt.Fprintf(out, "  Tagged: %s\n", target)
+		return mirror, nil
+	}
+
+	if len(mirrors) > 1 {
+		return "", fmt.Errorf("all %d mirrors failed, last error: %w", len(mirrors), err)
+	}
+	return "", err
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/harpoon/hpn/pkg/reference"
+)
+
+func TestMirrorImages(t *testing.T) {
+	newRule := func(prefix, pattern string, mirrors ...string) MirrorRule {
+		t.Helper()
+		rule, err := NewMirrorRule(prefix, pattern, mirrors)
+		if err != nil {
+			t.Fatalf("NewMirrorRule(%q, %q) failed: %v", prefix, pattern, err)
+		}
+		return rule
+	}
+	rules := []MirrorRule{
+		newRule("registry.k8s.io/*", "", "mirror.local/k8s/*", "backup.local/k8s"),
+		newRule("docker.io/library", "", "mirror.local/hub"),
+		newRule("", `^gcr\.io/([^/]+)/(.*)$`, "mirror.local/gcr/$1-$2"),
+	}
+
+	tests := []struct {
+		image string
+		want  []string
+	}{
+		{"registry.k8s.io/pause:3.9", []string{"mirror.local/k8s/pause:3.9", "backup.local/k8s/pause:3.9"}},
+		{"registry.k8s.io/coredns/coredns", []string{"mirror.local/k8s/coredns/coredns:latest", "backup.local/k8s/coredns/coredns:latest"}},
+		{"nginx:1.25", []string{"mirror.local/hub/nginx:1.25"}},
+		{"nginx@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", []string{"mirror.local/hub/nginx@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"}},
+		{"gcr.io/distroless/static:nonroot", []string{"mirror.local/gcr/distroless-static:nonroot"}},
+		{"registry.k8s.io.evil.com/pause:3.9", nil},
+		{"calico/node:v3.28.2", nil},
+		{"quay.io/prometheus/node-exporter:v1.8.0", nil},
+	}
+	for _, tt := range tests {
+		ref, err := reference.Parse(tt.image)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tt.image, err)
+		}
+		got, err := mirrorImages(rules, ref)
+		if err != nil {
+			t.Errorf("mirrorImages(%q) failed: %v", tt.image, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("mirrorImages(%q) = %v, want %v", tt.image, got, tt.want)
+		}
+	}
+
+	invalid := []MirrorRule{newRule("", `^(.*)$`, "mirror.local/Hub/$1")}
+	ref, _ := reference.Parse("nginx:1.25")
+	if _, err := mirrorImages(invalid, ref); err == nil {
+		t.Error("mirrorImages with an invalid mirror reference succeeded, want an error")
+	}
+}
+
+func TestPullMirrorPinned(t *testing.T) {
+	const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	rule, err := NewMirrorRule("docker.io/library", "", []string{"mirror.local/hub"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt := newFakeRuntime(map[string]string{})
+	s := NewImageServiceWithRuntime(rt, Options{Output: &strings.Builder{}, Mirrors: []MirrorRule{rule}})
+	images := []string{"nginx:1.25@" + digest, "redis@" + digest}
+
+	result, err := s.Pull(context.Background(), PullRequest{Images: images, Parallel: 1})
+	if err != nil {
+		t.Fatalf("Pull failed: %v", err)
+	}
+	if len(result.Failed) != 0 || result.Items[0].Source != "mirror.local/hub/nginx:1.25@"+digest {
+		t.Fatalf("pull = %+v, want both images pulled from the mirror", result.Items)
+	}
+
+	// Without the pinned digest the images are found under their mirror tag
+	dir := t.TempDir()
+	result, err = s.Save(context.Background(), SaveRequest{Images: images, Mode: SaveModeImagesDir, BaseDir: dir, Parallel: 1})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	for i, want := range []string{"nginx_1.25_sha256-", "redis_sha256-"} {
+		item := result.Items[i]
+		if item.Status != ItemSucceeded || !strings.HasPrefix(filepath.Base(item.Target), want) {
+			t.Errorf("save %s = %s %s (%s), want a %s* tar file", item.Item, item.Status, item.Target, item.Error, want)
+		}
+	}
+
+	result, err = s.Push(context.Background(), PushRequest{Images: images, Registry: "harbor.local", Parallel: 1})
+	if err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if len(result.Success) != 2 {
+		t.Errorf("push = %+v, want both images pushed", result.Items)
+	}
+	for _, call := range []string{"save nginx:1.25", "save redis:sha256-0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", "tag nginx:1.25 harbor.local/nginx:1.25"} {
+		if !slices.Contains(rt.calls, call) {
+			t.Errorf("calls = %v, want %q", rt.calls, call)
+		}
+	}
+}
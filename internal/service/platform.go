@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/harpoon/hpn/internal/runtime"
+	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/reference"
+	"github.com/harpoon/hpn/pkg/types"
+)
+
+// entryPlatforms returns the platforms an entry is processed for one by one.
+// An entry with its own platform is processed for that platform only, like
+// an entry of a single-platform run.
+func entryPlatforms(entry *types.ImageEntry, platforms []string) []string {
+	if entry.Platform != "" {
+		return nil
+	}
+	return platforms
+}
+
+// platformTag returns tag suffixed with platform, e.g. 1.25-linux-arm64.
+// The tag is shortened if the result would exceed the maximum tag length.
+func platformTag(tag, platform string) string {
+	suffix := "-" + strings.ReplaceAll(platform, "/", "-")
+	if len(tag)+len(suffix) > maxTagLength {
+		tag = tag[:maxTagLength-len(suffix)]
+	}
+	return tag + suffix
+}
+
+// platformImage returns the local name of the copy of an image pulled for
+// platform, e.g. nginx:1.25-linux-arm64
+func platformImage(ref *reference.Reference, platform string) string {
+	return ref.FamiliarName() + ":" + platformTag(imageTag(ref), platform)
+}
+
+// pullPlatforms pulls an image for every platform and tags each copy with
+// its platform image name, since pulling the next platform replaces the
+// local image
+func pullPlatforms(ctx context.Context, rt runtime.ContainerRuntime, ref *reference.Reference, source string, platforms []string, options runtime.PullOptions, tagTimeout time.Duration, res *ItemResult, out io.Writer) error {
+	for _, platform := range platforms {
+		fmt.Fprintf(out, "  Platform: %s\n", platform)
+
+		options.Platform = platform
+		if err := rt.Pull(ctx, source, options); err != nil {
+			return err
+		}
+
+		target := platformImage(ref, platform)
+		tagCtx, cancel := context.WithTimeout(ctx, tagTimeout)
+		err := rt.Tag(tagCtx, source, target)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to tag image: %w", err)
+		}
+
+		fmt.Fprintf(out, "  Tagged: %s\n", target)
+		res.Targets = append(res.Targets, target)
+	}
+
+	return nil
+}
+
+// checkManifestLists fails a push of entries for several platforms up front
+// if rt cannot combine the platform images into manifest lists
+func checkManifestLists(rt runtime.ContainerRuntime, entries []types.ImageEntry, platforms []string) error {
+	if _, ok := runtime.As[runtime.ManifestListBuilder](rt); ok {
+		return nil
+	}
+	for i := range entries {
+		if !entries[i].Skips(types.ActionPush) && len(entryPlatforms(&entries[i], platforms)) > 0 {
+			return errors.New(errors.ErrInvalidArgument,
+				fmt.Sprintf("runtime %s cannot create manifest lists, use docker, podman or native to push multiple platforms", rt.Name()))
+		}
+	}
+	return nil
+}
+
+// pushPlatforms pushes the platform images of an image under platform tags
+// of the target repository and combines them into a manifest list at the
+// target and every additional tag
+func pushPlatforms(ctx context.Context, rt runtime.ContainerRuntime, job *pushJob, tagTimeout time.Duration, pushOptions runtime.PushOptions, res *ItemResult, out io.Writer) error {
+	builder, ok := runtime.As[runtime.ManifestListBuilder](rt)
+	if !ok {
+		return errors.New(errors.ErrRuntimeCommand,
+			fmt.Sprintf("runtime %s cannot create manifest lists, use docker, podman or native to push multiple platforms", rt.Name()))
+	}
+
+	res.Target = job.target
+	separator := strings.LastIndexByte(job.target, ':')
+	repository, tag := job.target[:separator], job.target[separator+1:]
+
+	var images []string
+	for _, platform := range job.platforms {
+		target := repository + ":" + platformTag(tag, platform)
+		if err := tagAndPush(ctx, rt, platformImage(job.ref, platform), target, tagTimeout, pushOptions, out); err != nil {
+			return err
+		}
+		images = append(images, target)
+	}
+	res.Targets = append(res.Targets, images...)
+
+	lists := []string{job.target}
+	for _, extra := range job.tags {
+		lists = append(lists, repository+":"+extra)
+	}
+
+	for i, list := range lists {
+		listCtx, cancel := context.WithTimeout(ctx, pushOptions.Timeout)
+		err := builder.PushManifestList(listCtx, list, images, pushOptions)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "  Manifest list: %s (%d platforms)\n", list, len(images))
+		if i > 0 {
+			res.Targets = append(res.Targets, list)
+		}
+	}
+
+	if job.ref.Digest != "" {
+		fmt.Fprintf(out, "  Digest: manifest list rebuilt from platform images (pinned digest not verified)\n")
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/harpoon/hpn/internal/runtime"
+	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/types"
+)
+
+// listRuntime is a fakeRuntime that can push manifest lists
+type listRuntime struct {
+	*fakeRuntime
+	lists map[string][]string // platform images by manifest list
+}
+
+func (l *listRuntime) PushManifestList(ctx context.Context, list string, images []string, options runtime.PushOptions) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.record("manifest %s", list)
+	for _, image := range images {
+		if _, ok := l.registry[image]; !ok {
+			return errors.New(errors.ErrImageNotFound, "platform image not pushed: "+image)
+		}
+	}
+	l.lists[list] = images
+	return nil
+}
+
+var testPlatforms = []string{"linux/amd64", "linux/arm64/v8"}
+
+func TestPullPlatforms(t *testing.T) {
+	rt := newFakeRuntime(map[string]string{})
+	s := NewImageServiceWithRuntime(rt, Options{Output: &strings.Builder{}})
+	result, err := s.Pull(context.Background(), PullRequest{
+		Entries:   []types.ImageEntry{{Image: "nginx:1.25"}, {Image: "redis:7", Platform: "linux/arm64"}},
+		Platforms: testPlatforms,
+		Parallel:  1,
+	})
+	if err != nil {
+		t.Fatalf("Pull failed: %v", err)
+	}
+
+	want := []string{"nginx:1.25-linux-amd64", "nginx:1.25-linux-arm64-v8"}
+	if got := result.Items[0].Targets; !reflect.DeepEqual(got, want) {
+		t.Errorf("platform targets = %v, want %v", got, want)
+	}
+	for i, image := range want {
+		if digest := rt.images[image]; digest != "sha256:nginx:1.25"+testPlatforms[i] {
+			t.Errorf("%s = %q, want the image pulled for %s", image, digest, testPlatforms[i])
+		}
+	}
+
+	// An entry with its own platform is pulled once, for that platform
+	if !slices.Contains(rt.calls, "pull redis:7 linux/arm64") || slices.Contains(rt.calls, "pull redis:7 linux/amd64") {
+		t.Errorf("calls = %v, want a single redis:7 pull for linux/arm64", rt.calls)
+	}
+	if targets := result.Items[1].Targets; len(targets) != 0 {
+		t.Errorf("entry with its own platform has targets %v, want none", targets)
+	}
+}
+
+func TestSavePlatforms(t *testing.T) {
+	rt := newFakeRuntime(map[string]string{
+		"nginx:1.25-linux-amd64":    "sha256:amd64",
+		"nginx:1.25-linux-arm64-v8": "sha256:arm64",
+	})
+	dir := t.TempDir()
+	s := NewImageServiceWithRuntime(rt, Options{Output: &strings.Builder{}})
+	result, err := s.Save(context.Background(), SaveRequest{
+		Images:    []string{"nginx:1.25"},
+		Platforms: testPlatforms,
+		Mode:      SaveModeImagesDir,
+		Parallel:  1,
+		BaseDir:   dir,
+	})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	item := result.Items[0]
+	want := []string{filepath.Join(dir, "nginx_1.25-linux-amd64.tar"), filepath.Join(dir, "nginx_1.25-linux-arm64-v8.tar")}
+	if item.Status != ItemSucceeded || !reflect.DeepEqual(item.Targets, want) {
+		t.Errorf("save = %s %v (%s), want %s %v", item.Status, item.Targets, item.Error, ItemSucceeded, want)
+	}
+}
+
+func TestPushPlatforms(t *testing.T) {
+	rt := &listRuntime{
+		fakeRuntime: newFakeRuntime(map[string]string{
+			"nginx:1.25-linux-amd64":    "sha256:amd64",
+			"nginx:1.25-linux-arm64-v8": "sha256:arm64",
+		}),
+		lists: map[string][]string{},
+	}
+	s := NewImageServiceWithRuntime(rt, Options{Output: &strings.Builder{}})
+	result, err := s.Push(context.Background(), PushRequest{
+		Entries:   []types.ImageEntry{{Image: "nginx:1.25", Tags: []string{"stable"}}},
+		Platforms: testPlatforms,
+		Registry:  "harbor.local",
+		Project:   "edge",
+		Mode:      PushModeProject,
+		Parallel:  1,
+	})
+	if err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+
+	item := result.Items[0]
+	if item.Status != ItemSucceeded {
+		t.Fatalf("push = %s (%s), want %s", item.Status, item.Error, ItemSucceeded)
+	}
+	images := []string{"harbor.local/edge/nginx:1.25-linux-amd64", "harbor.local/edge/nginx:1.25-linux-arm64-v8"}
+	if item.Target != "harbor.local/edge/nginx:1.25" {
+		t.Errorf("target = %s, want harbor.local/edge/nginx:1.25", item.Target)
+	}
+	if want := append(append([]string(nil), images...), "harbor.local/edge/nginx:stable"); !reflect.DeepEqual(item.Targets, want) {
+		t.Errorf("targets = %v, want %v", item.Targets, want)
+	}
+	wantLists := map[string][]string{
+		"harbor.local/edge/nginx:1.25":   images,
+		"harbor.local/edge/nginx:stable": images,
+	}
+	if !reflect.DeepEqual(rt.lists, wantLists) {
+		t.Errorf("manifest lists = %v, want %v", rt.lists, wantLists)
+	}
+}
+
+func TestPushPlatformsWithoutManifestLists(t *testing.T) {
+	rt := newFakeRuntime(map[string]string{"nginx:1.25-linux-amd64": "sha256:amd64"})
+	rt.name = "nerdctl"
+	s := NewImageServiceWithRuntime(rt, Options{Output: &strings.Builder{}})
+	req := PushRequest{
+		Entries:   []types.ImageEntry{{Image: "redis:7", Platform: "linux/arm64"}, {Image: "nginx:1.25"}},
+		Platforms: testPlatforms,
+		Registry:  "harbor.local",
+		Parallel:  1,
+	}
+
+	_, err := s.Push(context.Background(), req)
+	if errors.GetCode(err) != errors.ErrInvalidArgument || !strings.Contains(err.Error(), "runtime nerdctl cannot create manifest lists") {
+		t.Errorf("multi-platform push on nerdctl = %v, want INVALID_ARGUMENT", err)
+	}
+	if len(rt.calls) != 0 {
+		t.Errorf("rejected push ran %v", rt.calls)
+	}
+
+	// Entries with their own platform or skipping push need no manifest lists
+	req.Entries[1].Skip = []string{types.ActionPush}
+	if _, err := s.Push(context.Background(), req); err != nil {
+		t.Errorf("single-platform push on nerdctl failed: %v", err)
+	}
+}
+
+func TestPlatformTag(t *testing.T) {
+	tests := []struct {
+		tag, platform, want string
+	}{
+		{"1.25", "linux/amd64", "1.25-linux-amd64"},
+		{"latest", "linux/arm/v7", "latest-linux-arm-v7"},
+		{strings.Repeat("t", 128), "linux/arm64", strings.Repeat("t", 116) + "-linux-arm64"},
+	}
+	for _, tt := range tests {
+		if got := platformTag(tt.tag, tt.platform); got != tt.want {
+			t.Errorf("platformTag(%q, %q) = %q, want %q", tt.tag, tt.platform, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// limiter decides how many jobs of the worker pool may run at once
+type limiter interface {
+	// Max returns the upper bound of concurrently running jobs
+	Max() int
+
+	// Limit returns the number of jobs currently allowed to run
+	Limit() int
+
+	// Done records the outcome of a finished job
+	Done(err error)
+}
+
+// fixedLimiter always allows the same number of jobs
+type fixedLimiter int
+
+func (f fixedLimiter) Max() int   { return int(f) }
+func (f fixedLimiter) Limit() int { return int(f) }
+func (f fixedLimiter) Done(error) {}
+
+// runOrdered runs n jobs concurrently as allowed by lim. Each job writes its
+// progress into a private buffer which is flushed to out in job order once
+// all earlier jobs have finished, so output of concurrent jobs never interleaves.
+// Once ctx is done no further jobs are started; runOrdered waits for the
+// running ones and returns the number of jobs started, which always are the
+// first ones.
+func runOrdered(ctx context.Context, n int, lim limiter, out io.Writer, job func(i int, out io.Writer) error) int {
+	workers := lim.Max()
+	if workers > n {
+		workers = n
+	}
+
+	// Serial execution streams progress directly
+	if workers <= 1 {
+		started := 0
+		for ; started < n && ctx.Err() == nil; started++ {
+			lim.Done(job(started, out))
+		}
+		return started
+	}
+
+	var (
+		mu      sync.Mutex
+		slots   = sync.NewCond(&mu)
+		wg      sync.WaitGroup
+		active  int
+		next    int
+		buffers = make([]*bytes.Buffer, n)
+		jobs    = make(chan int)
+	)
+
+	// Wake the dispatcher when the context is done while it waits for a slot
+	stop := context.AfterFunc(ctx, func() {
+		mu.Lock()
+		slots.Broadcast()
+		mu.Unlock()
+	})
+	defer stop()
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				buf := &bytes.Buffer{}
+				err := job(i, buf)
+
+				mu.Lock()
+				active--
+				lim.Done(err)
+				buffers[i] = buf
+				for next < n && buffers[next] != nil {
+					out.Write(buffers[next].Bytes())
+					buffers[next].Reset()
+					next++
+				}
+				slots.Broadcast()
+				mu.Unlock()
+			}
+		}()
+	}
+
+	started := 0
+	for ; started < n; started++ {
+		// Wait until the limiter allows another job to start
+		mu.Lock()
+		for active >= lim.Limit() && ctx.Err() == nil {
+			slots.Wait()
+		}
+		if ctx.Err() != nil {
+			mu.Unlock()
+			break
+		}
+		active++
+		mu.Unlock()
+
+		jobs <- started
+	}
+	close(jobs)
+	wg.Wait()
+	return started
+}
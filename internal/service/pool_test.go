@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/harpoon/hpn/internal/runtime"
+)
+
+// countingLimiter allows limit of max jobs and counts the finished ones
+type countingLimiter struct {
+	max, limit int
+	mu         sync.Mutex
+	done       int
+}
+
+func (c *countingLimiter) Max() int   { return c.max }
+func (c *countingLimiter) Limit() int { return c.limit }
+func (c *countingLimiter) Done(error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.done++
+}
+
+func TestRunOrdered(t *testing.T) {
+	tests := []struct {
+		name       string
+		jobs       int
+		max, limit int
+	}{
+		{"serial", 5, 1, 1},
+		{"parallel", 12, 4, 4},
+		{"limit below max", 12, 4, 2},
+		{"more workers than jobs", 3, 8, 8},
+	}
+	for _, tt := range tests {
+		var (
+			mu        sync.Mutex
+			active    int
+			maxActive int
+			out       strings.Builder
+		)
+		lim := &countingLimiter{max: tt.max, limit: tt.limit}
+		started := runOrdered(context.Background(), tt.jobs, lim, &out, func(i int, w io.Writer) error {
+			mu.Lock()
+			active++
+			if active > maxActive {
+				maxActive = active
+			}
+			mu.Unlock()
+
+			// Later jobs finish first
+			fmt.Fprintf(w, "start %d\n", i)
+			time.Sleep(time.Duration(tt.jobs-i) * time.Millisecond)
+			fmt.Fprintf(w, "end %d\n", i)
+
+			mu.Lock()
+			active--
+			mu.Unlock()
+			if i%3 == 0 {
+				return fmt.Errorf("job %d failed", i)
+			}
+			return nil
+		})
+
+		var want strings.Builder
+		for i := 0; i < tt.jobs; i++ {
+			fmt.Fprintf(&want, "start %d\nend %d\n", i, i)
+		}
+		if out.String() != want.String() {
+			t.Errorf("%s: output out of order:\n%s", tt.name, out.String())
+		}
+		if maxActive > tt.limit {
+			t.Errorf("%s: %d jobs ran at once, want at most %d", tt.name, maxActive, tt.limit)
+		}
+		if tt.limit > 1 && tt.jobs > 1 && maxActive < 2 {
+			t.Errorf("%s: jobs ran serially, want up to %d at once", tt.name, tt.limit)
+		}
+		if lim.done != tt.jobs || started != tt.jobs {
+			t.Errorf("%s: started %d jobs and limiter saw %d finished, want %d", tt.name, started, lim.done, tt.jobs)
+		}
+	}
+}
+
+func TestRunOrderedCanceled(t *testing.T) {
+	tests := []struct {
+		name       string
+		max, limit int
+	}{
+		{"serial", 1, 1},
+		{"parallel", 4, 4},
+		{"limit below max", 4, 2},
+	}
+	for _, tt := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		var (
+			mu  sync.Mutex
+			ran []int
+			out strings.Builder
+		)
+		lim := &countingLimiter{max: tt.max, limit: tt.limit}
+		started := runOrdered(ctx, 20, lim, &out, func(i int, w io.Writer) error {
+			mu.Lock()
+			ran = append(ran, i)
+			mu.Unlock()
+
+			// The last job allowed to run at once cancels, the others
+			// finish only afterwards
+			if i == tt.limit-1 {
+				cancel()
+			}
+			<-ctx.Done()
+			fmt.Fprintf(w, "job %d\n", i)
+			return nil
+		})
+
+		// Jobs already running finish, no new ones are started
+		if started != tt.limit {
+			t.Errorf("%s: %d jobs started, want the %d running when canceled", tt.name, started, tt.limit)
+		}
+		if len(ran) != started || lim.done != started {
+			t.Errorf("%s: %d jobs ran and %d finished, want the %d started", tt.name, len(ran), lim.done, started)
+		}
+		var want strings.Builder
+		for i := 0; i < started; i++ {
+			fmt.Fprintf(&want, "job %d\n", i)
+		}
+		if out.String() != want.String() {
+			t.Errorf("%s: output =\n%s\nwant\n%s", tt.name, out.String(), want.String())
+		}
+	}
+
+	// Nothing starts with a context that is already done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	started := runOrdered(ctx, 5, fixedLimiter(2), io.Discard, func(i int, w io.Writer) error {
+		t.Errorf("job %d started after cancel", i)
+		return nil
+	})
+	if started != 0 {
+		t.Errorf("runOrdered with a canceled context started %d jobs, want 0", started)
+	}
+}
+
+func TestParallelResultOrder(t *testing.T) {
+	rt := newFakeRuntime(map[string]string{})
+	var images, want []string
+	for i := 0; i < 20; i++ {
+		image := fmt.Sprintf("app-%d:1", i)
+		images = append(images, image)
+		if i%5 == 0 {
+			rt.failures[image] = fmt.Errorf("pull %d failed", i)
+		} else {
+			want = append(want, image)
+		}
+	}
+
+	var out strings.Builder
+	s := NewImageServiceWithRuntime(rt, Options{Output: &out})
+	result, err := s.Pull(context.Background(), PullRequest{Images: images, Parallel: 4})
+	if err != nil {
+		t.Fatalf("Pull failed: %v", err)
+	}
+	if !reflect.DeepEqual(result.Success, want) || len(result.Failed) != 4 || result.Failed[1].Item != "app-5:1" {
+		t.Errorf("result = %v succeeded, %+v failed, want items in request order", result.Success, result.Failed)
+	}
+
+	// The progress of every image is written in one piece and in order
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 2*len(images) {
+		t.Fatalf("output has %d lines, want %d:\n%s", len(lines), 2*len(images), out.String())
+	}
+	for i, image := range images {
+		if lines[2*i] != fmt.Sprintf("[%d/20] Pulling %s...", i+1, image) || !strings.Contains(lines[2*i+1], " "+image) {
+			t.Errorf("output of %s = %q, %q", image, lines[2*i], lines[2*i+1])
+		}
+	}
+}
+
+// cancelingRuntime cancels the operation once it pulled an image
+type cancelingRuntime struct {
+	*fakeRuntime
+	after  string
+	cancel context.CancelFunc
+}
+
+func (c *cancelingRuntime) Pull(ctx context.Context, image string, options runtime.PullOptions) error {
+	err := c.fakeRuntime.Pull(ctx, image, options)
+	if image == c.after {
+		c.cancel()
+	}
+	return err
+}
+
+func TestPullCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rt := &cancelingRuntime{fakeRuntime: newFakeRuntime(map[string]string{}), after: "redis:7", cancel: cancel}
+
+	var out strings.Builder
+	s := NewImageServiceWithRuntime(rt, Options{Output: &out})
+	result, err := s.Pull(ctx, PullRequest{Images: []string{"nginx:1.25", "redis:7", "alpine:3.19", "busybox:1.36"}})
+	if err != nil {
+		t.Fatalf("Pull failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(result.Success, []string{"nginx:1.25", "redis:7"}) || len(result.Failed) != 2 {
+		t.Errorf("result = %v succeeded, %+v failed, want the last two images cancelled", result.Success, result.Failed)
+	}
+	for _, item := range result.Items[2:] {
+		if item.Status != ItemCancelled || item.Error != context.Canceled.Error() {
+			t.Errorf("item %s = %s (%s), want cancelled", item.Item, item.Status, item.Error)
+		}
+	}
+	if want := "2 successful, 2 failed (2 cancelled)"; result.Summary != want {
+		t.Errorf("summary = %q, want %q", result.Summary, want)
+	}
+	if !strings.HasSuffix(out.String(), "⏹️  Cancelled alpine:3.19: context canceled\n⏹️  Cancelled busybox:1.36: context canceled\n") {
+		t.Errorf("output does not report the cancelled images:\n%s", out.String())
+	}
+	if len(rt.calls) != 2 {
+		t.Errorf("runtime calls = %q, want only the first two pulls", rt.calls)
+	}
+}
@@ -0,0 +1,942 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/harpoon/hpn/internal/logger"
+	"github.com/harpoon/hpn/internal/runtime"
+	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/reference"
+	"github.com/harpoon/hpn/pkg/types"
+)
+
+// Default timeouts used when Options.Timeouts leaves an operation unset
+const (
+	defaultPullTimeout = types.DefaultTimeout
+	defaultPushTimeout = types.DefaultTransferTimeout
+	defaultSaveTimeout = types.DefaultTransferTimeout
+	defaultLoadTimeout = types.DefaultTransferTimeout
+	defaultTagTimeout  = types.DefaultTimeout
+)
+
+// maxTagLength is the maximum length of an image tag
+const maxTagLength = 128
+
+// Timeouts contains per-operation timeouts. Each timeout bounds a single
+// attempt of the operation, retries get a fresh timeout.
+type Timeouts struct {
+	Pull time.Duration
+	Push time.Duration
+	Save time.Duration
+	Load time.Duration
+	Tag  time.Duration
+}
+
+// withDefaults returns t with unset timeouts replaced by the defaults
+func (t Timeouts) withDefaults() Timeouts {
+	if t.Pull <= 0 {
+		t.Pull = defaultPullTimeout
+	}
+	if t.Push <= 0 {
+		t.Push = defaultPushTimeout
+	}
+	if t.Save <= 0 {
+		t.Save = defaultSaveTimeout
+	}
+	if t.Load <= 0 {
+		t.Load = defaultLoadTimeout
+	}
+	if t.Tag <= 0 {
+		t.Tag = defaultTagTimeout
+	}
+	return t
+}
+
+// Options configures a Service
+type Options struct {
+	// Detector is used to discover container runtimes
+	Detector runtime.RuntimeDetector
+
+	// Runtime is an explicitly requested runtime name (e.g. from --runtime)
+	Runtime string
+
+	// Preferred is the runtime configured as preferred
+	Preferred string
+
+	// AutoFallback selects another runtime when the preferred one is unavailable
+	AutoFallback bool
+
+	// Confirm is asked whether to fall back to another runtime when the
+	// preferred one is unavailable and AutoFallback is disabled
+	Confirm func(configured, fallback string) bool
+
+	// Retry is the retry policy applied to runtime operations
+	Retry runtime.RetryConfig
+
+	// Timeouts are the default per-operation timeouts
+	Timeouts Timeouts
+
+	// Mirrors redirect pulls of matching images to mirror registries
+	Mirrors []MirrorRule
+
+	// Parallel is the default number of workers used when a request does not set one
+	Parallel int
+
+	// AutoAdjust adapts the number of workers up to Parallel based on observed
+	// throughput and errors when a request does not set an explicit worker count
+	AutoAdjust bool
+
+	// Output receives progress messages, defaults to os.Stdout
+	Output io.Writer
+
+	// Logger receives diagnostic messages, defaults to a no-op logger
+	Logger logger.Logger
+}
+
+// Service implements ImageService on top of a container runtime
+type Service struct {
+	opts     Options
+	out      io.Writer
+	log      logger.Logger
+	timeouts Timeouts
+	runtime  runtime.ContainerRuntime
+}
+
+var _ ImageService = (*Service)(nil)
+
+// NewImageService creates a new image service
+func NewImageService(opts Options) *Service {
+	out := opts.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	log := opts.Logger
+	if log == nil {
+		log = logger.Nop()
+	}
+	return &Service{
+		opts:     opts,
+		out:      out,
+		log:      log,
+		timeouts: opts.Timeouts.withDefaults(),
+	}
+}
+
+// NewImageServiceWithRuntime creates an image service bound to the given runtime
+func NewImageServiceWithRuntime(rt runtime.ContainerRuntime, opts Options) *Service {
+	s := NewImageService(opts)
+	s.runtime = s.wrapRuntime(rt)
+	return s
+}
+
+// Runtime returns the container runtime used by the service, selecting it on first use
+func (s *Service) Runtime() (runtime.ContainerRuntime, error) {
+	if s.runtime != nil {
+		return s.runtime, nil
+	}
+
+	selected, err := s.selectRuntime()
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Debug("Selected container runtime", logger.F("runtime", selected.Name()))
+	s.runtime = s.wrapRuntime(selected)
+	return s.runtime, nil
+}
+
+// wrapRuntime applies the retry policy and save/load timeouts to rt
+func (s *Service) wrapRuntime(rt runtime.ContainerRuntime) runtime.ContainerRuntime {
+	if _, ok := rt.(*runtime.RetryRuntime); ok {
+		return rt
+	}
+
+	wrapped := runtime.NewRetryRuntime(rt, s.opts.Retry)
+	wrapped.SetTimeouts(s.timeouts.Save, s.timeouts.Load)
+	return wrapped
+}
+
+// selectRuntime selects the appropriate container runtime
+func (s *Service) selectRuntime() (runtime.ContainerRuntime, error) {
+	if s.opts.Detector == nil {
+		return nil, errors.New(errors.ErrRuntimeNotFound, "no runtime detector configured")
+	}
+
+	// If runtime is explicitly specified
+	if s.opts.Runtime != "" {
+		selected, err := s.opts.Detector.GetByName(s.opts.Runtime)
+		if err != nil {
+			return nil, fmt.Errorf("specified runtime '%s' is not available: %w", s.opts.Runtime, err)
+		}
+		return selected, nil
+	}
+
+	// No specific runtime configured, use the preferred one
+	if s.opts.Preferred == "" {
+		preferred := s.opts.Detector.GetPreferred()
+		if preferred == nil {
+			return nil, errors.New(errors.ErrRuntimeNotFound, "no container runtime found. Please install docker, podman, or nerdctl")
+		}
+		return preferred, nil
+	}
+
+	configured, err := s.opts.Detector.GetByName(s.opts.Preferred)
+	if err == nil {
+		return configured, nil
+	}
+
+	// Configured runtime is not available, check for alternatives
+	available := s.opts.Detector.DetectAvailable()
+	if len(available) == 0 {
+		return nil, errors.New(errors.ErrRuntimeNotFound, "no container runtime found. Please install docker, podman, or nerdctl")
+	}
+
+	fallback := available[0]
+	if s.opts.AutoFallback {
+		s.log.Warn(fmt.Sprintf("Runtime '%s' unavailable, using '%s'", s.opts.Preferred, fallback.Name()))
+		return fallback, nil
+	}
+
+	if s.opts.Confirm != nil && s.opts.Confirm(s.opts.Preferred, fallback.Name()) {
+		s.log.Info(fmt.Sprintf("Using '%s' runtime", fallback.Name()))
+		return fallback, nil
+	}
+
+	return nil, errors.New(errors.ErrRuntimeUnavailable,
+		fmt.Sprintf("user declined runtime fallback. Please install '%s' or update config", s.opts.Preferred))
+}
+
+// operation describes the wording used when reporting progress for an action
+type operation struct {
+	name        string // pull
+	progressive string // Pulling
+	past        string // pulled
+}
+
+var (
+	opPull = operation{"pull", "Pulling", "pulled"}
+	opSave = operation{"save", "Saving", "saved"}
+	opLoad = operation{"load", "Loading", "loaded"}
+	opPush = operation{"push", "Pushing", "pushed"}
+	opCopy = operation{"copy", "Copying", "copied"}
+)
+
+// itemFunc performs an operation on the i-th item, writing progress to out.
+// It records the target and digest of the item in res and returns a *skipped
+// error for items that are not processed.
+type itemFunc func(ctx context.Context, rt runtime.ContainerRuntime, i int, res *ItemResult, out io.Writer) error
+
+// reasonUpToDate is the skip reason of images the target already holds
+const reasonUpToDate = "up to date"
+
+// skipped is returned by an itemFunc for an item that was not processed
+type skipped struct {
+	reason string
+}
+
+// Error returns the skip reason
+func (s *skipped) Error() string {
+	return "skipped (" + s.reason + ")"
+}
+
+// run executes fn for every item on a bounded worker pool and aggregates the outcome
+func (s *Service) run(ctx context.Context, op operation, items []string, parallel int, fn itemFunc) (*OperationResult, error) {
+	rt, err := s.Runtime()
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	errs := make([]error, len(items))
+	itemResults := make([]ItemResult, len(items))
+	lim := s.limiter(parallel)
+
+	s.log.Debug("Starting operation",
+		logger.F("operation", op.name),
+		logger.F("items", len(items)),
+		logger.F("max_workers", lim.Max()))
+
+	started := runOrdered(ctx, len(items), lim, s.out, func(i int, out io.Writer) error {
+		item := items[i]
+		log := s.log.WithFields(logger.F("operation", op.name), logger.F("item", item))
+		fmt.Fprintf(out, "[%d/%d] %s %s...\n", i+1, len(items), op.progressive, item)
+
+		ctx := runtime.WithRetryObserver(ctx, func(attempt, maxAttempts int, delay time.Duration, err error) {
+			fmt.Fprintf(out, "  Attempt %d/%d failed: %v (retrying in %s)\n", attempt, maxAttempts, err, delay.Round(time.Millisecond))
+			log.Warn("Retrying operation", logger.F("attempt", attempt), logger.F("delay", delay), logger.Err(err))
+		})
+
+		itemStart := time.Now()
+		itemResults[i] = ItemResult{Item: item, Status: ItemSucceeded}
+		err := fn(ctx, rt, i, &itemResults[i], out)
+		itemResults[i].Duration = time.Since(itemStart)
+		if skip, ok := err.(*skipped); ok {
+			fmt.Fprintf(out, "⏭️  Skipped %s: %s\n", item, skip.reason)
+			log.Debug("Operation skipped", logger.F("reason", skip.reason))
+			itemResults[i].Status = ItemSkipped
+			itemResults[i].Reason = skip.reason
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintf(out, "❌ Failed to %s %s: %v\n", op.name, item, err)
+			log.Error("Operation failed", logger.F("code", errors.GetCode(err).String()), logger.Err(err))
+			itemResults[i].Status = ItemFailed
+			itemResults[i].Error = err.Error()
+			itemResults[i].Code = errors.GetCode(err)
+			errs[i] = err
+			return err
+		}
+
+		fmt.Fprintf(out, "✅ Successfully %s %s\n", op.past, item)
+		log.Debug("Operation succeeded", logger.F("duration", itemResults[i].Duration))
+		return nil
+	})
+
+	// Items not started before the context was done are reported as cancelled
+	if started < len(items) {
+		s.log.Warn("Operation cancelled",
+			logger.F("operation", op.name),
+			logger.F("remaining", len(items)-started),
+			logger.Err(ctx.Err()))
+	}
+	for i := started; i < len(items); i++ {
+		fmt.Fprintf(s.out, "⏹️  Cancelled %s: %v\n", items[i], ctx.Err())
+		itemResults[i] = ItemResult{Item: items[i], Status: ItemCancelled, Error: ctx.Err().Error()}
+		errs[i] = ctx.Err()
+	}
+
+	result := &OperationResult{
+		Action:  op.name,
+		Success: []string{},
+		Failed:  []FailedOperation{},
+		Skipped: []string{},
+		Items:   itemResults,
+	}
+	for i, item := range items {
+		if itemResults[i].Status == ItemSkipped {
+			result.Skipped = append(result.Skipped, item)
+		} else if errs[i] != nil {
+			result.Failed = append(result.Failed, FailedOperation{
+				Item:  item,
+				Error: errs[i].Error(),
+				Code:  errors.GetCode(errs[i]),
+			})
+		} else {
+			result.Success = append(result.Success, item)
+		}
+	}
+
+	result.Duration = time.Since(start)
+	result.Summary = fmt.Sprintf("%d successful, %d failed", len(result.Success), len(result.Failed))
+	if cancelled := len(items) - started; cancelled > 0 {
+		result.Summary += fmt.Sprintf(" (%d cancelled)", cancelled)
+	}
+	if len(result.Skipped) > 0 {
+		result.Summary += fmt.Sprintf(", %d skipped", len(result.Skipped))
+	}
+	return result, nil
+}
+
+// limiter returns the concurrency limiter for a request. An explicit worker
+// count is used as-is, otherwise the service default applies and is adjusted
+// at runtime when AutoAdjust is enabled.
+func (s *Service) limiter(parallel int) limiter {
+	if parallel > 0 {
+		return fixedLimiter(parallel)
+	}
+
+	workers := s.opts.Parallel
+	if workers < 1 {
+		workers = 1
+	}
+
+	if s.opts.AutoAdjust && workers > 1 {
+		return newAdaptiveLimiter(workers, s.log)
+	}
+	return fixedLimiter(workers)
+}
+
+// Pull pulls every image in the request
+func (s *Service) Pull(ctx context.Context, req PullRequest) (*OperationResult, error) {
+	timeout := req.Timeout
+	if timeout <= 0 {
+		timeout = s.timeouts.Pull
+	}
+
+	entries := imageEntries(req.Images, req.Entries)
+	return s.run(ctx, opPull, entryImages(entries), req.Parallel, func(ctx context.Context, rt runtime.ContainerRuntime, i int, res *ItemResult, out io.Writer) error {
+		entry := entries[i]
+		if entry.Skips(types.ActionPull) {
+			return &skipped{reason: "skip: pull"}
+		}
+
+		ref, err := reference.Parse(entry.Image)
+		if err != nil {
+			return err
+		}
+
+		// The timeout applies to every attempt of the pull
+		options := runtime.PullOptions{
+			Proxy:    req.ProxyConfig,
+			Retry:    req.Retry,
+			Timeout:  timeout,
+			Platform: entry.Platform,
+		}
+		source := localImage(entry.Image, ref)
+		platforms := entryPlatforms(&entry, req.Platforms)
+		if len(platforms) == 0 && entry.Platform != "" {
+			fmt.Fprintf(out, "  Platform: %s\n", entry.Platform)
+		}
+		pull := func(image string) error {
+			if len(platforms) > 0 {
+				res.Targets = nil
+				return pullPlatforms(ctx, rt, ref, image, platforms, options, s.timeouts.Tag, res, out)
+			}
+			return rt.Pull(ctx, image, options)
+		}
+
+		mirrors, err := mirrorImages(s.opts.Mirrors, ref)
+		if err != nil {
+			return err
+		}
+		pulled := entry.Image
+		if len(mirrors) > 0 {
+			if pulled, err = pullMirrors(ctx, rt, ref, source, mirrors, pull, s.timeouts.Tag, s.log, out); err != nil {
+				return err
+			}
+			res.Source = pulled
+		} else if err := pull(source); err != nil {
+			return err
+		}
+
+		// Mirrored images keep the digest of the mirror repository
+		if info, err := s.Inspect(ctx, pulled); err != nil {
+			s.log.Debug("Failed to determine image digest", logger.F("image", pulled), logger.Err(err))
+		} else if info.Digest != "" {
+			res.Digest = info.Digest
+			fmt.Fprintf(out, "  Digest: %s\n", info.Digest)
+		}
+		return nil
+	})
+}
+
+// Save saves every image in the request to a tar file
+func (s *Service) Save(ctx context.Context, req SaveRequest) (*OperationResult, error) {
+	baseDir := req.BaseDir
+	if baseDir == "" {
+		baseDir = SaveDir(req.Mode)
+	}
+
+	if req.Mode == SaveModeImagesDir || req.Mode == SaveModeProjectDir {
+		if err := os.MkdirAll(baseDir, 0755); err != nil {
+			return nil, errors.Wrap(err, errors.ErrFileOperation, "failed to create images directory")
+		}
+	}
+
+	entries := imageEntries(req.Images, req.Entries)
+	return s.run(ctx, opSave, entryImages(entries), req.Parallel, func(ctx context.Context, rt runtime.ContainerRuntime, i int, res *ItemResult, out io.Writer) error {
+		if entries[i].Skips(types.ActionSave) {
+			return &skipped{reason: "skip: save"}
+		}
+
+		// Every platform image is saved to its own tar file
+		if platforms := entryPlatforms(&entries[i], req.Platforms); len(platforms) > 0 {
+			ref, err := reference.Parse(entries[i].Image)
+			if err != nil {
+				return err
+			}
+			for _, platform := range platforms {
+				tarPath, err := saveImage(ctx, rt, platformImage(ref, platform), baseDir, req.Mode, s.timeouts.Tag, out)
+				if err != nil {
+					return err
+				}
+				res.Targets = append(res.Targets, tarPath)
+			}
+			return nil
+		}
+
+		tarPath, err := saveImage(ctx, rt, entries[i].Image, baseDir, req.Mode, s.timeouts.Tag, out)
+		res.Target = tarPath
+		return err
+	})
+}
+
+// Load loads every tar file found according to the request mode
+func (s *Service) Load(ctx context.Context, req LoadRequest) (*OperationResult, error) {
+	baseDir := req.BaseDir
+	if baseDir == "" {
+		baseDir = LoadDir(req.Mode)
+	}
+
+	tarFiles, err := findTarFiles(baseDir, req.Pattern, req.Mode == LoadModeRecursive)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrFileOperation, fmt.Sprintf("failed to find tar files in %s", baseDir))
+	}
+
+	s.log.Info(fmt.Sprintf("Found %d tar files to load", len(tarFiles)), logger.F("dir", baseDir))
+
+	return s.run(ctx, opLoad, tarFiles, req.Parallel, func(ctx context.Context, rt runtime.ContainerRuntime, i int, res *ItemResult, out io.Writer) error {
+		return loadImage(ctx, rt, tarFiles[i])
+	})
+}
+
+// Inspect returns the components of an image and the digest of its local copy
+// as reported by the runtime. Digest is empty if the runtime cannot report it
+// and the reference is not pinned.
+func (s *Service) Inspect(ctx context.Context, image string) (*types.Image, error) {
+	info, err := types.ParseImage(image)
+	if err != nil {
+		return nil, err
+	}
+	if info.Digest != "" {
+		return info, nil
+	}
+
+	rt, err := s.Runtime()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeouts.Tag)
+	defer cancel()
+
+	info.Digest, err = runtime.ImageDigest(ctx, rt, image)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Push tags and pushes every image in the request to the target registry
+func (s *Service) Push(ctx context.Context, req PushRequest) (*OperationResult, error) {
+	// The timeout applies to every attempt of the push
+	pushOptions := runtime.PushOptions{
+		Proxy:   req.ProxyConfig,
+		Retry:   req.Retry,
+		Timeout: req.Timeout,
+	}
+	if pushOptions.Timeout <= 0 {
+		pushOptions.Timeout = s.timeouts.Push
+	}
+
+	targets, err := ParseTargetTemplate(req.Template, req.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	// Date stamps of tag rules are the same for every image
+	now := time.Now()
+
+	entries := imageEntries(req.Images, req.Entries)
+	if len(req.Platforms) > 0 {
+		rt, err := s.Runtime()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkManifestLists(rt, entries, req.Platforms); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.run(ctx, opPush, entryImages(entries), req.Parallel, func(ctx context.Context, rt runtime.ContainerRuntime, i int, res *ItemResult, out io.Writer) error {
+		entry := entries[i]
+		if entry.Skips(types.ActionPush) {
+			return &skipped{reason: "skip: push"}
+		}
+
+		ref, err := reference.Parse(entry.Image)
+		if err != nil {
+			return err
+		}
+
+		target, err := targets.Target(ref, &entry, req.Registry, req.Project)
+		if err != nil {
+			return err
+		}
+
+		rules, err := entryTagRules(req.TagRules, &entry)
+		if err != nil {
+			return err
+		}
+
+		job := &pushJob{
+			image:     entry.Image,
+			ref:       ref,
+			target:    target,
+			tags:      append(append([]string(nil), entry.Tags...), req.Tags...),
+			platforms: entryPlatforms(&entry, req.Platforms),
+			force:     req.Force,
+		}
+		if err := retag(job, rules, now); err != nil {
+			return err
+		}
+		return pushImage(ctx, rt, job, s.timeouts.Tag, pushOptions, res, out)
+	})
+}
+
+// imageEntries returns the entries of a request, converting plain images to
+// entries without overrides
+func imageEntries(images []string, entries []types.ImageEntry) []types.ImageEntry {
+	if len(entries) > 0 {
+		return entries
+	}
+
+	converted := make([]types.ImageEntry, len(images))
+	for i, image := range images {
+		converted[i] = types.ImageEntry{Image: image}
+	}
+	return converted
+}
+
+// entryImages returns the image references of entries
+func entryImages(entries []types.ImageEntry) []string {
+	images := make([]string, len(entries))
+	for i, entry := range entries {
+		images[i] = entry.Image
+	}
+	return images
+}
+
+// SaveDir returns the default base directory for a save mode
+func SaveDir(mode SaveMode) string {
+	if mode == SaveModeCurrentDir {
+		return "."
+	}
+	return "./images"
+}
+
+// LoadDir returns the default base directory for a load mode
+func LoadDir(mode LoadMode) string {
+	if mode == LoadModeCurrentDir {
+		return "."
+	}
+	return "./images"
+}
+
+// saveImage saves a single image to tar file and returns the tar file path
+func saveImage(ctx context.Context, rt runtime.ContainerRuntime, image, baseDir string, mode SaveMode, inspectTimeout time.Duration, out io.Writer) (string, error) {
+	ref, err := reference.Parse(image)
+	if err != nil {
+		return "", err
+	}
+
+	// Parse image name to generate tar filename
+	tarFilename := generateTarFilename(image)
+
+	var tarPath string
+
+	switch mode {
+	case SaveModeProjectDir:
+		// Mode 3: ./images/<project>/
+		projectDir := filepath.Join(baseDir, imageProject(ref))
+		if err := os.MkdirAll(projectDir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create project directory %s: %v", projectDir, err)
+		}
+		tarPath = filepath.Join(projectDir, tarFilename)
+	default:
+		// Mode 1: current directory, Mode 2: ./images/
+		tarPath = filepath.Join(baseDir, tarFilename)
+	}
+
+	if err := rt.Save(ctx, findLocalImage(ctx, rt, image, ref, inspectTimeout), tarPath); err != nil {
+		return "", fmt.Errorf("failed to save image: %w", err)
+	}
+
+	// Check if file was created successfully
+	if _, err := os.Stat(tarPath); err != nil {
+		return "", fmt.Errorf("tar file was not created: %v", err)
+	}
+
+	fmt.Fprintf(out, "  Saved: %s\n", tarPath)
+	return tarPath, nil
+}
+
+// generateTarFilename generates tar filename from image name. The digest of
+// a pinned image is appended as <algorithm>-<hex> so the name stays unique
+// and deterministic, e.g. nginx_1.25_sha256-6c3c62....tar.
+func generateTarFilename(image string) string {
+	name, digest, pinned := strings.Cut(image, "@")
+
+	// Replace problematic characters for filename
+	filename := strings.ReplaceAll(name, "/", "_")
+	filename = strings.ReplaceAll(filename, ":", "_")
+
+	if pinned {
+		filename += "_" + strings.Replace(digest, ":", "-", 1)
+	}
+
+	// Add .tar extension
+	return filename + ".tar"
+}
+
+// localImage returns the name of an image in the local image store. Pinned
+// images are looked up by digest alone; a tag next to the digest is only
+// informational.
+func localImage(image string, ref *reference.Reference) string {
+	if ref.Digest == "" {
+		return image
+	}
+	return ref.FamiliarName() + "@" + ref.Digest
+}
+
+// findLocalImage returns the name of an image in the local image store like
+// localImage. A pinned image pulled through a mirror is only known by the
+// digest of the mirror repository, so if the runtime does not know the
+// pinned digest it is looked up under the tag pullMirrors gave it.
+func findLocalImage(ctx context.Context, rt runtime.ContainerRuntime, image string, ref *reference.Reference, timeout time.Duration) string {
+	pinned := localImage(image, ref)
+	inspector, ok := runtime.As[runtime.ImageInspector](rt)
+	if ref.Digest == "" || !ok {
+		return pinned
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if _, err := inspector.RepoDigests(ctx, pinned); err == nil {
+		return pinned
+	}
+	if _, err := inspector.RepoDigests(ctx, mirroredImage(ref)); err == nil {
+		return mirroredImage(ref)
+	}
+	return pinned
+}
+
+// mirroredImage returns the name pullMirrors tags a pinned image with: its
+// tag, or the digest tag if it has none
+func mirroredImage(ref *reference.Reference) string {
+	return ref.FamiliarName() + ":" + imageTag(ref)
+}
+
+// imageTag returns the tag an image is stored and pushed under: its tag, or
+// a tag derived from its digest if it is pinned by digest only
+func imageTag(ref *reference.Reference) string {
+	if tag := ref.TagOrDefault(); tag != "" {
+		return tag
+	}
+	return digestTag(ref.Digest)
+}
+
+// digestTag returns the tag used to push an image pinned by digest only,
+// e.g. sha256-6c3c62... for sha256:6c3c62...
+func digestTag(digest string) string {
+	tag := strings.Replace(digest, ":", "-", 1)
+	if len(tag) > maxTagLength {
+		tag = tag[:maxTagLength]
+	}
+	return tag
+}
+
+// imageProject returns the project of an image, i.e. its repository path
+// without the image name. Images without one belong to "library".
+func imageProject(ref *reference.Reference) string {
+	if namespace := ref.Namespace(); namespace != "" {
+		return namespace
+	}
+	return reference.OfficialNamespace
+}
+
+// findTarFiles finds all files matching pattern in the specified directory
+func findTarFiles(dir, pattern string, recursive bool) ([]string, error) {
+	if pattern == "" {
+		pattern = "*.tar"
+	}
+
+	if !recursive {
+		// Find tar files only in the specified directory
+		return filepath.Glob(filepath.Join(dir, pattern))
+	}
+
+	// Recursively find tar files in subdirectories
+	var tarFiles []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if matched, _ := filepath.Match(pattern, strings.ToLower(info.Name())); matched {
+			tarFiles = append(tarFiles, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tarFiles, nil
+}
+
+// loadImage loads a single tar file using the specified runtime
+func loadImage(ctx context.Context, rt runtime.ContainerRuntime, tarFile string) error {
+	if err := rt.Load(ctx, tarFile); err != nil {
+		return fmt.Errorf("failed to load image: %w", err)
+	}
+
+	return nil
+}
+
+// pushJob describes the push of a single image
+type pushJob struct {
+	image     string               // image as listed
+	ref       *reference.Reference // parsed image reference
+	target    string               // target reference
+	tags      []string             // additional tags pushed to the target repository
+	platforms []string             // platform images combined into a manifest list at the target
+	force     bool                 // push even if the target is up to date
+}
+
+// pushImage tags and pushes a single image and records the pushed reference
+// and digest in res. Images pinned by digest are pushed under their tag, or
+// a tag derived from the digest, and the digest of the pushed image must
+// match the pinned one unless that is the digest of an image index.
+func pushImage(ctx context.Context, rt runtime.ContainerRuntime, job *pushJob, tagTimeout time.Duration, pushOptions runtime.PushOptions, res *ItemResult, out io.Writer) error {
+	if len(job.platforms) > 0 {
+		return pushPlatforms(ctx, rt, job, tagTimeout, pushOptions, res, out)
+	}
+
+	res.Target = job.target
+	source := findLocalImage(ctx, rt, job.image, job.ref, tagTimeout)
+
+	if !job.force {
+		if digest, ok := upToDate(ctx, rt, source, job, tagTimeout, pushOptions); ok {
+			fmt.Fprintf(out, "  Up to date: %s (%s)\n", job.target, digest)
+			res.Digest = digest
+			res.Targets = tagTargets(job)
+			return &skipped{reason: reasonUpToDate}
+		}
+	}
+
+	if err := tagAndPush(ctx, rt, source, job.target, tagTimeout, pushOptions, out); err != nil {
+		return err
+	}
+
+	inspectCtx, cancel := context.WithTimeout(ctx, tagTimeout)
+	defer cancel()
+
+	digest, err := runtime.ImageDigest(inspectCtx, rt, job.target)
+	if err != nil {
+		return fmt.Errorf("failed to determine pushed digest: %w", err)
+	}
+	res.Digest = digest
+
+	switch {
+	case job.ref.Digest == "":
+		if digest != "" {
+			fmt.Fprintf(out, "  Digest: %s\n", digest)
+		}
+	case digest == "":
+		fmt.Fprintf(out, "  Digest: unknown, %s cannot report it (verification skipped)\n", rt.Name())
+	case digest != job.ref.Digest:
+		// Runtimes keep only the platform manifest of an image pulled by
+		// the digest of an index, so that is what they push
+		index, err := pinnedIndex(ctx, rt, job, tagTimeout, pushOptions)
+		switch {
+		case err != nil:
+			fmt.Fprintf(out, "  Digest: %s, cannot tell whether pinned digest %s is an image index (verification skipped): %v\n", digest, job.ref.Digest, err)
+		case index:
+			fmt.Fprintf(out, "  Digest: %s, platform manifest of pinned image index %s (verification skipped)\n", digest, job.ref.Digest)
+		default:
+			return errors.New(errors.ErrDigestMismatch,
+				fmt.Sprintf("pushed digest %s of %s does not match pinned digest %s", digest, job.target, job.ref.Digest)).
+				WithContext("expected", job.ref.Digest).
+				WithContext("actual", digest)
+		}
+	default:
+		fmt.Fprintf(out, "  Digest: %s (verified)\n", digest)
+	}
+
+	// Push the additional tags of the image to the same repository
+	for _, target := range tagTargets(job) {
+		if err := tagAndPush(ctx, rt, source, target, tagTimeout, pushOptions, out); err != nil {
+			return err
+		}
+		res.Targets = append(res.Targets, target)
+	}
+
+	return nil
+}
+
+// tagTargets returns the references of the additional tags of an image
+func tagTargets(job *pushJob) []string {
+	repository := job.target[:strings.LastIndexByte(job.target, ':')]
+	targets := make([]string, 0, len(job.tags))
+	for _, tag := range job.tags {
+		targets = append(targets, repository+":"+tag)
+	}
+	return targets
+}
+
+// upToDate reports whether the target and the additional tags of a push
+// already hold the manifest of source, returning its digest. It requires a
+// runtime that can compare local images with the registry; a failed check
+// means the image is pushed.
+func upToDate(ctx context.Context, rt runtime.ContainerRuntime, source string, job *pushJob, timeout time.Duration, pushOptions runtime.PushOptions) (string, bool) {
+	checker, ok := runtime.As[runtime.PushChecker](rt)
+	if !ok {
+		return "", false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var digest string
+	for _, target := range append([]string{job.target}, tagTargets(job)...) {
+		current, ok, err := checker.UpToDate(ctx, source, target, pushOptions)
+		if err != nil || !ok {
+			return "", false
+		}
+		digest = current
+	}
+
+	// A pushed image pinned by a different digest fails verification unless
+	// the pinned digest is that of an image index
+	if job.ref.Digest != "" && digest != job.ref.Digest {
+		if index, err := pinnedIndex(ctx, rt, job, timeout, pushOptions); err != nil || !index {
+			return "", false
+		}
+	}
+	return digest, true
+}
+
+// pinnedIndex reports whether the digest an image is pinned by is that of an
+// image index in the registry of the image. It fails if the runtime cannot
+// look up manifests.
+func pinnedIndex(ctx context.Context, rt runtime.ContainerRuntime, job *pushJob, timeout time.Duration, pushOptions runtime.PushOptions) (bool, error) {
+	inspector, ok := runtime.As[runtime.ManifestInspector](rt)
+	if !ok {
+		return false, fmt.Errorf("%s cannot inspect registry manifests", rt.Name())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return inspector.IsIndex(ctx, job.ref.Name()+"@"+job.ref.Digest, runtime.PullOptions{Proxy: pushOptions.Proxy})
+}
+
+// tagAndPush tags source as target and pushes target
+func tagAndPush(ctx context.Context, rt runtime.ContainerRuntime, source, target string, tagTimeout time.Duration, pushOptions runtime.PushOptions, out io.Writer) error {
+	fmt.Fprintf(out, "  Tag: %s -> %s\n", source, target)
+
+	// Tag the image
+	tagCtx, cancel := context.WithTimeout(ctx, tagTimeout)
+	defer cancel()
+
+	if err := rt.Tag(tagCtx, source, target); err != nil {
+		return fmt.Errorf("failed to tag image: %w", err)
+	}
+
+	// Push the image
+	if err := rt.Push(ctx, target, pushOptions); err != nil {
+		return fmt.Errorf("failed to push image: %w", err)
+	}
+
+	fmt.Fprintf(out, "  Pushed: %s\n", target)
+	return nil
+}
@@ -0,0 +1,386 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/harpoon/hpn/internal/runtime"
+	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/reference"
+)
+
+// fakeRuntime is a runtime with a local image store and a registry in memory
+type fakeRuntime struct {
+	name     string
+	mu       sync.Mutex
+	images   map[string]string // manifest digests of local images by reference
+	registry map[string]string // manifest digests pushed by target reference
+	indexes  map[string]bool   // whether repo@digest references are image indexes
+	failures map[string]error  // errors returned for images or tar files
+	calls    []string
+}
+
+func newFakeRuntime(images map[string]string) *fakeRuntime {
+	return &fakeRuntime{
+		name:     "fake",
+		images:   images,
+		registry: map[string]string{},
+		indexes:  map[string]bool{},
+		failures: map[string]error{},
+	}
+}
+
+func (f *fakeRuntime) record(format string, args ...any) {
+	f.calls = append(f.calls, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeRuntime) Name() string      { return f.name }
+func (f *fakeRuntime) IsAvailable() bool { return true }
+
+func (f *fakeRuntime) Version() (string, error) { return "1.0", nil }
+
+func (f *fakeRuntime) Pull(ctx context.Context, image string, options runtime.PullOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("pull %s %s", image, options.Platform)
+	if err := f.failures[image]; err != nil {
+		return err
+	}
+	f.images[image] = "sha256:" + image + options.Platform
+	return nil
+}
+
+func (f *fakeRuntime) Save(ctx context.Context, image, tarPath string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("save %s", image)
+	if _, ok := f.images[image]; !ok {
+		return errors.New(errors.ErrImageNotFound, "no such image: "+image)
+	}
+	return os.WriteFile(tarPath, nil, 0644)
+}
+
+func (f *fakeRuntime) Load(ctx context.Context, tarPath string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("load %s", tarPath)
+	return f.failures[filepath.Base(tarPath)]
+}
+
+func (f *fakeRuntime) Tag(ctx context.Context, source, target string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("tag %s %s", source, target)
+	digest, ok := f.images[source]
+	if !ok {
+		return errors.New(errors.ErrImageNotFound, "no such image: "+source)
+	}
+	f.images[target] = digest
+	return nil
+}
+
+func (f *fakeRuntime) Push(ctx context.Context, image string, options runtime.PushOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("push %s", image)
+	digest, ok := f.images[image]
+	if !ok {
+		return errors.New(errors.ErrImageNotFound, "no such image: "+image)
+	}
+	f.registry[image] = digest
+	return nil
+}
+
+func (f *fakeRuntime) RepoDigests(ctx context.Context, image string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	digest, ok := f.registry[image]
+	if !ok {
+		if _, ok := f.images[image]; !ok {
+			return nil, errors.New(errors.ErrImageNotFound, "no such image: "+image)
+		}
+		return nil, nil
+	}
+	ref, err := reference.Parse(image)
+	if err != nil {
+		return nil, err
+	}
+	return []string{ref.Name() + "@" + digest}, nil
+}
+
+func (f *fakeRuntime) UpToDate(ctx context.Context, image, target string, options runtime.PushOptions) (string, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	digest := f.images[image]
+	return digest, digest != "" && f.registry[target] == digest, nil
+}
+
+func (f *fakeRuntime) IsIndex(ctx context.Context, image string, options runtime.PullOptions) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	index, ok := f.indexes[image]
+	if !ok {
+		return false, errors.New(errors.ErrRegistryConnection, "registry unreachable")
+	}
+	return index, nil
+}
+
+// fakeDetector detects a fixed list of runtimes, the first one preferred
+type fakeDetector struct {
+	available []runtime.ContainerRuntime
+}
+
+func (d *fakeDetector) DetectAvailable() []runtime.ContainerRuntime { return d.available }
+
+func (d *fakeDetector) GetPreferred() runtime.ContainerRuntime {
+	if len(d.available) == 0 {
+		return nil
+	}
+	return d.available[0]
+}
+
+func (d *fakeDetector) GetByName(name string) (runtime.ContainerRuntime, error) {
+	for _, rt := range d.available {
+		if rt.Name() == name {
+			return rt, nil
+		}
+	}
+	return nil, errors.NewRuntimeNotFound(name)
+}
+
+// newDetector returns a detector of fake runtimes with the given names
+func newDetector(names ...string) *fakeDetector {
+	d := &fakeDetector{}
+	for _, name := range names {
+		rt := newFakeRuntime(map[string]string{})
+		rt.name = name
+		d.available = append(d.available, rt)
+	}
+	return d
+}
+
+func TestSelectRuntime(t *testing.T) {
+	tests := []struct {
+		name     string
+		detector *fakeDetector
+		opts     Options
+		confirm  *bool  // answer to the fallback question, nil if it must not be asked
+		want     string // selected runtime
+		err      string // expected error, if any
+	}{
+		{"explicit", newDetector("docker", "podman"), Options{Runtime: "podman"}, nil, "podman", ""},
+		{"explicit unavailable", newDetector("docker"), Options{Runtime: "nerdctl", Preferred: "docker"}, nil, "", "specified runtime 'nerdctl' is not available"},
+		{"first available", newDetector("podman", "docker"), Options{}, nil, "podman", ""},
+		{"none available", newDetector(), Options{}, nil, "", "no container runtime found"},
+		{"preferred", newDetector("docker", "podman"), Options{Preferred: "podman"}, nil, "podman", ""},
+		{"automatic fallback", newDetector("podman"), Options{Preferred: "docker", AutoFallback: true}, nil, "podman", ""},
+		{"confirmed fallback", newDetector("podman"), Options{Preferred: "docker"}, boolPtr(true), "podman", ""},
+		{"declined fallback", newDetector("podman"), Options{Preferred: "docker"}, boolPtr(false), "podman", "user declined runtime fallback"},
+		{"no fallback", newDetector(), Options{Preferred: "docker", AutoFallback: true}, nil, "", "no container runtime found"},
+		{"no detector", nil, Options{}, nil, "", "no runtime detector configured"},
+	}
+	for _, tt := range tests {
+		opts := tt.opts
+		if tt.detector != nil {
+			opts.Detector = tt.detector
+		}
+		asked := 0
+		opts.Confirm = func(configured, fallback string) bool {
+			asked++
+			if configured != tt.opts.Preferred || fallback != tt.want {
+				t.Errorf("%s: asked to fall back from %s to %s", tt.name, configured, fallback)
+			}
+			return tt.confirm != nil && *tt.confirm
+		}
+		opts.Output = &strings.Builder{}
+
+		s := NewImageService(opts)
+		rt, err := s.Runtime()
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: Runtime() = %v, want an error containing %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Runtime() failed: %v", tt.name, err)
+			continue
+		}
+		if rt.Name() != tt.want {
+			t.Errorf("%s: Runtime() = %s, want %s", tt.name, rt.Name(), tt.want)
+		}
+
+		// The selection is made once per service
+		s.Runtime()
+		want := 0
+		if tt.confirm != nil {
+			want = 1
+		}
+		if asked != want {
+			t.Errorf("%s: fallback asked %d times, want %d", tt.name, asked, want)
+		}
+	}
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestRunResult(t *testing.T) {
+	rt := newFakeRuntime(map[string]string{})
+	rt.failures["missing:1"] = errors.New(errors.ErrImageNotFound, "manifest unknown")
+
+	var out strings.Builder
+	s := NewImageServiceWithRuntime(rt, Options{Output: &out})
+	result, err := s.Pull(context.Background(), PullRequest{Images: []string{"nginx:1.25", "missing:1", "redis:7"}})
+	if err != nil {
+		t.Fatalf("Pull failed: %v", err)
+	}
+
+	if want := []string{"nginx:1.25", "redis:7"}; !reflect.DeepEqual(result.Success, want) {
+		t.Errorf("succeeded = %v, want %v", result.Success, want)
+	}
+	if len(result.Failed) != 1 || result.Failed[0].Item != "missing:1" || !strings.Contains(result.Failed[0].Error, "manifest unknown") {
+		t.Errorf("failed = %+v, want missing:1 with its error", result.Failed)
+	}
+	if result.Summary != "2 successful, 1 failed" {
+		t.Errorf("summary = %q", result.Summary)
+	}
+	if len(result.Items) != 3 || result.Items[1].Status != ItemFailed || result.Items[1].Code != errors.ErrImageNotFound {
+		t.Errorf("items = %+v, want missing:1 failed with %s", result.Items, errors.ErrImageNotFound)
+	}
+	for _, line := range []string{"[2/3] Pulling missing:1...", "❌ Failed to pull missing:1", "✅ Successfully pulled redis:7"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("output lacks %q:\n%s", line, out.String())
+		}
+	}
+
+	// Without a runtime nothing runs
+	s = NewImageService(Options{Detector: newDetector(), Output: &out})
+	if result, err := s.Pull(context.Background(), PullRequest{Images: []string{"nginx:1.25"}}); err == nil || result != nil {
+		t.Errorf("Pull without a runtime = %v, %v, want an error", result, err)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	rt := newFakeRuntime(map[string]string{
+		"nginx:1.25":          "sha256:nginx",
+		"calico/node:v3.28.2": "sha256:calico",
+	})
+	s := NewImageServiceWithRuntime(rt, Options{Output: &strings.Builder{}})
+
+	result, err := s.Save(context.Background(), SaveRequest{
+		Images:  []string{"nginx:1.25", "calico/node:v3.28.2", "redis:7"},
+		Mode:    SaveModeProjectDir,
+		BaseDir: filepath.Join(dir, "images"),
+	})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if len(result.Success) != 2 || len(result.Failed) != 1 || result.Failed[0].Item != "redis:7" {
+		t.Errorf("save = %v succeeded, %+v failed, want redis:7 to fail", result.Success, result.Failed)
+	}
+
+	tars := []string{
+		filepath.Join(dir, "images", "calico", "calico_node_v3.28.2.tar"),
+		filepath.Join(dir, "images", "library", "nginx_1.25.tar"),
+	}
+	for _, tar := range tars {
+		if _, err := os.Stat(tar); err != nil {
+			t.Errorf("saved tar file: %v", err)
+		}
+	}
+
+	// Tar files in project directories are only found recursively
+	result, err = s.Load(context.Background(), LoadRequest{Mode: LoadModeImagesDir, BaseDir: filepath.Join(dir, "images")})
+	if err != nil || len(result.Success)+len(result.Failed) != 0 {
+		t.Errorf("non-recursive load = %+v, %v, want no tar files", result, err)
+	}
+
+	rt.failures["nginx_1.25.tar"] = errors.New(errors.ErrImageInvalid, "invalid tar header")
+	result, err = s.Load(context.Background(), LoadRequest{Mode: LoadModeRecursive, BaseDir: filepath.Join(dir, "images")})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !reflect.DeepEqual(result.Success, tars[:1]) || len(result.Failed) != 1 || result.Failed[0].Item != tars[1] {
+		t.Errorf("load = %v succeeded, %+v failed, want %s to fail", result.Success, result.Failed, tars[1])
+	}
+
+	var loaded []string
+	for _, call := range rt.calls {
+		if strings.HasPrefix(call, "load ") {
+			loaded = append(loaded, strings.TrimPrefix(call, "load "))
+		}
+	}
+	sort.Strings(loaded)
+	if !reflect.DeepEqual(loaded, tars) {
+		t.Errorf("loaded %v, want %v", loaded, tars)
+	}
+}
+
+func TestPushPinnedDigest(t *testing.T) {
+	const (
+		pinned   = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+		platform = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+	)
+	tests := []struct {
+		name     string
+		local    string // digest of the pinned image in the local store
+		manifest string // what the registry has under the pinned digest: manifest, index or nothing
+		status   ItemStatus
+		code     errors.ErrorCode
+		output   string
+	}{
+		{"single manifest", pinned, "manifest", ItemSucceeded, 0, "(verified)"},
+		{"single manifest mismatch", platform, "manifest", ItemFailed, errors.ErrDigestMismatch, "does not match pinned digest"},
+		{"index", platform, "index", ItemSucceeded, 0, "platform manifest of pinned image index"},
+		{"registry unreachable", platform, "", ItemSucceeded, 0, "verification skipped"},
+	}
+	for _, tt := range tests {
+		rt := newFakeRuntime(map[string]string{"nginx@" + pinned: tt.local})
+		if tt.manifest != "" {
+			rt.indexes["docker.io/library/nginx@"+pinned] = tt.manifest == "index"
+		}
+
+		var out strings.Builder
+		s := NewImageServiceWithRuntime(rt, Options{Output: &out})
+		req := PushRequest{Images: []string{"nginx@" + pinned}, Registry: "harbor.local", Parallel: 1}
+		result, err := s.Push(context.Background(), req)
+		if err != nil {
+			t.Fatalf("%s: Push failed: %v", tt.name, err)
+		}
+
+		item := result.Items[0]
+		if item.Status != tt.status || item.Code != tt.code {
+			t.Errorf("%s: push = %s %s (%s), want %s %s", tt.name, item.Status, item.Code, item.Error, tt.status, tt.code)
+		}
+		if !strings.Contains(out.String(), tt.output) {
+			t.Errorf("%s: output lacks %q:\n%s", tt.name, tt.output, out.String())
+		}
+		if tt.status != ItemSucceeded {
+			continue
+		}
+		if item.Digest != tt.local {
+			t.Errorf("%s: pushed digest = %s, want %s", tt.name, item.Digest, tt.local)
+		}
+
+		// A second push finds the target up to date if the pin is verified
+		result, err = s.Push(context.Background(), req)
+		if err != nil {
+			t.Fatalf("%s: second Push failed: %v", tt.name, err)
+		}
+		want := ItemSkipped
+		if tt.manifest == "" {
+			want = ItemSucceeded
+		}
+		if status := result.Items[0].Status; status != want {
+			t.Errorf("%s: second push = %s, want %s", tt.name, status, want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/reference"
+	"github.com/harpoon/hpn/pkg/types"
+)
+
+// TagRule replaces the tags it matches or adds tags next to them
+type TagRule struct {
+	pattern *regexp.Regexp
+	replace *template.Template // nil keeps matching tags
+	add     []*template.Template
+}
+
+// TagData is the data tag rule templates are executed with
+type TagData struct {
+	Tag  string    // tag the rule matched
+	Date string    // date of the run as YYYYMMDD (UTC)
+	Now  time.Time // time of the run, e.g. {{.Now.Format "2006.01.02"}}
+}
+
+// NewTagRule creates a rule that replaces the tags matching the regular
+// expression match, or every tag if match is empty, with replace and adds
+// the tags of add for them. Replace and add are templates of TagData
+// expanded with the submatches of match ($1, ${name}), e.g.
+// "latest" -> "{{.Date}}" or `v(\d+)\.(\d+)\.\d+` + "v$1.$2".
+func NewTagRule(match, replace string, add []string) (TagRule, error) {
+	if replace == "" && len(add) == 0 {
+		return TagRule{}, errors.New(errors.ErrInvalidConfig, fmt.Sprintf("tag rule %q requires replace or add", match))
+	}
+
+	expression := match
+	if expression == "" {
+		expression = ".*"
+	}
+	pattern, err := regexp.Compile("^(?:" + expression + ")$")
+	if err != nil {
+		return TagRule{}, errors.Wrap(err, errors.ErrInvalidConfig, fmt.Sprintf("invalid tag rule match %q", match))
+	}
+
+	rule := TagRule{pattern: pattern}
+	if replace != "" {
+		if rule.replace, err = parseTagTemplate(replace); err != nil {
+			return TagRule{}, err
+		}
+	}
+	for _, tag := range add {
+		tmpl, err := parseTagTemplate(tag)
+		if err != nil {
+			return TagRule{}, err
+		}
+		rule.add = append(rule.add, tmpl)
+	}
+	return rule, nil
+}
+
+// NewTagRules creates the rules of a configuration or image list entry
+func NewTagRules(configs []types.TagRule) ([]TagRule, error) {
+	rules := make([]TagRule, 0, len(configs))
+	for _, config := range configs {
+		rule, err := NewTagRule(config.Match, config.Replace, config.Add)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// parseTagTemplate parses a replace or add template of a tag rule
+func parseTagTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("tag").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrInvalidConfig, fmt.Sprintf("invalid tag template %q", text))
+	}
+	return tmpl, nil
+}
+
+// apply returns the replacement and the added tags of tag. Tags the rule
+// does not match are returned unchanged.
+func (r *TagRule) apply(tag string, now time.Time) (string, []string, error) {
+	match := r.pattern.FindStringSubmatchIndex(tag)
+	if match == nil {
+		return tag, nil, nil
+	}
+
+	data := TagData{Tag: tag, Date: now.UTC().Format("20060102"), Now: now}
+	expand := func(tmpl *template.Template) (string, error) {
+		var b strings.Builder
+		if err := tmpl.Execute(&b, &data); err != nil {
+			return "", errors.Wrap(err, errors.ErrInvalidArgument, "failed to apply tag rule")
+		}
+		return string(r.pattern.ExpandString(nil, b.String(), tag, match)), nil
+	}
+
+	var added []string
+	for _, tmpl := range r.add {
+		extra, err := expand(tmpl)
+		if err != nil {
+			return "", nil, err
+		}
+		added = append(added, extra)
+	}
+
+	replaced := tag
+	if r.replace != nil {
+		var err error
+		if replaced, err = expand(r.replace); err != nil {
+			return "", nil, err
+		}
+	}
+	return replaced, added, nil
+}
+
+// entryTagRules returns the tag rules of a request followed by those of an
+// entry
+func entryTagRules(rules []TagRule, entry *types.ImageEntry) ([]TagRule, error) {
+	if len(entry.TagRules) == 0 {
+		return rules, nil
+	}
+
+	entryRules, err := NewTagRules(entry.TagRules)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]TagRule(nil), rules...), entryRules...), nil
+}
+
+// retag applies tag rules in order to the target tag and the additional tags
+// of a job. Tags added by a rule are subject to the following rules only.
+// Duplicate tags are pushed once.
+func retag(job *pushJob, rules []TagRule, now time.Time) error {
+	separator := strings.LastIndexByte(job.target, ':')
+	repository := job.target[:separator]
+	tags := append([]string{job.target[separator+1:]}, job.tags...)
+
+	for i := range rules {
+		for j, n := 0, len(tags); j < n; j++ {
+			replaced, added, err := rules[i].apply(tags[j], now)
+			if err != nil {
+				return err
+			}
+			tags[j] = replaced
+			tags = append(tags, added...)
+		}
+	}
+
+	seen := make(map[string]bool, len(tags))
+	unique := tags[:0]
+	for _, tag := range tags {
+		if !reference.ValidTag(tag) {
+			return errors.New(errors.ErrInvalidArgument, fmt.Sprintf("tag rules produced invalid tag %q for %s", tag, job.image))
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			unique = append(unique, tag)
+		}
+	}
+
+	job.target = repository + ":" + unique[0]
+	job.tags = unique[1:]
+	return nil
+}
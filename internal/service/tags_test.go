@@ -0,0 +1,78 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/harpoon/hpn/pkg/types"
+)
+
+func TestRetag(t *testing.T) {
+	now := time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC)
+	tests := []struct {
+		name   string
+		target string
+		tags   []string
+		rules  []types.TagRule
+		want   string
+		extra  []string
+	}{
+		{"no rules", "harbor.local/app:v1", []string{"stable", "v1", "stable"}, nil, "harbor.local/app:v1", []string{"stable"}},
+		{"suffix", "harbor.local/app:v1", []string{"stable"}, []types.TagRule{{Replace: "$0-amd64"}}, "harbor.local/app:v1-amd64", []string{"stable-amd64"}},
+		{"template suffix", "localhost:5000/app:v1", nil, []types.TagRule{{Replace: "{{.Tag}}-amd64"}}, "localhost:5000/app:v1-amd64", []string{}},
+		{"date stamp", "harbor.local/app:latest", []string{"stable"}, []types.TagRule{{Match: "latest", Replace: "{{.Date}}"}}, "harbor.local/app:20260314", []string{"stable"}},
+		{"time format", "harbor.local/app:latest", nil, []types.TagRule{{Match: "latest", Replace: `nightly-{{.Now.Format "2006.01.02"}}`}}, "harbor.local/app:nightly-2026.03.14", []string{}},
+		{"match is anchored", "harbor.local/app:latest-alpine", nil, []types.TagRule{{Match: "latest", Replace: "{{.Date}}"}}, "harbor.local/app:latest-alpine", []string{}},
+		{"release tags", "harbor.local/app:v1.2.3", nil,
+			[]types.TagRule{{Match: `v(\d+)\.(\d+)\.\d+`, Add: []string{"v$1.$2", "v$1", "stable"}}},
+			"harbor.local/app:v1.2.3", []string{"v1.2", "v1", "stable"}},
+		{"rules in order", "harbor.local/app:v1.2.3", nil,
+			[]types.TagRule{{Match: `v(\d+)\.(\d+)\.\d+`, Add: []string{"v$1.$2"}}, {Replace: "$0-amd64"}},
+			"harbor.local/app:v1.2.3-amd64", []string{"v1.2-amd64"}},
+		{"added tags skip the rule", "harbor.local/app:v1", nil, []types.TagRule{{Replace: "$0-amd64", Add: []string{"$0"}}}, "harbor.local/app:v1-amd64", []string{"v1"}},
+		{"named submatch", "harbor.local/app:1.25-alpine", nil, []types.TagRule{{Match: `(?P<version>[\d.]+)-alpine`, Replace: "${version}"}}, "harbor.local/app:1.25", []string{}},
+		{"duplicates", "harbor.local/app:latest", []string{"stable"}, []types.TagRule{{Match: "stable", Replace: "latest"}}, "harbor.local/app:latest", []string{}},
+	}
+	for _, tt := range tests {
+		rules, err := NewTagRules(tt.rules)
+		if err != nil {
+			t.Fatalf("%s: NewTagRules failed: %v", tt.name, err)
+		}
+		job := &pushJob{image: "app", target: tt.target, tags: tt.tags}
+		if err := retag(job, rules, now); err != nil {
+			t.Errorf("%s: retag failed: %v", tt.name, err)
+			continue
+		}
+		if job.target != tt.want || !reflect.DeepEqual(job.tags, tt.extra) {
+			t.Errorf("%s: retag = %s %v, want %s %v", tt.name, job.target, job.tags, tt.want, tt.extra)
+		}
+	}
+}
+
+func TestTagRuleInvalid(t *testing.T) {
+	for _, rule := range []types.TagRule{
+		{Match: "latest"},
+		{Match: "(", Replace: "x"},
+		{Replace: "{{.Tag"},
+	} {
+		if _, err := NewTagRule(rule.Match, rule.Replace, rule.Add); err == nil {
+			t.Errorf("NewTagRule(%+v) succeeded, want an error", rule)
+		}
+	}
+
+	for _, rule := range []types.TagRule{
+		{Replace: "$0/amd64"},
+		{Replace: "{{.Missing}}"},
+		{Match: "latest", Add: []string{"-latest"}},
+	} {
+		rules, err := NewTagRules([]types.TagRule{rule})
+		if err != nil {
+			t.Fatalf("NewTagRules(%+v) failed: %v", rule, err)
+		}
+		job := &pushJob{image: "app", target: "harbor.local/app:latest"}
+		if err := retag(job, rules, time.Now()); err == nil {
+			t.Errorf("retag with %+v = %s %v, want an error", rule, job.target, job.tags)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/harpoon/hpn/pkg/errors"
+	"github.com/harpoon/hpn/pkg/reference"
+	"github.com/harpoon/hpn/pkg/types"
+)
+
+// Push target templates of the push modes
+const (
+	TemplateSimple   = "{{.Registry}}/{{.Name}}:{{.Tag}}"              // registry/image:tag
+	TemplateProject  = "{{.Registry}}/{{.Project}}/{{.Name}}:{{.Tag}}" // registry/project/image:tag
+	TemplatePreserve = "{{.Registry}}/{{.Path}}:{{.Tag}}"              // registry/original/path/image:tag
+)
+
+// TargetData is the data push target templates are executed with. For
+// ghcr.io/org/team/app:v1 pushed to harbor.local it holds Registry
+// harbor.local, Domain ghcr.io, Path org/team/app, Namespace org/team,
+// Name app and Tag v1.
+type TargetData struct {
+	Registry  string // target registry
+	Project   string // target project: the entry's, the requested or the image's project
+	Domain    string // registry of the image
+	Path      string // repository path of the image, with the entry's project and name applied
+	Namespace string // repository path of the image without its name, empty if it has none
+	Name      string // repository name: the entry's or the last path component
+	Tag       string // tag of the image, or one derived from its digest
+}
+
+// templateFuncs are the functions available to push target templates
+var templateFuncs = template.FuncMap{
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"lower":      strings.ToLower,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+}
+
+// TargetTemplate maps images to the references they are pushed to
+type TargetTemplate struct {
+	tmpl *template.Template
+
+	// project is used for entries with a project in simple mode, which
+	// push to registry/project/image:tag as before
+	project *template.Template
+}
+
+// ModeTemplate returns the push target template of a push mode
+func ModeTemplate(mode PushMode) string {
+	switch mode {
+	case PushModeProject:
+		return TemplateProject
+	case PushModePreserve:
+		return TemplatePreserve
+	default:
+		return TemplateSimple
+	}
+}
+
+// ParseTargetTemplate parses a push target template such as
+// "{{.Registry}}/mirror/{{.Path}}:{{.Tag}}". An empty text selects the
+// template of mode.
+func ParseTargetTemplate(text string, mode PushMode) (*TargetTemplate, error) {
+	preset := text == ""
+	if preset {
+		text = ModeTemplate(mode)
+	}
+
+	tmpl, err := template.New("target").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrInvalidArgument, fmt.Sprintf("invalid push template %q", text))
+	}
+
+	t := &TargetTemplate{tmpl: tmpl}
+	if preset && mode != PushModeProject {
+		t.project = template.Must(template.New("target").Parse(TemplateProject))
+	}
+
+	// Catch unknown fields before any image is pushed
+	sample := TargetData{Registry: "registry.local", Project: "library", Domain: reference.DefaultDomain,
+		Path: "library/nginx", Namespace: "library", Name: "nginx", Tag: reference.DefaultTag}
+	if err := tmpl.Execute(&strings.Builder{}, &sample); err != nil {
+		return nil, errors.Wrap(err, errors.ErrInvalidArgument, fmt.Sprintf("invalid push template %q", text))
+	}
+	return t, nil
+}
+
+// Target returns the reference an image is pushed to. The entry may
+// override the target repository name and project; an empty project keeps
+// the project of the image.
+func (t *TargetTemplate) Target(ref *reference.Reference, entry *types.ImageEntry, registry, project string) (string, error) {
+	data := TargetData{
+		Registry:  registry,
+		Project:   project,
+		Domain:    ref.Domain,
+		Namespace: ref.Namespace(),
+		Name:      ref.Repository(),
+		Tag:       imageTag(ref),
+	}
+	if entry.Name != "" {
+		data.Name = entry.Name
+	}
+	if data.Project == "" {
+		data.Project = imageProject(ref)
+	}
+
+	data.Path = data.Name
+	if data.Namespace != "" {
+		data.Path = data.Namespace + "/" + data.Name
+	}
+
+	tmpl := t.tmpl
+	if entry.Project != "" {
+		data.Project = entry.Project
+		data.Path = entry.Project + "/" + data.Name
+		if t.project != nil {
+			tmpl = t.project
+		}
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, &data); err != nil {
+		return "", errors.Wrap(err, errors.ErrInvalidArgument, "failed to apply push template")
+	}
+
+	target := b.String()
+	parsed, err := reference.Parse(target)
+	if err != nil {
+		return "", errors.Wrap(err, errors.ErrInvalidArgument, fmt.Sprintf("push template produced invalid target %q", target))
+	}
+	if parsed.Tag == "" || parsed.Digest != "" {
+		return "", errors.New(errors.ErrInvalidArgument, fmt.Sprintf("push template produced target %q, want name:tag", target))
+	}
+	return target, nil
+}
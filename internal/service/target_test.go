@@ -0,0 +1,82 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/harpoon/hpn/pkg/reference"
+	"github.com/harpoon/hpn/pkg/types"
+)
+
+func TestTargetTemplate(t *testing.T) {
+	const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		template string
+		mode     PushMode
+		image    string
+		entry    types.ImageEntry
+		project  string
+		want     string
+	}{
+		{"", PushModeSimple, "nginx:1.25", types.ImageEntry{}, "", "harbor.local/nginx:1.25"},
+		{"", PushModeSimple, "ghcr.io/org/team/app:v1", types.ImageEntry{}, "prod", "harbor.local/app:v1"},
+		{"", PushModeSimple, "calico/node:v3.28.2", types.ImageEntry{Project: "network", Name: "calico-node"}, "", "harbor.local/network/calico-node:v3.28.2"},
+		{"", PushModeProject, "nginx", types.ImageEntry{}, "", "harbor.local/library/nginx:latest"},
+		{"", PushModeProject, "ghcr.io/org/team/app:v1", types.ImageEntry{}, "", "harbor.local/org/team/app:v1"},
+		{"", PushModeProject, "ghcr.io/org/team/app:v1", types.ImageEntry{}, "prod", "harbor.local/prod/app:v1"},
+		{"", PushModeProject, "ghcr.io/org/app:v1", types.ImageEntry{Project: "apps"}, "prod", "harbor.local/apps/app:v1"},
+		{"", PushModePreserve, "ghcr.io/org/team/app:v1", types.ImageEntry{}, "prod", "harbor.local/org/team/app:v1"},
+		{"", PushModePreserve, "localhost:5000/app:v1", types.ImageEntry{}, "", "harbor.local/app:v1"},
+		{"", PushModePreserve, "ghcr.io/org/team/app:v1", types.ImageEntry{Name: "api"}, "", "harbor.local/org/team/api:v1"},
+		{"", PushModePreserve, "ghcr.io/org/team/app:v1", types.ImageEntry{Project: "apps"}, "", "harbor.local/apps/app:v1"},
+		{"", PushModePreserve, "nginx@" + digest, types.ImageEntry{}, "", "harbor.local/library/nginx:sha256-0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"},
+		{"{{.Registry}}/mirror/{{.Path}}:{{.Tag}}", PushModeSimple, "ghcr.io/org/team/app:v1", types.ImageEntry{}, "", "harbor.local/mirror/org/team/app:v1"},
+		{"{{.Registry}}/{{.Project}}/{{replace \"/\" \"-\" .Path}}:{{.Tag}}", PushModeSimple, "ghcr.io/org/team/app:v1", types.ImageEntry{}, "prod", "harbor.local/prod/org-team-app:v1"},
+		{"{{.Registry}}/{{.Domain | replace \":\" \"-\"}}/{{.Path}}:{{.Tag}}", PushModeSimple, "localhost:5000/app:v1", types.ImageEntry{}, "", "harbor.local/localhost-5000/app:v1"},
+		{"{{.Registry}}/{{.Path | trimPrefix \"library/\"}}:{{.Tag}}", PushModeSimple, "nginx:1.25", types.ImageEntry{}, "", "harbor.local/nginx:1.25"},
+	}
+	for _, tt := range tests {
+		targets, err := ParseTargetTemplate(tt.template, tt.mode)
+		if err != nil {
+			t.Fatalf("ParseTargetTemplate(%q, %d) failed: %v", tt.template, tt.mode, err)
+		}
+		ref, err := reference.Parse(tt.image)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tt.image, err)
+		}
+		got, err := targets.Target(ref, &tt.entry, "harbor.local", tt.project)
+		if err != nil {
+			t.Errorf("Target(%q) with template %q, mode %d failed: %v", tt.image, tt.template, tt.mode, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Target(%q) with template %q, mode %d = %q, want %q", tt.image, tt.template, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestTargetTemplateInvalid(t *testing.T) {
+	for _, template := range []string{
+		"{{.Registry}/{{.Path}}",
+		"{{.Registry}}/{{.Repo}}:{{.Tag}}",
+		"{{.Registry}}/{{unknown .Path}}:{{.Tag}}",
+	} {
+		if _, err := ParseTargetTemplate(template, PushModeSimple); err == nil {
+			t.Errorf("ParseTargetTemplate(%q) succeeded, want an error", template)
+		}
+	}
+
+	ref, _ := reference.Parse("nginx:1.25")
+	for _, template := range []string{
+		"{{.Registry}}/{{.Path}}",
+		"{{.Registry}}/{{.Path}}@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		"{{.Registry}}/Mirror/{{.Path}}:{{.Tag}}",
+	} {
+		targets, err := ParseTargetTemplate(template, PushModeSimple)
+		if err != nil {
+			t.Fatalf("ParseTargetTemplate(%q) failed: %v", template, err)
+		}
+		if target, err := targets.Target(ref, &types.ImageEntry{}, "harbor.local", ""); err == nil {
+			t.Errorf("Target with template %q = %q, want an error", template, target)
+		}
+	}
+}
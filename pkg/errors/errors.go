@@ -1,6 +1,7 @@
 package errors
 
 import (
+	stderrors "errors"
 	"fmt"
 )
 
@@ -68,6 +69,18 @@ const (
 	ErrInvalidConfig
 	ErrConfigNotFound
 	ErrConfigParsing
+
+	// Operation errors
+	ErrRuntimeTimeout
+	ErrRegistryRateLimit
+
+	// Batch and usage errors
+	ErrPartialFailure
+	ErrBatchFailed
+	ErrInvalidArgument
+
+	// Verification errors
+	ErrDigestMismatch
 )
 
 // String returns the string representation of the error code
@@ -111,6 +124,18 @@ func (e ErrorCode) String() string {
 		return "CONFIG_NOT_FOUND"
 	case ErrConfigParsing:
 		return "CONFIG_PARSING"
+	case ErrRuntimeTimeout:
+		return "RUNTIME_TIMEOUT"
+	case ErrRegistryRateLimit:
+		return "REGISTRY_RATE_LIMIT"
+	case ErrPartialFailure:
+		return "PARTIAL_FAILURE"
+	case ErrBatchFailed:
+		return "BATCH_FAILED"
+	case ErrInvalidArgument:
+		return "INVALID_ARGUMENT"
+	case ErrDigestMismatch:
+		return "DIGEST_MISMATCH"
 	default:
 		return "UNKNOWN"
 	}
@@ -133,6 +158,16 @@ func Wrap(err error, code ErrorCode, message string) *HarpoonError {
 	}
 }
 
+// GetCode returns the code of the first HarpoonError in err's chain,
+// or 0 if there is none
+func GetCode(err error) ErrorCode {
+	var herr *HarpoonError
+	if stderrors.As(err, &herr) {
+		return herr.Code
+	}
+	return 0
+}
+
 // Common error constructors
 func NewRuntimeNotFound(runtime string) *HarpoonError {
 	return New(ErrRuntimeNotFound, fmt.Sprintf("container runtime '%s' not found", runtime)).
@@ -153,4 +188,31 @@ func NewInsufficientSpace(required, available int64) *HarpoonError {
 	return New(ErrInsufficientSpace, fmt.Sprintf("insufficient disk space: required %d bytes, available %d bytes", required, available)).
 		WithContext("required", required).
 		WithContext("available", available)
-}
\ No newline at end of file
+}
+
+// NewBatchError creates the error for a batch operation in which some or all
+// of total items failed. failures holds the error code of every failed item,
+// 0 if it has none; when all items failed for the same reason that code is
+// kept as failure_code.
+func NewBatchError(message string, total int, failures []ErrorCode) *HarpoonError {
+	if len(failures) < total {
+		return New(ErrPartialFailure, message).
+			WithContext("total", total).
+			WithContext("failed", len(failures))
+	}
+
+	err := New(ErrBatchFailed, message).
+		WithContext("total", total).
+		WithContext("failed", len(failures))
+
+	if len(failures) > 0 {
+		common := failures[0]
+		for _, code := range failures[1:] {
+			if code != common {
+				return err
+			}
+		}
+		err.WithContext("failure_code", common)
+	}
+	return err
+}
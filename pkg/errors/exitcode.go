@@ -0,0 +1,73 @@
+package errors
+
+import (
+	stderrors "errors"
+)
+
+// Process exit codes returned by hpn. These values are part of the public
+// interface and must not change; see docs/exit-codes.md.
+const (
+	ExitSuccess            = 0  // operation completed successfully
+	ExitGeneral            = 1  // unclassified failure
+	ExitUsage              = 2  // invalid command line arguments
+	ExitConfig             = 3  // configuration missing or invalid
+	ExitRuntimeUnavailable = 4  // no usable container runtime
+	ExitAuth               = 5  // registry authentication failed
+	ExitNetwork            = 6  // registry or network unreachable, rate limited
+	ExitImageNotFound      = 7  // image or manifest does not exist or is invalid
+	ExitDiskSpace          = 8  // insufficient disk space
+	ExitTimeout            = 9  // runtime operation timed out
+	ExitPartialFailure     = 10 // some items of a batch failed
+	ExitBatchFailure       = 11 // all items of a batch failed for different reasons
+)
+
+// ExitCode returns the process exit code for err. A batch in which every
+// item failed for the same reason exits with the code of that reason, which
+// is ExitGeneral for reasons without a category of their own.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitSuccess
+	}
+
+	var herr *HarpoonError
+	if !stderrors.As(err, &herr) {
+		return ExitGeneral
+	}
+
+	if herr.Code == ErrBatchFailed {
+		if cause, ok := herr.Context["failure_code"].(ErrorCode); ok {
+			return exitCodeFor(cause)
+		}
+	}
+
+	return exitCodeFor(herr.Code)
+}
+
+// exitCodeFor maps an error code to its exit code category
+func exitCodeFor(code ErrorCode) int {
+	switch code {
+	case ErrInvalidArgument:
+		return ExitUsage
+	case ErrInvalidConfig, ErrConfigNotFound, ErrConfigParsing:
+		return ExitConfig
+	case ErrRuntimeNotFound, ErrRuntimeUnavailable:
+		return ExitRuntimeUnavailable
+	case ErrRegistryAuth:
+		return ExitAuth
+	case ErrRegistryConnection, ErrRegistryTimeout, ErrRegistryRateLimit,
+		ErrNetworkTimeout, ErrNetworkConnection, ErrProxyConnection:
+		return ExitNetwork
+	case ErrImageNotFound, ErrImageInvalid, ErrImageParsing:
+		return ExitImageNotFound
+	case ErrInsufficientSpace:
+		return ExitDiskSpace
+	case ErrRuntimeTimeout:
+		return ExitTimeout
+	case ErrPartialFailure:
+		return ExitPartialFailure
+	case ErrBatchFailed:
+		return ExitBatchFailure
+	default:
+		return ExitGeneral
+	}
+}
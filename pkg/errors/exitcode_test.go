@@ -0,0 +1,89 @@
+package errors
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	codes := map[ErrorCode]int{
+		ErrRuntimeNotFound:    ExitRuntimeUnavailable,
+		ErrRuntimeUnavailable: ExitRuntimeUnavailable,
+		ErrRuntimeCommand:     ExitGeneral,
+		ErrImageNotFound:      ExitImageNotFound,
+		ErrImageInvalid:       ExitImageNotFound,
+		ErrImageParsing:       ExitImageNotFound,
+		ErrRegistryAuth:       ExitAuth,
+		ErrRegistryConnection: ExitNetwork,
+		ErrRegistryTimeout:    ExitNetwork,
+		ErrNetworkTimeout:     ExitNetwork,
+		ErrNetworkConnection:  ExitNetwork,
+		ErrProxyConnection:    ExitNetwork,
+		ErrInsufficientSpace:  ExitDiskSpace,
+		ErrFileNotFound:       ExitGeneral,
+		ErrFilePermission:     ExitGeneral,
+		ErrFileOperation:      ExitGeneral,
+		ErrInvalidConfig:      ExitConfig,
+		ErrConfigNotFound:     ExitConfig,
+		ErrConfigParsing:      ExitConfig,
+		ErrRuntimeTimeout:     ExitTimeout,
+		ErrRegistryRateLimit:  ExitNetwork,
+		ErrPartialFailure:     ExitPartialFailure,
+		ErrBatchFailed:        ExitBatchFailure,
+		ErrInvalidArgument:    ExitUsage,
+		ErrDigestMismatch:     ExitGeneral,
+	}
+	for code := ErrRuntimeNotFound; code <= ErrDigestMismatch; code++ {
+		want, ok := codes[code]
+		if !ok {
+			t.Errorf("error code %s has no exit code in the test table", code)
+			continue
+		}
+		if got := ExitCode(New(code, "failed")); got != want {
+			t.Errorf("ExitCode(%s) = %d, want %d", code, got, want)
+		}
+	}
+
+	if got := ExitCode(nil); got != ExitSuccess {
+		t.Errorf("ExitCode(nil) = %d, want %d", got, ExitSuccess)
+	}
+	if got := ExitCode(fmt.Errorf("open images.txt: permission denied")); got != ExitGeneral {
+		t.Errorf("ExitCode of an error without a code = %d, want %d", got, ExitGeneral)
+	}
+	if got := ExitCode(fmt.Errorf("push: %w", New(ErrRegistryAuth, "denied"))); got != ExitAuth {
+		t.Errorf("ExitCode of a wrapped error = %d, want %d", got, ExitAuth)
+	}
+}
+
+func TestBatchExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		total    int
+		failures []ErrorCode
+		code     ErrorCode
+		want     int
+	}{
+		{"all same", 2, []ErrorCode{ErrRegistryAuth, ErrRegistryAuth}, ErrBatchFailed, ExitAuth},
+		{"all same network", 3, []ErrorCode{ErrRegistryRateLimit, ErrRegistryRateLimit, ErrRegistryRateLimit}, ErrBatchFailed, ExitNetwork},
+		{"all same unclassified", 2, []ErrorCode{ErrRuntimeCommand, ErrRuntimeCommand}, ErrBatchFailed, ExitGeneral},
+		{"all without code", 2, []ErrorCode{0, 0}, ErrBatchFailed, ExitGeneral},
+		{"single", 1, []ErrorCode{ErrRuntimeTimeout}, ErrBatchFailed, ExitTimeout},
+		{"mixed", 2, []ErrorCode{ErrRegistryAuth, ErrNetworkTimeout}, ErrBatchFailed, ExitBatchFailure},
+		{"mixed unclassified", 2, []ErrorCode{ErrRuntimeCommand, ErrFileOperation}, ErrBatchFailed, ExitBatchFailure},
+		{"mixed with and without code", 2, []ErrorCode{ErrRegistryAuth, 0}, ErrBatchFailed, ExitBatchFailure},
+		{"partial", 3, []ErrorCode{ErrRegistryAuth}, ErrPartialFailure, ExitPartialFailure},
+		{"partial mixed", 3, []ErrorCode{ErrRegistryAuth, ErrImageNotFound}, ErrPartialFailure, ExitPartialFailure},
+	}
+	for _, tt := range tests {
+		err := NewBatchError("batch failed", tt.total, tt.failures)
+		if err.Code != tt.code {
+			t.Errorf("%s: NewBatchError code = %s, want %s", tt.name, err.Code, tt.code)
+		}
+		if err.Context["total"] != tt.total || err.Context["failed"] != len(tt.failures) {
+			t.Errorf("%s: context = %v, want %d of %d failed", tt.name, err.Context, len(tt.failures), tt.total)
+		}
+		if got := ExitCode(err); got != tt.want {
+			t.Errorf("%s: ExitCode = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
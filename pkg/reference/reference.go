@@ -0,0 +1,249 @@
+// Package reference parses container image references following the
+// distribution reference grammar:
+//
+//	reference := name [ ":" tag ] [ "@" digest ]
+//	name      := [ domain "/" ] path-component [ "/" path-component ]*
+//	domain    := host [ ":" port ]
+//
+// References are normalized the way docker does: a missing domain means
+// docker.io and single-component docker.io repositories live in "library".
+package reference
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/harpoon/hpn/pkg/errors"
+)
+
+const (
+	// DefaultDomain is the registry used for references without a domain
+	DefaultDomain = "docker.io"
+
+	// OfficialNamespace is the docker.io namespace of official images
+	OfficialNamespace = "library"
+
+	// DefaultTag is the tag implied by references without tag or digest
+	DefaultTag = "latest"
+
+	// legacyDefaultDomain is normalized to DefaultDomain
+	legacyDefaultDomain = "index.docker.io"
+
+	// maxNameLength is the maximum length of a repository name
+	maxNameLength = 255
+)
+
+var (
+	domainComponent = `(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])`
+
+	domainPattern = anchored(
+		`(?:`+domainComponent+`(?:\.`+domainComponent+`)*|\[[a-fA-F0-9:]+\])`,
+		`(?::[0-9]+)?`)
+	pathComponentPattern = anchored(`[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*`)
+	tagPattern           = anchored(`[\w][\w.-]{0,127}`)
+	digestPattern        = anchored(`[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]+`)
+)
+
+// digestLengths are the encoded lengths of the registered digest algorithms
+var digestLengths = map[string]int{
+	"sha256": 64,
+	"sha384": 96,
+	"sha512": 128,
+}
+
+// Reference is a normalized image reference
+type Reference struct {
+	Domain string // registry host with optional port, e.g. docker.io, localhost:5000
+	Path   string // repository path, e.g. library/nginx, coredns/coredns
+	Tag    string // tag, empty if not specified
+	Digest string // digest as algorithm:encoded, empty if not specified
+}
+
+// Parse parses and normalizes an image reference
+func Parse(s string) (*Reference, error) {
+	if s == "" {
+		return nil, invalid(s, "reference is empty")
+	}
+
+	ref := &Reference{}
+	name := s
+
+	if i := strings.IndexByte(name, '@'); i >= 0 {
+		ref.Digest = name[i+1:]
+		name = name[:i]
+		if err := validateDigest(ref.Digest); err != nil {
+			return nil, invalid(s, err.Error())
+		}
+	}
+
+	// A tag follows the last colon after the last slash; earlier colons
+	// belong to the domain port
+	if i := strings.LastIndexByte(name, ':'); i > strings.LastIndexByte(name, '/') {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+		if !ValidTag(ref.Tag) {
+			return nil, invalid(s, fmt.Sprintf("invalid tag %q", ref.Tag))
+		}
+	}
+
+	if name == "" {
+		return nil, invalid(s, "repository name is empty")
+	}
+
+	ref.Domain, ref.Path = splitDomain(name)
+	if ref.Domain != "" && !domainPattern.MatchString(ref.Domain) {
+		return nil, invalid(s, fmt.Sprintf("invalid registry %q", ref.Domain))
+	}
+
+	for _, component := range strings.Split(ref.Path, "/") {
+		if pathComponentPattern.MatchString(component) {
+			continue
+		}
+		if strings.ToLower(component) != component {
+			return nil, invalid(s, "repository name must be lowercase")
+		}
+		return nil, invalid(s, fmt.Sprintf("invalid repository path component %q", component))
+	}
+
+	// Normalize docker.io references
+	if ref.Domain == "" || ref.Domain == legacyDefaultDomain {
+		ref.Domain = DefaultDomain
+	}
+	if ref.Domain == DefaultDomain && !strings.Contains(ref.Path, "/") {
+		ref.Path = OfficialNamespace + "/" + ref.Path
+	}
+
+	if len(ref.Name()) > maxNameLength {
+		return nil, invalid(s, fmt.Sprintf("repository name must not be longer than %d characters", maxNameLength))
+	}
+
+	return ref, nil
+}
+
+// splitDomain splits a name into domain and path. The first component is a
+// domain if it contains a dot or port, is localhost or has upper case letters.
+func splitDomain(name string) (string, string) {
+	i := strings.IndexByte(name, '/')
+	if i < 0 {
+		return "", name
+	}
+
+	first := name[:i]
+	if strings.ContainsAny(first, ".:") || first == "localhost" || strings.ToLower(first) != first {
+		return first, name[i+1:]
+	}
+	return "", name
+}
+
+// validateDigest checks the format of a digest and the length of registered algorithms
+func validateDigest(digest string) error {
+	if !digestPattern.MatchString(digest) {
+		return fmt.Errorf("invalid digest %q", digest)
+	}
+
+	algorithm, encoded, _ := strings.Cut(digest, ":")
+	if length, ok := digestLengths[algorithm]; ok {
+		if len(encoded) != length || strings.Trim(encoded, "0123456789abcdef") != "" {
+			return fmt.Errorf("invalid %s digest %q", algorithm, encoded)
+		}
+	}
+	return nil
+}
+
+// String returns the fully qualified reference, e.g.
+// docker.io/library/nginx:1.25. Parsing it yields the same reference.
+func (r *Reference) String() string {
+	s := r.Name()
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// FamiliarString returns the shortest form of the reference as shown by
+// docker, e.g. nginx:1.25 or calico/node:v3.28.2
+func (r *Reference) FamiliarString() string {
+	s := r.FamiliarName()
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// Name returns the fully qualified repository name without tag or digest
+func (r *Reference) Name() string {
+	return r.Domain + "/" + r.Path
+}
+
+// FamiliarName returns the repository name without the default domain and
+// official namespace. The domain is kept when the path would otherwise be
+// mistaken for one, e.g. docker.io/localhost/app.
+func (r *Reference) FamiliarName() string {
+	if r.Domain != DefaultDomain {
+		return r.Name()
+	}
+	if domain, _ := splitDomain(r.Path); domain != "" {
+		return r.Name()
+	}
+	return strings.TrimPrefix(r.Path, OfficialNamespace+"/")
+}
+
+// Repository returns the last component of the path, e.g. "coredns" for
+// registry.k8s.io/coredns/coredns
+func (r *Reference) Repository() string {
+	return r.Path[strings.LastIndexByte(r.Path, '/')+1:]
+}
+
+// Namespace returns the path without its last component, e.g. "library" for
+// nginx or "production/team" for harbor.example.com/production/team/api.
+// It is empty for single-component paths outside docker.io.
+func (r *Reference) Namespace() string {
+	i := strings.LastIndexByte(r.Path, '/')
+	if i < 0 {
+		return ""
+	}
+	return r.Path[:i]
+}
+
+// TagOrDefault returns the tag, or "latest" if the reference has neither tag
+// nor digest
+func (r *Reference) TagOrDefault() string {
+	if r.Tag == "" && r.Digest == "" {
+		return DefaultTag
+	}
+	return r.Tag
+}
+
+// ValidTag reports whether tag is a valid image tag
+func ValidTag(tag string) bool {
+	return tagPattern.MatchString(tag)
+}
+
+// ValidPath reports whether path is a valid repository path without domain,
+// e.g. "nginx" or "team/app"
+func ValidPath(path string) bool {
+	for _, component := range strings.Split(path, "/") {
+		if !pathComponentPattern.MatchString(component) {
+			return false
+		}
+	}
+	return true
+}
+
+// anchored compiles the concatenated expressions matching a whole string
+func anchored(expressions ...string) *regexp.Regexp {
+	return regexp.MustCompile(`^(?:` + strings.Join(expressions, "") + `)$`)
+}
+
+// invalid creates the error returned for an invalid reference
+func invalid(s, reason string) error {
+	return errors.New(errors.ErrImageInvalid, fmt.Sprintf("invalid image reference %q: %s", s, reason)).
+		WithContext("reference", s)
+}
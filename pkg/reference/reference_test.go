@@ -0,0 +1,148 @@
+package reference
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/harpoon/hpn/pkg/errors"
+)
+
+const testDigest = "sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Reference
+	}{
+		{"nginx", Reference{Domain: "docker.io", Path: "library/nginx"}},
+		{"nginx:1.25", Reference{Domain: "docker.io", Path: "library/nginx", Tag: "1.25"}},
+		{"calico/node:v3.28.2", Reference{Domain: "docker.io", Path: "calico/node", Tag: "v3.28.2"}},
+		{"docker.io/nginx", Reference{Domain: "docker.io", Path: "library/nginx"}},
+		{"index.docker.io/library/nginx", Reference{Domain: "docker.io", Path: "library/nginx"}},
+		{"registry.k8s.io/coredns/coredns:v1.11.1", Reference{Domain: "registry.k8s.io", Path: "coredns/coredns", Tag: "v1.11.1"}},
+		{"localhost:5000/app", Reference{Domain: "localhost:5000", Path: "app"}},
+		{"localhost:5000/app:1.0", Reference{Domain: "localhost:5000", Path: "app", Tag: "1.0"}},
+		{"localhost/app", Reference{Domain: "localhost", Path: "app"}},
+		{"[::1]:5000/app:dev", Reference{Domain: "[::1]:5000", Path: "app", Tag: "dev"}},
+		{"harbor.example.com/prod/team/api:v2", Reference{Domain: "harbor.example.com", Path: "prod/team/api", Tag: "v2"}},
+		{"quay.io/my_org/my-app__x.y", Reference{Domain: "quay.io", Path: "my_org/my-app__x.y"}},
+		{"nginx@" + testDigest, Reference{Domain: "docker.io", Path: "library/nginx", Digest: testDigest}},
+		{"ghcr.io/a/b:1.0@" + testDigest, Reference{Domain: "ghcr.io", Path: "a/b", Tag: "1.0", Digest: testDigest}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", tt.input, err)
+			}
+			if *got != tt.want {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.input, *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		":latest",
+		"Nginx",
+		"library/Nginx",
+		"nginx:",
+		"nginx:-bad",
+		"nginx:" + strings.Repeat("a", 129),
+		"nginx@sha256:abc",
+		"nginx@" + strings.ToUpper(testDigest),
+		"a//b",
+		"registry-.example.com/app",
+		"app/",
+		strings.Repeat("a", 256),
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			_, err := Parse(input)
+			if err == nil {
+				t.Fatalf("Parse(%q) succeeded, want error", input)
+			}
+			if code := errors.GetCode(err); code != errors.ErrImageInvalid {
+				t.Errorf("Parse(%q) error code = %s, want %s", input, code, errors.ErrImageInvalid)
+			}
+		})
+	}
+}
+
+func TestReferenceAccessors(t *testing.T) {
+	tests := []struct {
+		input      string
+		familiar   string
+		repository string
+		namespace  string
+		tag        string
+	}{
+		{"nginx", "nginx", "nginx", "library", "latest"},
+		{"calico/node:v3.28.2", "calico/node:v3.28.2", "node", "calico", "v3.28.2"},
+		{"registry.k8s.io/coredns/coredns:v1.11.1", "registry.k8s.io/coredns/coredns:v1.11.1", "coredns", "coredns", "v1.11.1"},
+		{"localhost:5000/app", "localhost:5000/app", "app", "", "latest"},
+		{"harbor.example.com/prod/team/api:v2", "harbor.example.com/prod/team/api:v2", "api", "prod/team", "v2"},
+		{"nginx@" + testDigest, "nginx@" + testDigest, "nginx", "library", ""},
+		{"docker.io/localhost/app", "docker.io/localhost/app", "app", "localhost", "latest"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			ref, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", tt.input, err)
+			}
+			if got := ref.FamiliarString(); got != tt.familiar {
+				t.Errorf("FamiliarString() = %q, want %q", got, tt.familiar)
+			}
+			if got := ref.Repository(); got != tt.repository {
+				t.Errorf("Repository() = %q, want %q", got, tt.repository)
+			}
+			if got := ref.Namespace(); got != tt.namespace {
+				t.Errorf("Namespace() = %q, want %q", got, tt.namespace)
+			}
+			if got := ref.TagOrDefault(); got != tt.tag {
+				t.Errorf("TagOrDefault() = %q, want %q", got, tt.tag)
+			}
+		})
+	}
+}
+
+func FuzzParseRoundTrip(f *testing.F) {
+	for _, seed := range []string{
+		"nginx",
+		"nginx:1.25",
+		"calico/node:v3.28.2",
+		"localhost:5000/app:1.0",
+		"[::1]:5000/app",
+		"registry.k8s.io/coredns/coredns:v1.11.1",
+		"harbor.example.com/prod/team/api:v2@" + testDigest,
+		"index.docker.io/library",
+		"Registry/app",
+		"docker.io/localhost/app",
+		"docker.io/foo.bar/app",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		ref, err := Parse(input)
+		if err != nil {
+			return
+		}
+
+		for _, s := range []string{ref.String(), ref.FamiliarString()} {
+			reparsed, err := Parse(s)
+			if err != nil {
+				t.Fatalf("Parse(%q) of %q failed: %v", s, input, err)
+			}
+			if *reparsed != *ref {
+				t.Fatalf("Parse(%q) = %+v, want %+v (input %q)", s, *reparsed, *ref, input)
+			}
+		}
+	})
+}
@@ -3,6 +3,7 @@ package types
 import (
 	"time"
 
+	"github.com/harpoon/hpn/internal/auth"
 	"github.com/harpoon/hpn/internal/runtime"
 )
 
@@ -15,31 +16,94 @@ type Config struct {
 	Logging  LoggingConfig  `yaml:"logging" json:"logging" mapstructure:"logging"`
 	Parallel ParallelConfig `yaml:"parallel" json:"parallel" mapstructure:"parallel"`
 	Modes    ModeConfig     `yaml:"modes" json:"modes" mapstructure:"modes"`
+
+	// Registries configures credentials and TLS per registry
+	Registries []RegistryConfig `yaml:"registries" json:"registries" mapstructure:"registries"`
+
+	// Mirrors redirect pulls to mirror registries; the first matching rule applies
+	Mirrors []MirrorConfig `yaml:"mirrors" json:"mirrors" mapstructure:"mirrors"`
+
+	// Tags are additional tags pushed with every image
+	Tags []string `yaml:"tags" json:"tags" mapstructure:"tags"`
+
+	// TagRules transform the tags of every pushed image, in order
+	TagRules []TagRule `yaml:"tag_rules" json:"tag_rules" mapstructure:"tag_rules"`
+
+	// Variables are substituted into image lists (${NAME}); names are case-insensitive
+	Variables map[string]string `yaml:"variables" json:"variables" mapstructure:"variables"`
 }
 
 // ProxyConfig contains proxy settings
 type ProxyConfig struct {
-	HTTP    string `yaml:"http" json:"http" mapstructure:"http"`
-	HTTPS   string `yaml:"https" json:"https" mapstructure:"https"`
-	Enabled bool   `yaml:"enabled" json:"enabled" mapstructure:"enabled"`
+	HTTP       string                `yaml:"http" json:"http" mapstructure:"http"`
+	HTTPS      string                `yaml:"https" json:"https" mapstructure:"https"`
+	NoProxy    []string              `yaml:"no_proxy" json:"no_proxy" mapstructure:"no_proxy"`
+	Enabled    bool                  `yaml:"enabled" json:"enabled" mapstructure:"enabled"`
+	Registries []RegistryProxyConfig `yaml:"registries" json:"registries" mapstructure:"registries"`
+}
+
+// RegistryProxyConfig overrides proxy settings for a single registry
+type RegistryProxyConfig struct {
+	Registry string `yaml:"registry" json:"registry" mapstructure:"registry"` // hostname[:port] or *.domain
+	HTTP     string `yaml:"http" json:"http" mapstructure:"http"`
+	HTTPS    string `yaml:"https" json:"https" mapstructure:"https"`
+	Bypass   bool   `yaml:"bypass" json:"bypass" mapstructure:"bypass"` // connect directly
+}
+
+// RegistryConfig contains the settings of the registries matching Registry.
+// The password is read from PasswordEnv, TokenFile or a credential helper so
+// it is not stored in the configuration.
+type RegistryConfig struct {
+	Registry         string `yaml:"registry" json:"registry" mapstructure:"registry"` // hostname[:port] or *.domain
+	Username         string `yaml:"username" json:"username" mapstructure:"username"`
+	PasswordEnv      string `yaml:"password_env" json:"password_env" mapstructure:"password_env"`                // environment variable holding the password
+	TokenFile        string `yaml:"token_file" json:"token_file" mapstructure:"token_file"`                      // file holding the password or token
+	CredentialHelper string `yaml:"credential_helper" json:"credential_helper" mapstructure:"credential_helper"` // docker-credential-<name>
+	Insecure         bool   `yaml:"insecure" json:"insecure" mapstructure:"insecure"`                            // allow plain HTTP and unverified HTTPS
+	SkipVerify       bool   `yaml:"skip_verify" json:"skip_verify" mapstructure:"skip_verify"`                   // do not verify the server certificate
+	CAFile           string `yaml:"ca_file" json:"ca_file" mapstructure:"ca_file"`                               // CA certificates of the registry
+	CertFile         string `yaml:"cert_file" json:"cert_file" mapstructure:"cert_file"`                         // client certificate
+	KeyFile          string `yaml:"key_file" json:"key_file" mapstructure:"key_file"`                            // key of the client certificate
+}
+
+// MirrorConfig redirects pulls of the images matching Prefix or Regex to
+// Mirrors, which are tried in order
+type MirrorConfig struct {
+	Prefix  string   `yaml:"prefix" json:"prefix" mapstructure:"prefix"`    // repository prefix, e.g. registry.k8s.io/*
+	Regex   string   `yaml:"regex" json:"regex" mapstructure:"regex"`       // matched against the full reference, e.g. registry.k8s.io/pause:3.9
+	Mirrors []string `yaml:"mirrors" json:"mirrors" mapstructure:"mirrors"` // replacement prefixes, or templates with $1 for Regex
 }
 
 // RuntimeConfig contains container runtime settings
 type RuntimeConfig struct {
 	Preferred    string        `yaml:"preferred" json:"preferred" mapstructure:"preferred"`
 	Timeout      time.Duration `yaml:"timeout" json:"timeout" mapstructure:"timeout"`
+	Timeouts     TimeoutConfig `yaml:"timeouts" json:"timeouts" mapstructure:"timeouts"`
 	Retry        RetryConfig   `yaml:"retry" json:"retry" mapstructure:"retry"`
 	AutoFallback bool          `yaml:"auto_fallback" json:"auto_fallback" mapstructure:"auto_fallback"`
+	StoreDir     string        `yaml:"store_dir" json:"store_dir" mapstructure:"store_dir"` // image store of the native runtime
+}
+
+// TimeoutConfig contains per-operation timeouts. Unset values fall back to
+// RuntimeConfig.Timeout, or to the operation default if that is unset too.
+type TimeoutConfig struct {
+	Pull time.Duration `yaml:"pull" json:"pull" mapstructure:"pull"`
+	Push time.Duration `yaml:"push" json:"push" mapstructure:"push"`
+	Save time.Duration `yaml:"save" json:"save" mapstructure:"save"`
+	Load time.Duration `yaml:"load" json:"load" mapstructure:"load"`
+	Tag  time.Duration `yaml:"tag" json:"tag" mapstructure:"tag"`
 }
 
 // LoggingConfig contains logging settings
 type LoggingConfig struct {
-	Level     string `yaml:"level" json:"level" mapstructure:"level"`
-	Format    string `yaml:"format" json:"format" mapstructure:"format"` // "text" or "json"
-	File      string `yaml:"file" json:"file" mapstructure:"file"`
-	Console   bool   `yaml:"console" json:"console" mapstructure:"console"`
-	Timestamp bool   `yaml:"timestamp" json:"timestamp" mapstructure:"timestamp"`
-	Colors    bool   `yaml:"colors" json:"colors" mapstructure:"colors"`
+	Level      string `yaml:"level" json:"level" mapstructure:"level"`
+	Format     string `yaml:"format" json:"format" mapstructure:"format"` // "text" or "json"
+	File       string `yaml:"file" json:"file" mapstructure:"file"`
+	MaxSize    int    `yaml:"max_size" json:"max_size" mapstructure:"max_size"`          // megabytes before the log file is rotated
+	MaxBackups int    `yaml:"max_backups" json:"max_backups" mapstructure:"max_backups"` // rotated log files to keep
+	Console    bool   `yaml:"console" json:"console" mapstructure:"console"`
+	Timestamp  bool   `yaml:"timestamp" json:"timestamp" mapstructure:"timestamp"`
+	Colors     bool   `yaml:"colors" json:"colors" mapstructure:"colors"`
 }
 
 // ParallelConfig contains parallel processing settings
@@ -53,6 +117,10 @@ type ModeConfig struct {
 	SaveMode SaveMode `yaml:"save_mode" json:"save_mode" mapstructure:"save_mode"`
 	LoadMode LoadMode `yaml:"load_mode" json:"load_mode" mapstructure:"load_mode"`
 	PushMode PushMode `yaml:"push_mode" json:"push_mode" mapstructure:"push_mode"`
+
+	// PushTemplate maps images to push targets, e.g.
+	// {{.Registry}}/{{.Project}}/{{.Path}}:{{.Tag}}; it replaces PushMode when set
+	PushTemplate string `yaml:"push_template,omitempty" json:"push_template,omitempty" mapstructure:"push_template"`
 }
 
 // RetryConfig contains retry settings
@@ -84,8 +152,9 @@ const (
 type PushMode int
 
 const (
-	PushModeSimple  PushMode = iota + 1 // registry/image:tag
-	PushModeProject                     // registry/project/image:tag (智能项目名称选择)
+	PushModeSimple   PushMode = iota + 1 // registry/image:tag
+	PushModeProject                      // registry/project/image:tag (智能项目名称选择)
+	PushModePreserve                     // registry/original/path/image:tag
 )
 
 // DefaultConfig returns a configuration with default values
@@ -98,7 +167,6 @@ func DefaultConfig() *Config {
 		},
 		Runtime: RuntimeConfig{
 			Preferred:    "",
-			Timeout:      5 * time.Minute,
 			AutoFallback: false,
 			Retry: RetryConfig{
 				MaxAttempts: 3,
@@ -107,11 +175,13 @@ func DefaultConfig() *Config {
 			},
 		},
 		Logging: LoggingConfig{
-			Level:     "info",
-			Format:    "text",
-			Console:   true,
-			Timestamp: true,
-			Colors:    true,
+			Level:      "info",
+			Format:     "text",
+			MaxSize:    10,
+			MaxBackups: 3,
+			Console:    true,
+			Timestamp:  true,
+			Colors:     true,
 		},
 		Parallel: ParallelConfig{
 			MaxWorkers: 4,
@@ -125,12 +195,90 @@ func DefaultConfig() *Config {
 	}
 }
 
+// Default timeouts of operations when neither their own nor the general
+// runtime timeout is set
+const (
+	DefaultTimeout         = 5 * time.Minute
+	DefaultTransferTimeout = 10 * time.Minute // push, save and load
+)
+
+// OperationTimeout returns the timeout for an operation (pull, push, save,
+// load or tag), falling back to the general runtime timeout and then to the
+// operation default. Other operations, such as login, use the general timeout.
+func (r *RuntimeConfig) OperationTimeout(operation string) time.Duration {
+	var timeout time.Duration
+	switch operation {
+	case "pull":
+		timeout = r.Timeouts.Pull
+	case "push":
+		timeout = r.Timeouts.Push
+	case "save":
+		timeout = r.Timeouts.Save
+	case "load":
+		timeout = r.Timeouts.Load
+	case "tag":
+		timeout = r.Timeouts.Tag
+	}
+
+	switch {
+	case timeout > 0:
+		return timeout
+	case r.Timeout > 0:
+		return r.Timeout
+	case operation == "push" || operation == "save" || operation == "load":
+		return DefaultTransferTimeout
+	default:
+		return DefaultTimeout
+	}
+}
+
 // ToRuntimeProxyConfig converts ProxyConfig to runtime.ProxyConfig
 func (p *ProxyConfig) ToRuntimeProxyConfig() *runtime.ProxyConfig {
+	registries := make([]runtime.RegistryProxy, 0, len(p.Registries))
+	for _, r := range p.Registries {
+		registries = append(registries, runtime.RegistryProxy{
+			Registry: r.Registry,
+			HTTP:     r.HTTP,
+			HTTPS:    r.HTTPS,
+			Bypass:   r.Bypass,
+		})
+	}
+
 	return &runtime.ProxyConfig{
-		HTTP:    p.HTTP,
-		HTTPS:   p.HTTPS,
-		Enabled: p.Enabled,
+		HTTP:       p.HTTP,
+		HTTPS:      p.HTTPS,
+		NoProxy:    p.NoProxy,
+		Enabled:    p.Enabled,
+		Registries: registries,
+	}
+}
+
+// ToAuthRegistry converts RegistryConfig to the credential settings of auth
+func (r *RegistryConfig) ToAuthRegistry() auth.Registry {
+	return auth.Registry{
+		Registry:    r.Registry,
+		Username:    r.Username,
+		PasswordEnv: r.PasswordEnv,
+		TokenFile:   r.TokenFile,
+		Helper:      r.CredentialHelper,
+	}
+}
+
+// HasTLS reports whether the registry has TLS settings
+func (r *RegistryConfig) HasTLS() bool {
+	return r.Insecure || r.SkipVerify || r.CAFile != "" || r.CertFile != "" || r.KeyFile != ""
+}
+
+// ToRuntimeRegistryTLS converts the TLS settings of RegistryConfig to
+// runtime.RegistryTLS
+func (r *RegistryConfig) ToRuntimeRegistryTLS() runtime.RegistryTLS {
+	return runtime.RegistryTLS{
+		Registry:   r.Registry,
+		Insecure:   r.Insecure,
+		SkipVerify: r.SkipVerify,
+		CAFile:     r.CAFile,
+		CertFile:   r.CertFile,
+		KeyFile:    r.KeyFile,
 	}
 }
 
@@ -141,4 +289,4 @@ func (r *RetryConfig) ToRuntimeRetryConfig() runtime.RetryConfig {
 		Delay:       r.Delay,
 		MaxDelay:    r.MaxDelay,
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,31 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOperationTimeout(t *testing.T) {
+	operations := []string{"pull", "push", "save", "load", "tag", "login"}
+	tests := []struct {
+		name   string
+		config RuntimeConfig
+		want   []time.Duration // timeouts of operations in order
+	}{
+		{"defaults", DefaultConfig().Runtime,
+			[]time.Duration{5 * time.Minute, 10 * time.Minute, 10 * time.Minute, 10 * time.Minute, 5 * time.Minute, 5 * time.Minute}},
+		{"general timeout", RuntimeConfig{Timeout: 2 * time.Minute},
+			[]time.Duration{2 * time.Minute, 2 * time.Minute, 2 * time.Minute, 2 * time.Minute, 2 * time.Minute, 2 * time.Minute}},
+		{"operation timeouts", RuntimeConfig{Timeouts: TimeoutConfig{Pull: time.Minute, Save: 20 * time.Minute, Tag: 30 * time.Second}},
+			[]time.Duration{time.Minute, 10 * time.Minute, 20 * time.Minute, 10 * time.Minute, 30 * time.Second, 5 * time.Minute}},
+		{"operation timeouts over the general timeout", RuntimeConfig{Timeout: 2 * time.Minute, Timeouts: TimeoutConfig{Push: 15 * time.Minute, Load: time.Minute}},
+			[]time.Duration{2 * time.Minute, 15 * time.Minute, 2 * time.Minute, time.Minute, 2 * time.Minute, 2 * time.Minute}},
+	}
+	for _, tt := range tests {
+		for i, operation := range operations {
+			if got := tt.config.OperationTimeout(operation); got != tt.want[i] {
+				t.Errorf("%s: OperationTimeout(%q) = %s, want %s", tt.name, operation, got, tt.want[i])
+			}
+		}
+	}
+}
@@ -3,6 +3,8 @@ package types
 import (
 	"fmt"
 	"strings"
+
+	"github.com/harpoon/hpn/pkg/reference"
 )
 
 // Image represents a container image with its components
@@ -16,71 +18,77 @@ type Image struct {
 	Size     int64  `json:"size,omitempty"`
 }
 
+// Actions an image list entry can skip
+const (
+	ActionPull = "pull"
+	ActionSave = "save"
+	ActionPush = "push"
+)
+
+// ImageEntry is an image of an image list with optional per-image overrides
+type ImageEntry struct {
+	Image    string    `yaml:"image" json:"image"`
+	Name     string    `yaml:"name,omitempty" json:"name,omitempty"`           // target repository name
+	Project  string    `yaml:"project,omitempty" json:"project,omitempty"`     // target project
+	Platform string    `yaml:"platform,omitempty" json:"platform,omitempty"`   // os/arch[/variant] to pull
+	Tags     []string  `yaml:"tags,omitempty" json:"tags,omitempty"`           // additional tags to push
+	TagRules []TagRule `yaml:"tag_rules,omitempty" json:"tag_rules,omitempty"` // tag rules applied after those of the run
+	Skip     []string  `yaml:"skip,omitempty" json:"skip,omitempty"`           // actions to skip: pull, save, push
+}
+
+// TagRule transforms the tags an image is pushed under. Replace and Add are
+// templates with the fields .Tag, .Date (YYYYMMDD) and .Now, expanded with
+// the submatches of Match ($1, ${name}).
+type TagRule struct {
+	Match   string   `yaml:"match,omitempty" json:"match,omitempty"`     // regular expression matched against the whole tag, every tag if empty
+	Replace string   `yaml:"replace,omitempty" json:"replace,omitempty"` // replacement of matching tags
+	Add     []string `yaml:"add,omitempty" json:"add,omitempty"`         // tags added for matching tags
+}
+
+// Skips reports whether the entry skips action
+func (e *ImageEntry) Skips(action string) bool {
+	for _, skipped := range e.Skip {
+		if skipped == action {
+			return true
+		}
+	}
+	return false
+}
+
 // String returns the full image name
 func (i *Image) String() string {
+	name := i.Name
 	if i.Project != "" && i.Project != "library" {
-		return fmt.Sprintf("%s/%s/%s:%s", i.Registry, i.Project, i.Name, i.Tag)
+		name = fmt.Sprintf("%s/%s/%s", i.Registry, i.Project, i.Name)
+	} else if i.Registry != "" && i.Registry != "docker.io" {
+		name = fmt.Sprintf("%s/%s", i.Registry, i.Name)
+	}
+
+	if i.Tag != "" {
+		name += ":" + i.Tag
 	}
-	if i.Registry != "" && i.Registry != "docker.io" {
-		return fmt.Sprintf("%s/%s:%s", i.Registry, i.Name, i.Tag)
+	if i.Digest != "" {
+		name += "@" + i.Digest
 	}
-	return fmt.Sprintf("%s:%s", i.Name, i.Tag)
+	return name
 }
 
-// ParseImage parses an image string into an Image struct
+// ParseImage parses an image string into an Image struct. References without
+// tag or digest get the "latest" tag.
 func ParseImage(imageStr string) (*Image, error) {
-	if imageStr == "" {
-		return nil, fmt.Errorf("image string cannot be empty")
+	ref, err := reference.Parse(imageStr)
+	if err != nil {
+		return nil, err
 	}
 
-	image := &Image{
+	return &Image{
+		Registry: ref.Domain,
+		Project:  ref.Namespace(),
+		Name:     ref.Repository(),
+		Tag:      ref.TagOrDefault(),
+		Digest:   ref.Digest,
 		FullName: imageStr,
-	}
-
-	// Split by tag first
-	parts := strings.Split(imageStr, ":")
-	if len(parts) == 1 {
-		image.Tag = "latest"
-	} else {
-		image.Tag = parts[len(parts)-1]
-		imageStr = strings.Join(parts[:len(parts)-1], ":")
-	}
-
-	// Split by registry and path
-	pathParts := strings.Split(imageStr, "/")
-	
-	switch len(pathParts) {
-	case 1:
-		// Simple image name (e.g., "nginx")
-		image.Registry = "docker.io"
-		image.Project = "library"
-		image.Name = pathParts[0]
-	case 2:
-		// Could be registry/image or project/image
-		if strings.Contains(pathParts[0], ".") || strings.Contains(pathParts[0], ":") {
-			// registry/image
-			image.Registry = pathParts[0]
-			image.Project = ""
-			image.Name = pathParts[1]
-		} else {
-			// project/image (assume docker.io)
-			image.Registry = "docker.io"
-			image.Project = pathParts[0]
-			image.Name = pathParts[1]
-		}
-	case 3:
-		// registry/project/image
-		image.Registry = pathParts[0]
-		image.Project = pathParts[1]
-		image.Name = pathParts[2]
-	default:
-		// More complex path (registry/nested/project/image)
-		image.Registry = pathParts[0]
-		image.Project = strings.Join(pathParts[1:len(pathParts)-1], "/")
-		image.Name = pathParts[len(pathParts)-1]
-	}
-
-	return image, nil
+	}, nil
 }
 
 // GenerateTarFilename generates a tar filename for the image
@@ -95,7 +103,13 @@ func (i *Image) GenerateTarFilename() string {
 	project = strings.ReplaceAll(project, "/", "_")
 	
 	name := strings.ReplaceAll(i.Name, "/", "_")
-	tag := strings.ReplaceAll(i.Tag, ":", "_")
-	
-	return fmt.Sprintf("%s_%s_%s_%s.tar", registry, project, name, tag)
+	filename := fmt.Sprintf("%s_%s_%s", registry, project, name)
+	if i.Tag != "" {
+		filename += "_" + strings.ReplaceAll(i.Tag, ":", "_")
+	}
+	if i.Digest != "" {
+		filename += "_" + strings.Replace(i.Digest, ":", "-", 1)
+	}
+
+	return filename + ".tar"
 }
\ No newline at end of file